@@ -0,0 +1,435 @@
+<!doctype html>
+<html lang="en">
+
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Axes Authorization Server - Admin Console</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.3/dist/css/bootstrap.min.css" rel="stylesheet"
+        integrity="sha384-QWTKZyjpPEjISv5WaRU9OFeRpok6YctnYmDr5pNlyT2bRjXh0JMhjY6hW+ALEwIH" crossorigin="anonymous">
+    <style>
+        .content-wrapper {
+            display: flex;
+            align-items: center;
+            justify-content: center;
+
+            padding: 4rem;
+        }
+
+        .login-card {
+            width: 30%;
+        }
+
+        textarea.json {
+            font-family: monospace;
+            font-size: 0.85rem;
+        }
+    </style>
+</head>
+
+<body>
+    {{ if eq .Page "login" }}
+    <div class="container-fluid vh-100">
+        <div class="row h-100">
+            <div class="content-wrapper">
+                <div class="card login-card shadow border-0">
+                    <div class="card-header"><h2 class="text-muted">Admin Console</h2></div>
+                    <div class="card-body">
+                        <form method="POST" action="{{ html .FormAction }}">
+                            <input type="hidden" name="action" value="login">
+                            {{ if .ErrorMessage }}
+                            <div class="alert alert-danger" role="alert">{{ html .ErrorMessage }}</div>
+                            {{ end }}
+                            <div class="mb-3">
+                                <label for="username" class="form-label">Username</label>
+                                <input name="username" type="text" class="form-control" id="username" autofocus>
+                            </div>
+                            <div class="mb-4">
+                                <label for="password" class="form-label">Password or admin token</label>
+                                <input name="password" type="password" class="form-control" id="password">
+                            </div>
+                            <div class="d-grid">
+                                <button type="submit" class="btn btn-success">Sign in</button>
+                            </div>
+                        </form>
+                    </div>
+                </div>
+            </div>
+        </div>
+    </div>
+    {{ else }}
+    <nav class="navbar navbar-expand bg-body-tertiary border-bottom mb-4">
+        <div class="container-fluid">
+            <a class="navbar-brand text-muted" href="?page=overview">Axxes Admin Console</a>
+            <ul class="navbar-nav me-auto">
+                <li class="nav-item"><a class="nav-link{{ if eq .Page "users" }} active{{ end }}" href="?page=users">Users</a></li>
+                <li class="nav-item"><a class="nav-link{{ if eq .Page "clients" }} active{{ end }}" href="?page=clients">Clients</a></li>
+                <li class="nav-item"><a class="nav-link{{ if eq .Page "claims" }} active{{ end }}" href="?page=claims">Claims</a></li>
+                <li class="nav-item"><a class="nav-link{{ if eq .Page "scopes" }} active{{ end }}" href="?page=scopes">Scopes &amp; Consents</a></li>
+                <li class="nav-item"><a class="nav-link{{ if eq .Page "keys" }} active{{ end }}" href="?page=keys">Keys</a></li>
+                <li class="nav-item"><a class="nav-link{{ if eq .Page "sessions" }} active{{ end }}" href="?page=sessions">Sessions &amp; Codes</a></li>
+                <li class="nav-item"><a class="nav-link{{ if eq .Page "tokens" }} active{{ end }}" href="?page=tokens">Tokens</a></li>
+            </ul>
+            <form method="POST" action="?page=overview" class="d-flex align-items-center">
+                <span class="text-muted me-3">{{ html .Admin }}</span>
+                <input type="hidden" name="action" value="logout">
+                <button type="submit" class="btn btn-sm btn-outline-secondary">Sign out</button>
+            </form>
+        </div>
+    </nav>
+
+    <div class="container">
+        {{ if .Message }}
+        <div class="alert alert-success" role="alert">{{ html .Message }}</div>
+        {{ end }}
+        {{ if .ErrorMessage }}
+        <div class="alert alert-danger" role="alert">{{ html .ErrorMessage }}</div>
+        {{ end }}
+
+        {{ if eq .Page "overview" }}
+        <div class="row row-cols-4 g-3">
+            <div class="col"><div class="card"><div class="card-body"><h5 class="card-title">{{ len .Users }}</h5><a href="?page=users">users</a></div></div></div>
+            <div class="col"><div class="card"><div class="card-body"><h5 class="card-title">{{ len .Clients }}</h5><a href="?page=clients">clients</a></div></div></div>
+            <div class="col"><div class="card"><div class="card-body"><h5 class="card-title">{{ len .Scopes }}</h5><a href="?page=scopes">scopes</a></div></div></div>
+            <div class="col"><div class="card"><div class="card-body"><h5 class="card-title">{{ len .Keys }}</h5><a href="?page=keys">signing keys</a></div></div></div>
+            <div class="col"><div class="card"><div class="card-body"><h5 class="card-title">{{ len .Sessions }}</h5><a href="?page=sessions">sessions</a></div></div></div>
+            <div class="col"><div class="card"><div class="card-body"><h5 class="card-title">{{ len .Codes }}</h5><a href="?page=sessions">authorization codes</a></div></div></div>
+            <div class="col"><div class="card"><div class="card-body"><h5 class="card-title">{{ len .Tokens }}</h5><a href="?page=tokens">recent token issuances</a></div></div></div>
+        </div>
+        {{ end }}
+
+        {{ if eq .Page "users" }}
+        <table class="table table-sm align-middle">
+            <thead><tr><th>Username</th><th>Email</th><th>Active</th><th>TOTP</th><th></th></tr></thead>
+            <tbody>
+                {{ range .Users }}
+                <tr>
+                    <td><a href="?page=users&id={{ urlquery .Username }}">{{ html .Username }}</a></td>
+                    <td>{{ html .Email }}</td>
+                    <td>{{ if .Active }}yes{{ else }}no{{ end }}</td>
+                    <td>{{ if .TOTP }}enrolled{{ end }}</td>
+                    <td class="text-end">
+                        <a class="btn btn-sm btn-outline-secondary" href="?page=claims&user={{ urlquery .Username }}">Claims</a>
+                        <a class="btn btn-sm btn-outline-secondary" href="?page=scopes&user={{ urlquery .Username }}">Consents</a>
+                        <form method="POST" action="?page=users" class="d-inline">
+                            <input type="hidden" name="action" value="delete_user">
+                            <input type="hidden" name="username" value="{{ html .Username }}">
+                            <button type="submit" class="btn btn-sm btn-outline-danger">Delete</button>
+                        </form>
+                    </td>
+                </tr>
+                {{ end }}
+            </tbody>
+        </table>
+        <div class="card">
+            <div class="card-header">{{ if .User.Username }}Edit user {{ html .User.Username }}{{ else }}Add user{{ end }}</div>
+            <div class="card-body">
+                <form method="POST" action="{{ html .FormAction }}">
+                    <input type="hidden" name="action" value="save_user">
+                    <div class="row g-3 mb-3">
+                        <div class="col-md-4">
+                            <label for="username" class="form-label">Username</label>
+                            <input name="username" type="text" class="form-control" id="username" value="{{ html .User.Username }}"{{ if .User.Username }} readonly{{ end }}>
+                        </div>
+                        <div class="col-md-4">
+                            <label for="password" class="form-label">Password</label>
+                            <input name="password" type="password" class="form-control" id="password" autocomplete="new-password"{{ if .User.Username }} placeholder="unchanged"{{ end }}>
+                        </div>
+                        <div class="col-md-4">
+                            <label for="email" class="form-label">Email</label>
+                            <input name="email" type="email" class="form-control" id="email" value="{{ html .User.Email }}">
+                        </div>
+                        <div class="col-md-4">
+                            <label for="totp_secret" class="form-label">TOTP secret</label>
+                            <input name="totp_secret" type="text" class="form-control" id="totp_secret" value="{{ html .User.TOTPSecret }}">
+                        </div>
+                        <div class="col-md-4 d-flex align-items-end">
+                            <div class="form-check">
+                                <input name="active" type="checkbox" class="form-check-input" id="active"{{ if or .User.Active (not .User.Username) }} checked{{ end }}>
+                                <label for="active" class="form-check-label">Active</label>
+                            </div>
+                        </div>
+                    </div>
+                    <div class="mb-3">
+                        <label for="attributes" class="form-label">Attributes (JSON, by group)</label>
+                        <textarea name="attributes" class="form-control json" id="attributes" rows="6">{{ html .User.AttributesJSON }}</textarea>
+                    </div>
+                    <button type="submit" class="btn btn-success">Save</button>
+                    {{ if .User.Username }}<a class="btn btn-link" href="?page=users">Add another user</a>{{ end }}
+                </form>
+            </div>
+        </div>
+        {{ end }}
+
+        {{ if eq .Page "clients" }}
+        <table class="table table-sm align-middle">
+            <thead><tr><th>Client id</th><th>Redirect URI</th><th>Access token</th><th>MFA</th><th></th></tr></thead>
+            <tbody>
+                {{ range .Clients }}
+                <tr>
+                    <td><a href="?page=clients&id={{ urlquery .Id }}">{{ html .Id }}</a></td>
+                    <td><code>{{ html .RedirectURI }}</code></td>
+                    <td>{{ if .AccessTokenFormat }}{{ html .AccessTokenFormat }}{{ else }}jwt{{ end }}</td>
+                    <td>{{ if .RequireMFA }}required{{ end }}</td>
+                    <td class="text-end">
+                        <a class="btn btn-sm btn-outline-secondary" href="?page=claims&client={{ urlquery .Id }}">Claims</a>
+                        <form method="POST" action="?page=clients" class="d-inline">
+                            <input type="hidden" name="action" value="delete_client">
+                            <input type="hidden" name="client_id" value="{{ html .Id }}">
+                            <button type="submit" class="btn btn-sm btn-outline-danger">Delete</button>
+                        </form>
+                    </td>
+                </tr>
+                {{ end }}
+            </tbody>
+        </table>
+        <div class="card">
+            <div class="card-header">{{ if .Client.Id }}Edit client {{ html .Client.Id }}{{ else }}Add client{{ end }}</div>
+            <div class="card-body">
+                <form method="POST" action="{{ html .FormAction }}">
+                    <input type="hidden" name="action" value="save_client">
+                    <div class="row g-3 mb-3">
+                        <div class="col-md-4">
+                            <label for="client_id" class="form-label">Client id</label>
+                            <input name="client_id" type="text" class="form-control" id="client_id" value="{{ html .Client.Id }}"{{ if .Client.Id }} readonly{{ end }}>
+                        </div>
+                        <div class="col-md-4">
+                            <label for="client_secret" class="form-label">Client secret</label>
+                            <input name="client_secret" type="password" class="form-control" id="client_secret" autocomplete="new-password"{{ if .Client.Id }} placeholder="unchanged"{{ end }}>
+                        </div>
+                        <div class="col-md-4">
+                            <label for="redirect_uri" class="form-label">Redirect URI (wildcards allowed)</label>
+                            <input name="redirect_uri" type="text" class="form-control" id="redirect_uri" value="{{ html .Client.RedirectURI }}">
+                        </div>
+                        <div class="col-md-4">
+                            <label for="access_token_format" class="form-label">Access token format</label>
+                            <select name="access_token_format" class="form-select" id="access_token_format">
+                                <option value=""{{ if eq .Client.AccessTokenFormat "" }} selected{{ end }}>jwt</option>
+                                <option value="opaque"{{ if eq .Client.AccessTokenFormat "opaque" }} selected{{ end }}>opaque</option>
+                            </select>
+                        </div>
+                        <div class="col-md-4 d-flex align-items-end">
+                            <div class="form-check">
+                                <input name="require_mfa" type="checkbox" class="form-check-input" id="require_mfa"{{ if .Client.RequireMFA }} checked{{ end }}>
+                                <label for="require_mfa" class="form-check-label">Require MFA</label>
+                            </div>
+                        </div>
+                    </div>
+                    <div class="mb-3">
+                        <label for="config" class="form-label">Advanced settings (JSON like a <code>clients</code> entry, the fields above win)</label>
+                        <textarea name="config" class="form-control json" id="config" rows="10">{{ html .Client.ConfigJSON }}</textarea>
+                    </div>
+                    <button type="submit" class="btn btn-success">Save</button>
+                    {{ if .Client.Id }}<a class="btn btn-link" href="?page=clients">Add another client</a>{{ end }}
+                </form>
+            </div>
+        </div>
+        {{ end }}
+
+        {{ if eq .Page "claims" }}
+        <div class="row">
+            <div class="col-md-3">
+                <h6>Users</h6>
+                <div class="list-group mb-4">
+                    {{ range .Users }}
+                    <a class="list-group-item list-group-item-action{{ if eq .Username $.ClaimsUser }} active{{ end }}" href="?page=claims&user={{ urlquery .Username }}">{{ html .Username }}</a>
+                    {{ end }}
+                </div>
+                <h6>Clients</h6>
+                <div class="list-group">
+                    {{ range .Clients }}
+                    <a class="list-group-item list-group-item-action{{ if eq .Id $.ClaimsClient }} active{{ end }}" href="?page=claims&client={{ urlquery .Id }}">{{ html .Id }}</a>
+                    {{ end }}
+                </div>
+            </div>
+            <div class="col-md-9">
+                {{ if or .ClaimsUser .ClaimsClient }}
+                <form method="POST" action="{{ html .FormAction }}">
+                    <input type="hidden" name="user" value="{{ html .ClaimsUser }}">
+                    <input type="hidden" name="client" value="{{ html .ClaimsClient }}">
+                    <label for="claims" class="form-label">Claims of {{ if .ClaimsUser }}user {{ html .ClaimsUser }}{{ else }}client {{ html .ClaimsClient }}{{ end }}
+                        (<code>default</code> and <code>byPurpose</code> layers with <code>base</code>, <code>clientOverrides</code> and <code>scopeOverrides</code>)</label>
+                    <textarea name="claims" class="form-control json mb-3" id="claims" rows="24">{{ html .ClaimsJSON }}</textarea>
+                    <button type="submit" name="action" value="save_claims" class="btn btn-success">Save</button>
+                    <button type="submit" name="action" value="delete_claims" class="btn btn-outline-danger">Delete</button>
+                </form>
+                {{ else }}
+                <p class="text-muted">Select a user or a client.</p>
+                {{ end }}
+            </div>
+        </div>
+        {{ end }}
+
+        {{ if eq .Page "scopes" }}
+        <div class="row">
+            <div class="col-md-6">
+                <h5>Scopes</h5>
+                <table class="table table-sm align-middle">
+                    <thead><tr><th>Scope</th><th>Consent</th><th></th></tr></thead>
+                    <tbody>
+                        {{ range .Scopes }}
+                        <tr>
+                            <td>{{ html .Name }}</td>
+                            <td>{{ if .RequireConsent }}required{{ end }}</td>
+                            <td class="text-end">
+                                <form method="POST" action="{{ html $.FormAction }}" class="d-inline">
+                                    <input type="hidden" name="action" value="save_scope">
+                                    <input type="hidden" name="name" value="{{ html .Name }}">
+                                    {{ if not .RequireConsent }}<input type="hidden" name="require_consent" value="on">{{ end }}
+                                    <button type="submit" class="btn btn-sm btn-outline-secondary">{{ if .RequireConsent }}Skip consent{{ else }}Require consent{{ end }}</button>
+                                </form>
+                                <form method="POST" action="{{ html $.FormAction }}" class="d-inline">
+                                    <input type="hidden" name="action" value="delete_scope">
+                                    <input type="hidden" name="name" value="{{ html .Name }}">
+                                    <button type="submit" class="btn btn-sm btn-outline-danger">Delete</button>
+                                </form>
+                            </td>
+                        </tr>
+                        {{ end }}
+                    </tbody>
+                </table>
+                <form method="POST" action="{{ html .FormAction }}" class="row g-2 align-items-center">
+                    <input type="hidden" name="action" value="save_scope">
+                    <div class="col"><input name="name" type="text" class="form-control" placeholder="new scope"></div>
+                    <div class="col-auto">
+                        <div class="form-check">
+                            <input name="require_consent" type="checkbox" class="form-check-input" id="require_consent">
+                            <label for="require_consent" class="form-check-label">Require consent</label>
+                        </div>
+                    </div>
+                    <div class="col-auto"><button type="submit" class="btn btn-success">Add</button></div>
+                </form>
+            </div>
+            <div class="col-md-6">
+                <h5>Consents</h5>
+                <form method="GET" action="" class="row g-2 mb-3">
+                    <input type="hidden" name="page" value="scopes">
+                    <div class="col">
+                        <select name="user" class="form-select">
+                            {{ range .Users }}
+                            <option value="{{ html .Username }}"{{ if eq .Username $.ConsentsUser }} selected{{ end }}>{{ html .Username }}</option>
+                            {{ end }}
+                        </select>
+                    </div>
+                    <div class="col-auto"><button type="submit" class="btn btn-outline-secondary">Show</button></div>
+                </form>
+                {{ if .ConsentsUser }}
+                <form method="POST" action="{{ html .FormAction }}">
+                    <input type="hidden" name="user" value="{{ html .ConsentsUser }}">
+                    {{ range .Consents }}
+                    <div class="form-check">
+                        <input type="hidden" name="scope" value="{{ html .Scope }}">
+                        <input name="granted" value="{{ html .Scope }}" type="checkbox" class="form-check-input" id="consent-{{ html .Scope }}"{{ if .Granted }} checked{{ end }}>
+                        <label for="consent-{{ html .Scope }}" class="form-check-label">{{ html .Scope }}</label>
+                    </div>
+                    {{ end }}
+                    <div class="mt-3">
+                        <button type="submit" name="action" value="save_consents" class="btn btn-success">Save</button>
+                        <button type="submit" name="action" value="delete_consents" class="btn btn-outline-danger">Revoke all</button>
+                    </div>
+                </form>
+                {{ end }}
+            </div>
+        </div>
+        {{ end }}
+
+        {{ if eq .Page "keys" }}
+        <table class="table table-sm align-middle">
+            <thead><tr><th>Key id</th><th>Type</th><th>Method</th><th>Active</th><th></th></tr></thead>
+            <tbody>
+                {{ range .Keys }}
+                <tr>
+                    <td><code>{{ html .Kid }}</code></td>
+                    <td>{{ html .Type }}</td>
+                    <td>{{ html .Method }}</td>
+                    <td>{{ if .Active }}yes{{ else }}no{{ end }}</td>
+                    <td class="text-end">
+                        <form method="POST" action="{{ html $.FormAction }}" class="d-inline">
+                            <input type="hidden" name="kid" value="{{ html .Kid }}">
+                            {{ if .Active }}
+                            <button type="submit" name="action" value="deactivate_key" class="btn btn-sm btn-outline-secondary">Deactivate</button>
+                            {{ else }}
+                            <button type="submit" name="action" value="activate_key" class="btn btn-sm btn-outline-secondary">Activate</button>
+                            {{ end }}
+                            <button type="submit" name="action" value="delete_key" class="btn btn-sm btn-outline-danger">Delete</button>
+                        </form>
+                    </td>
+                </tr>
+                {{ end }}
+            </tbody>
+        </table>
+        <div class="card">
+            <div class="card-header">Generate key</div>
+            <div class="card-body">
+                <form method="POST" action="{{ html .FormAction }}" class="row g-3 align-items-end">
+                    <input type="hidden" name="action" value="add_key">
+                    <div class="col-md-3">
+                        <label for="type" class="form-label">Key type</label>
+                        <select name="type" class="form-select" id="type">
+                            {{ range .KeyTypes }}<option>{{ html . }}</option>{{ end }}
+                        </select>
+                    </div>
+                    <div class="col-md-3">
+                        <label for="method" class="form-label">Signing method</label>
+                        <select name="method" class="form-select" id="method">
+                            {{ range .SigningMethods }}<option>{{ html . }}</option>{{ end }}
+                        </select>
+                    </div>
+                    <div class="col-md-3">
+                        <div class="form-check">
+                            <input name="active" type="checkbox" class="form-check-input" id="key_active">
+                            <label for="key_active" class="form-check-label">Sign with it</label>
+                        </div>
+                    </div>
+                    <div class="col-md-3"><button type="submit" class="btn btn-success">Generate</button></div>
+                </form>
+            </div>
+        </div>
+        {{ end }}
+
+        {{ if eq .Page "sessions" }}
+        <h5>Sessions</h5>
+        <table class="table table-sm">
+            <thead><tr><th>Session</th><th>User</th><th>Methods</th><th>Last used</th></tr></thead>
+            <tbody>
+                {{ range .Sessions }}
+                <tr><td><code>{{ html .Id }}</code></td><td>{{ html .Username }}</td><td>{{ html .AMR }}</td><td>{{ html .LastUsed }}</td></tr>
+                {{ else }}
+                <tr><td colspan="4" class="text-muted">no sessions</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+        <h5>Authorization codes</h5>
+        <table class="table table-sm">
+            <thead><tr><th>Code</th><th>Client</th><th>User</th><th>Scopes</th><th>Redirect URI</th><th>Expires</th></tr></thead>
+            <tbody>
+                {{ range .Codes }}
+                <tr><td><code>{{ html .Code }}</code></td><td>{{ html .ClientId }}</td><td>{{ html .Username }}</td><td>{{ html .Scopes }}</td><td><code>{{ html .RedirectURI }}</code></td><td>{{ html .ExpiresAt }}</td></tr>
+                {{ else }}
+                <tr><td colspan="6" class="text-muted">no outstanding codes</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+        {{ end }}
+
+        {{ if eq .Page "tokens" }}
+        <table class="table table-sm">
+            <thead><tr><th>Issued</th><th>Client</th><th>User</th><th>Scopes</th><th>Access token</th><th>Profile</th></tr></thead>
+            <tbody>
+                {{ range .Tokens }}
+                <tr>
+                    <td>{{ html .Time }}</td><td>{{ html .ClientId }}</td><td>{{ html .UserId }}</td><td>{{ html .Scopes }}</td>
+                    <td>{{ if .Opaque }}opaque{{ else }}jwt{{ end }}</td>
+                    <td>{{ if .Profile }}<span class="badge text-bg-warning">{{ html .Profile }}</span>{{ end }}</td>
+                </tr>
+                {{ else }}
+                <tr><td colspan="6" class="text-muted">no tokens issued yet</td></tr>
+                {{ end }}
+            </tbody>
+        </table>
+        {{ end }}
+    </div>
+    {{ end }}
+</body>
+
+</html>
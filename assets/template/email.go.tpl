@@ -0,0 +1,56 @@
+<!doctype html>
+<html lang="en">
+
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Axes Authorization Server</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.3/dist/css/bootstrap.min.css" rel="stylesheet"
+        integrity="sha384-QWTKZyjpPEjISv5WaRU9OFeRpok6YctnYmDr5pNlyT2bRjXh0JMhjY6hW+ALEwIH" crossorigin="anonymous">
+    <style>
+        .content-wrapper {
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            
+            padding: 4rem;
+        }
+
+        .login-card {
+            width: 30%;
+        }
+    </style>
+</head>
+
+<body class="vh-100">
+    <div class="container-fluid h-100">
+        <div class="row h-100">
+            <div class="content-wrapper">
+                <div class="card login-card shadow border-0">
+                <div class="card-header"><h2 class="text-muted">Axxes Authorization Server</h2></div>
+                    <div class="card-body">
+                        <form method="POST" action="{{ .FormAction }}" enctype="multipart/form-data" class="needs-validation" novalidate>
+                            {{ if .FormErrorMessage }}
+                            <div class="alert alert-danger" role="alert">
+                                {{ .FormErrorMessage }}
+                            </div>
+                            {{ end }}
+                            {{ if .Email }}
+                            <p>If <strong>{{ .Email }}</strong> belongs to an account, we have sent it a sign-in code and a link.</p>
+                            {{ end }}
+                            <div class="mb-4">
+                                <label for="email_code" class="form-label">Sign-in code</label>
+                                <input name="email_code" type="text" inputmode="numeric" autocomplete="one-time-code" maxlength="6" class="form-control" id="email_code" autofocus>
+                            </div>
+                            <div class="d-grid">
+                                <button type="submit" class="btn btn-success">Sign In</button>
+                            </div>
+                        </form>
+                    </div>
+                </div>
+            </div>
+        </div>
+    </div>
+</body>
+
+</html>
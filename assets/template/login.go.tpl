@@ -30,6 +30,22 @@
                 <div class="card login-card shadow border-0">
                 <div class="card-header"><h2 class="text-muted">Axxes Authorization Server</h2></div>
                     <div class="card-body">
+                        {{ if .Personas }}
+                        <div class="alert alert-warning" role="alert">
+                            <strong>Development sign-in</strong> &mdash; pick a persona to sign in without a password.
+                        </div>
+                        <div class="list-group mb-4">
+                            {{ range .Personas }}
+                            <form method="POST" action="{{ $.FormAction }}" enctype="multipart/form-data" class="list-group-item list-group-item-action p-0">
+                                <button type="submit" name="persona" value="{{ .Username }}" class="btn w-100 text-start px-3 py-2">
+                                    <div class="fw-semibold">{{ .Username }}</div>
+                                    {{ if .Description }}<div class="small text-muted">{{ .Description }}</div>{{ end }}
+                                    {{ range .Roles }}<span class="badge text-bg-secondary me-1">{{ . }}</span>{{ end }}
+                                </button>
+                            </form>
+                            {{ end }}
+                        </div>
+                        {{ end }}
                         <form method="POST" action="{{ .FormAction }}" enctype="multipart/form-data" class="needs-validation" novalidate>
                             {{ if .FormErrorMessage }}
                             <div class="alert alert-danger" role="alert">
@@ -58,6 +74,27 @@
                                 <button type="submit" class="btn btn-success">Sign In</button>
                             </div>
                         </form>
+                        {{ if .EmailLogin }}
+                        <form method="POST" action="{{ .FormAction }}" enctype="multipart/form-data" class="mt-4">
+                            <div class="input-group">
+                                <input name="email" type="email" class="form-control" placeholder="Email address" aria-label="Email address" required>
+                                <button type="submit" class="btn btn-outline-secondary">Email me a sign-in code</button>
+                            </div>
+                        </form>
+                        {{ end }}
+                        {{ if .Upstreams }}
+                        <div class="d-grid gap-2 mt-4">
+                            {{ range .Upstreams }}
+                            <a href="{{ .URL }}" class="btn btn-outline-secondary">Log in with {{ .DisplayName }}</a>
+                            {{ end }}
+                        </div>
+                        {{ end }}
+                        {{ if .PasskeyLoginURL }}
+                        <div class="d-grid mt-4">
+                            <div id="passkey-error" class="alert alert-danger" role="alert" hidden></div>
+                            <button type="button" id="passkey" class="btn btn-outline-primary" data-login-url="{{ .PasskeyLoginURL }}" data-return="{{ .FormAction }}" hidden>Sign in with a passkey</button>
+                        </div>
+                        {{ end }}
                     </div>
                 </div>
             </div>
@@ -67,6 +104,53 @@
     <script src="https://cdn.jsdelivr.net/npm/bootstrap@5.3.3/dist/js/bootstrap.bundle.min.js"
         integrity="sha384-YvpcrYf0tY3lHB60NNkmXc5s9fDVZLESaAA55NDzOxhy9GkcIdslK1eN7N6jIeHz"
         crossorigin="anonymous"></script>
+    {{ if .PasskeyLoginURL }}
+    <script>
+        function fromBase64URL(value) {
+            var binary = atob(value.replace(/-/g, "+").replace(/_/g, "/"));
+            return Uint8Array.from(binary, function (c) { return c.charCodeAt(0); }).buffer;
+        }
+        function toBase64URL(buffer) {
+            var binary = String.fromCharCode.apply(null, new Uint8Array(buffer));
+            return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+        }
+
+        var passkey = document.getElementById("passkey");
+        var passkeyError = document.getElementById("passkey-error");
+        passkey.hidden = !window.PublicKeyCredential;
+        passkey.addEventListener("click", async function () {
+            passkeyError.hidden = true;
+            try {
+                var options = await (await fetch(passkey.dataset.loginUrl, { credentials: "same-origin" })).json();
+                options.publicKey.challenge = fromBase64URL(options.publicKey.challenge);
+                var credential = await navigator.credentials.get(options);
+                var response = await fetch(passkey.dataset.loginUrl, {
+                    method: "POST",
+                    credentials: "same-origin",
+                    headers: { "Content-Type": "application/json" },
+                    body: JSON.stringify({
+                        id: credential.id,
+                        rawId: toBase64URL(credential.rawId),
+                        type: credential.type,
+                        response: {
+                            clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+                            authenticatorData: toBase64URL(credential.response.authenticatorData),
+                            signature: toBase64URL(credential.response.signature),
+                            userHandle: credential.response.userHandle ? toBase64URL(credential.response.userHandle) : ""
+                        }
+                    })
+                });
+                if (!response.ok) {
+                    throw new Error(await response.text());
+                }
+                window.location.href = passkey.dataset.return;
+            } catch (error) {
+                passkeyError.textContent = error.message;
+                passkeyError.hidden = false;
+            }
+        });
+    </script>
+    {{ end }}
 </body>
 
 </html>
\ No newline at end of file
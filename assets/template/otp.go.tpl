@@ -0,0 +1,77 @@
+<!doctype html>
+<html lang="en">
+
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Axes Authorization Server</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.3/dist/css/bootstrap.min.css" rel="stylesheet"
+        integrity="sha384-QWTKZyjpPEjISv5WaRU9OFeRpok6YctnYmDr5pNlyT2bRjXh0JMhjY6hW+ALEwIH" crossorigin="anonymous">
+    <style>
+        .content-wrapper {
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            
+            padding: 4rem;
+        }
+
+        .login-card {
+            width: 30%;
+        }
+    </style>
+</head>
+
+<body class="vh-100">
+    <div class="container-fluid h-100">
+        <div class="row h-100">
+            <div class="content-wrapper">
+                <div class="card login-card shadow border-0">
+                <div class="card-header"><h2 class="text-muted">Axxes Authorization Server</h2></div>
+                    <div class="card-body">
+                        {{ if .Enrolled }}
+                        <div class="alert alert-success" role="alert">
+                            The authenticator has been enrolled.
+                        </div>
+                        {{ else }}
+                        <form method="POST" action="{{ .FormAction }}" enctype="multipart/form-data" class="needs-validation" novalidate>
+                            {{ if .FormErrorMessage }}
+                            <div class="alert alert-danger" role="alert">
+                                {{ .FormErrorMessage }}
+                            </div>
+                            {{ end }}
+                            {{ if .KeyURI }}
+                            <div class="mb-4 text-center">
+                                <p>Scan the code with your authenticator app</p>
+                                <div id="qrcode" data-uri="{{ .KeyURI }}"></div>
+                                <p class="mt-2"><small class="text-muted">or enter the key <code>{{ .Secret }}</code></small></p>
+                            </div>
+                            {{ end }}
+                            <div class="mb-4">
+                                <label for="otp" class="form-label">One-time code</label>
+                                <input name="otp" type="text" inputmode="numeric" autocomplete="one-time-code" maxlength="6" class="form-control" id="otp" autofocus>
+                            </div>
+                            <div class="d-grid">
+                                <button type="submit" class="btn btn-success">Verify</button>
+                            </div>
+                        </form>
+                        {{ end }}
+                    </div>
+                </div>
+            </div>
+        </div>
+    </div>
+
+    {{ if .KeyURI }}
+    <script src="https://cdn.jsdelivr.net/npm/qrcode-generator@1.4.4/qrcode.min.js" crossorigin="anonymous"></script>
+    <script>
+        var container = document.getElementById("qrcode");
+        var qr = qrcode(0, "M");
+        qr.addData(container.dataset.uri);
+        qr.make();
+        container.innerHTML = qr.createImgTag(4);
+    </script>
+    {{ end }}
+</body>
+
+</html>
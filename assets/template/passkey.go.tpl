@@ -0,0 +1,97 @@
+<!doctype html>
+<html lang="en">
+
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>Axes Authorization Server</title>
+    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.3/dist/css/bootstrap.min.css" rel="stylesheet"
+        integrity="sha384-QWTKZyjpPEjISv5WaRU9OFeRpok6YctnYmDr5pNlyT2bRjXh0JMhjY6hW+ALEwIH" crossorigin="anonymous">
+    <style>
+        .content-wrapper {
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            
+            padding: 4rem;
+        }
+
+        .login-card {
+            width: 30%;
+        }
+    </style>
+</head>
+
+<body class="vh-100">
+    <div class="container-fluid h-100">
+        <div class="row h-100">
+            <div class="content-wrapper">
+                <div class="card login-card shadow border-0">
+                <div class="card-header"><h2 class="text-muted">Axxes Authorization Server</h2></div>
+                    <div class="card-body">
+                        <div id="passkey-error" class="alert alert-danger" role="alert" hidden></div>
+                        <div id="passkey-success" class="alert alert-success" role="alert" hidden>
+                            The passkey has been registered.
+                        </div>
+                        <p>Passkeys registered: <span id="passkey-count">{{ .Credentials }}</span></p>
+                        <div class="d-grid">
+                            <button type="button" id="passkey" class="btn btn-success" data-action="{{ .FormAction }}">Register a passkey</button>
+                        </div>
+                    </div>
+                </div>
+            </div>
+        </div>
+    </div>
+
+    <script type="application/json" id="passkey-options">{{ .Options }}</script>
+    <script>
+        function fromBase64URL(value) {
+            var binary = atob(value.replace(/-/g, "+").replace(/_/g, "/"));
+            return Uint8Array.from(binary, function (c) { return c.charCodeAt(0); }).buffer;
+        }
+        function toBase64URL(buffer) {
+            var binary = String.fromCharCode.apply(null, new Uint8Array(buffer));
+            return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+        }
+
+        var passkey = document.getElementById("passkey");
+        var passkeyError = document.getElementById("passkey-error");
+        passkey.addEventListener("click", async function () {
+            passkeyError.hidden = true;
+            try {
+                var options = JSON.parse(document.getElementById("passkey-options").textContent);
+                options.publicKey.challenge = fromBase64URL(options.publicKey.challenge);
+                options.publicKey.user.id = fromBase64URL(options.publicKey.user.id);
+                options.publicKey.excludeCredentials.forEach(function (descriptor) {
+                    descriptor.id = fromBase64URL(descriptor.id);
+                });
+                var credential = await navigator.credentials.create(options);
+                var response = await fetch(passkey.dataset.action, {
+                    method: "POST",
+                    credentials: "same-origin",
+                    headers: { "Content-Type": "application/json" },
+                    body: JSON.stringify({
+                        id: credential.id,
+                        rawId: toBase64URL(credential.rawId),
+                        type: credential.type,
+                        response: {
+                            clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+                            attestationObject: toBase64URL(credential.response.attestationObject)
+                        }
+                    })
+                });
+                if (!response.ok) {
+                    throw new Error(await response.text());
+                }
+                document.getElementById("passkey-success").hidden = false;
+                document.getElementById("passkey-count").textContent = Number(document.getElementById("passkey-count").textContent) + 1;
+                passkey.hidden = true;
+            } catch (error) {
+                passkeyError.textContent = error.message + " (reload the page to try again)";
+                passkeyError.hidden = false;
+            }
+        });
+    </script>
+</body>
+
+</html>
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,30 +16,54 @@ func main() {
 		fmt.Fprintf(os.Stderr, "read error: %v\n", err)
 		os.Exit(1)
 	}
+	if err := convert(data, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
 
-	// Try to unmarshal as an array of docs first, fallback to single
-	var arr []any
-	if err := json.Unmarshal(data, &arr); err == nil {
-		for i, doc := range arr {
-			if i > 0 {
-				fmt.Println("---")
-			}
-			if err := yaml.NewEncoder(os.Stdout).Encode(doc); err != nil {
-				fmt.Fprintf(os.Stderr, "yaml encode error: %v\n", err)
-				os.Exit(1)
-			}
-		}
-		return
+// convert writes the JSON document (or an array of documents) as YAML, integers stay integers
+func convert(data []byte, w io.Writer) error {
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("json unmarshal error: %w", err)
 	}
 
-	// Not an array → single doc
-	var obj any
-	if err := json.Unmarshal(data, &obj); err != nil {
-		fmt.Fprintf(os.Stderr, "json unmarshal error: %v\n", err)
-		os.Exit(1)
+	// an array is a list of documents
+	docs, ok := doc.([]any)
+	if !ok {
+		docs = []any{doc}
 	}
-	if err := yaml.NewEncoder(os.Stdout).Encode(obj); err != nil {
-		fmt.Fprintf(os.Stderr, "yaml encode error: %v\n", err)
-		os.Exit(1)
+	for i, doc := range docs {
+		if i > 0 {
+			fmt.Fprintln(w, "---")
+		}
+		if err := yaml.NewEncoder(w).Encode(numbers(doc)); err != nil {
+			return fmt.Errorf("yaml encode error: %w", err)
+		}
+	}
+	return nil
+}
+
+// numbers replaces the JSON numbers of the document by int64 (!!int) or float64 (!!float) values
+func numbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = numbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = numbers(item)
+		}
 	}
+	return value
 }
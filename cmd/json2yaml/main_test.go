@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{
+			name: "numbers",
+			json: `{"seconds": 7776000, "ratio": 1.5, "big": 1e3, "list": [1, 2.5]}`,
+			want: "big: 1000\nlist:\n    - 1\n    - 2.5\nratio: 1.5\nseconds: 7776000\n",
+		},
+		{
+			name: "documents",
+			json: `[{"a": 1}, {"b": "x"}]`,
+			want: "a: 1\n---\nb: x\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := convert([]byte(tt.json), &out); err != nil {
+				t.Fatalf("convert() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("convert() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/axent-pl/oauth2mock/pkg/config"
+	"github.com/axent-pl/oauth2mock/pkg/kcimport"
+	"gopkg.in/yaml.v3"
+)
+
+type Settings struct {
+	OutputFormat string `env:"OUTPUT_FORMAT" default:"json"`
+}
+
+var settings Settings
+
+func init() {
+	if err := config.Load(&settings); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config settings: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Reads a Keycloak realm export from stdin and writes the Axes data file to stdout,
+// everything which could not be translated is reported on stderr.
+func main() {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, report, err := kcimport.Import(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "json marshal error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch settings.OutputFormat {
+	case "json":
+		os.Stdout.Write(out.Bytes())
+	case "yaml":
+		var obj any
+		if err := json.Unmarshal(out.Bytes(), &obj); err != nil {
+			fmt.Fprintf(os.Stderr, "json unmarshal error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := yaml.NewEncoder(os.Stdout).Encode(obj); err != nil {
+			fmt.Fprintf(os.Stderr, "yaml encode error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported output format: %s\n", settings.OutputFormat)
+		os.Exit(1)
+	}
+
+	for _, line := range report {
+		fmt.Fprintf(os.Stderr, "not translated: %s\n", line)
+	}
+}
@@ -6,46 +6,52 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/axent-pl/oauth2mock/pkg/auth"
-	"github.com/axent-pl/oauth2mock/pkg/authorizationservice"
-	"github.com/axent-pl/oauth2mock/pkg/claimservice"
-	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
 	"github.com/axent-pl/oauth2mock/pkg/config"
-	"github.com/axent-pl/oauth2mock/pkg/consentservice"
 	"github.com/axent-pl/oauth2mock/pkg/di"
 	"github.com/axent-pl/oauth2mock/pkg/handler"
 	"github.com/axent-pl/oauth2mock/pkg/http/routing"
 	"github.com/axent-pl/oauth2mock/pkg/http/server"
-	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/realm"
+	"github.com/axent-pl/oauth2mock/pkg/service/encryption"
 	"github.com/axent-pl/oauth2mock/pkg/service/template"
-	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
-	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
 
 type Settings struct {
+	// DataFile lists (comma separated) the data files (.json, .yaml or .yml) and conf.d directories merged into the config
 	DataFile      string `env:"DATAFILE_PATH" default:"assets/config/config.json"`
 	ServerAddress string `env:"SERVER_ADDRESS" default:":8222"`
 	TemplateDir   string `env:"TEMPLATES_PATH" default:"assets/template"`
 
 	UseOrigin bool   `env:"OAUTH2_ISSUER_FROM_ORIGIN" default:"true"`
 	Issuer    string `env:"OAUTH2_ISSUER"`
+
+	// PersonaLogin lists the users on the login page for one-click sign-in without credentials, development only
+	PersonaLogin bool `env:"PERSONA_LOGIN" default:"false"`
+
+	// the management API accepts the admin token or an access token of the realm granted the admin scope
+	AdminToken string `env:"ADMIN_TOKEN"`
+	AdminScope string `env:"ADMIN_SCOPE" default:"admin"`
+	// AdminUsers lists (comma separated) the users of a realm who may sign in to its admin console
+	AdminUsers string `env:"ADMIN_USERS"`
+
+	// the data file is polled for changes every ReloadSeconds (0 disables polling), SIGHUP reloads it too
+	ReloadSeconds int `env:"CONFIG_RELOAD_SECONDS" default:"2"`
 }
 
 var (
 	settings Settings
 
-	clientService        clientservice.Service
-	userService          userservice.Service
-	claimService         claimservice.Service
-	consentService       consentservice.Service
-	authorizationService authorizationservice.Service
-	templateService      template.Service
-	signingService       signing.SigningServicer
-	sessionService       sessionservice.Service
+	configData      []byte // merged content of the data files and realm files the realms were loaded from
+	realms          []*realm.Realm
+	templateService template.Service
 
-	router     routing.Router
+	routes     *routing.Switch
 	httpServer server.Serverer
 )
 
@@ -68,161 +74,397 @@ func init() {
 		os.Exit(1)
 	}
 	slog.Info("config settings initialized")
+	if settings.PersonaLogin {
+		slog.Warn("PERSONA LOGIN ENABLED: anyone can sign in as any user without credentials, never use this outside development")
+	}
 }
 
-// Initialize services
-func init() {
+// initServices loads the realms from the data file and the templates
+func initServices() {
 	var err error
 
-	data, err := os.ReadFile(settings.DataFile)
+	data, err := config.ReadDataFile(settings.DataFile, config.DataFileBaseDir(settings.DataFile))
 	if err != nil {
 		slog.Error("failed to read config", "error", err)
 		os.Exit(1)
 	}
 
-	sessionService, err = sessionservice.NewFromConfig(data)
+	realms, err = realm.LoadAll(data, config.DataFileBaseDir(settings.DataFile))
 	if err != nil {
-		slog.Error("failed to initialize session service", "error", err)
+		slog.Error("failed to initialize realms", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("session service initialized")
-
-	clientService, err = clientservice.NewClientService(settings.DataFile)
-	if err != nil {
-		slog.Error("failed to initialize client service", "error", err)
+	slog.Info("realms initialized", "count", len(realms))
+	if configData, err = realm.ExpandFiles(data, config.DataFileBaseDir(settings.DataFile)); err != nil {
+		slog.Error("failed to read realm files", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("client service initialized")
 
-	userService, err = userservice.NewFromConfig(data)
+	templateService, err = template.NewDefaultTemplateService(settings.TemplateDir)
 	if err != nil {
-		slog.Error("failed to initialize user service", "error", err)
+		slog.Error("failed to initialize template service", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("user service initialized")
+	slog.Info("template service initialized")
 
-	claimService, err = claimservice.NewFromConfig(data)
+	err = di.Wire()
 	if err != nil {
-		slog.Error("failed to initialize claim service", "error", err)
+		slog.Error("failed to wire dependencies", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("claimservice initialized")
+}
 
-	authorizationService, err = authorizationservice.NewFromConfig(data)
-	if err != nil {
-		slog.Error("failed to initialize authorization service", "error", err)
-		os.Exit(1)
+// initServer configures the HTTP router and server
+func initServer() {
+	routes = routing.NewSwitch(newRouter(realms))
+	httpServer, _ = server.NewServer(settings.ServerAddress, routes)
+}
+
+// newRouter registers the routes of the realms
+func newRouter(realms []*realm.Realm) *routing.Router {
+	router := &routing.Router{}
+
+	// the clock is shared by all realms, the admin token or an admin access token of the default realm manages it
+	clockAuthentication := routing.WithMiddleware(routing.AdminAuthenticationMiddleware(settings.AdminToken, settings.AdminScope, realms[0].Signing))
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		router.RegisterHandler(
+			handler.ClockAdminHandler(clock.Default),
+			routing.WithPath(clockAdminPath),
+			routing.WithMethod(method),
+			clockAuthentication)
 	}
-	slog.Info("authorizationservice initialized")
 
-	consentService, err = consentservice.NewFromConfig(data)
-	if err != nil {
-		slog.Error("failed to initialize consent service", "error", err)
-		os.Exit(1)
+	// realms matched by host go first, the default realm matches any host
+	for i := len(realms) - 1; i >= 0; i-- {
+		registerRealmRoutes(router, realms[i])
 	}
-	slog.Info("consentservice initialized")
+	return router
+}
 
-	templateService, err = template.NewDefaultTemplateService(settings.TemplateDir)
+// reloadConfig reads the data file again and swaps the realms and their routes at once. Realms keep
+// their runtime stores (sessions, codes, tokens) and runtime changes (see realm.Reload), a config which
+// fails to load is rejected and the running realms stay in place, an unchanged config is not reloaded.
+// Called by the file watcher only, reloads never overlap.
+func reloadConfig() {
+	baseDir := config.DataFileBaseDir(settings.DataFile)
+	data, err := config.ReadDataFile(settings.DataFile, baseDir)
 	if err != nil {
-		slog.Error("failed to initialize template service", "error", err)
-		os.Exit(1)
+		slog.Error("config reload rejected: failed to read config", "error", err)
+		return
 	}
-	slog.Info("template service initialized")
-
-	signingService, err = signing.NewSigningService(settings.DataFile)
+	expanded, err := realm.ExpandFiles(data, baseDir)
 	if err != nil {
-		slog.Error("failed to initialize signing service", "error", err)
-		os.Exit(1)
+		slog.Error("config reload rejected: failed to read realm files", "error", err)
+		return
+	}
+	changes := config.Diff(configData, expanded)
+	if len(changes) == 0 {
+		slog.Info("config reload skipped: config unchanged")
+		return
 	}
-	slog.Info("signing initialized")
 
-	err = di.Wire()
+	reloaded, err := realm.Reload(data, baseDir, realms)
 	if err != nil {
-		slog.Error("failed to wire dependencies", "error", err)
-		os.Exit(1)
+		slog.Error("config reload rejected", "error", err, "changes", changes)
+		return
 	}
+	routes.Set(newRouter(reloaded))
+	realms, configData = reloaded, expanded
+	slog.Warn("config reloaded", "realms", len(realms), "changes", changes)
 }
 
-// Configure HTTP router and server
-func init() {
+// virtual clock of the server (not below a realm path)
+const clockAdminPath = routing.AdminPathPrefix + "clock"
+
+// SAML 2.0 IdP endpoints of a realm (relative to the realm path)
+const (
+	samlMetadataPath = "/saml/metadata"
+	samlSSOPath      = "/saml/sso"
+	samlSSOPostPath  = "/saml/sso/post"
+)
+
+// identity brokering endpoints of a realm (relative to the realm path)
+const (
+	brokerLoginPath    = "/broker/login"
+	brokerCallbackPath = "/broker/callback"
+)
+
+// TOTP enrolment page of a realm (relative to the realm path)
+const totpEnrolmentPath = "/mfa/totp"
+
+// outbox of the mailer of a realm (relative to the realm path)
+const mailOutboxPath = "/mail/outbox"
+
+// fault injection rules of a realm (relative to the realm path)
+const faultsAdminPath = routing.AdminPathPrefix + "faults"
+
+// management API of a realm (relative to the realm path)
+const (
+	adminClientsPath  = routing.AdminPathPrefix + "clients"
+	adminUsersPath    = routing.AdminPathPrefix + "users"
+	adminScopesPath   = routing.AdminPathPrefix + "scopes"
+	adminConsentsPath = routing.AdminPathPrefix + "consents"
+	adminClaimsPath   = routing.AdminPathPrefix + "claims"
+	adminKeysPath     = routing.AdminPathPrefix + "keys"
+)
+
+// admin console of a realm (relative to the realm path)
+const consolePath = "/console"
+
+// runtime state of a realm (relative to the realm path)
+const (
+	resetAdminPath    = routing.AdminPathPrefix + "reset"
+	snapshotAdminPath = routing.AdminPathPrefix + "snapshot"
+)
+
+// passkey endpoints of a realm (relative to the realm path)
+const (
+	passkeyRegistrationPath = "/webauthn/register"
+	passkeyLoginPath        = "/webauthn/login"
+)
+
+// registerRealmRoutes registers the endpoints of a realm under its path (or host)
+func registerRealmRoutes(router *routing.Router, r *realm.Realm) {
+	endpoints := r.Profile.Endpoints()
+	issuerPath := r.Path + endpoints.IssuerSuffix
+	issuer := settings.Issuer + issuerPath
+	if r.Issuer != "" {
+		issuer = r.Issuer
+	}
 	openidConfiguration := auth.OpenIDConfiguration{
-		Issuer:                           settings.Issuer,
-		UseOrigin:                        settings.UseOrigin,
-		WellKnownEndpoint:                "/.well-known/openid-configuration",
-		AuthorizationEndpoint:            "/authorize",
-		TokenEndpoint:                    "/token",
-		UserInfoEndpoint:                 "/userinfo",
-		JWKSEndpoint:                     "/.well-known/jwks.json",
-		GrantTypesSupported:              []string{"authorization_code", "client_credentials", "password"},
+		Issuer:                           issuer,
+		IssuerPath:                       issuerPath,
+		IssuerSuffix:                     endpoints.IssuerSuffix,
+		UseOrigin:                        settings.UseOrigin && r.Issuer == "",
+		WellKnownEndpoint:                endpoints.WellKnown,
+		AuthorizationEndpoint:            endpoints.Authorization,
+		TokenEndpoint:                    endpoints.Token,
+		UserInfoEndpoint:                 endpoints.UserInfo,
+		IntrospectionEndpoint:            endpoints.Introspection,
+		EndSessionEndpoint:               endpoints.EndSession,
+		JWKSEndpoint:                     endpoints.JWKS,
+		GrantTypesSupported:              []string{"authorization_code", "client_credentials", "password", "refresh_token"},
 		ResponseTypesSupported:           []string{"code"},
 		SubjectTypesSupported:            []string{"public"},
-		IdTokenSigningAlgValuesSupported: signingService.GetSigningMethods(),
+		IdTokenSigningAlgValuesSupported: r.Signing.GetSigningMethods(),
+
+		IdTokenEncryptionAlgValuesSupported: encryption.SupportedKeyManagementAlgorithms,
+		IdTokenEncryptionEncValuesSupported: encryption.SupportedContentEncryptionAlgorithms,
+
+		UserinfoSigningAlgValuesSupported:    r.Signing.GetSigningMethods(),
+		UserinfoEncryptionAlgValuesSupported: encryption.SupportedKeyManagementAlgorithms,
+		UserinfoEncryptionEncValuesSupported: encryption.SupportedContentEncryptionAlgorithms,
+
+		RequestParameterSupported:     true,
+		RequestURIParameterSupported:  true,
+		RequireRequestURIRegistration: true,
+	}
+
+	// faults are injected before any other middleware runs
+	faultInjection := routing.WithMiddleware(routing.FaultInjectionMiddleware(r.Faults, r.Path))
+	route := func(path string, options ...routing.RouteOption) []routing.RouteOption {
+		options = append([]routing.RouteOption{faultInjection}, options...)
+		options = append(options, routing.WithPath(r.Path+path))
+		if r.Host != "" {
+			options = append(options, routing.WithHost(r.Host))
+		}
+		return options
+	}
+	cookiePath := r.Path
+	if cookiePath == "" {
+		cookiePath = "/"
+	}
+	loginOptions := []routing.LoginOption{
+		routing.WithBrokerLogin(r.Brokers, r.Path+brokerLoginPath),
+		routing.WithPasskeyLogin(r.Path + passkeyLoginPath),
+		routing.WithEmailLogin(r.Mail),
+	}
+	if settings.PersonaLogin {
+		loginOptions = append(loginOptions, routing.WithPersonaLogin(r.Claims))
 	}
+	userAuthentication := routing.UserAuthenticationMiddleware(r.Users, r.Sessions, r.Clients, loginOptions...)
+
+	router.RegisterHandler(
+		handler.WellKnownHandler(openidConfiguration, r.Clients),
+		route("/", routing.WithMethod(http.MethodGet))...)
+
+	router.RegisterHandler(
+		handler.WellKnownHandler(openidConfiguration, r.Clients),
+		route(openidConfiguration.WellKnownEndpoint, routing.WithMethod(http.MethodGet))...)
+
+	router.RegisterHandler(
+		handler.JWKSGetHandler(r.Signing),
+		route(openidConfiguration.JWKSEndpoint, routing.WithMethod(http.MethodGet))...)
+
+	router.RegisterHandler(
+		handler.AuthorizeResponseTypeCodeHandler(openidConfiguration, r.Clients, r.Consents, r.Authorizations),
+		route(openidConfiguration.AuthorizationEndpoint,
+			routing.ForQueryValue("response_type", "code"),
+			routing.WithMiddleware(handler.AuthorizeRequestMiddleware(openidConfiguration, r.Clients, r.Consents)),
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)),
+			routing.WithMiddleware(userAuthentication))...)
+
+	router.RegisterHandler(
+		handler.AuthorizeResponseTypeCodeHandler(openidConfiguration, r.Clients, r.Consents, r.Authorizations),
+		route(openidConfiguration.AuthorizationEndpoint)...)
+
+	router.RegisterHandler(
+		handler.TokenAuthorizationCodeHandler(openidConfiguration, r.Clients, r.Consents, r.Authorizations, r.Claims, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing),
+		route(openidConfiguration.TokenEndpoint,
+			routing.WithMethod(http.MethodPost),
+			routing.ForPostFormValue("grant_type", "authorization_code"),
+			routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))...)
+
+	router.RegisterHandler(
+		handler.TokenClientCredentialsHandler(openidConfiguration, r.Clients, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing),
+		route(openidConfiguration.TokenEndpoint,
+			routing.WithMethod(http.MethodPost),
+			routing.ForPostFormValue("grant_type", "client_credentials"),
+			routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))...)
+
+	router.RegisterHandler(
+		handler.TokenPasswordHandler(openidConfiguration, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing),
+		route(openidConfiguration.TokenEndpoint,
+			routing.WithMethod(http.MethodPost),
+			routing.ForPostFormValue("grant_type", "password"),
+			routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))...)
+
+	router.RegisterHandler(
+		handler.TokenRefreshTokenHandler(openidConfiguration, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing),
+		route(openidConfiguration.TokenEndpoint,
+			routing.WithMethod(http.MethodPost),
+			routing.ForPostFormValue("grant_type", "refresh_token"),
+			routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))...)
 
-	router = routing.Router{}
+	router.RegisterHandler(
+		handler.TokenUnsupportedGrantTypeHandler(),
+		route(openidConfiguration.TokenEndpoint,
+			routing.WithMethod(http.MethodPost),
+			routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))...)
+
+	router.RegisterHandler(
+		handler.UserinfoHandler(r.Users, r.Clients, r.Claims, r.Tokens, r.Signing),
+		route(openidConfiguration.UserInfoEndpoint, routing.WithMethod(http.MethodGet))...)
+
+	router.RegisterHandler(
+		handler.UserinfoHandler(r.Users, r.Clients, r.Claims, r.Tokens, r.Signing),
+		route(openidConfiguration.UserInfoEndpoint, routing.WithMethod(http.MethodPost))...)
+
+	router.RegisterHandler(
+		handler.TokenIntrospectionHandler(r.Clients, r.Users, r.Claims, r.Tokens, r.Signing),
+		route(openidConfiguration.IntrospectionEndpoint,
+			routing.WithMethod(http.MethodPost),
+			routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))...)
 
 	router.RegisterHandler(
-		handler.WellKnownHandler(openidConfiguration),
-		routing.WithMethod(http.MethodGet),
-		routing.WithPath("/"))
+		handler.EndSessionHandler(r.Clients, r.Sessions, r.Signing),
+		route(openidConfiguration.EndSessionEndpoint,
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)))...)
 
 	router.RegisterHandler(
-		handler.WellKnownHandler(openidConfiguration),
-		routing.WithMethod(http.MethodGet),
-		routing.WithPath(openidConfiguration.WellKnownEndpoint))
+		handler.SAMLMetadataHandler(openidConfiguration, r.Signing, samlSSOPath, samlSSOPostPath),
+		route(samlMetadataPath, routing.WithMethod(http.MethodGet))...)
 
 	router.RegisterHandler(
-		handler.JWKSGetHandler(),
-		routing.WithMethod(http.MethodGet),
-		routing.WithPath(openidConfiguration.JWKSEndpoint))
+		handler.SAMLPostBindingHandler(r.Path+samlSSOPath),
+		route(samlSSOPostPath, routing.WithMethod(http.MethodPost))...)
 
 	router.RegisterHandler(
-		handler.AuthorizeResponseTypeCodeHandler(),
-		routing.WithPath(openidConfiguration.AuthorizationEndpoint),
-		routing.ForQueryValue("response_type", "code"),
-		routing.WithMiddleware(routing.SessionMiddleware()),
-		routing.WithMiddleware(routing.UserAuthenticationMiddleware()))
+		handler.SAMLSSOHandler(openidConfiguration, r.Clients, r.Claims, r.Signing),
+		route(samlSSOPath,
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)),
+			routing.WithMiddleware(userAuthentication))...)
 
 	router.RegisterHandler(
-		handler.TokenAuthorizationCodeHandler(openidConfiguration, clientService, consentService, authorizationService, claimService, signingService),
-		routing.WithMethod(http.MethodPost),
-		routing.WithPath(openidConfiguration.TokenEndpoint),
-		routing.ForPostFormValue("grant_type", "authorization_code"),
-		routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))
+		handler.BrokerLoginHandler(openidConfiguration, r.Brokers, r.Sessions, brokerCallbackPath),
+		route(brokerLoginPath,
+			routing.WithMethod(http.MethodGet),
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)))...)
 
 	router.RegisterHandler(
-		handler.TokenClientCredentialsHandler(openidConfiguration, clientService, claimService, signingService),
-		routing.WithMethod(http.MethodPost),
-		routing.WithPath(openidConfiguration.TokenEndpoint),
-		routing.ForPostFormValue("grant_type", "client_credentials"),
-		routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))
+		handler.BrokerCallbackHandler(openidConfiguration, r.Brokers, r.Users, r.Consents, r.Sessions, brokerCallbackPath),
+		route(brokerCallbackPath,
+			routing.WithMethod(http.MethodGet),
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)))...)
 
 	router.RegisterHandler(
-		handler.TokenPasswordHandler(openidConfiguration, clientService, userService, claimService, consentService, signingService),
-		routing.WithMethod(http.MethodPost),
-		routing.WithPath(openidConfiguration.TokenEndpoint),
-		routing.ForPostFormValue("grant_type", "password"),
-		routing.WithMiddleware(routing.RateLimitMiddleware(100, 20)))
+		handler.TOTPEnrolmentHandler(r.Users, r.Sessions),
+		route(totpEnrolmentPath,
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)),
+			routing.WithMiddleware(userAuthentication))...)
 
 	router.RegisterHandler(
-		handler.UserinfoHandler(userService, clientService, claimService, signingService),
-		routing.WithMethod(http.MethodGet),
-		routing.WithPath(openidConfiguration.UserInfoEndpoint),
-	)
+		handler.PasskeyRegistrationHandler(r.WebAuthn, r.Sessions),
+		route(passkeyRegistrationPath,
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)),
+			routing.WithMiddleware(userAuthentication))...)
 
 	router.RegisterHandler(
-		handler.SCIMGetHandler(),
-		routing.WithMethod(http.MethodGet),
-		routing.WithPath("/beta/scim/users"))
+		handler.PasskeyLoginHandler(r.Users, r.WebAuthn, r.Sessions),
+		route(passkeyLoginPath,
+			routing.WithMiddleware(routing.SessionMiddleware(r.Sessions, cookiePath)))...)
+
+	adminAuthentication := routing.WithMiddleware(routing.AdminAuthenticationMiddleware(settings.AdminToken, settings.AdminScope, r.Signing))
+
+	// the outbox holds the login codes and links of every user
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		router.RegisterHandler(
+			handler.MailOutboxHandler(r.Mail),
+			route(mailOutboxPath, routing.WithMethod(method), adminAuthentication)...)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		router.RegisterHandler(
+			handler.FaultsAdminHandler(r.Faults),
+			route(faultsAdminPath, routing.WithMethod(method), adminAuthentication)...)
+	}
+
+	adminHandlers := map[string]routing.HandlerFunc{
+		adminClientsPath:  handler.AdminClientsHandler(r.Clients),
+		adminUsersPath:    handler.AdminUsersHandler(r.Users),
+		adminScopesPath:   handler.AdminScopesHandler(r.Consents),
+		adminConsentsPath: handler.AdminConsentsHandler(r.Consents),
+		adminClaimsPath:   handler.AdminClaimsHandler(r.Claims),
+	}
+	for path, adminHandler := range adminHandlers {
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			router.RegisterHandler(adminHandler, route(path, routing.WithMethod(method), adminAuthentication)...)
+		}
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		router.RegisterHandler(
+			handler.AdminKeysHandler(r.Signing),
+			route(adminKeysPath, routing.WithMethod(method), adminAuthentication)...)
+	}
+
+	stateful := r.StatefulServices()
+	adminUsers := strings.FieldsFunc(settings.AdminUsers, func(c rune) bool { return c == ',' || c == ' ' })
+	consoleHandler := handler.ConsoleHandler(r.Clients, r.Users, r.Claims, r.Consents, r.Signing, r.Tokens, stateful, settings.AdminToken, adminUsers)
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		router.RegisterHandler(consoleHandler, route(consolePath, routing.WithMethod(method))...)
+	}
+
 	router.RegisterHandler(
-		handler.SCIMPostHandler(),
-		routing.WithMethod(http.MethodPost),
-		routing.WithPath("/beta/scim/users"))
+		handler.ResetAdminHandler(stateful),
+		route(resetAdminPath, routing.WithMethod(http.MethodPost), adminAuthentication)...)
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		router.RegisterHandler(
+			handler.SnapshotAdminHandler(stateful),
+			route(snapshotAdminPath, routing.WithMethod(method), adminAuthentication)...)
+	}
 
-	httpServer, _ = server.NewServer(settings.ServerAddress, router)
+	router.RegisterHandler(
+		handler.SCIMGetHandler(r.Users),
+		route("/beta/scim/users", routing.WithMethod(http.MethodGet))...)
+	router.RegisterHandler(
+		handler.SCIMPostHandler(r.Users),
+		route("/beta/scim/users", routing.WithMethod(http.MethodPost))...)
 }
 
 func main() {
+	initServices()
+	initServer()
+
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT)
 
@@ -233,6 +475,8 @@ func main() {
 	}()
 	defer cancel()
 
+	go config.Watch(ctx, settings.DataFile, time.Duration(settings.ReloadSeconds)*time.Second, reloadConfig)
+
 	if err := httpServer.Start(ctx); err != nil {
 		os.Exit(1)
 	}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/realm"
+)
+
+// testRealmConfig is the config of the default realm and of the realm acme
+const testRealmConfig = `
+	"signing": {"keys": [{"provider": {"fromRandom": {"type": "P-256", "deterministic": true, "seed": "main"}}, "method": "ES256", "active": true}]},
+	"users": {"provider": "json", "users": {}},
+	"claims": {"provider": "json"},
+	"clients": {},
+	"consents": {"provider": "json", "scopes": {"openid": {"requireConsent": false}}},
+	"authorization": {"provider": "memory", "authorizationRequestTTLSeconds": 60, "authorizationCodeLength": 16},
+	"session": {"provider": "memory"}`
+
+const testConfig = `{` + testRealmConfig + `, "realms": {"acme": {` + testRealmConfig + `}}}`
+
+func TestAdminRoutesRequireAuthentication(t *testing.T) {
+	realms, err := realm.LoadAll([]byte(testConfig), t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	router := newRouter(realms)
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, clockAdminPath},
+		{http.MethodPost, clockAdminPath},
+		{http.MethodDelete, clockAdminPath},
+		{http.MethodGet, faultsAdminPath},
+		{http.MethodPut, faultsAdminPath},
+		{http.MethodPost, faultsAdminPath},
+		{http.MethodPatch, faultsAdminPath},
+		{http.MethodDelete, faultsAdminPath},
+		{http.MethodPost, resetAdminPath},
+		{http.MethodGet, snapshotAdminPath},
+		{http.MethodPut, snapshotAdminPath},
+		{http.MethodGet, adminClientsPath},
+		{http.MethodGet, adminKeysPath},
+		{http.MethodGet, mailOutboxPath},
+		{http.MethodDelete, mailOutboxPath},
+		{http.MethodGet, "/realms/acme" + mailOutboxPath},
+		{http.MethodPost, "/realms/acme" + resetAdminPath},
+		{http.MethodGet, "/realms/acme" + snapshotAdminPath},
+		{http.MethodGet, "/realms/acme" + faultsAdminPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status without a token = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
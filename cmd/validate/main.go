@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/axent-pl/oauth2mock/pkg/config"
+	"github.com/axent-pl/oauth2mock/pkg/validate"
+)
+
+type Settings struct {
+	DataFile string `env:"DATAFILE_PATH" default:"assets/config/config.json"`
+}
+
+var settings Settings
+
+func init() {
+	if err := config.Load(&settings); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config settings: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Checks the data files given as arguments (DATAFILE_PATH by default) and the realm files they reference,
+// every problem is printed as file:line:column: path: message and makes the exit status 1.
+func main() {
+	// the services log while the realms are loaded, only the problems matter here
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	files := os.Args[1:]
+	if len(files) == 0 {
+		files = []string{settings.DataFile}
+	}
+
+	failed := false
+	for _, file := range files {
+		problems, err := validate.File(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -1,10 +1,15 @@
 package auth
 
-import "net/url"
+import (
+	"net/url"
+	"strings"
+)
 
 type OpenIDConfiguration struct {
 	UseOrigin                        bool     `json:"-"` // flag to set Issuer from request Origin (both for well-known and token)
 	Issuer                           string   `json:"issuer"`
+	IssuerPath                       string   `json:"-"` // path of the issuer below the origin (e.g. /realms/{name}), appended when the issuer is taken from the Origin
+	IssuerSuffix                     string   `json:"-"` // trailing part of the issuer path which the endpoints do not share (e.g. /v2.0 for Entra)
 	WellKnownEndpoint                string   `json:"-"`
 	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
 	TokenEndpoint                    string   `json:"token_endpoint"`
@@ -14,15 +19,39 @@ type OpenIDConfiguration struct {
 	SubjectTypesSupported            []string `json:"subject_types_supported"`
 	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
 
+	IdTokenEncryptionAlgValuesSupported []string `json:"id_token_encryption_alg_values_supported,omitempty"`
+	IdTokenEncryptionEncValuesSupported []string `json:"id_token_encryption_enc_values_supported,omitempty"`
+
+	UserinfoSigningAlgValuesSupported    []string `json:"userinfo_signing_alg_values_supported,omitempty"`
+	UserinfoEncryptionAlgValuesSupported []string `json:"userinfo_encryption_alg_values_supported,omitempty"`
+	UserinfoEncryptionEncValuesSupported []string `json:"userinfo_encryption_enc_values_supported,omitempty"`
+
 	UserInfoEndpoint       string   `json:"userinfo_endpoint"`
 	ResponseModesSupported []string `json:"response_modes_supported"`
+	IntrospectionEndpoint  string   `json:"introspection_endpoint,omitempty"`
+	EndSessionEndpoint     string   `json:"end_session_endpoint,omitempty"`
+
+	RequestParameterSupported              bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported           bool     `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration          bool     `json:"require_request_uri_registration"`
+	RequestObjectSigningAlgValuesSupported []string `json:"request_object_signing_alg_values_supported,omitempty"`
 }
 
 func (oidc *OpenIDConfiguration) SetIssuer(issuer string) {
 	oidc.Issuer = issuer
-	oidc.AuthorizationEndpoint = issuer + removeOrigin(oidc.AuthorizationEndpoint)
-	oidc.TokenEndpoint = issuer + removeOrigin(oidc.TokenEndpoint)
-	oidc.JWKSEndpoint = issuer + removeOrigin(oidc.JWKSEndpoint)
+	base := strings.TrimSuffix(issuer, oidc.IssuerSuffix)
+	oidc.AuthorizationEndpoint = base + removeOrigin(oidc.AuthorizationEndpoint)
+	oidc.TokenEndpoint = base + removeOrigin(oidc.TokenEndpoint)
+	oidc.JWKSEndpoint = base + removeOrigin(oidc.JWKSEndpoint)
+	if oidc.UserInfoEndpoint != "" {
+		oidc.UserInfoEndpoint = base + removeOrigin(oidc.UserInfoEndpoint)
+	}
+	if oidc.IntrospectionEndpoint != "" {
+		oidc.IntrospectionEndpoint = base + removeOrigin(oidc.IntrospectionEndpoint)
+	}
+	if oidc.EndSessionEndpoint != "" {
+		oidc.EndSessionEndpoint = base + removeOrigin(oidc.EndSessionEndpoint)
+	}
 }
 
 func removeOrigin(rawURL string) string {
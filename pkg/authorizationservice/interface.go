@@ -1,6 +1,8 @@
 package authorizationservice
 
 import (
+	"time"
+
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
@@ -11,6 +13,8 @@ type AuthorizationRequester interface {
 	GetScopes() []string
 	GetState() string
 	GetNonce() string
+	GetAMR() []string
+	GetAuthTime() time.Time
 
 	GetClient() clientservice.Entity
 	GetUser() userservice.Entity
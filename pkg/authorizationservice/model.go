@@ -1,6 +1,8 @@
 package authorizationservice
 
 import (
+	"time"
+
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
@@ -13,6 +15,8 @@ type authorizationRequest struct {
 	Nonce        string
 	Client       clientservice.Entity
 	User         userservice.Entity
+	AMR          []string
+	AuthTime     time.Time
 }
 
 type NewAuthorizationRequestOption func(*authorizationRequest) error
@@ -45,6 +49,22 @@ func WithUser(user userservice.Entity) NewAuthorizationRequestOption {
 	}
 }
 
+// WithAMR records the authentication methods (RFC 8176) the user logged in with
+func WithAMR(amr []string) NewAuthorizationRequestOption {
+	return func(req *authorizationRequest) error {
+		req.AMR = amr
+		return nil
+	}
+}
+
+// WithAuthTime records when the user authenticated (auth_time of the tokens)
+func WithAuthTime(authTime time.Time) NewAuthorizationRequestOption {
+	return func(req *authorizationRequest) error {
+		req.AuthTime = authTime
+		return nil
+	}
+}
+
 func NewAuthorizationRequest(responseType string, scopes []string, client clientservice.Entity, options ...NewAuthorizationRequestOption) (AuthorizationRequester, error) {
 	req := &authorizationRequest{
 		ResponseType: responseType,
@@ -89,3 +109,11 @@ func (req *authorizationRequest) GetClient() clientservice.Entity {
 func (req *authorizationRequest) GetUser() userservice.Entity {
 	return req.User
 }
+
+func (req *authorizationRequest) GetAMR() []string {
+	return req.AMR
+}
+
+func (req *authorizationRequest) GetAuthTime() time.Time {
+	return req.AuthTime
+}
@@ -7,8 +7,16 @@ import (
 	"sync"
 	"time"
 
-	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
 	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+// defaults of a config which leaves out the TTL or the code length
+const (
+	defaultTTLSeconds = 60
+	defaultCodeLength = 16
 )
 
 type memoryAuthorizationServiceConfig struct {
@@ -23,6 +31,7 @@ type memoryAuthorizationService struct {
 	codeLength int
 	requests   map[string]authorizationServiceItem
 	requestsMU sync.RWMutex
+	clientSrv  clientservice.Service // resolves the clients of a restored snapshot
 }
 
 type authorizationServiceItem struct {
@@ -41,14 +50,25 @@ func NewMemoryAuthorizationService(rawAuthorizationConfig json.RawMessage, rawCo
 		return nil, fmt.Errorf("failed to unmarshal authorization service config: %w", err)
 	}
 
+	if config.TTLSeconds == 0 {
+		config.TTLSeconds = defaultTTLSeconds
+	}
+	if config.CodeLength == 0 {
+		config.CodeLength = defaultCodeLength
+	}
+	if config.TTLSeconds < 0 {
+		return nil, errs.New("invalid authorization service config", errs.ErrInvalidArgument).WithDetailsf("authorizationRequestTTLSeconds must be positive, got %d", config.TTLSeconds)
+	}
+	if config.CodeLength < 0 {
+		return nil, errs.New("invalid authorization service config", errs.ErrInvalidArgument).WithDetailsf("authorizationCodeLength must be positive, got %d", config.CodeLength)
+	}
+
 	service.codeLength = config.CodeLength
 	service.ttl = time.Second * time.Duration(config.TTLSeconds)
 	service.ticker = time.Second * time.Duration(config.TTLSeconds) * 10
 
 	go service.cleanupExpiredCodes()
 
-	di.Register(service)
-
 	return service, nil
 }
 
@@ -74,7 +94,7 @@ func (s *memoryAuthorizationService) Store(authRequest AuthorizationRequester) (
 	}
 
 	s.requests[code] = authorizationServiceItem{
-		expiresAt: time.Now().Add(s.ttl),
+		expiresAt: clock.Now().Add(s.ttl),
 		request:   authRequest,
 	}
 
@@ -89,7 +109,7 @@ func (s *memoryAuthorizationService) Get(code string) (AuthorizationRequester, e
 	if !exists {
 		return nil, fmt.Errorf("invalid authorization code %s", code)
 	}
-	if time.Now().After(authRequestData.expiresAt) {
+	if clock.Now().After(authRequestData.expiresAt) {
 		return nil, fmt.Errorf("authorization code %s has expired", code)
 	}
 
@@ -105,7 +125,7 @@ func (s *memoryAuthorizationService) cleanupExpiredCodes() {
 	for range ticker.C {
 		s.requestsMU.Lock()
 		for code, authRequestData := range s.requests {
-			if time.Now().After(authRequestData.expiresAt) {
+			if clock.Now().After(authRequestData.expiresAt) {
 				delete(s.requests, code)
 			}
 		}
@@ -113,6 +133,101 @@ func (s *memoryAuthorizationService) cleanupExpiredCodes() {
 	}
 }
 
+func (s *memoryAuthorizationService) InjectClientService(clientSrv clientservice.Service) {
+	s.requestsMU.Lock()
+	defer s.requestsMU.Unlock()
+	s.clientSrv = clientSrv
+}
+
+// authorizationSnapshot is the serialized form of a pending authorization code
+type authorizationSnapshot struct {
+	ExpiresAt    time.Time       `json:"expiresAt"`
+	ResponseType string          `json:"responseType"`
+	RedirectURI  string          `json:"redirectUri"`
+	Scopes       []string        `json:"scopes"`
+	State        string          `json:"state,omitempty"`
+	Nonce        string          `json:"nonce,omitempty"`
+	ClientId     string          `json:"clientId"`
+	User         json.RawMessage `json:"user,omitempty"`
+	AMR          []string        `json:"amr,omitempty"`
+	AuthTime     time.Time       `json:"authTime,omitzero"`
+}
+
+// Reset drops all authorization codes
+func (s *memoryAuthorizationService) Reset() error {
+	s.requestsMU.Lock()
+	defer s.requestsMU.Unlock()
+	s.requests = make(map[string]authorizationServiceItem)
+	return nil
+}
+
+// Snapshot returns the pending authorization requests by code
+func (s *memoryAuthorizationService) Snapshot() (json.RawMessage, error) {
+	s.requestsMU.RLock()
+	defer s.requestsMU.RUnlock()
+	snapshot := make(map[string]authorizationSnapshot, len(s.requests))
+	for code, item := range s.requests {
+		request := item.request
+		data := authorizationSnapshot{
+			ExpiresAt:    item.expiresAt,
+			ResponseType: request.GetResponseType(),
+			RedirectURI:  request.GetRedirectURI(),
+			Scopes:       request.GetScopes(),
+			State:        request.GetState(),
+			Nonce:        request.GetNonce(),
+			ClientId:     request.GetClient().Id(),
+			AMR:          request.GetAMR(),
+			AuthTime:     request.GetAuthTime(),
+		}
+		if user := request.GetUser(); user != nil {
+			var err error
+			if data.User, err = userservice.MarshalEntity(user); err != nil {
+				return nil, err
+			}
+		}
+		snapshot[code] = data
+	}
+	return json.Marshal(snapshot)
+}
+
+func (s *memoryAuthorizationService) Restore(rawSnapshot json.RawMessage) (func(), error) {
+	s.requestsMU.RLock()
+	clientSrv := s.clientSrv
+	s.requestsMU.RUnlock()
+	if clientSrv == nil {
+		return nil, errs.New("authorization service is not wired with a client service", errs.ErrInternal)
+	}
+	snapshot := make(map[string]authorizationSnapshot)
+	if err := json.Unmarshal(rawSnapshot, &snapshot); err != nil {
+		return nil, errs.New("invalid authorizations snapshot", errs.ErrInvalidArgument).WithDetails(err.Error())
+	}
+	requests := make(map[string]authorizationServiceItem, len(snapshot))
+	for code, data := range snapshot {
+		client, err := clientSrv.GetClient(data.ClientId)
+		if err != nil {
+			return nil, errs.New(fmt.Sprintf("invalid authorizations snapshot: unknown client '%s'", data.ClientId), errs.ErrInvalidArgument)
+		}
+		options := []NewAuthorizationRequestOption{WithRedirectURI(data.RedirectURI), WithState(data.State), WithNonce(data.Nonce), WithAMR(data.AMR), WithAuthTime(data.AuthTime)}
+		if len(data.User) > 0 {
+			user, err := userservice.UnmarshalEntity(data.User)
+			if err != nil {
+				return nil, errs.New(fmt.Sprintf("invalid authorizations snapshot: %v", err), errs.ErrInvalidArgument)
+			}
+			options = append(options, WithUser(user))
+		}
+		request, err := NewAuthorizationRequest(data.ResponseType, data.Scopes, client, options...)
+		if err != nil {
+			return nil, errs.New(fmt.Sprintf("invalid authorizations snapshot: %v", err), errs.ErrInvalidArgument)
+		}
+		requests[code] = authorizationServiceItem{expiresAt: data.ExpiresAt, request: request}
+	}
+	return func() {
+		s.requestsMU.Lock()
+		defer s.requestsMU.Unlock()
+		s.requests = requests
+	}, nil
+}
+
 func init() {
 	Register("memory", NewMemoryAuthorizationService)
 }
@@ -0,0 +1,26 @@
+package authorizationservice
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewMemoryAuthorizationServiceDefaults(t *testing.T) {
+	service, err := NewMemoryAuthorizationService(json.RawMessage(`{"provider": "memory"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := service.(*memoryAuthorizationService)
+	if memory.ttl.Seconds() != defaultTTLSeconds || memory.codeLength != defaultCodeLength {
+		t.Errorf("ttl = %v, codeLength = %d, want the defaults", memory.ttl, memory.codeLength)
+	}
+
+	for _, config := range []string{
+		`{"provider": "memory", "authorizationRequestTTLSeconds": -1}`,
+		`{"provider": "memory", "authorizationCodeLength": -1}`,
+	} {
+		if _, err := NewMemoryAuthorizationService(json.RawMessage(config), nil); err == nil {
+			t.Errorf("NewMemoryAuthorizationService(%s) succeeded, want an error", config)
+		}
+	}
+}
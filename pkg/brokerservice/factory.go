@@ -0,0 +1,58 @@
+package brokerservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+type BrokerServiceFactory func(json.RawMessage) (Service, error)
+
+var (
+	brokerServiceFactoryRegistryMU sync.RWMutex
+	brokerServiceFactoryRegistry   = map[string]BrokerServiceFactory{}
+)
+
+func Register(name string, f BrokerServiceFactory) {
+	brokerServiceFactoryRegistryMU.Lock()
+	defer brokerServiceFactoryRegistryMU.Unlock()
+	brokerServiceFactoryRegistry[name] = f
+}
+
+type Config struct {
+	BrokersConfig json.RawMessage `json:"brokers"`
+}
+
+// NewFromConfig initializes the broker service of the brokers section,
+// identity brokering is optional so a missing section yields a service without upstreams
+func NewFromConfig(rawConfig []byte) (Service, error) {
+	slog.Info("init started", "module", "brokerservice")
+	config := Config{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, errors.New("failed to unmarshal config")
+	}
+
+	provider := "oidc"
+	if config.BrokersConfig != nil {
+		var brokersConfig map[string]json.RawMessage
+		if err := json.Unmarshal(config.BrokersConfig, &brokersConfig); err != nil {
+			return nil, errors.New("failed to parse brokers config")
+		}
+		if providerRaw, ok := brokersConfig["provider"]; ok {
+			if err := json.Unmarshal(providerRaw, &provider); err != nil {
+				return nil, errors.New("invalid brokers.provider")
+			}
+		}
+	}
+
+	brokerServiceFactoryRegistryMU.RLock()
+	factory, ok := brokerServiceFactoryRegistry[provider]
+	brokerServiceFactoryRegistryMU.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown broker service provider: %s", provider)
+	}
+
+	return factory(config.BrokersConfig)
+}
@@ -0,0 +1,21 @@
+package brokerservice
+
+// Entity is an upstream identity provider users can log in with
+type Entity interface {
+	Alias() string
+	DisplayName() string
+	Issuer() string
+	// UserId derives the id of the local user from the upstream claims
+	UserId(claims map[string]interface{}) (string, error)
+	// Consents are granted to users created just in time
+	Consents() map[string]bool
+}
+
+type Service interface {
+	GetUpstreams() []Entity
+	GetUpstream(alias string) (Entity, error)
+	// AuthorizationURL returns the URL of the upstream authorization request
+	AuthorizationURL(upstream Entity, redirectURI string, state string, nonce string) (string, error)
+	// Exchange redeems the authorization code at the upstream provider and returns the verified upstream claims
+	Exchange(upstream Entity, code string, redirectURI string, nonce string) (map[string]interface{}, error)
+}
@@ -0,0 +1,61 @@
+package brokerservice
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+)
+
+type upstreamHandler struct {
+	alias        string
+	displayName  string
+	issuer       string
+	clientId     string
+	clientSecret string
+	scopes       []string
+	userIdClaim  string
+	userIdPrefix string
+	consents     map[string]bool
+
+	// discovery document and keys of the upstream, fetched on first use
+	metadataMU sync.Mutex
+	metadata   *upstreamMetadata
+	jwks       *signing.JSONWebKeySet
+}
+
+type upstreamMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func (u *upstreamHandler) Alias() string {
+	return u.alias
+}
+
+func (u *upstreamHandler) DisplayName() string {
+	return u.displayName
+}
+
+func (u *upstreamHandler) Issuer() string {
+	return u.issuer
+}
+
+func (u *upstreamHandler) UserId(claims map[string]interface{}) (string, error) {
+	value, ok := claims[u.userIdClaim]
+	if !ok {
+		return "", fmt.Errorf("upstream %s did not return the %s claim", u.alias, u.userIdClaim)
+	}
+	id := fmt.Sprint(value)
+	if id == "" {
+		return "", fmt.Errorf("upstream %s returned an empty %s claim", u.alias, u.userIdClaim)
+	}
+	return u.userIdPrefix + id, nil
+}
+
+func (u *upstreamHandler) Consents() map[string]bool {
+	return u.consents
+}
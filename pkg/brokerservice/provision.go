@@ -0,0 +1,62 @@
+package brokerservice
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+// Provision maps the upstream identity to a local user. A user with the derived id is linked when it exists,
+// otherwise a user without local credentials is created just in time and granted the consents of the upstream.
+// The returned user carries the upstream claims (attribute group "upstream") for the claim service.
+func Provision(upstream Entity, claims map[string]interface{}, userSvc userservice.Service, consentSvc consentservice.Service) (userservice.Entity, error) {
+	userId, err := upstream.UserId(claims)
+	if err != nil {
+		return nil, err
+	}
+	brokerAttributes := map[string]interface{}{"alias": upstream.Alias()}
+
+	// linked users are copied, the upstream claims belong to the session rather than to the stored user
+	if existing, err := userSvc.GetUser(userId); err == nil {
+		user, err := userservice.NewUserHandler(existing.Id(), existing.AuthenticationScheme(),
+			userservice.WithName(existing.Name()),
+			userservice.WithActive(existing.Active()))
+		if err != nil {
+			return nil, err
+		}
+		for group, attributes := range existing.GetAllAttributes() {
+			user.SetAttributesGroup(group, attributes)
+		}
+		user.SetAttributesGroup(userservice.AttributesGroupBroker, brokerAttributes)
+		user.SetAttributesGroup(userservice.AttributesGroupUpstream, claims)
+		slog.Info("brokered user linked", "upstream", upstream.Alias(), "userId", userId)
+		return user, nil
+	}
+
+	user, err := userservice.NewUserHandler(userId, nil,
+		userservice.WithCustomAttributes(userservice.AttributesGroupBroker, brokerAttributes),
+		userservice.WithCustomAttributes(userservice.AttributesGroupUpstream, claims))
+	if err != nil {
+		return nil, err
+	}
+	if err := userSvc.AddUser(user); err != nil {
+		return nil, fmt.Errorf("failed to create brokered user %s: %w", userId, err)
+	}
+
+	consents := make([]consentservice.Entity, 0, len(upstream.Consents()))
+	for scope, granted := range upstream.Consents() {
+		consent, err := consentservice.NewConsent(scope, consentservice.WithGranted(granted))
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, consent)
+	}
+	if err := consentSvc.SaveConsents(user, nil, consents); err != nil {
+		return nil, fmt.Errorf("failed to save consents of brokered user %s: %w", userId, err)
+	}
+
+	slog.Info("brokered user created", "upstream", upstream.Alias(), "userId", userId)
+	return user, nil
+}
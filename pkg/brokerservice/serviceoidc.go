@@ -0,0 +1,306 @@
+package brokerservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+)
+
+const wellKnownPath = "/.well-known/openid-configuration"
+
+// protocolClaims describe the ID token itself rather than the user, they are not kept as upstream claims
+var protocolClaims = []string{"aud", "exp", "iat", "nbf", "jti", "nonce", "azp", "at_hash", "c_hash", "auth_time", "sid"}
+
+type oidcBrokerServiceConfig struct {
+	Provider  string `json:"provider"`
+	Upstreams map[string]struct {
+		DisplayName  string          `json:"displayName"`
+		Issuer       string          `json:"issuer"`
+		ClientId     string          `json:"clientId"`
+		ClientSecret string          `json:"clientSecret"`
+		Scopes       []string        `json:"scopes"`
+		UserIdClaim  string          `json:"userIdClaim"`
+		UserIdPrefix *string         `json:"userIdPrefix"`
+		Consents     map[string]bool `json:"consents"`
+	} `json:"upstreams"`
+}
+
+type oidcBrokerService struct {
+	upstreams  map[string]*upstreamHandler
+	httpClient *http.Client
+}
+
+func NewOIDCBrokerService(rawConfig json.RawMessage) (Service, error) {
+	service := &oidcBrokerService{
+		upstreams:  make(map[string]*upstreamHandler),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if rawConfig == nil {
+		return service, nil
+	}
+
+	config := oidcBrokerServiceConfig{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal broker service config: %w", err)
+	}
+
+	for alias, upstreamConfig := range config.Upstreams {
+		if upstreamConfig.Issuer == "" {
+			return nil, fmt.Errorf("upstream %s: missing issuer", alias)
+		}
+		if upstreamConfig.ClientId == "" {
+			return nil, fmt.Errorf("upstream %s: missing clientId", alias)
+		}
+		upstream := &upstreamHandler{
+			alias:        alias,
+			displayName:  upstreamConfig.DisplayName,
+			issuer:       strings.TrimSuffix(upstreamConfig.Issuer, "/"),
+			clientId:     upstreamConfig.ClientId,
+			clientSecret: upstreamConfig.ClientSecret,
+			scopes:       upstreamConfig.Scopes,
+			userIdClaim:  upstreamConfig.UserIdClaim,
+			userIdPrefix: alias + ":",
+			consents:     upstreamConfig.Consents,
+		}
+		if upstream.displayName == "" {
+			upstream.displayName = alias
+		}
+		if len(upstream.scopes) == 0 {
+			upstream.scopes = []string{"openid"}
+		}
+		if upstream.userIdClaim == "" {
+			upstream.userIdClaim = "sub"
+		}
+		if upstreamConfig.UserIdPrefix != nil {
+			upstream.userIdPrefix = *upstreamConfig.UserIdPrefix
+		}
+		service.upstreams[alias] = upstream
+	}
+
+	return service, nil
+}
+
+func (s *oidcBrokerService) GetUpstreams() []Entity {
+	upstreams := make([]Entity, 0, len(s.upstreams))
+	for _, upstream := range s.upstreams {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Slice(upstreams, func(i, j int) bool { return upstreams[i].Alias() < upstreams[j].Alias() })
+	return upstreams
+}
+
+func (s *oidcBrokerService) GetUpstream(alias string) (Entity, error) {
+	upstream, ok := s.upstreams[alias]
+	if !ok {
+		return nil, errs.New("unknown upstream", errs.ErrNotFound).WithDetailsf("upstream '%s' is not configured", alias)
+	}
+	return upstream, nil
+}
+
+func (s *oidcBrokerService) AuthorizationURL(entity Entity, redirectURI string, state string, nonce string) (string, error) {
+	upstream, err := s.handler(entity)
+	if err != nil {
+		return "", err
+	}
+	metadata, err := s.getMetadata(upstream)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint of upstream %s: %w", upstream.alias, err)
+	}
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", upstream.clientId)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", strings.Join(upstream.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	authorizationURL.RawQuery = query.Encode()
+	return authorizationURL.String(), nil
+}
+
+func (s *oidcBrokerService) Exchange(entity Entity, code string, redirectURI string, nonce string) (map[string]interface{}, error) {
+	upstream, err := s.handler(entity)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := s.getMetadata(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	// code exchange (client_secret_post)
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", upstream.clientId)
+	form.Set("client_secret", upstream.clientSecret)
+	response, err := s.httpClient.PostForm(metadata.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("token request to upstream %s failed: %w", upstream.alias, err)
+	}
+	defer response.Body.Close()
+	tokenResponse := struct {
+		AccessToken      string `json:"access_token"`
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokenResponse); err != nil {
+		return nil, fmt.Errorf("invalid token response of upstream %s: %w", upstream.alias, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream %s rejected the code: %s %s", upstream.alias, tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, fmt.Errorf("upstream %s did not return an ID token", upstream.alias)
+	}
+
+	// ID token
+	claims, err := s.verifyIDToken(upstream, metadata, tokenResponse.IDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token of upstream %s: %w", upstream.alias, err)
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("invalid ID token of upstream %s: nonce mismatch", upstream.alias)
+	}
+	for _, claim := range protocolClaims {
+		delete(claims, claim)
+	}
+
+	// the ID token wins over the userinfo response, which only adds claims (when available)
+	if metadata.UserInfoEndpoint != "" && tokenResponse.AccessToken != "" {
+		userInfo, err := s.getUserInfo(metadata.UserInfoEndpoint, tokenResponse.AccessToken)
+		if err != nil {
+			slog.Warn("userinfo request to upstream failed", "upstream", upstream.alias, "error", err)
+		}
+		if userInfo["sub"] != nil && userInfo["sub"] != claims["sub"] {
+			return nil, fmt.Errorf("userinfo of upstream %s is for a different subject", upstream.alias)
+		}
+		for claim, value := range userInfo {
+			if _, ok := claims[claim]; !ok {
+				claims[claim] = value
+			}
+		}
+	}
+
+	return claims, nil
+}
+
+func (s *oidcBrokerService) handler(entity Entity) (*upstreamHandler, error) {
+	upstream, ok := s.upstreams[entity.Alias()]
+	if !ok {
+		return nil, errs.New("unknown upstream", errs.ErrNotFound).WithDetailsf("upstream '%s' is not configured", entity.Alias())
+	}
+	return upstream, nil
+}
+
+// getMetadata fetches the discovery document of the upstream once, the upstream
+// does not have to be up when the server starts
+func (s *oidcBrokerService) getMetadata(upstream *upstreamHandler) (*upstreamMetadata, error) {
+	upstream.metadataMU.Lock()
+	defer upstream.metadataMU.Unlock()
+	if upstream.metadata != nil {
+		return upstream.metadata, nil
+	}
+
+	metadata := &upstreamMetadata{}
+	if err := s.getJSON(upstream.issuer+wellKnownPath, metadata); err != nil {
+		return nil, fmt.Errorf("discovery of upstream %s failed: %w", upstream.alias, err)
+	}
+	if metadata.Issuer != upstream.issuer {
+		return nil, fmt.Errorf("discovery of upstream %s failed: issuer mismatch '%s'", upstream.alias, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery of upstream %s failed: missing endpoints", upstream.alias)
+	}
+	upstream.metadata = metadata
+	return metadata, nil
+}
+
+// verifyIDToken checks the signature, issuer and audience of the ID token,
+// the keys are fetched again once when the token is signed with an unknown key
+func (s *oidcBrokerService) verifyIDToken(upstream *upstreamHandler, metadata *upstreamMetadata, idToken string) (map[string]interface{}, error) {
+	upstream.metadataMU.Lock()
+	defer upstream.metadataMU.Unlock()
+
+	var verifyErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if upstream.jwks == nil || attempt > 0 {
+			jwks := &signing.JSONWebKeySet{}
+			if err := s.getJSON(metadata.JWKSURI, jwks); err != nil {
+				return nil, fmt.Errorf("failed to fetch keys: %w", err)
+			}
+			upstream.jwks = jwks
+		}
+		claims, err := signing.VerifyWithJWKS(idToken, *upstream.jwks, false)
+		if err != nil {
+			verifyErr = err
+			continue
+		}
+		if iss, _ := claims.GetIssuer(); iss != metadata.Issuer {
+			return nil, fmt.Errorf("issuer mismatch '%s'", iss)
+		}
+		if aud, _ := claims.GetAudience(); !slices.Contains(aud, upstream.clientId) {
+			return nil, fmt.Errorf("token is not issued for client '%s'", upstream.clientId)
+		}
+		return claims, nil
+	}
+	return nil, verifyErr
+}
+
+// getUserInfo returns the userinfo claims, signed or encrypted responses are not supported and yield no claims
+func (s *oidcBrokerService) getUserInfo(endpoint string, accessToken string) (map[string]interface{}, error) {
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", response.StatusCode)
+	}
+	userInfo := make(map[string]interface{})
+	if mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type")); mediaType != "application/json" {
+		return userInfo, nil
+	}
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&userInfo); err != nil {
+		return nil, err
+	}
+	return userInfo, nil
+}
+
+func (s *oidcBrokerService) getJSON(endpoint string, v any) error {
+	response, err := s.httpClient.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d of %s", response.StatusCode, endpoint)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(v)
+}
+
+func init() {
+	Register("oidc", NewOIDCBrokerService)
+}
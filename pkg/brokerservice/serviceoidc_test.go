@@ -0,0 +1,152 @@
+package brokerservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+// newUpstream starts an upstream provider issuing ID tokens for the user alice
+func newUpstream(t *testing.T, nonce string) *httptest.Server {
+	keys, err := signing.NewFromConfig([]byte(`{"signing": {"keys": [{"provider": {"fromRandom": {"type": "P-256"}}, "method": "ES256", "active": true}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var upstream *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc(wellKnownPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(upstreamMetadata{
+			Issuer:                upstream.URL,
+			AuthorizationEndpoint: upstream.URL + "/authorize",
+			TokenEndpoint:         upstream.URL + "/token",
+			JWKSURI:               upstream.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwks, _ := keys.GetJWKS()
+		w.Write(jwks)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "valid-code" || r.PostFormValue("client_secret") != "broker-secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken, _ := keys.Sign(map[string]any{
+			"iss":    upstream.URL,
+			"aud":    "broker",
+			"sub":    "alice",
+			"email":  "alice@upstream.test",
+			"groups": []string{"staff"},
+			"nonce":  nonce,
+			"exp":    time.Now().Add(time.Minute).Unix(),
+		})
+		json.NewEncoder(w).Encode(map[string]string{"id_token": string(idToken)})
+	})
+	upstream = httptest.NewServer(mux)
+	return upstream
+}
+
+func newBrokerService(t *testing.T, issuer string) Service {
+	rawConfig, _ := json.Marshal(map[string]any{
+		"brokers": map[string]any{
+			"provider": "oidc",
+			"upstreams": map[string]any{
+				"corporate": map[string]any{
+					"issuer":       issuer,
+					"clientId":     "broker",
+					"clientSecret": "broker-secret",
+					"scopes":       []string{"openid", "email"},
+					"consents":     map[string]bool{"openid": true, "email": true},
+				},
+			},
+		},
+	})
+	service, err := NewFromConfig(rawConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestOIDCBrokerServiceExchange(t *testing.T) {
+	upstreamServer := newUpstream(t, "nonce-1")
+	defer upstreamServer.Close()
+	service := newBrokerService(t, upstreamServer.URL)
+
+	upstream, err := service.GetUpstream("corporate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizationURL, err := service.AuthorizationURL(upstream, "http://localhost/broker/callback", "state-1", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := upstreamServer.URL + "/authorize?client_id=broker&nonce=nonce-1&redirect_uri=http%3A%2F%2Flocalhost%2Fbroker%2Fcallback&response_type=code&scope=openid+email&state=state-1"; authorizationURL != want {
+		t.Errorf("AuthorizationURL() = %s, want %s", authorizationURL, want)
+	}
+
+	claims, err := service.Exchange(upstream, "valid-code", "http://localhost/broker/callback", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "alice" || claims["email"] != "alice@upstream.test" {
+		t.Errorf("Exchange() claims = %v", claims)
+	}
+	if _, ok := claims["nonce"]; ok {
+		t.Errorf("Exchange() kept the protocol claim nonce")
+	}
+
+	if _, err := service.Exchange(upstream, "valid-code", "http://localhost/broker/callback", "nonce-2"); err == nil {
+		t.Errorf("Exchange() accepted a nonce mismatch")
+	}
+	if _, err := service.Exchange(upstream, "invalid-code", "http://localhost/broker/callback", "nonce-1"); err == nil {
+		t.Errorf("Exchange() accepted an invalid code")
+	}
+}
+
+func TestProvision(t *testing.T) {
+	userSvc, err := userservice.NewFromConfig([]byte(`{"users": {"provider": "json", "users": {}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	consentSvc, err := consentservice.NewFromConfig([]byte(`{"consents": {"provider": "json", "scopes": {"openid": {"requireConsent": false}, "email": {"requireConsent": true}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := newBrokerService(t, "http://upstream.test")
+	upstream, _ := service.GetUpstream("corporate")
+	claims := map[string]interface{}{"sub": "alice", "email": "alice@upstream.test"}
+
+	user, err := Provision(upstream, claims, userSvc, consentSvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id() != "corporate:alice" {
+		t.Errorf("Provision() user id = %s, want corporate:alice", user.Id())
+	}
+	if _, err := userSvc.GetUser("corporate:alice"); err != nil {
+		t.Errorf("Provision() did not create the user: %v", err)
+	}
+	consents, err := consentSvc.GetConsents(user, nil, []string{"email"})
+	if err != nil || !consents["email"].IsGranted() {
+		t.Errorf("Provision() did not grant the upstream consents")
+	}
+
+	// the second login links the existing user with the fresh upstream claims
+	claims = map[string]interface{}{"sub": "alice", "email": "alice@new.test"}
+	user, err = Provision(upstream, claims, userSvc, consentSvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email := user.GetAttributesGroup(userservice.AttributesGroupUpstream)["email"]; email != "alice@new.test" {
+		t.Errorf("Provision() upstream email = %v, want alice@new.test", email)
+	}
+}
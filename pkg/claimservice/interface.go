@@ -5,7 +5,40 @@ import (
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
 
+// ClaimsLayer is a single "layer" of claims.
+type ClaimsLayer struct {
+	Base            map[string]interface{}            `json:"base"`
+	ClientOverrides map[string]map[string]interface{} `json:"clientOverrides"`
+	ScopeOverrides  map[string]map[string]interface{} `json:"scopeOverrides"`
+}
+
+// ClaimsSet is a set of claims: defaults + per-purpose overrides.
+// Example JSON:
+//
+//	"claims": {
+//	  "default": { ...ClaimsLayer... },
+//	  "byPurpose": {
+//	    "id": { ...ClaimsLayer... },
+//	    "access": { ...ClaimsLayer... },
+//	    "refresh": { ...ClaimsLayer... },
+//	    "userinfo": { ...ClaimsLayer... },
+//	    "saml": { ...ClaimsLayer... }
+//	  }
+//	}
+type ClaimsSet struct {
+	Default   ClaimsLayer            `json:"default"`
+	ByPurpose map[string]ClaimsLayer `json:"byPurpose"`
+}
+
 type Service interface {
 	GetUserClaims(user userservice.Entity, client clientservice.Entity, scope []string, purpose string) (map[string]interface{}, error)
 	GetClientClaims(client clientservice.Entity, scope []string, purpose string) (map[string]interface{}, error)
+
+	// runtime management (admin API) of the claims of users (by id) and clients (by id)
+	GetUserClaimsSet(username string) (ClaimsSet, error)
+	PutUserClaimsSet(username string, claims ClaimsSet) error
+	DeleteUserClaimsSet(username string) error
+	GetClientClaimsSet(clientId string) (ClaimsSet, error)
+	PutClientClaimsSet(clientId string, claims ClaimsSet) error
+	DeleteClientClaimsSet(clientId string) error
 }
@@ -9,7 +9,7 @@ import (
 
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
 	"github.com/axent-pl/oauth2mock/pkg/consentservice"
-	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
 
@@ -20,6 +20,7 @@ const (
 	PurposeAccess   Purpose = "access"
 	PurposeRefresh  Purpose = "refresh"
 	PurposeUserInfo Purpose = "userinfo"
+	PurposeSAML     Purpose = "saml"
 )
 
 // ----- Config structs -----
@@ -27,36 +28,32 @@ const (
 type jsonClaimServiceConfig struct {
 	UsersWrapper struct {
 		Users map[string]struct {
-			Claims jsonClaimsSet `json:"claims"`
+			Claims ClaimsSet `json:"claims"`
 		} `json:"users"`
 	} `json:"users"`
 	Clients map[string]struct {
-		Claims jsonClaimsSet `json:"claims"`
+		Claims ClaimsSet `json:"claims"`
 	} `json:"clients"`
+	Brokers struct {
+		Upstreams map[string]jsonUpstreamClaims `json:"upstreams"`
+	} `json:"brokers"`
 }
 
-// A single "layer" of claims.
-type jsonClaims struct {
-	Base            map[string]interface{}            `json:"base"`
-	ClientOverrides map[string]map[string]interface{} `json:"clientOverrides"`
-	ScopeOverrides  map[string]map[string]interface{} `json:"scopeOverrides"`
-}
-
-// A set of claims: defaults + per-purpose overrides.
+// Claims of users logged in through an upstream provider (identity brokering).
 // Example JSON:
 //
-//	"claims": {
-//	  "default": { ...jsonClaims... },
-//	  "byPurpose": {
-//	    "id": { ...jsonClaims... },
-//	    "access": { ...jsonClaims... },
-//	    "refresh": { ...jsonClaims... },
-//	    "userinfo": { ...jsonClaims... }
+//	"upstreams": {
+//	  "corporate": {
+//	    "claimMappings": { "email": "email", "upstream_groups": "groups" },
+//	    "claims": { ...ClaimsSet... }
 //	  }
 //	}
-type jsonClaimsSet struct {
-	Default   jsonClaims            `json:"default"`
-	ByPurpose map[string]jsonClaims `json:"byPurpose"`
+//
+// claimMappings copy upstream claims (value) to user claims (key), they are the lowest layer.
+// The claims set applies to users created just in time, configured users keep their own.
+type jsonUpstreamClaims struct {
+	ClaimMappings map[string]string `json:"claimMappings"`
+	Claims        ClaimsSet         `json:"claims"`
 }
 
 // ----- Service impl -----
@@ -64,18 +61,24 @@ type jsonClaimsSet struct {
 type jsonClaimService struct {
 	consentService consentservice.Service
 
-	userClaims     map[string]jsonClaimsSet // key: userId
+	userClaims     map[string]ClaimsSet // key: userId
+	changedUsers   map[string]bool      // claims of users put or deleted at runtime
 	userClaimsMU   sync.RWMutex
-	clientClaims   map[string]jsonClaimsSet // key: clientName
+	clientClaims   map[string]ClaimsSet // key: clientName
+	changedClients map[string]bool      // claims of clients put or deleted at runtime
 	clientClaimsMU sync.RWMutex
+	upstreamClaims map[string]jsonUpstreamClaims // key: upstream alias
 }
 
 func NewJSONClaimsService(rawClaimsConfig json.RawMessage, rawConfig json.RawMessage) (Service, error) {
 	slog.Info("claimservice factory NewJSONClaimsService started")
 	config := jsonClaimServiceConfig{}
 	service := &jsonClaimService{
-		userClaims:   make(map[string]jsonClaimsSet),
-		clientClaims: make(map[string]jsonClaimsSet),
+		userClaims:     make(map[string]ClaimsSet),
+		changedUsers:   make(map[string]bool),
+		clientClaims:   make(map[string]ClaimsSet),
+		changedClients: make(map[string]bool),
+		upstreamClaims: make(map[string]jsonUpstreamClaims),
 	}
 
 	if err := json.Unmarshal(rawConfig, &config); err != nil {
@@ -94,7 +97,11 @@ func NewJSONClaimsService(rawClaimsConfig json.RawMessage, rawConfig json.RawMes
 	}
 	service.clientClaimsMU.Unlock()
 
-	di.Register(service)
+	for alias, upstreamData := range config.Brokers.Upstreams {
+		upstreamData.Claims = normalizeClaimsSet(upstreamData.Claims)
+		service.upstreamClaims[alias] = upstreamData
+	}
+
 	return service, nil
 }
 
@@ -158,11 +165,18 @@ func (s *jsonClaimService) GetUserClaims(user userservice.Entity, client clients
 		return nil, fmt.Errorf("could not get consents: %w", err)
 	}
 
+	mappedClaims, upstreamClaimsSet, brokered := s.getUpstreamClaims(user)
 	userClaimsSet, ok := s.userClaims[user.Id()]
+	if !ok && brokered {
+		userClaimsSet, ok = upstreamClaimsSet, true
+	}
 	if !ok {
 		return claims, fmt.Errorf("no claims for user %s", user.Name())
 	}
 
+	// 0) Apply claims mapped from the upstream provider
+	applyLayer(claims, mappedClaims)
+
 	// 1) Apply defaults
 	applyLayer(claims, userClaimsSet.Default.Base)
 
@@ -176,7 +190,7 @@ func (s *jsonClaimService) GetUserClaims(user userservice.Entity, client clients
 	for _, scope := range scopes {
 		scopeConsent, ok := consents[scope]
 		if !ok {
-			return nil, fmt.Errorf("undefined scope %s", scope)
+			return nil, errs.New(fmt.Sprintf("undefined scope %s", scope), consentservice.ErrUndefinedScope)
 		}
 		if scopeConsent.IsGranted() {
 			grantedScopes = append(grantedScopes, scope)
@@ -206,6 +220,114 @@ func (s *jsonClaimService) GetUserClaims(user userservice.Entity, client clients
 	return claims, nil
 }
 
+// getUpstreamClaims returns the mapped upstream claims and the claims set of the upstream
+// the user logged in with, ok is false for users which did not log in through an upstream
+func (s *jsonClaimService) getUpstreamClaims(user userservice.Entity) (map[string]interface{}, ClaimsSet, bool) {
+	alias, _ := user.GetAttributesGroup(userservice.AttributesGroupBroker)["alias"].(string)
+	upstreamClaims, ok := s.upstreamClaims[alias]
+	if !ok {
+		return nil, ClaimsSet{}, false
+	}
+	upstreamValues := user.GetAttributesGroup(userservice.AttributesGroupUpstream)
+	mapped := make(map[string]interface{})
+	for claim, upstreamClaim := range upstreamClaims.ClaimMappings {
+		if value, ok := upstreamValues[upstreamClaim]; ok {
+			mapped[claim] = value
+		}
+	}
+	return mapped, upstreamClaims.Claims, true
+}
+
+func (s *jsonClaimService) GetUserClaimsSet(username string) (ClaimsSet, error) {
+	s.userClaimsMU.RLock()
+	defer s.userClaimsMU.RUnlock()
+	claims, ok := s.userClaims[username]
+	if !ok {
+		return ClaimsSet{}, errs.New(fmt.Sprintf("no claims for user %s", username), errs.ErrNotFound)
+	}
+	return claims, nil
+}
+
+func (s *jsonClaimService) PutUserClaimsSet(username string, claims ClaimsSet) error {
+	s.userClaimsMU.Lock()
+	defer s.userClaimsMU.Unlock()
+	s.userClaims[username] = normalizeClaimsSet(claims)
+	s.changedUsers[username] = true
+	return nil
+}
+
+func (s *jsonClaimService) DeleteUserClaimsSet(username string) error {
+	s.userClaimsMU.Lock()
+	defer s.userClaimsMU.Unlock()
+	if _, ok := s.userClaims[username]; !ok {
+		return errs.New(fmt.Sprintf("no claims for user %s", username), errs.ErrNotFound)
+	}
+	delete(s.userClaims, username)
+	s.changedUsers[username] = true
+	return nil
+}
+
+func (s *jsonClaimService) GetClientClaimsSet(clientId string) (ClaimsSet, error) {
+	s.clientClaimsMU.RLock()
+	defer s.clientClaimsMU.RUnlock()
+	claims, ok := s.clientClaims[clientId]
+	if !ok {
+		return ClaimsSet{}, errs.New(fmt.Sprintf("no claims for client %s", clientId), errs.ErrNotFound)
+	}
+	return claims, nil
+}
+
+func (s *jsonClaimService) PutClientClaimsSet(clientId string, claims ClaimsSet) error {
+	s.clientClaimsMU.Lock()
+	defer s.clientClaimsMU.Unlock()
+	s.clientClaims[clientId] = normalizeClaimsSet(claims)
+	s.changedClients[clientId] = true
+	return nil
+}
+
+func (s *jsonClaimService) DeleteClientClaimsSet(clientId string) error {
+	s.clientClaimsMU.Lock()
+	defer s.clientClaimsMU.Unlock()
+	if _, ok := s.clientClaims[clientId]; !ok {
+		return errs.New(fmt.Sprintf("no claims for client %s", clientId), errs.ErrNotFound)
+	}
+	delete(s.clientClaims, clientId)
+	s.changedClients[clientId] = true
+	return nil
+}
+
+// KeepRuntimeChanges carries the claims of users and clients changed at runtime over from previous
+// (the service of the config before a reload), they win over the config
+func (s *jsonClaimService) KeepRuntimeChanges(previous Service) {
+	p, ok := previous.(*jsonClaimService)
+	if !ok || p == s {
+		return
+	}
+	p.userClaimsMU.RLock()
+	s.userClaimsMU.Lock()
+	keepChanges(s.userClaims, s.changedUsers, p.userClaims, p.changedUsers)
+	s.userClaimsMU.Unlock()
+	p.userClaimsMU.RUnlock()
+
+	p.clientClaimsMU.RLock()
+	defer p.clientClaimsMU.RUnlock()
+	s.clientClaimsMU.Lock()
+	defer s.clientClaimsMU.Unlock()
+	keepChanges(s.clientClaims, s.changedClients, p.clientClaims, p.changedClients)
+}
+
+// keepChanges copies the changed entries (or their deletion) of previous to claims
+func keepChanges(claims map[string]ClaimsSet, changed map[string]bool, previous map[string]ClaimsSet, previousChanged map[string]bool) {
+	for id := range previousChanged {
+		if claimsSet, ok := previous[id]; ok {
+			claims[id] = claimsSet
+		} else {
+			delete(claims, id)
+		}
+		changed[id] = true
+	}
+}
+
 func init() {
 	Register("json", NewJSONClaimsService)
 }
@@ -213,11 +335,11 @@ func init() {
 // ----- helpers -----
 
 // normalizeClaimsSet ensures maps are non-nil so later lookups are safe.
-func normalizeClaimsSet(cs jsonClaimsSet) jsonClaimsSet {
+func normalizeClaimsSet(cs ClaimsSet) ClaimsSet {
 	if cs.ByPurpose == nil {
-		cs.ByPurpose = make(map[string]jsonClaims)
+		cs.ByPurpose = make(map[string]ClaimsLayer)
 	}
-	normalizeLayer := func(l *jsonClaims) {
+	normalizeLayer := func(l *ClaimsLayer) {
 		if l.Base == nil {
 			l.Base = make(map[string]interface{})
 		}
@@ -1,6 +1,9 @@
 package clientservice
 
-import "github.com/axent-pl/oauth2mock/pkg/service/authentication"
+import (
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+)
 
 type Entity interface {
 	Id() string
@@ -8,9 +11,26 @@ type Entity interface {
 	RedirectURIPattern() string
 	AuthenticationScheme() authentication.SchemeHandler
 	ValidateRedirectURI(redirectURI string) bool
+	JWKS() signing.JSONWebKeySet
+	ValidateRequestURI(requestURI string) bool
+	RequestObjectSigningAlg() string
+	AllowUnsignedRequestObject() bool
+	AccessTokenFormat() string
+	IDTokenEncryption() EncryptionSettings
+	AccessTokenEncryption() EncryptionSettings
+	UserinfoSignedResponseAlg() string
+	UserinfoEncryption() EncryptionSettings
+	SAML() SAMLSettings
+	RequireMFA() bool
 }
 
 type Service interface {
 	GetClient(client_id string) (Entity, error)
+	GetClientBySAMLEntityID(entityID string) (Entity, error)
 	Authenticate(credentials authentication.CredentialsHandler) (Entity, error)
+
+	// runtime management (admin API)
+	GetClientConfigs() map[string]ClientConfig
+	PutClient(id string, config ClientConfig) error
+	DeleteClient(id string) error
 }
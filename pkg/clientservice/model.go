@@ -2,12 +2,53 @@ package clientservice
 
 import (
 	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
 )
 
+const (
+	AccessTokenFormatJWT    = "jwt"
+	AccessTokenFormatOpaque = "opaque"
+)
+
+// EncryptionSettings describes how tokens issued to the client are encrypted (JWE).
+// Keys are the recipient public keys; empty Alg means no encryption.
+type EncryptionSettings struct {
+	Alg  string
+	Enc  string
+	Keys signing.JSONWebKeySet
+}
+
+func (e EncryptionSettings) Enabled() bool {
+	return e.Alg != ""
+}
+
+// SAMLSettings describes the client as a SAML 2.0 service provider; empty EntityID means no SAML
+type SAMLSettings struct {
+	EntityID     string
+	ACSURL       string // assertion consumer service URL (pattern), used when the AuthnRequest does not name one
+	NameIDFormat string
+}
+
+func (s SAMLSettings) Enabled() bool {
+	return s.EntityID != ""
+}
+
 type client struct {
-	id                 string
-	redirectURIPattern string
-	authScheme         authentication.SchemeHandler
+	id                         string
+	config                     ClientConfig // without the secret
+	redirectURIPattern         string
+	authScheme                 authentication.SchemeHandler
+	jwks                       signing.JSONWebKeySet
+	requestURIPatterns         []string
+	requestObjectSigningAlg    string
+	allowUnsignedRequestObject bool
+	accessTokenFormat          string
+	idTokenEncryption          EncryptionSettings
+	accessTokenEncryption      EncryptionSettings
+	userinfoSignedResponseAlg  string
+	userinfoEncryption         EncryptionSettings
+	saml                       SAMLSettings
+	requireMFA                 bool
 }
 
 func (c *client) Id() string {
@@ -30,3 +71,69 @@ func (c *client) ValidateRedirectURI(redirectURI string) bool {
 func (c *client) AuthenticationScheme() authentication.SchemeHandler {
 	return c.authScheme
 }
+
+// JWKS returns the public keys registered for the client (used e.g. to verify request objects)
+func (c *client) JWKS() signing.JSONWebKeySet {
+	return c.jwks
+}
+
+// ValidateRequestURI checks the given request_uri against the client's registered request_uris (patterns)
+func (c *client) ValidateRequestURI(requestURI string) bool {
+	if len(requestURI) == 0 {
+		return false
+	}
+	for _, pattern := range c.requestURIPatterns {
+		if MatchesWildcard(requestURI, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestObjectSigningAlg returns the JWS alg the client must use for request objects (empty means any)
+func (c *client) RequestObjectSigningAlg() string {
+	return c.requestObjectSigningAlg
+}
+
+// AllowUnsignedRequestObject reports whether the client may send request objects with alg "none"
+func (c *client) AllowUnsignedRequestObject() bool {
+	return c.allowUnsignedRequestObject
+}
+
+// AccessTokenFormat returns the format of issued access tokens (AccessTokenFormatJWT or AccessTokenFormatOpaque)
+func (c *client) AccessTokenFormat() string {
+	if c.accessTokenFormat == "" {
+		return AccessTokenFormatJWT
+	}
+	return c.accessTokenFormat
+}
+
+// IDTokenEncryption returns the ID token encryption settings (encrypted with the client's keys)
+func (c *client) IDTokenEncryption() EncryptionSettings {
+	return c.idTokenEncryption
+}
+
+// AccessTokenEncryption returns the access token encryption settings (encrypted with the resource server's keys)
+func (c *client) AccessTokenEncryption() EncryptionSettings {
+	return c.accessTokenEncryption
+}
+
+// UserinfoSignedResponseAlg returns the JWS alg used to sign UserInfo responses (empty means plain JSON)
+func (c *client) UserinfoSignedResponseAlg() string {
+	return c.userinfoSignedResponseAlg
+}
+
+// UserinfoEncryption returns the UserInfo response encryption settings (encrypted with the client's keys)
+func (c *client) UserinfoEncryption() EncryptionSettings {
+	return c.userinfoEncryption
+}
+
+// SAML returns the service provider settings of the client
+func (c *client) SAML() SAMLSettings {
+	return c.saml
+}
+
+// RequireMFA reports whether users must pass a second factor (TOTP) to authorize the client
+func (c *client) RequireMFA() bool {
+	return c.requireMFA
+}
@@ -4,57 +4,127 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
 
-	"github.com/axent-pl/oauth2mock/pkg/di"
 	"github.com/axent-pl/oauth2mock/pkg/errs"
 	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
 )
 
 type clientService struct {
-	clients map[string]client
+	clients   map[string]client
+	changed   map[string]bool // clients added, replaced or deleted at runtime
+	clientsMU sync.RWMutex
 }
 
-func NewClientService(jsonFilepath string) (Service, error) {
-	type jsonStruct struct {
-		Id          string `json:"client_id"`
-		Secret      string `json:"client_secret"`
-		RedirectURI string `json:"redirect_uri"`
-	}
-	type jsonStoreStruct struct {
-		Clients map[string]jsonStruct `json:"clients"`
-	}
-	f := jsonStoreStruct{}
+// ClientConfig is the entry of a client in the clients section of the config
+type ClientConfig struct {
+	Id                         string                `json:"client_id"`
+	Secret                     string                `json:"client_secret,omitempty"`
+	RedirectURI                string                `json:"redirect_uri"`
+	JWKS                       signing.JSONWebKeySet `json:"jwks,omitzero"`
+	RequestURIs                []string              `json:"request_uris,omitempty"`
+	RequestObjectSigningAlg    string                `json:"request_object_signing_alg,omitempty"`
+	AllowUnsignedRequestObject bool                  `json:"allow_unsigned_request_object,omitempty"`
+	AccessTokenFormat          string                `json:"access_token_format,omitempty"`
+
+	IDTokenEncryptedResponseAlg     string                `json:"id_token_encrypted_response_alg,omitempty"`
+	IDTokenEncryptedResponseEnc     string                `json:"id_token_encrypted_response_enc,omitempty"`
+	AccessTokenEncryptedResponseAlg string                `json:"access_token_encrypted_response_alg,omitempty"`
+	AccessTokenEncryptedResponseEnc string                `json:"access_token_encrypted_response_enc,omitempty"`
+	AccessTokenEncryptionJWKS       signing.JSONWebKeySet `json:"access_token_encryption_jwks,omitzero"`
 
+	UserinfoSignedResponseAlg    string `json:"userinfo_signed_response_alg,omitempty"`
+	UserinfoEncryptedResponseAlg string `json:"userinfo_encrypted_response_alg,omitempty"`
+	UserinfoEncryptedResponseEnc string `json:"userinfo_encrypted_response_enc,omitempty"`
+
+	SAML struct {
+		EntityID     string `json:"entity_id,omitempty"`
+		ACSURL       string `json:"acs_url,omitempty"`
+		NameIDFormat string `json:"name_id_format,omitempty"`
+	} `json:"saml,omitzero"`
+
+	RequireMFA bool `json:"require_mfa,omitempty"`
+}
+
+func NewClientService(jsonFilepath string) (Service, error) {
 	data, err := os.ReadFile(jsonFilepath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read clients config file: %w", err)
 	}
+	return NewFromConfig(data)
+}
+
+// NewFromConfig builds the client service from the clients section of the raw config
+func NewFromConfig(rawConfig []byte) (Service, error) {
+	type jsonStoreStruct struct {
+		Clients map[string]ClientConfig `json:"clients"`
+	}
+	f := jsonStoreStruct{}
 
-	if err := json.Unmarshal(data, &f); err != nil {
+	if err := json.Unmarshal(rawConfig, &f); err != nil {
 		return nil, fmt.Errorf("failed to parse clients config file: %w", err)
 	}
 
 	clientStore := &clientService{
 		clients: make(map[string]client),
+		changed: make(map[string]bool),
 	}
 	for k, v := range f.Clients {
-		credentials, err := authentication.NewScheme(authentication.WithClientIdAndSecret(v.Id, v.Secret))
+		c, err := newClient(k, v, nil)
 		if err != nil {
-			panic(fmt.Errorf("failed to parse client credentials from config file: %w", err))
-		}
-		clientStore.clients[k] = client{
-			id:                 v.Id,
-			authScheme:         credentials,
-			redirectURIPattern: v.RedirectURI,
+			return nil, err
 		}
+		clientStore.clients[k] = c
 	}
 
-	di.Register(clientStore)
-
 	return clientStore, nil
 }
 
+// newClient builds the client from its config, a missing secret is taken from the credentials
+// of the client it replaces (when given)
+func newClient(id string, v ClientConfig, replaced *client) (client, error) {
+	var credentials authentication.SchemeHandler
+	if v.Secret == "" && replaced != nil {
+		credentials = replaced.authScheme
+	} else {
+		var err error
+		if credentials, err = authentication.NewScheme(authentication.WithClientIdAndSecret(v.Id, v.Secret)); err != nil {
+			return client{}, fmt.Errorf("failed to parse client credentials of client %s: %w", id, err)
+		}
+	}
+	switch v.AccessTokenFormat {
+	case "", AccessTokenFormatJWT, AccessTokenFormatOpaque:
+	default:
+		return client{}, fmt.Errorf("invalid access_token_format '%s' for client %s", v.AccessTokenFormat, id)
+	}
+	accessTokenEncryptionKeys := v.AccessTokenEncryptionJWKS
+	if len(accessTokenEncryptionKeys.Keys) == 0 {
+		accessTokenEncryptionKeys = v.JWKS
+	}
+	v.Secret = ""
+	return client{
+		id:                         v.Id,
+		config:                     v,
+		authScheme:                 credentials,
+		redirectURIPattern:         v.RedirectURI,
+		jwks:                       v.JWKS,
+		requestURIPatterns:         v.RequestURIs,
+		requestObjectSigningAlg:    v.RequestObjectSigningAlg,
+		allowUnsignedRequestObject: v.AllowUnsignedRequestObject,
+		accessTokenFormat:          v.AccessTokenFormat,
+		idTokenEncryption:          newEncryptionSettings(v.IDTokenEncryptedResponseAlg, v.IDTokenEncryptedResponseEnc, v.JWKS),
+		accessTokenEncryption:      newEncryptionSettings(v.AccessTokenEncryptedResponseAlg, v.AccessTokenEncryptedResponseEnc, accessTokenEncryptionKeys),
+		userinfoSignedResponseAlg:  v.UserinfoSignedResponseAlg,
+		userinfoEncryption:         newEncryptionSettings(v.UserinfoEncryptedResponseAlg, v.UserinfoEncryptedResponseEnc, v.JWKS),
+		saml:                       SAMLSettings{EntityID: v.SAML.EntityID, ACSURL: v.SAML.ACSURL, NameIDFormat: v.SAML.NameIDFormat},
+		requireMFA:                 v.RequireMFA,
+	}, nil
+}
+
 func (s *clientService) GetClient(client_id string) (Entity, error) {
+	s.clientsMU.RLock()
+	defer s.clientsMU.RUnlock()
 	client, ok := s.clients[client_id]
 	if !ok {
 		return nil, errs.New("invalid client_id", errs.ErrNotFound).WithDetailsf("client_id '%s' not found", client_id)
@@ -62,13 +132,26 @@ func (s *clientService) GetClient(client_id string) (Entity, error) {
 	return &client, nil
 }
 
+func (s *clientService) GetClientBySAMLEntityID(entityID string) (Entity, error) {
+	s.clientsMU.RLock()
+	defer s.clientsMU.RUnlock()
+	for _, client := range s.clients {
+		if client.saml.Enabled() && client.saml.EntityID == entityID {
+			return &client, nil
+		}
+	}
+	return nil, errs.New("unknown service provider", errs.ErrNotFound).WithDetailsf("no client with SAML entity_id '%s'", entityID)
+}
+
 func (s *clientService) Authenticate(credentials authentication.CredentialsHandler) (Entity, error) {
 	clientId, err := credentials.IdentityName()
 	if err != nil {
 		return nil, errs.Wrap("invalid client credentials", err)
 	}
 
+	s.clientsMU.RLock()
 	client, ok := s.clients[clientId]
+	s.clientsMU.RUnlock()
 	if !ok {
 		return nil, errs.New("invalid client_id", errs.ErrNotFound).WithDetailsf("client_id '%s' not found", clientId)
 	}
@@ -80,3 +163,70 @@ func (s *clientService) Authenticate(credentials authentication.CredentialsHandl
 
 	return &client, nil
 }
+
+// GetClientConfigs returns the config of every client by id, secrets are left out
+func (s *clientService) GetClientConfigs() map[string]ClientConfig {
+	s.clientsMU.RLock()
+	defer s.clientsMU.RUnlock()
+	configs := make(map[string]ClientConfig, len(s.clients))
+	for id, client := range s.clients {
+		configs[id] = client.config
+	}
+	return configs
+}
+
+// PutClient adds the client or replaces it, the secret of a replaced client is kept when the config has none
+func (s *clientService) PutClient(id string, config ClientConfig) error {
+	if config.Id == "" {
+		config.Id = id
+	}
+	if config.Id != id {
+		return errs.New(fmt.Sprintf("client_id '%s' does not match the client '%s'", config.Id, id), errs.ErrInvalidArgument)
+	}
+
+	s.clientsMU.Lock()
+	defer s.clientsMU.Unlock()
+	var replaced *client
+	if current, ok := s.clients[id]; ok {
+		replaced = &current
+	}
+	c, err := newClient(id, config, replaced)
+	if err != nil {
+		return errs.New(err.Error(), errs.ErrInvalidArgument)
+	}
+	s.clients[id] = c
+	s.changed[id] = true
+	return nil
+}
+
+func (s *clientService) DeleteClient(id string) error {
+	s.clientsMU.Lock()
+	defer s.clientsMU.Unlock()
+	if _, ok := s.clients[id]; !ok {
+		return errs.New("invalid client_id", errs.ErrNotFound).WithDetailsf("client_id '%s' not found", id)
+	}
+	delete(s.clients, id)
+	s.changed[id] = true
+	return nil
+}
+
+// KeepRuntimeChanges carries the clients added, replaced or deleted at runtime over from previous
+// (the service of the config before a reload), they win over the config
+func (s *clientService) KeepRuntimeChanges(previous Service) {
+	p, ok := previous.(*clientService)
+	if !ok || p == s {
+		return
+	}
+	p.clientsMU.RLock()
+	defer p.clientsMU.RUnlock()
+	s.clientsMU.Lock()
+	defer s.clientsMU.Unlock()
+	for id := range p.changed {
+		if c, ok := p.clients[id]; ok {
+			s.clients[id] = c
+		} else {
+			delete(s.clients, id)
+		}
+		s.changed[id] = true
+	}
+}
@@ -3,6 +3,8 @@ package clientservice
 import (
 	"regexp"
 	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
 )
 
 func MatchesWildcard(redirectURI, clientRedirectURI string) bool {
@@ -14,3 +16,11 @@ func MatchesWildcard(redirectURI, clientRedirectURI string) bool {
 	}
 	return regex.MatchString(redirectURI)
 }
+
+// newEncryptionSettings builds the encryption settings, enc defaults to A256GCM when only alg is registered
+func newEncryptionSettings(alg, enc string, keys signing.JSONWebKeySet) EncryptionSettings {
+	if alg != "" && enc == "" {
+		enc = "A256GCM"
+	}
+	return EncryptionSettings{Alg: alg, Enc: enc, Keys: keys}
+}
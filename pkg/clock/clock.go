@@ -0,0 +1,102 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// State describes the virtual time
+type State struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+	// OffsetSeconds is the distance of the virtual time from the real time
+	OffsetSeconds int64 `json:"offsetSeconds"`
+}
+
+// VirtualClock follows the real time shifted by an offset, when frozen it stands still.
+// The zero value is the real time.
+type VirtualClock struct {
+	mu       sync.RWMutex
+	offset   time.Duration
+	frozen   bool
+	frozenAt time.Time
+}
+
+// Default is the clock of the server, codes, sessions and tokens expire by its time
+var Default = &VirtualClock{}
+
+// Now returns the time of the Default clock, use it instead of time.Now wherever tests may want to control the time
+func Now() time.Time {
+	return Default.Now()
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now()
+}
+
+func (c *VirtualClock) now() time.Time {
+	if c.frozen {
+		return c.frozenAt
+	}
+	return time.Now().Add(c.offset)
+}
+
+// Freeze stops the clock at the current virtual time
+func (c *VirtualClock) Freeze() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.frozen {
+		c.frozenAt = c.now()
+		c.frozen = true
+	}
+}
+
+// Resume lets the clock run again from the current virtual time
+func (c *VirtualClock) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		c.offset = time.Until(c.frozenAt)
+		c.frozen = false
+	}
+}
+
+// Advance moves the virtual time by d (backwards when negative)
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		c.frozenAt = c.frozenAt.Add(d)
+		return
+	}
+	c.offset += d
+}
+
+// Set moves the virtual time to t
+func (c *VirtualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		c.frozenAt = t
+		return
+	}
+	c.offset = time.Until(t)
+}
+
+// Reset returns to the real time
+func (c *VirtualClock) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = 0
+	c.frozen = false
+	c.frozenAt = time.Time{}
+}
+
+func (c *VirtualClock) State() State {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	return State{Now: now, Frozen: c.frozen, OffsetSeconds: int64(time.Until(now).Round(time.Second) / time.Second)}
+}
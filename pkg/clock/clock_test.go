@@ -0,0 +1,37 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClock(t *testing.T) {
+	c := &VirtualClock{}
+	if d := time.Since(c.Now()); d < 0 || d > time.Second {
+		t.Fatalf("zero value is %v away from the real time", d)
+	}
+
+	instant := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.Freeze()
+	c.Set(instant)
+	if !c.Now().Equal(instant) {
+		t.Errorf("Now() = %v, want %v", c.Now(), instant)
+	}
+	c.Advance(90 * time.Second)
+	if want := instant.Add(90 * time.Second); !c.Now().Equal(want) {
+		t.Errorf("Now() = %v, want %v", c.Now(), want)
+	}
+	if state := c.State(); !state.Frozen || !state.Now.Equal(instant.Add(90*time.Second)) {
+		t.Errorf("State() = %+v", state)
+	}
+
+	c.Resume()
+	if d := c.Now().Sub(instant.Add(90 * time.Second)); d < 0 || d > time.Second {
+		t.Errorf("resumed clock is %v away from the frozen time", d)
+	}
+
+	c.Reset()
+	if d := time.Since(c.Now()); d < 0 || d > time.Second {
+		t.Errorf("reset clock is %v away from the real time", d)
+	}
+}
@@ -0,0 +1,374 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DataFileExtensions are the file extensions of data files, the format is selected by the extension
+var DataFileExtensions = []string{".json", ".yaml", ".yml"}
+
+// DataFiles lists the files of a data file setting in the order they are merged. The setting is
+// a comma separated list of files and directories, a directory (e.g. conf.d) contributes
+// its data files sorted by name, hidden files and subdirectories are skipped.
+func DataFiles(setting string) ([]string, error) {
+	var files []string
+	for _, entry := range strings.Split(setting, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		info, err := os.Stat(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, entry)
+			continue
+		}
+		dirEntries, err := os.ReadDir(entry)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(dirEntries))
+		for _, dirEntry := range dirEntries {
+			name := dirEntry.Name()
+			if dirEntry.IsDir() || strings.HasPrefix(name, ".") || !isDataFile(name) {
+				continue
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			files = append(files, filepath.Join(entry, name))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no data files in '%s'", setting)
+	}
+	return files, nil
+}
+
+// DataFileBaseDir is the directory all relative references of the data files (realm files and ${file:...})
+// start from: the first directory of the setting or the directory of its first file
+func DataFileBaseDir(setting string) string {
+	first, _, _ := strings.Cut(setting, ",")
+	first = strings.TrimSpace(first)
+	if info, err := os.Stat(first); err == nil && info.IsDir() {
+		return first
+	}
+	return filepath.Dir(first)
+}
+
+// ReadDataFile reads the files of a data file setting (see DataFiles) and returns them as one JSON document.
+// Every file is decoded by its extension and interpolated (see Interpolate) with file references relative
+// to baseDir, then the files are merged: objects are merged key by key, any other value of a later file
+// replaces the earlier one.
+func ReadDataFile(setting string, baseDir string) ([]byte, error) {
+	files, err := DataFiles(setting)
+	if err != nil {
+		return nil, err
+	}
+	var merged any
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		value, err := DecodeDataFile(file, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if value, err = Interpolate(value, baseDir); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		merged = Merge(merged, value)
+	}
+	return json.Marshal(merged)
+}
+
+func isDataFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, candidate := range DataFileExtensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodeDataFile decodes a JSON or YAML (.yaml, .yml) data file into JSON values,
+// numbers are decoded as json.Number
+func DecodeDataFile(filename string, data []byte) (any, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		if len(node.Content) == 0 {
+			// e.g. a conf.d file with comments only
+			return map[string]any{}, nil
+		}
+		return YAMLValue(node.Content[0])
+	default:
+		if err := json.Unmarshal(data, new(any)); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return nil, fmt.Errorf("line %d: %w", 1+bytes.Count(data[:syntaxErr.Offset], []byte("\n")), err)
+			}
+			return nil, err
+		}
+		var value any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err := dec.Decode(&value)
+		return value, err
+	}
+}
+
+// YAMLValue converts a YAML node into the JSON value it stands for, aliases and merge keys (<<) are resolved
+func YAMLValue(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return YAMLValue(node.Alias)
+	case yaml.SequenceNode:
+		items := make([]any, 0, len(node.Content))
+		for _, child := range node.Content {
+			item, err := YAMLValue(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		object := make(map[string]any, len(node.Content)/2)
+		var merges []*yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				merges = append(merges, value)
+				continue
+			}
+			item, err := YAMLValue(value)
+			if err != nil {
+				return nil, err
+			}
+			object[key.Value] = item
+		}
+		// explicit keys win over merged ones
+		for _, merge := range merges {
+			if merge.Kind == yaml.AliasNode {
+				merge = merge.Alias
+			}
+			sources := []*yaml.Node{merge}
+			if merge.Kind == yaml.SequenceNode {
+				sources = merge.Content
+			}
+			for _, source := range sources {
+				value, err := YAMLValue(source)
+				if err != nil {
+					return nil, err
+				}
+				mapping, ok := value.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("line %d: merge (<<) needs a mapping", merge.Line)
+				}
+				for key, item := range mapping {
+					if _, ok := object[key]; !ok {
+						object[key] = item
+					}
+				}
+			}
+		}
+		return object, nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return nil, nil
+		case "!!bool":
+			var value bool
+			err := node.Decode(&value)
+			return value, err
+		case "!!int":
+			var value int64
+			if err := node.Decode(&value); err != nil {
+				return nil, err
+			}
+			return json.Number(strconv.FormatInt(value, 10)), nil
+		case "!!float":
+			var value float64
+			if err := node.Decode(&value); err != nil {
+				return nil, err
+			}
+			if math.IsInf(value, 0) || math.IsNaN(value) {
+				return nil, fmt.Errorf("line %d: %s is not a JSON number", node.Line, node.Value)
+			}
+			return json.Number(strconv.FormatFloat(value, 'f', -1, 64)), nil
+		}
+		if node.Style == 0 && isReference(node.Value) {
+			return PlainReference(node.Value), nil
+		}
+		return node.Value, nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML node", node.Line)
+}
+
+// PlainReference is a plain (unquoted) YAML scalar which consists of exactly one reference (see Expand),
+// e.g. ttlSeconds: ${TTL}. Interpolated it takes the type of its expanded value like a literal YAML scalar
+// would (a number, a bool or null), quoted scalars and JSON strings stay strings.
+type PlainReference string
+
+// Value returns the value of the expanded reference
+func (r PlainReference) Value(baseDir string) (any, error) {
+	expanded, err := Expand(string(r), baseDir)
+	if err != nil {
+		return nil, err
+	}
+	value, err := YAMLValue(&yaml.Node{Kind: yaml.ScalarNode, Value: expanded})
+	if err != nil {
+		// e.g. .inf, not a JSON number
+		return expanded, nil
+	}
+	if value, ok := value.(PlainReference); ok {
+		// the expanded value is not expanded again
+		return string(value), nil
+	}
+	return value, nil
+}
+
+// isReference tells whether s consists of exactly one reference
+func isReference(s string) bool {
+	return strings.HasPrefix(s, "${") && strings.IndexByte(s, '}') == len(s)-1
+}
+
+// Merge merges src into dst: objects are merged key by key, any other value of src replaces dst
+func Merge(dst, src any) any {
+	dstObject, ok := dst.(map[string]any)
+	srcObject, ok2 := src.(map[string]any)
+	if !ok || !ok2 {
+		return src
+	}
+	for key, value := range srcObject {
+		dstObject[key] = Merge(dstObject[key], value)
+	}
+	return dstObject
+}
+
+// Interpolate replaces the references in the string values of a decoded data file (see Expand and
+// PlainReference), relative file references start from baseDir. The error names the path of the failing value.
+func Interpolate(value any, baseDir string) (any, error) {
+	return interpolate(value, baseDir, "")
+}
+
+func interpolate(value any, baseDir string, path string) (any, error) {
+	switch value := value.(type) {
+	case string:
+		expanded, err := Expand(value, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return expanded, nil
+	case PlainReference:
+		expanded, err := value.Value(baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return expanded, nil
+	case []any:
+		for i, item := range value {
+			expanded, err := interpolate(item, baseDir, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			value[i] = expanded
+		}
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			item := value[key]
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			expanded, err := interpolate(item, baseDir, childPath)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = expanded
+		}
+	}
+	return value, nil
+}
+
+// Expand replaces the references of a string value:
+//   - ${NAME} the environment variable NAME, an error when it is not set
+//   - ${NAME:-default} the environment variable NAME, default when it is not set or empty
+//   - ${file:path} the content of the file (without trailing newlines), relative to baseDir
+//   - $${ a literal ${
+func Expand(s string, baseDir string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		if start > 0 && s[start-1] == '$' {
+			sb.WriteString(s[:start-1] + "${")
+			s = s[start+2:]
+			continue
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference in '%s'", s)
+		}
+		sb.WriteString(s[:start])
+		value, err := resolveReference(s[start+2:start+end], baseDir)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(value)
+		s = s[start+end+1:]
+	}
+}
+
+func resolveReference(reference string, baseDir string) (string, error) {
+	if path, ok := strings.CutPrefix(reference, "file:"); ok {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	name, fallback, hasFallback := strings.Cut(reference, ":-")
+	if name == "" {
+		return "", fmt.Errorf("invalid reference '${%s}'", reference)
+	}
+	value, ok := os.LookupEnv(name)
+	if hasFallback && value == "" {
+		return fallback, nil
+	}
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AXES_TEST_SET", "value")
+	t.Setenv("AXES_TEST_EMPTY", "")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${AXES_TEST_SET}", "value"},
+		{"a-${AXES_TEST_SET}-${AXES_TEST_SET}", "a-value-value"},
+		{"${AXES_TEST_UNSET:-fallback}", "fallback"},
+		{"${AXES_TEST_EMPTY:-fallback}", "fallback"},
+		{"${AXES_TEST_SET:-fallback}", "value"},
+		{"${file:secret}", "s3cret"},
+		{"$${AXES_TEST_SET}", "${AXES_TEST_SET}"},
+	}
+	for _, tt := range tests {
+		got, err := Expand(tt.in, dir)
+		if err != nil || got != tt.want {
+			t.Errorf("Expand(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"${AXES_TEST_UNSET}", "${AXES_TEST_SET", "${}", "${file:missing}"} {
+		if _, err := Expand(in, dir); err == nil {
+			t.Errorf("Expand(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestReadDataFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.yaml":              "x-memory: &memory\n  provider: memory\nsession: *memory\nauthorization:\n  <<: *memory\n  authorizationCodeLength: 16\nclients:\n  ACME:\n    client_secret: ${AXES_TEST_SECRET:-none}\n    scopes: [openid]\n",
+		"conf.d/20-users.json":   `{"clients": {"ACME": {"scopes": ["email"]}}, "users": {"provider": "json"}}`,
+		"conf.d/10-clients.yml":  "clients:\n  ACME:\n    redirect_uri: http://localhost/*\n  TEST:\n    enabled: true\n    client_secret: ${file:secrets/test}\n",
+		"secrets/test":           "t3st\n",
+		"conf.d/.hidden.json":    `{"broken"`,
+		"conf.d/README.md":       "not a data file",
+		"conf.d/nested/x.json":   `{"broken"`,
+		"conf.d/30-comments.yml": "# nothing yet\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setting := filepath.Join(dir, "base.yaml") + ", " + filepath.Join(dir, "conf.d")
+
+	names, err := DataFiles(setting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"base.yaml", "conf.d/10-clients.yml", "conf.d/20-users.json", "conf.d/30-comments.yml"}
+	for i := range names {
+		names[i], _ = filepath.Rel(dir, names[i])
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("DataFiles() = %v, want %v", names, want)
+	}
+	if got := DataFileBaseDir(setting); got != dir {
+		t.Errorf("DataFileBaseDir() = %q, want %q", got, dir)
+	}
+
+	// file references of all data files start from the base directory, not from the directory of the file
+	data, err := ReadDataFile(setting, DataFileBaseDir(setting))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantData := `{"authorization":{"authorizationCodeLength":16,"provider":"memory"},` +
+		`"clients":{"ACME":{"client_secret":"none","redirect_uri":"http://localhost/*","scopes":["email"]},"TEST":{"client_secret":"t3st","enabled":true}},` +
+		`"session":{"provider":"memory"},"users":{"provider":"json"},"x-memory":{"provider":"memory"}}`
+	if string(data) != wantData {
+		t.Errorf("ReadDataFile() =\n%s\nwant\n%s", data, wantData)
+	}
+
+	empty := t.TempDir()
+	if _, err := DataFiles(empty + ",,"); err == nil {
+		t.Error("DataFiles() of a directory without data files succeeded, want an error")
+	}
+}
+
+func TestInterpolatePlainReference(t *testing.T) {
+	t.Setenv("AXES_TEST_TTL", "300")
+	t.Setenv("AXES_TEST_BOOL", "false")
+	t.Setenv("AXES_TEST_SECRET", "1234")
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": "ttl: ${AXES_TEST_TTL}\nenabled: ${AXES_TEST_BOOL}\nfallback: ${AXES_TEST_UNSET:-1.5}\n" +
+			"quoted: \"${AXES_TEST_SECRET}\"\nmixed: ${AXES_TEST_TTL}s\nnested: ${AXES_TEST_NESTED}\n",
+		"config.json": `{"ttl": "${AXES_TEST_TTL}"}`,
+	}
+	t.Setenv("AXES_TEST_NESTED", "${AXES_TEST_TTL}")
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a plain YAML scalar takes the type of the expanded value, quoted and JSON strings stay strings
+	tests := map[string]string{
+		"config.yaml": `{"enabled":false,"fallback":1.5,"mixed":"300s","nested":"${AXES_TEST_TTL}","quoted":"1234","ttl":300}`,
+		"config.json": `{"ttl":"300"}`,
+	}
+	for name, want := range tests {
+		data, err := ReadDataFile(filepath.Join(dir, name), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("ReadDataFile(%s) = %s, want %s", name, data, want)
+		}
+	}
+}
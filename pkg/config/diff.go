@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff lists the paths (e.g. clients.ACME.redirect_uri) added (+), removed (-) or changed (~)
+// between two JSON documents. Values are left out as they may be secrets. When either document
+// is no valid JSON the numbers of the changed lines are listed instead.
+func Diff(previous []byte, current []byte) []string {
+	var previousDoc, currentDoc any
+	if json.Unmarshal(previous, &previousDoc) != nil || json.Unmarshal(current, &currentDoc) != nil {
+		return diffLines(previous, current)
+	}
+	changes := []string{}
+	diffValues("", previousDoc, currentDoc, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i][2:] < changes[j][2:] })
+	return changes
+}
+
+func diffValues(path string, previous any, current any, changes *[]string) {
+	previousObject, previousIsObject := previous.(map[string]any)
+	currentObject, currentIsObject := current.(map[string]any)
+	if !previousIsObject || !currentIsObject {
+		if !reflect.DeepEqual(previous, current) {
+			*changes = append(*changes, "~ "+diffPath(path))
+		}
+		return
+	}
+	for key, previousValue := range previousObject {
+		currentValue, ok := currentObject[key]
+		if !ok {
+			*changes = append(*changes, "- "+joinPath(path, key))
+			continue
+		}
+		diffValues(joinPath(path, key), previousValue, currentValue, changes)
+	}
+	for key := range currentObject {
+		if _, ok := previousObject[key]; !ok {
+			*changes = append(*changes, "+ "+joinPath(path, key))
+		}
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func diffPath(path string) string {
+	if path == "" {
+		return "(document)"
+	}
+	return path
+}
+
+func diffLines(previous []byte, current []byte) []string {
+	previousLines := strings.Split(string(previous), "\n")
+	currentLines := strings.Split(string(current), "\n")
+	changes := []string{}
+	for i := 0; i < max(len(previousLines), len(currentLines)); i++ {
+		switch {
+		case i >= len(previousLines):
+			changes = append(changes, fmt.Sprintf("+ line %d", i+1))
+		case i >= len(currentLines):
+			changes = append(changes, fmt.Sprintf("- line %d", i+1))
+		case previousLines[i] != currentLines[i]:
+			changes = append(changes, fmt.Sprintf("~ line %d", i+1))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	previous := []byte(`{"clients": {"ACME": {"client_secret": "a", "redirect_uri": "x"}, "OLD": {}}, "users": {"provider": "json"}}`)
+	current := []byte(`{"clients": {"ACME": {"client_secret": "b", "redirect_uri": "x"}, "NEW": {}}, "users": {"provider": "json"}}`)
+
+	want := []string{"~ clients.ACME.client_secret", "+ clients.NEW", "- clients.OLD"}
+	if got := Diff(previous, current); !slices.Equal(got, want) {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+	if got := Diff(previous, previous); len(got) != 0 {
+		t.Errorf("Diff() of equal documents = %v", got)
+	}
+	if got := Diff([]byte("{\n}"), []byte("{\n,\n}")); !slices.Equal(got, []string{"~ line 2", "+ line 3"}) {
+		t.Errorf("Diff() of invalid JSON = %v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Watch calls onChange whenever the content of the data files of the setting (see DataFiles) changes and
+// whenever the process receives SIGHUP, until ctx is done. The files are polled every interval (zero only
+// listens for SIGHUP), their names, modification times and sizes are checked first and their hash only
+// when they differ. Files added to or removed from a conf.d directory count as a change.
+func Watch(ctx context.Context, setting string, interval time.Duration, onChange func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	stamp, _ := filesStamp(setting)
+	hash := filesHash(setting)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			slog.Info("SIGHUP received", "file", setting)
+			stamp, _ = filesStamp(setting)
+			hash = filesHash(setting)
+			onChange()
+		case <-tick:
+			current, err := filesStamp(setting)
+			if err != nil || current == stamp {
+				continue
+			}
+			stamp = current
+			if currentHash := filesHash(setting); !bytes.Equal(currentHash, hash) {
+				hash = currentHash
+				slog.Info("file changed", "file", setting)
+				onChange()
+			}
+		}
+	}
+}
+
+// filesStamp describes the names, modification times and sizes of the data files
+func filesStamp(setting string) (string, error) {
+	files, err := DataFiles(setting)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "%s %d %d\n", file, info.ModTime().UnixNano(), info.Size())
+	}
+	return sb.String(), nil
+}
+
+// filesHash hashes the names and contents of the data files
+func filesHash(setting string) []byte {
+	files, err := DataFiles(setting)
+	if err != nil {
+		return nil
+	}
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s %d\n", file, len(data))
+		h.Write(data)
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "10-base.json")
+	if err := os.WriteFile(file, []byte(`{"clients": {}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changed := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, dir, 10*time.Millisecond, func() { changed <- struct{}{} })
+		close(done)
+	}()
+
+	// the content is unchanged, a new modification time alone is not a change
+	time.Sleep(50 * time.Millisecond)
+	if err := os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-changed:
+		t.Fatal("Watch() reported a change of the modification time only")
+	default:
+	}
+
+	if err := os.WriteFile(file, []byte(`{"clients": {"ACME": {}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch() did not report the changed content")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "20-extra.json"), []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch() did not report the added file")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch() did not return when the context was done")
+	}
+}
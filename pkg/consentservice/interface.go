@@ -1,10 +1,16 @@
 package consentservice
 
 import (
+	"fmt"
+
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
 
+// ErrUndefinedScope is the kind of the errors of scopes missing in the consents.scopes section, it is an invalid argument
+var ErrUndefinedScope = fmt.Errorf("undefined scope: %w", errs.ErrInvalidArgument)
+
 type Entity interface {
 	GetScope() string
 	IsGranted() bool
@@ -16,8 +22,22 @@ type Entity interface {
 	SetState(bool) error
 }
 
+// Scope is the definition of a scope in the consents.scopes section of the config
+type Scope struct {
+	RequireConsent bool `json:"requireConsent"`
+}
+
 type Service interface {
 	GetConsents(user userservice.Entity, client clientservice.Entity, scopes []string) (map[string]Entity, error)
 	SaveConsents(user userservice.Entity, client clientservice.Entity, consents []Entity) error
 	ClearConsents(user userservice.Entity, client clientservice.Entity) error
+
+	// runtime management (admin API)
+	GetScopes() map[string]Scope
+	PutScope(name string, scope Scope) error
+	DeleteScope(name string) error
+	// GetUserConsents returns the consent states of the user by scope
+	GetUserConsents(username string) map[string]bool
+	PutUserConsents(username string, consents map[string]bool) error
+	DeleteUserConsents(username string) error
 }
@@ -4,10 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
 	"sync"
 
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
-	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
 
@@ -25,14 +26,13 @@ type jsonConsentServiceConfig struct {
 	} `json:"consents"`
 }
 
-type jsonConsentServiceScopeMeta struct {
-	requireConsent bool
-}
-
 type jsonConsentService struct {
+	configConsents map[string]map[string]bool // consents of the config, the service returns to them on Reset
 	userConsents   map[string]map[string]bool
+	changedUsers   map[string]bool // users whose consents were given, revoked or replaced at runtime
 	userConsentsMU sync.RWMutex
-	scopes         map[string]jsonConsentServiceScopeMeta
+	scopes         map[string]Scope
+	changedScopes  map[string]bool // scopes defined, replaced or deleted at runtime
 	scopesMU       sync.RWMutex
 }
 
@@ -40,8 +40,10 @@ func NewJSONConsentsService(rawConsentsConfig json.RawMessage, rawConfig json.Ra
 	slog.Info("claimservice factory NewJSONConsentsService started")
 	config := jsonConsentServiceConfig{}
 	service := &jsonConsentService{
-		userConsents: make(map[string]map[string]bool),
-		scopes:       make(map[string]jsonConsentServiceScopeMeta),
+		userConsents:  make(map[string]map[string]bool),
+		changedUsers:  make(map[string]bool),
+		scopes:        make(map[string]Scope),
+		changedScopes: make(map[string]bool),
 	}
 
 	if err := json.Unmarshal(rawConfig, &config); err != nil {
@@ -50,18 +52,18 @@ func NewJSONConsentsService(rawConsentsConfig json.RawMessage, rawConfig json.Ra
 
 	service.userConsentsMU.Lock()
 	defer service.userConsentsMU.Unlock()
+	service.configConsents = make(map[string]map[string]bool)
 	for username, userData := range config.UsersWrapper.Users {
-		service.userConsents[username] = userData.Consents
+		service.configConsents[username] = userData.Consents
 	}
+	service.userConsents = copyConsents(service.configConsents)
 
 	service.scopesMU.Lock()
 	defer service.scopesMU.Unlock()
 	for scope, meta := range config.Consents.Scopes {
-		service.scopes[scope] = jsonConsentServiceScopeMeta{requireConsent: meta.RequireConsent}
+		service.scopes[scope] = Scope{RequireConsent: meta.RequireConsent}
 	}
 
-	di.Register(service)
-
 	return service, nil
 }
 
@@ -78,12 +80,16 @@ func (s *jsonConsentService) getUserConsentState(username string, scope string)
 func (s *jsonConsentService) GetConsents(user userservice.Entity, client clientservice.Entity, scopes []string) (map[string]Entity, error) {
 	consents := make(map[string]Entity)
 	username := user.Id()
+	s.userConsentsMU.RLock()
+	defer s.userConsentsMU.RUnlock()
+	s.scopesMU.RLock()
+	defer s.scopesMU.RUnlock()
 
 	for _, scope := range scopes {
 		if _, ok := s.scopes[scope]; !ok {
-			return consents, fmt.Errorf("undefined scope %s", scope)
+			return consents, errs.New(fmt.Sprintf("undefined scope %s", scope), ErrUndefinedScope)
 		}
-		consent, err := NewConsent(scope, WithRequired(s.scopes[scope].requireConsent))
+		consent, err := NewConsent(scope, WithRequired(s.scopes[scope].RequireConsent))
 		if err != nil {
 			return consents, fmt.Errorf("could not initialize consent for scope %s: %w", scope, err)
 		}
@@ -98,6 +104,10 @@ func (s *jsonConsentService) GetConsents(user userservice.Entity, client clients
 
 func (s *jsonConsentService) SaveConsents(user userservice.Entity, client clientservice.Entity, consents []Entity) error {
 	username := user.Id()
+	s.userConsentsMU.Lock()
+	defer s.userConsentsMU.Unlock()
+	s.scopesMU.RLock()
+	defer s.scopesMU.RUnlock()
 	if _, ok := s.userConsents[username]; !ok {
 		s.userConsents[username] = make(map[string]bool)
 	}
@@ -107,14 +117,172 @@ func (s *jsonConsentService) SaveConsents(user userservice.Entity, client client
 		}
 		s.userConsents[username][consent.GetScope()] = consent.IsGranted()
 	}
+	s.changedUsers[username] = true
 	return nil
 }
 func (s *jsonConsentService) ClearConsents(user userservice.Entity, client clientservice.Entity) error {
 	username := user.Id()
+	s.userConsentsMU.Lock()
+	defer s.userConsentsMU.Unlock()
 	s.userConsents[username] = make(map[string]bool)
+	s.changedUsers[username] = true
+	return nil
+}
+
+func (s *jsonConsentService) GetScopes() map[string]Scope {
+	s.scopesMU.RLock()
+	defer s.scopesMU.RUnlock()
+	scopes := make(map[string]Scope, len(s.scopes))
+	for name, scope := range s.scopes {
+		scopes[name] = scope
+	}
+	return scopes
+}
+
+// PutScope adds or replaces the definition of the scope
+func (s *jsonConsentService) PutScope(name string, scope Scope) error {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return errs.New(fmt.Sprintf("invalid scope name '%s'", name), errs.ErrInvalidArgument)
+	}
+	s.scopesMU.Lock()
+	defer s.scopesMU.Unlock()
+	s.scopes[name] = scope
+	s.changedScopes[name] = true
+	return nil
+}
+
+// DeleteScope removes the definition of the scope, requests for it are rejected afterwards
+func (s *jsonConsentService) DeleteScope(name string) error {
+	s.scopesMU.Lock()
+	defer s.scopesMU.Unlock()
+	if _, ok := s.scopes[name]; !ok {
+		return errs.New(fmt.Sprintf("undefined scope %s", name), errs.ErrNotFound)
+	}
+	delete(s.scopes, name)
+	s.changedScopes[name] = true
+	return nil
+}
+
+func (s *jsonConsentService) GetUserConsents(username string) map[string]bool {
+	s.userConsentsMU.RLock()
+	defer s.userConsentsMU.RUnlock()
+	consents := make(map[string]bool, len(s.userConsents[username]))
+	for scope, granted := range s.userConsents[username] {
+		consents[scope] = granted
+	}
+	return consents
+}
+
+// PutUserConsents replaces the consents of the user, all scopes must be defined
+func (s *jsonConsentService) PutUserConsents(username string, consents map[string]bool) error {
+	s.scopesMU.RLock()
+	for scope := range consents {
+		if _, ok := s.scopes[scope]; !ok {
+			s.scopesMU.RUnlock()
+			return errs.New(fmt.Sprintf("scope %s is not defined", scope), errs.ErrInvalidArgument)
+		}
+	}
+	s.scopesMU.RUnlock()
+
+	userConsents := make(map[string]bool, len(consents))
+	for scope, granted := range consents {
+		userConsents[scope] = granted
+	}
+	s.userConsentsMU.Lock()
+	defer s.userConsentsMU.Unlock()
+	s.userConsents[username] = userConsents
+	s.changedUsers[username] = true
 	return nil
 }
 
+func (s *jsonConsentService) DeleteUserConsents(username string) error {
+	s.userConsentsMU.Lock()
+	defer s.userConsentsMU.Unlock()
+	delete(s.userConsents, username)
+	s.changedUsers[username] = true
+	return nil
+}
+
+// KeepRuntimeChanges carries the scopes and the consents of users changed at runtime over from
+// previous (the service of the config before a reload), they win over the config
+func (s *jsonConsentService) KeepRuntimeChanges(previous Service) {
+	p, ok := previous.(*jsonConsentService)
+	if !ok || p == s {
+		return
+	}
+	p.scopesMU.RLock()
+	s.scopesMU.Lock()
+	for name := range p.changedScopes {
+		if scope, ok := p.scopes[name]; ok {
+			s.scopes[name] = scope
+		} else {
+			delete(s.scopes, name)
+		}
+		s.changedScopes[name] = true
+	}
+	s.scopesMU.Unlock()
+	p.scopesMU.RUnlock()
+
+	p.userConsentsMU.RLock()
+	defer p.userConsentsMU.RUnlock()
+	s.userConsentsMU.Lock()
+	defer s.userConsentsMU.Unlock()
+	for username := range p.changedUsers {
+		if consents, ok := p.userConsents[username]; ok {
+			s.userConsents[username] = consents
+		} else {
+			delete(s.userConsents, username)
+		}
+		s.changedUsers[username] = true
+	}
+}
+
+// Reset drops the consents given or revoked at runtime
+func (s *jsonConsentService) Reset() error {
+	s.userConsentsMU.Lock()
+	defer s.userConsentsMU.Unlock()
+	s.userConsents = copyConsents(s.configConsents)
+	s.changedUsers = make(map[string]bool)
+	return nil
+}
+
+// Snapshot returns the consent states by username and scope
+func (s *jsonConsentService) Snapshot() (json.RawMessage, error) {
+	s.userConsentsMU.RLock()
+	defer s.userConsentsMU.RUnlock()
+	return json.Marshal(s.userConsents)
+}
+
+func (s *jsonConsentService) Restore(rawSnapshot json.RawMessage) (func(), error) {
+	userConsents := make(map[string]map[string]bool)
+	if err := json.Unmarshal(rawSnapshot, &userConsents); err != nil {
+		return nil, errs.New("invalid consents snapshot", errs.ErrInvalidArgument).WithDetails(err.Error())
+	}
+	return func() {
+		s.userConsentsMU.Lock()
+		defer s.userConsentsMU.Unlock()
+		// the restored consents replace the current ones, all of them are runtime state now
+		for username := range s.userConsents {
+			s.changedUsers[username] = true
+		}
+		for username := range userConsents {
+			s.changedUsers[username] = true
+		}
+		s.userConsents = userConsents
+	}, nil
+}
+
+func copyConsents(consents map[string]map[string]bool) map[string]map[string]bool {
+	copied := make(map[string]map[string]bool, len(consents))
+	for username, scopes := range consents {
+		copied[username] = make(map[string]bool, len(scopes))
+		for scope, granted := range scopes {
+			copied[username][scope] = granted
+		}
+	}
+	return copied
+}
+
 func init() {
 	Register("json", NewJSONConsentsService)
 }
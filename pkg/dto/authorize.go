@@ -12,4 +12,13 @@ type AuthorizeRequestDTO struct {
 	Scope        string `queryParam:"scope"`
 	State        string `queryParam:"state"`
 	Nonce        string `queryParam:"nonce"`
+	Request      string `queryParam:"request"`
+	RequestURI   string `queryParam:"request_uri"`
+}
+
+type EndSessionRequestDTO struct {
+	IdTokenHint           string `formField:"id_token_hint" queryParam:"id_token_hint"`
+	ClientId              string `formField:"client_id" queryParam:"client_id"`
+	PostLogoutRedirectURI string `formField:"post_logout_redirect_uri" queryParam:"post_logout_redirect_uri"`
+	State                 string `formField:"state" queryParam:"state"`
 }
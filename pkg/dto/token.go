@@ -43,5 +43,27 @@ type TokenPasswrodRequestDTO struct {
 	RedirectURI  string `formField:"redirect_uri"`
 	Username     string `formField:"username"`
 	Password     string `formField:"password"`
+	OTP          string `formField:"otp"`
 	Scope        string `formField:"scope"`
 }
+
+type TokenRefreshTokenRequestDTO struct {
+	GrantType    string `formField:"grant_type" validate:"required"`
+	ClientId     string `formField:"client_id" validate:"required"`
+	ClientSecret string `formField:"client_secret" validate:"required"`
+	RefreshToken string `formField:"refresh_token" validate:"required"`
+	Scope        string `formField:"scope"`
+}
+
+type TokenIntrospectionRequestDTO struct {
+	Token         string `formField:"token" validate:"required"`
+	TokenTypeHint string `formField:"token_type_hint"`
+	ClientId      string `formField:"client_id" validate:"required"`
+	ClientSecret  string `formField:"client_secret" validate:"required"`
+}
+
+// ErrorResponseDTO is the OAuth 2.0 error response (RFC 6749 section 5.2)
+type ErrorResponseDTO struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
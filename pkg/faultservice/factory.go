@@ -0,0 +1,58 @@
+package faultservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+type FaultServiceFactory func(json.RawMessage) (Service, error)
+
+var (
+	faultServiceFactoryRegistryMU sync.RWMutex
+	faultServiceFactoryRegistry   = map[string]FaultServiceFactory{}
+)
+
+func Register(name string, f FaultServiceFactory) {
+	faultServiceFactoryRegistryMU.Lock()
+	defer faultServiceFactoryRegistryMU.Unlock()
+	faultServiceFactoryRegistry[name] = f
+}
+
+type Config struct {
+	FaultsConfig json.RawMessage `json:"faults"`
+}
+
+// NewFromConfig initializes the fault injection rules of the faults section,
+// a missing section yields an in-memory service without rules
+func NewFromConfig(rawConfig []byte) (Service, error) {
+	slog.Info("init started", "module", "faultservice")
+	config := Config{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, errors.New("failed to unmarshal config")
+	}
+
+	provider := "memory"
+	if config.FaultsConfig != nil {
+		var faultsConfig map[string]json.RawMessage
+		if err := json.Unmarshal(config.FaultsConfig, &faultsConfig); err != nil {
+			return nil, errors.New("failed to parse faults config")
+		}
+		if providerRaw, ok := faultsConfig["provider"]; ok {
+			if err := json.Unmarshal(providerRaw, &provider); err != nil {
+				return nil, errors.New("invalid faults.provider")
+			}
+		}
+	}
+
+	faultServiceFactoryRegistryMU.RLock()
+	factory, ok := faultServiceFactoryRegistry[provider]
+	faultServiceFactoryRegistryMU.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown fault service provider: %s", provider)
+	}
+
+	return factory(config.FaultsConfig)
+}
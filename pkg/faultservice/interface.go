@@ -0,0 +1,129 @@
+package faultservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+)
+
+// Rule injects a fault into the requests it matches. Empty selectors match any request,
+// the fault is injected into Percentage percent of the matching requests.
+type Rule struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+
+	// selectors
+	Path       string  `json:"path,omitempty"` // endpoint path below the realm, may contain wildcards (path.Match)
+	Method     string  `json:"method,omitempty"`
+	ClientId   string  `json:"clientId,omitempty"`
+	User       string  `json:"user,omitempty"`
+	Percentage float64 `json:"percentage"`
+
+	// faults, the latency is added before any other fault (or the regular response)
+	LatencyMs        int    `json:"latencyMs,omitempty"`
+	Status           int    `json:"status,omitempty"`
+	Error            string `json:"error,omitempty"` // OAuth error code
+	ErrorDescription string `json:"errorDescription,omitempty"`
+	Drop             bool   `json:"drop,omitempty"`          // close the connection without a response
+	MalformedJSON    bool   `json:"malformedJson,omitempty"` // truncated JSON body
+}
+
+// Request is what the rules are matched against
+type Request struct {
+	Path     string
+	Method   string
+	ClientId string
+	User     string
+}
+
+// RuleSet is the faults section (without the provider), it is also used to replace the rules at runtime
+type RuleSet struct {
+	Enabled bool   `json:"enabled"`
+	Rules   []Rule `json:"rules"`
+}
+
+type Service interface {
+	// Enabled tells whether faults are injected at all (chaos mode)
+	Enabled() bool
+	SetEnabled(enabled bool)
+
+	GetRules() []Rule
+	// PutRule adds the rule or replaces the one with the same name
+	PutRule(rule Rule) error
+	DeleteRule(name string) error
+	SetRuleEnabled(name string, enabled bool) error
+	// SetRules replaces all rules
+	SetRules(rules []Rule) error
+
+	// Match returns the first enabled rule which matches the request and wins the dice roll
+	Match(request Request) (Rule, bool)
+}
+
+// UnmarshalJSON applies the defaults of omitted fields, rules are enabled and always injected
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	rule := plain{Enabled: true, Percentage: 100}
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return err
+	}
+	*r = Rule(rule)
+	return nil
+}
+
+// UnmarshalJSON applies the defaults of omitted fields, the configured rules are active
+func (s *RuleSet) UnmarshalJSON(data []byte) error {
+	type plain RuleSet
+	config := plain{Enabled: true}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	*s = RuleSet(config)
+	return nil
+}
+
+// Validate checks the rule is usable
+func (r Rule) Validate() error {
+	invalid := func(reason string) error {
+		return errs.New(fmt.Sprintf("rule '%s': %s", r.Name, reason), errs.ErrInvalidArgument)
+	}
+	if r.Name == "" {
+		return errs.New("rule without name", errs.ErrInvalidArgument)
+	}
+	if _, err := path.Match(r.Path, ""); err != nil {
+		return invalid("invalid path pattern")
+	}
+	if r.Percentage < 0 || r.Percentage > 100 {
+		return invalid("percentage must be between 0 and 100")
+	}
+	if r.LatencyMs < 0 {
+		return invalid("negative latencyMs")
+	}
+	if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+		return invalid("invalid status")
+	}
+	if r.LatencyMs == 0 && r.Status == 0 && r.Error == "" && !r.Drop && !r.MalformedJSON {
+		return invalid("no fault")
+	}
+	return nil
+}
+
+func (r Rule) matches(request Request) bool {
+	if r.Path != "" {
+		if matched, _ := path.Match(r.Path, request.Path); !matched {
+			return false
+		}
+	}
+	if r.Method != "" && !strings.EqualFold(r.Method, request.Method) {
+		return false
+	}
+	if r.ClientId != "" && r.ClientId != request.ClientId {
+		return false
+	}
+	if r.User != "" && r.User != request.User {
+		return false
+	}
+	return true
+}
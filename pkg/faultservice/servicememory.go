@@ -0,0 +1,184 @@
+package faultservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+)
+
+// memoryFaultService keeps the rules in memory, rules changed at runtime are lost on restart
+type memoryFaultService struct {
+	rulesMU sync.RWMutex
+	enabled bool
+	rules   []Rule
+
+	// changes at runtime, a reload keeps them
+	enabledChanged bool
+	rulesReplaced  bool
+	changedRules   map[string]bool
+
+	// roll returns a number in [0, 100), the rule is injected when it is below the percentage
+	roll func() float64
+}
+
+func NewMemoryFaultService(rawConfig json.RawMessage) (Service, error) {
+	service := &memoryFaultService{
+		enabled:      true,
+		changedRules: make(map[string]bool),
+		roll:         func() float64 { return rand.Float64() * 100 },
+	}
+	if rawConfig == nil {
+		return service, nil
+	}
+
+	config := RuleSet{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal faults config: %w", err)
+	}
+	if err := validateRules(config.Rules); err != nil {
+		return nil, err
+	}
+	service.rules = config.Rules
+	service.enabled = config.Enabled
+	return service, nil
+}
+
+func (s *memoryFaultService) Enabled() bool {
+	s.rulesMU.RLock()
+	defer s.rulesMU.RUnlock()
+	return s.enabled
+}
+
+func (s *memoryFaultService) SetEnabled(enabled bool) {
+	s.rulesMU.Lock()
+	defer s.rulesMU.Unlock()
+	s.enabled = enabled
+	s.enabledChanged = true
+}
+
+func (s *memoryFaultService) GetRules() []Rule {
+	s.rulesMU.RLock()
+	defer s.rulesMU.RUnlock()
+	return append([]Rule{}, s.rules...)
+}
+
+func (s *memoryFaultService) PutRule(rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	s.rulesMU.Lock()
+	defer s.rulesMU.Unlock()
+	s.changedRules[rule.Name] = true
+	s.putRule(rule)
+	return nil
+}
+
+func (s *memoryFaultService) putRule(rule Rule) {
+	for i := range s.rules {
+		if s.rules[i].Name == rule.Name {
+			s.rules[i] = rule
+			return
+		}
+	}
+	s.rules = append(s.rules, rule)
+}
+
+func (s *memoryFaultService) DeleteRule(name string) error {
+	s.rulesMU.Lock()
+	defer s.rulesMU.Unlock()
+	for i := range s.rules {
+		if s.rules[i].Name == name {
+			s.rules = slices.Delete(s.rules, i, i+1)
+			s.changedRules[name] = true
+			return nil
+		}
+	}
+	return errs.New("unknown rule", errs.ErrNotFound).WithDetailsf("rule '%s'", name)
+}
+
+func (s *memoryFaultService) SetRuleEnabled(name string, enabled bool) error {
+	s.rulesMU.Lock()
+	defer s.rulesMU.Unlock()
+	for i := range s.rules {
+		if s.rules[i].Name == name {
+			s.rules[i].Enabled = enabled
+			s.changedRules[name] = true
+			return nil
+		}
+	}
+	return errs.New("unknown rule", errs.ErrNotFound).WithDetailsf("rule '%s'", name)
+}
+
+func (s *memoryFaultService) SetRules(rules []Rule) error {
+	if err := validateRules(rules); err != nil {
+		return err
+	}
+	s.rulesMU.Lock()
+	defer s.rulesMU.Unlock()
+	s.rules = slices.Clone(rules)
+	s.rulesReplaced = true
+	return nil
+}
+
+func validateRules(rules []Rule) error {
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if names[rule.Name] {
+			return errs.New(fmt.Sprintf("duplicate rule '%s'", rule.Name), errs.ErrAlreadyExists)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
+
+// KeepRuntimeChanges carries the switch and the rules changed at runtime over from previous
+// (the service of the config before a reload), they win over the config
+func (s *memoryFaultService) KeepRuntimeChanges(previous Service) {
+	p, ok := previous.(*memoryFaultService)
+	if !ok || p == s {
+		return
+	}
+	p.rulesMU.RLock()
+	defer p.rulesMU.RUnlock()
+	s.rulesMU.Lock()
+	defer s.rulesMU.Unlock()
+	if p.enabledChanged {
+		s.enabled, s.enabledChanged = p.enabled, true
+	}
+	if p.rulesReplaced {
+		s.rules, s.rulesReplaced = slices.Clone(p.rules), true
+	}
+	for name := range p.changedRules {
+		if i := slices.IndexFunc(p.rules, func(rule Rule) bool { return rule.Name == name }); i >= 0 {
+			s.putRule(p.rules[i])
+		} else {
+			s.rules = slices.DeleteFunc(s.rules, func(rule Rule) bool { return rule.Name == name })
+		}
+		s.changedRules[name] = true
+	}
+}
+
+func (s *memoryFaultService) Match(request Request) (Rule, bool) {
+	s.rulesMU.RLock()
+	defer s.rulesMU.RUnlock()
+	if !s.enabled {
+		return Rule{}, false
+	}
+	for _, rule := range s.rules {
+		if rule.Enabled && rule.matches(request) && s.roll() < rule.Percentage {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func init() {
+	Register("memory", NewMemoryFaultService)
+}
@@ -0,0 +1,81 @@
+package faultservice
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+)
+
+func TestMemoryFaultServiceMatch(t *testing.T) {
+	service, err := NewMemoryFaultService([]byte(`{
+		"rules": [
+			{"name": "token-acme", "path": "/token", "clientId": "ACME", "error": "temporarily_unavailable", "status": 503},
+			{"name": "slow-mfa", "path": "/mfa/*", "latencyMs": 100},
+			{"name": "demo-half", "user": "demo", "percentage": 50, "drop": true},
+			{"name": "off", "status": 500, "enabled": false}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("NewMemoryFaultService() error = %v", err)
+	}
+	memory := service.(*memoryFaultService)
+	dice := 75.0
+	memory.roll = func() float64 { return dice }
+
+	tests := []struct {
+		name    string
+		request Request
+		want    string
+	}{
+		{"path and client", Request{Path: "/token", ClientId: "ACME"}, "token-acme"},
+		{"other client", Request{Path: "/token", ClientId: "ACME2"}, ""},
+		{"wildcard path", Request{Path: "/mfa/totp"}, "slow-mfa"},
+		{"percentage lost", Request{Path: "/authorize", User: "demo"}, ""},
+		{"disabled rule", Request{Path: "/userinfo"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := service.Match(tt.request)
+			if ok != (tt.want != "") || rule.Name != tt.want {
+				t.Errorf("Match() = %q, %v, want %q", rule.Name, ok, tt.want)
+			}
+		})
+	}
+
+	dice = 25
+	if rule, ok := service.Match(Request{Path: "/authorize", User: "demo"}); !ok || rule.Name != "demo-half" {
+		t.Errorf("Match() = %q, %v, want demo-half", rule.Name, ok)
+	}
+
+	if err := service.SetRuleEnabled("off", true); err != nil {
+		t.Fatalf("SetRuleEnabled() error = %v", err)
+	}
+	if rule, _ := service.Match(Request{Path: "/userinfo"}); rule.Name != "off" {
+		t.Errorf("Match() = %q, want off", rule.Name)
+	}
+	service.SetEnabled(false)
+	if _, ok := service.Match(Request{Path: "/token", ClientId: "ACME"}); ok {
+		t.Error("Match() injected a fault while disabled")
+	}
+}
+
+func TestMemoryFaultServiceInvalidRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		kind   error
+	}{
+		{"no fault", `{"rules": [{"name": "a", "path": "/token"}]}`, errs.ErrInvalidArgument},
+		{"percentage", `{"rules": [{"name": "a", "status": 500, "percentage": 120}]}`, errs.ErrInvalidArgument},
+		{"path pattern", `{"rules": [{"name": "a", "status": 500, "path": "/[token"}]}`, errs.ErrInvalidArgument},
+		{"duplicate", `{"rules": [{"name": "a", "status": 500}, {"name": "a", "drop": true}]}`, errs.ErrAlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMemoryFaultService([]byte(tt.config)); !errors.Is(err, tt.kind) {
+				t.Errorf("NewMemoryFaultService() error = %v, want %v", err, tt.kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+// errorStatus maps the errs kind of err to the HTTP status of the admin endpoints
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errs.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, errs.ErrInvalidArgument):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func decodeJSONBody(r *http.Request, v any) error {
+	return json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// adminRequestId returns the id query parameter naming the object of an admin request,
+// it is required by all methods but GET (which lists the objects without it)
+func adminRequestId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.URL.Query().Get("id")
+	if id == "" && r.Method != http.MethodGet {
+		http.Error(w, "missing id query parameter", http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
+func logAdminChange(r *http.Request, resource string, id string) {
+	slog.Warn("admin API change", "request", routing.RequestIDLogValue(r), "resource", resource, "method", r.Method, "id", id)
+}
+
+// AdminClientsHandler manages the clients: GET lists them (or returns the one of the id query parameter),
+// PUT adds or replaces the client of the id (the body is its entry of the clients section, the secret
+// of a replaced client is kept when omitted), DELETE removes it. Secrets are never returned.
+func AdminClientsHandler(clientSrv clientservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler AdminClientsHandler started", "request", routing.RequestIDLogValue(r))
+		id, ok := adminRequestId(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			configs := clientSrv.GetClientConfigs()
+			if id == "" {
+				writeJSON(w, http.StatusOK, configs)
+				return
+			}
+			config, ok := configs[id]
+			if !ok {
+				http.Error(w, "client not found", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, config)
+		case http.MethodPut:
+			config := clientservice.ClientConfig{}
+			if err := decodeJSONBody(r, &config); err != nil {
+				http.Error(w, "invalid client", http.StatusBadRequest)
+				return
+			}
+			if err := clientSrv.PutClient(id, config); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "client", id)
+			writeJSON(w, http.StatusOK, clientSrv.GetClientConfigs()[id])
+		case http.MethodDelete:
+			if err := clientSrv.DeleteClient(id); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "client", id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// adminUserDTO is a user of the admin API, like the entries of the users section of the config.
+// The password is write only.
+type adminUserDTO struct {
+	Username   string                            `json:"username"`
+	Password   string                            `json:"password,omitempty"`
+	Active     *bool                             `json:"active,omitempty"` // default true
+	TOTPSecret string                            `json:"totpSecret,omitempty"`
+	Email      string                            `json:"email,omitempty"`
+	Attributes map[string]map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func newAdminUserDTO(user userservice.Entity) adminUserDTO {
+	active := user.Active()
+	return adminUserDTO{
+		Username:   user.Name(),
+		Active:     &active,
+		TOTPSecret: user.TOTPSecret(),
+		Email:      user.Email(),
+		Attributes: user.GetAllAttributes(),
+	}
+}
+
+// saveAdminUser adds the user of the id or replaces it (keeping its password when the DTO has none)
+func saveAdminUser(userSrv userservice.Service, id string, userDTO adminUserDTO) (userservice.Entity, error) {
+	existing, _ := userSrv.GetUser(id)
+
+	var authScheme authentication.SchemeHandler
+	switch {
+	case userDTO.Password != "":
+		var err error
+		if authScheme, err = authentication.NewScheme(authentication.WithUsernameAndPassword(id, userDTO.Password)); err != nil {
+			return nil, err
+		}
+	case existing != nil:
+		authScheme = existing.AuthenticationScheme()
+	default:
+		return nil, errs.New("missing password", errs.ErrInvalidArgument)
+	}
+	active := userDTO.Active == nil || *userDTO.Active
+	options := []userservice.UserHandlerOption{
+		userservice.WithActive(active),
+		userservice.WithTOTPSecret(userDTO.TOTPSecret),
+		userservice.WithEmail(userDTO.Email),
+	}
+	for group, attributes := range userDTO.Attributes {
+		options = append(options, userservice.WithCustomAttributes(group, attributes))
+	}
+	user, err := userservice.NewUserHandler(id, authScheme, options...)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		err = userSrv.UpdateUser(user)
+	} else {
+		err = userSrv.AddUser(user)
+	}
+	return user, err
+}
+
+// AdminUsersHandler manages the users: GET lists them (or returns the one of the id query parameter),
+// PUT adds or replaces the user of the id (the password of a replaced user is kept when omitted),
+// DELETE removes it. Claims and consents of users are managed by AdminClaimsHandler and AdminConsentsHandler.
+func AdminUsersHandler(userSrv userservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler AdminUsersHandler started", "request", routing.RequestIDLogValue(r))
+		id, ok := adminRequestId(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if id != "" {
+				user, err := userSrv.GetUser(id)
+				if err != nil {
+					http.Error(w, "user not found", http.StatusNotFound)
+					return
+				}
+				writeJSON(w, http.StatusOK, newAdminUserDTO(user))
+				return
+			}
+			users, err := userSrv.GetUsers()
+			if err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			sort.Slice(users, func(i, j int) bool { return users[i].Name() < users[j].Name() })
+			userDTOs := make([]adminUserDTO, len(users))
+			for i, user := range users {
+				userDTOs[i] = newAdminUserDTO(user)
+			}
+			writeJSON(w, http.StatusOK, userDTOs)
+		case http.MethodPut:
+			userDTO := adminUserDTO{}
+			if err := decodeJSONBody(r, &userDTO); err != nil {
+				http.Error(w, "invalid user", http.StatusBadRequest)
+				return
+			}
+			if userDTO.Username != "" && userDTO.Username != id {
+				http.Error(w, "username does not match the id", http.StatusBadRequest)
+				return
+			}
+			user, err := saveAdminUser(userSrv, id, userDTO)
+			if err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "user", id)
+			writeJSON(w, http.StatusOK, newAdminUserDTO(user))
+		case http.MethodDelete:
+			if err := userSrv.DeleteUser(id); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "user", id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// AdminScopesHandler manages the scope definitions (the consents.scopes section): GET lists them
+// (or returns the one of the id query parameter), PUT adds or replaces the scope of the id, DELETE removes it
+func AdminScopesHandler(consentSrv consentservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler AdminScopesHandler started", "request", routing.RequestIDLogValue(r))
+		id, ok := adminRequestId(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			scopes := consentSrv.GetScopes()
+			if id == "" {
+				writeJSON(w, http.StatusOK, scopes)
+				return
+			}
+			scope, ok := scopes[id]
+			if !ok {
+				http.Error(w, "scope not found", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, scope)
+		case http.MethodPut:
+			scope := consentservice.Scope{}
+			if err := decodeJSONBody(r, &scope); err != nil {
+				http.Error(w, "invalid scope", http.StatusBadRequest)
+				return
+			}
+			if err := consentSrv.PutScope(id, scope); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "scope", id)
+			writeJSON(w, http.StatusOK, scope)
+		case http.MethodDelete:
+			if err := consentSrv.DeleteScope(id); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "scope", id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// AdminConsentsHandler manages the consents of the user of the id query parameter (required):
+// GET returns them by scope, PUT replaces them, DELETE revokes all of them
+func AdminConsentsHandler(consentSrv consentservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler AdminConsentsHandler started", "request", routing.RequestIDLogValue(r))
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "missing id query parameter", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, consentSrv.GetUserConsents(id))
+		case http.MethodPut:
+			consents := map[string]bool{}
+			if err := decodeJSONBody(r, &consents); err != nil {
+				http.Error(w, "invalid consents", http.StatusBadRequest)
+				return
+			}
+			if err := consentSrv.PutUserConsents(id, consents); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "consents", id)
+			writeJSON(w, http.StatusOK, consentSrv.GetUserConsents(id))
+		case http.MethodDelete:
+			if err := consentSrv.DeleteUserConsents(id); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "consents", id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// AdminClaimsHandler manages the claims (see claimservice.ClaimsSet) of the user of the user query parameter
+// or the client of the client query parameter: GET returns them, PUT replaces them, DELETE removes them
+func AdminClaimsHandler(claimSrv claimservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler AdminClaimsHandler started", "request", routing.RequestIDLogValue(r))
+		username, clientId := r.URL.Query().Get("user"), r.URL.Query().Get("client")
+		if (username == "") == (clientId == "") {
+			http.Error(w, "either the user or the client query parameter is required", http.StatusBadRequest)
+			return
+		}
+		get, put, remove := claimSrv.GetUserClaimsSet, claimSrv.PutUserClaimsSet, claimSrv.DeleteUserClaimsSet
+		id := username
+		if clientId != "" {
+			get, put, remove = claimSrv.GetClientClaimsSet, claimSrv.PutClientClaimsSet, claimSrv.DeleteClientClaimsSet
+			id = clientId
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			claims := claimservice.ClaimsSet{}
+			if err := decodeJSONBody(r, &claims); err != nil {
+				http.Error(w, "invalid claims", http.StatusBadRequest)
+				return
+			}
+			if err := put(id, claims); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "claims", id)
+		case http.MethodDelete:
+			if err := remove(id); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "claims", id)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		claims, err := get(id)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, claims)
+	}
+}
+
+// AdminKeysHandler manages the signing keys: GET lists them, POST adds a key (the body is an entry of
+// the signing.keys section), PATCH switches the key of the id query parameter (kid) on and off
+// ({"active": bool}), DELETE removes it
+func AdminKeysHandler(signingSrv signing.SigningServicer) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler AdminKeysHandler started", "request", routing.RequestIDLogValue(r))
+		id := r.URL.Query().Get("id")
+		if id == "" && (r.Method == http.MethodPatch || r.Method == http.MethodDelete) {
+			http.Error(w, "missing id query parameter", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, signingSrv.GetKeys())
+		case http.MethodPost:
+			keyConfig := signing.SigningServiceKeyConfig{}
+			if err := decodeJSONBody(r, &keyConfig); err != nil {
+				http.Error(w, "invalid key: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			key, err := signingSrv.AddKey(keyConfig)
+			if err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "key", key.Kid)
+			writeJSON(w, http.StatusCreated, key)
+		case http.MethodPatch:
+			toggle := struct {
+				Active *bool `json:"active"`
+			}{}
+			if err := decodeJSONBody(r, &toggle); err != nil || toggle.Active == nil {
+				http.Error(w, "the body must set active", http.StatusBadRequest)
+				return
+			}
+			if err := signingSrv.SetKeyActive(id, *toggle.Active); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "key", id)
+			writeJSON(w, http.StatusOK, signingSrv.GetKeys())
+		case http.MethodDelete:
+			if err := signingSrv.DeleteKey(id); err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			logAdminChange(r, "key", id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
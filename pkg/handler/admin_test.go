@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+)
+
+// adminStep is a request to an admin handler, the steps of a test run in order against the same realm
+type adminStep struct {
+	method     string
+	target     string
+	body       string
+	wantStatus int
+	wantBody   []string // fragments of the response body
+	notBody    []string // fragments the response body must not contain
+}
+
+func runAdminSteps(t *testing.T, h routing.HandlerFunc, steps []adminStep) {
+	t.Helper()
+	for _, step := range steps {
+		w := serveJSON(h, step.method, step.target, step.body)
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s %s: status = %d, want %d, body %s", step.method, step.target, w.Code, step.wantStatus, w.Body.String())
+		}
+		for _, fragment := range step.wantBody {
+			if !strings.Contains(w.Body.String(), fragment) {
+				t.Errorf("%s %s: body %s, want %s", step.method, step.target, w.Body.String(), fragment)
+			}
+		}
+		for _, fragment := range step.notBody {
+			if strings.Contains(w.Body.String(), fragment) {
+				t.Errorf("%s %s: body %s, must not contain %s", step.method, step.target, w.Body.String(), fragment)
+			}
+		}
+	}
+}
+
+func TestAdminClientsHandler(t *testing.T) {
+	r := newTestRealm(t, "")
+	runAdminSteps(t, AdminClientsHandler(r.Clients), []adminStep{
+		{method: http.MethodGet, target: "/admin/clients", wantStatus: http.StatusOK, wantBody: []string{`"ACME"`}, notBody: []string{"acme-secret"}},
+		{method: http.MethodGet, target: "/admin/clients?id=UNKNOWN", wantStatus: http.StatusNotFound},
+		{method: http.MethodPut, target: "/admin/clients?id=NEW", body: `{"client_id": "NEW", "client_secret": "new-secret", "redirect_uri": "http://new.localhost/*"}`,
+			wantStatus: http.StatusOK, wantBody: []string{`"redirect_uri":"http://new.localhost/*"`}, notBody: []string{"new-secret"}},
+		// the secret of a replaced client is kept when omitted
+		{method: http.MethodPut, target: "/admin/clients?id=NEW", body: `{"client_id": "NEW", "redirect_uri": "http://other.localhost/*"}`,
+			wantStatus: http.StatusOK},
+		{method: http.MethodGet, target: "/admin/clients?id=NEW", wantStatus: http.StatusOK, wantBody: []string{`"redirect_uri":"http://other.localhost/*"`}},
+		{method: http.MethodPut, target: "/admin/clients?id=NEW", body: `{"client_id": "`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPut, target: "/admin/clients", body: `{}`, wantStatus: http.StatusBadRequest},
+	})
+	credentials, err := authentication.NewCredentials(authentication.FromCliendIdAndSecret("NEW", "new-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Clients.Authenticate(credentials); err != nil {
+		t.Errorf("Authenticate() of the replaced client error = %v, want the secret kept", err)
+	}
+
+	runAdminSteps(t, AdminClientsHandler(r.Clients), []adminStep{
+		{method: http.MethodDelete, target: "/admin/clients?id=NEW", wantStatus: http.StatusNoContent},
+		{method: http.MethodDelete, target: "/admin/clients?id=NEW", wantStatus: http.StatusNotFound},
+	})
+}
+
+func TestAdminUsersHandler(t *testing.T) {
+	r := newTestRealm(t, "")
+	runAdminSteps(t, AdminUsersHandler(r.Users), []adminStep{
+		{method: http.MethodGet, target: "/admin/users", wantStatus: http.StatusOK, wantBody: []string{`"username":"demo"`}, notBody: []string{"password"}},
+		{method: http.MethodPut, target: "/admin/users?id=alice", body: `{"username": "alice"}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPut, target: "/admin/users?id=alice", body: `{"username": "bob", "password": "x"}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPut, target: "/admin/users?id=alice", body: `{"password": "alice", "email": "alice@example.com"}`,
+			wantStatus: http.StatusOK, wantBody: []string{`"username":"alice"`, `"active":true`, `"email":"alice@example.com"`}, notBody: []string{"password"}},
+		// the password of a replaced user is kept when omitted
+		{method: http.MethodPut, target: "/admin/users?id=alice", body: `{"active": false}`, wantStatus: http.StatusOK, wantBody: []string{`"active":false`}},
+		{method: http.MethodGet, target: "/admin/users?id=alice", wantStatus: http.StatusOK, wantBody: []string{`"active":false`}},
+	})
+	credentials, err := authentication.NewCredentials(authentication.FromUsernameAndPassword("alice", "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Users.Authenticate(credentials); err != nil {
+		t.Errorf("Authenticate() of the replaced user error = %v, want the password kept", err)
+	}
+
+	runAdminSteps(t, AdminUsersHandler(r.Users), []adminStep{
+		{method: http.MethodDelete, target: "/admin/users?id=alice", wantStatus: http.StatusNoContent},
+		{method: http.MethodGet, target: "/admin/users?id=alice", wantStatus: http.StatusNotFound},
+		{method: http.MethodDelete, target: "/admin/users", wantStatus: http.StatusBadRequest},
+	})
+}
+
+func TestAdminScopesAndConsentsHandlers(t *testing.T) {
+	r := newTestRealm(t, "")
+	runAdminSteps(t, AdminScopesHandler(r.Consents), []adminStep{
+		{method: http.MethodPut, target: "/admin/scopes?id=api", body: `{"requireConsent": true}`, wantStatus: http.StatusOK},
+		{method: http.MethodGet, target: "/admin/scopes?id=api", wantStatus: http.StatusOK, wantBody: []string{`"requireConsent":true`}},
+		{method: http.MethodGet, target: "/admin/scopes", wantStatus: http.StatusOK, wantBody: []string{`"openid"`, `"api"`}},
+	})
+	runAdminSteps(t, AdminConsentsHandler(r.Consents), []adminStep{
+		{method: http.MethodGet, target: "/admin/consents", wantStatus: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/admin/consents?id=demo", wantStatus: http.StatusOK, wantBody: []string{`"openid":true`}},
+		{method: http.MethodPut, target: "/admin/consents?id=demo", body: `{"api": true}`, wantStatus: http.StatusOK, wantBody: []string{`"api":true`}},
+		{method: http.MethodPut, target: "/admin/consents?id=demo", body: `{"undefined": true}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodDelete, target: "/admin/consents?id=demo", wantStatus: http.StatusNoContent},
+		{method: http.MethodGet, target: "/admin/consents?id=demo", wantStatus: http.StatusOK, notBody: []string{"true"}},
+	})
+	runAdminSteps(t, AdminScopesHandler(r.Consents), []adminStep{
+		{method: http.MethodDelete, target: "/admin/scopes?id=api", wantStatus: http.StatusNoContent},
+		{method: http.MethodGet, target: "/admin/scopes?id=api", wantStatus: http.StatusNotFound},
+	})
+}
+
+func TestAdminClaimsHandler(t *testing.T) {
+	r := newTestRealm(t, "")
+	runAdminSteps(t, AdminClaimsHandler(r.Claims), []adminStep{
+		{method: http.MethodGet, target: "/admin/claims", wantStatus: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/admin/claims?user=demo&client=ACME", wantStatus: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/admin/claims?user=demo", wantStatus: http.StatusOK, wantBody: []string{`"preferred_username":"demo"`}},
+		{method: http.MethodPut, target: "/admin/claims?client=ACME", body: `{"default": {"base": {"azp": "ACME", "tier": "gold"}}}`,
+			wantStatus: http.StatusOK, wantBody: []string{`"tier":"gold"`}},
+		{method: http.MethodGet, target: "/admin/claims?client=ACME", wantStatus: http.StatusOK, wantBody: []string{`"tier":"gold"`}},
+		{method: http.MethodDelete, target: "/admin/claims?client=ACME", wantStatus: http.StatusNoContent},
+		{method: http.MethodGet, target: "/admin/claims?client=ACME", wantStatus: http.StatusNotFound},
+	})
+}
+
+func TestAdminKeysHandler(t *testing.T) {
+	r := newTestRealm(t, "")
+	h := AdminKeysHandler(r.Signing)
+
+	w := serveJSON(h, http.MethodPost, "/admin/keys", `{"provider": {"fromRandom": {"type": "P-256", "deterministic": true, "seed": "admin"}}, "method": "ES256", "active": false}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d, body %s", w.Code, w.Body.String())
+	}
+	kid, _ := decodeJSON(t, w)["kid"].(string)
+	if kid == "" {
+		t.Fatalf("POST body %s, want the kid of the key", w.Body.String())
+	}
+
+	runAdminSteps(t, h, []adminStep{
+		{method: http.MethodGet, target: "/admin/keys", wantStatus: http.StatusOK, wantBody: []string{`"kid":"` + kid + `"`}, notBody: []string{`"d":`}},
+		{method: http.MethodPatch, target: "/admin/keys?id=" + kid, body: `{}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPatch, target: "/admin/keys?id=" + kid, body: `{"active": true}`,
+			wantStatus: http.StatusOK, wantBody: []string{`"kid":"` + kid + `","type":"P-256","method":"ES256","active":true`}},
+		{method: http.MethodPatch, target: "/admin/keys?id=unknown", body: `{"active": true}`, wantStatus: http.StatusNotFound},
+		{method: http.MethodDelete, target: "/admin/keys", wantStatus: http.StatusBadRequest},
+		{method: http.MethodDelete, target: "/admin/keys?id=" + kid, wantStatus: http.StatusNoContent},
+	})
+	var keys []map[string]any
+	w = serveJSON(h, http.MethodGet, "/admin/keys", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &keys); err != nil || len(keys) != 1 {
+		t.Errorf("keys after DELETE = %s, want the key of the config only", w.Body.String())
+	}
+}
+
+func TestAdminAuthenticationMiddleware(t *testing.T) {
+	r := newTestRealm(t, "")
+	passwordHandler := TokenPasswordHandler(testOpenIDConfiguration(), r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	accessToken := func(scope string) string {
+		w := serve(passwordHandler, http.MethodPost, "/token", map[string][]string{
+			"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+			"username": {"demo"}, "password": {"demo"}, "scope": {scope},
+		})
+		token, _ := decodeJSON(t, w)["access_token"].(string)
+		return token
+	}
+	var called bool
+	h := routing.AdminAuthenticationMiddleware("static-admin-token", "profile", r.Signing)(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+		{name: "admin token", token: "static-admin-token", wantStatus: http.StatusOK},
+		{name: "invalid token", token: "other-token", wantStatus: http.StatusUnauthorized},
+		{name: "access token with the admin scope", token: accessToken("openid profile"), wantStatus: http.StatusOK},
+		{name: "access token without the admin scope", token: accessToken("openid"), wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			req := httptest.NewRequest(http.MethodGet, "/admin/clients", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			h(w, req)
+			if w.Code != tt.wantStatus || called != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("status = %d, handler called = %v, want %d", w.Code, called, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,76 +1,139 @@
 package handler
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/axent-pl/oauth2mock/pkg/auth"
 	"github.com/axent-pl/oauth2mock/pkg/authorizationservice"
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
-	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
 	"github.com/axent-pl/oauth2mock/pkg/dto"
 	"github.com/axent-pl/oauth2mock/pkg/http/request"
 	"github.com/axent-pl/oauth2mock/pkg/http/routing"
-	"github.com/axent-pl/oauth2mock/pkg/service/template"
-	"github.com/axent-pl/oauth2mock/pkg/tpl"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
 )
 
-func AuthorizeResponseTypeCodeHandler() routing.HandlerFunc {
-	var wired bool
-	var templateDB template.Service
-	var clientSrv clientservice.Service
-	var authZSrv authorizationservice.Service
+// authorizeRequestContextKey holds the authorization request validated by AuthorizeRequestMiddleware
+type authorizeRequestContextKey struct{}
 
-	templateDB, wired = di.GiveMeInterface(templateDB)
-	if !wired {
-		slog.Error("could not wire template service")
-		return nil
+type validatedAuthorizeRequest struct {
+	dto    *dto.AuthorizeRequestDTO
+	client clientservice.Entity
+}
+
+// AuthorizeRequestMiddleware validates the client, the request object, the redirect URI and the scopes
+// of an authorization request before the user is asked to sign in, invalid requests never reach the login page
+func AuthorizeRequestMiddleware(openidConfig auth.OpenIDConfiguration, clientSrv clientservice.Service, consentSrv consentservice.Service) routing.Middleware {
+	return func(next routing.HandlerFunc) routing.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			authorizeRequestDTO, client, ok := validateAuthorizeRequest(w, r, openidConfig, clientSrv, consentSrv)
+			if !ok {
+				return
+			}
+			ctx := context.WithValue(r.Context(), authorizeRequestContextKey{}, validatedAuthorizeRequest{dto: authorizeRequestDTO, client: client})
+			next(w, r.WithContext(ctx))
+		}
 	}
-	clientSrv, wired = di.GiveMeInterface(clientSrv)
-	if !wired {
-		slog.Error("could not wire client service")
-		return nil
+}
+
+// validateAuthorizeRequest parses and validates the authorization request, the error response is written when it is invalid
+func validateAuthorizeRequest(w http.ResponseWriter, r *http.Request, openidConfig auth.OpenIDConfiguration, clientSrv clientservice.Service, consentSrv consentservice.Service) (*dto.AuthorizeRequestDTO, clientservice.Entity, bool) {
+	// authorization request DTO
+	authorizeRequestDTO := &dto.AuthorizeRequestDTO{}
+	valid, validator := request.UnmarshalAndValidate(r, authorizeRequestDTO)
+
+	// client
+	client, err := clientSrv.GetClient(authorizeRequestDTO.ClientId)
+	if err != nil {
+		slog.Error("invalid client", "request", routing.RequestIDLogValue(r), "error", err)
+		oauthError(w, errInvalidRequest, "invalid client_id")
+		return nil, nil, false
 	}
-	authZSrv, wired = di.GiveMeInterface(authZSrv)
-	if !wired {
-		slog.Error("could not wire authorization service")
-		return nil
+
+	// request object
+	if authorizeRequestDTO.Request != "" || authorizeRequestDTO.RequestURI != "" {
+		redirectURI, state := authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State
+		issuer := openidConfig.Issuer
+		if openidConfig.UseOrigin {
+			issuer = getOriginFromRequest(r) + openidConfig.IssuerPath
+		}
+		if err := applyRequestObject(authorizeRequestDTO, client, issuer); err != nil {
+			slog.Error("invalid request object", "request", routing.RequestIDLogValue(r), "error", err)
+			if client.ValidateRedirectURI(redirectURI) {
+				authorizeErrorRedirect(w, r, redirectURI, state, errInvalidRequestObject, err.Error())
+			} else {
+				oauthError(w, errInvalidRequestObject, err.Error())
+			}
+			return nil, nil, false
+		}
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("request handler AuthorizePostHandler started", "request", routing.RequestIDLogValue(r))
+	// errors can be sent to the client only after the redirect URI has been validated
+	if !client.ValidateRedirectURI(authorizeRequestDTO.RedirectURI) {
+		slog.Error("invalid redirect uri", "request", routing.RequestIDLogValue(r), "redirectURI", authorizeRequestDTO.RedirectURI)
+		oauthError(w, errInvalidRequest, "invalid redirect_uri")
+		return nil, nil, false
+	}
+	if !valid {
+		slog.Error("invalid authorize request", "request", routing.RequestIDLogValue(r), "validationErrors", validator.Errors)
+		authorizeErrorRedirect(w, r, authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State, errInvalidRequest, validationErrorDescription(validator))
+		return nil, nil, false
+	}
+	if authorizeRequestDTO.ResponseType != "code" {
+		slog.Error("unsupported response type", "request", routing.RequestIDLogValue(r), "responseType", authorizeRequestDTO.ResponseType)
+		authorizeErrorRedirect(w, r, authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State, errUnsupportedResponseType, "response_type '"+authorizeRequestDTO.ResponseType+"' is not supported")
+		return nil, nil, false
+	}
+	if scope, ok := undefinedScope(strings.Fields(authorizeRequestDTO.Scope), consentSrv); ok {
+		slog.Error("invalid scope", "request", routing.RequestIDLogValue(r), "scope", scope)
+		authorizeErrorRedirect(w, r, authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State, errInvalidScope, "scope '"+scope+"' is not defined")
+		return nil, nil, false
+	}
+	return authorizeRequestDTO, client, true
+}
 
-		templateData := tpl.AuthorizeTemplateData{
-			FormAction: r.URL.String(),
+// undefinedScope returns the first scope which is not defined in consents.scopes. Scopes with a colon
+// (token_profile:{name}, api://{app}/{permission}) are resolved by the token profiles and the realm profile.
+func undefinedScope(scopes []string, consentSrv consentservice.Service) (string, bool) {
+	defined := consentSrv.GetScopes()
+	for _, scope := range scopes {
+		if _, ok := defined[scope]; !ok && !strings.Contains(scope, ":") {
+			return scope, true
 		}
+	}
+	return "", false
+}
 
-		// authorization request DTO
-		authorizeRequestDTO := &dto.AuthorizeRequestDTO{}
-		if valid, validator := request.UnmarshalAndValidate(r, authorizeRequestDTO); !valid {
-			slog.Error("invalid authorize request", "request", routing.RequestIDLogValue(r), "validationErrors", validator.Errors)
-			templateData.FormErrorMessage = "invalid authorize request"
-			templateDB.Render(w, "login", templateData)
-			return
-		}
+func AuthorizeResponseTypeCodeHandler(openidConfig auth.OpenIDConfiguration, clientSrv clientservice.Service, consentSrv consentservice.Service, authZSrv authorizationservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler AuthorizePostHandler started", "request", routing.RequestIDLogValue(r))
 
-		// client
-		client, err := clientSrv.GetClient(authorizeRequestDTO.ClientId)
-		if err != nil {
-			slog.Error("invalid client", "request", routing.RequestIDLogValue(r), "error", err)
-			templateData.FormErrorMessage = "invalid client"
-			templateDB.Render(w, "login", templateData)
-			return
+		// the request is validated by AuthorizeRequestMiddleware ahead of the login, otherwise here
+		validated, ok := r.Context().Value(authorizeRequestContextKey{}).(validatedAuthorizeRequest)
+		if !ok {
+			authorizeRequestDTO, client, ok := validateAuthorizeRequest(w, r, openidConfig, clientSrv, consentSrv)
+			if !ok {
+				return
+			}
+			validated = validatedAuthorizeRequest{dto: authorizeRequestDTO, client: client}
 		}
+		authorizeRequestDTO, client := validated.dto, validated.client
 
 		// user
 		user, ok := r.Context().Value(routing.CTX_USER).(userservice.Entity)
 		if !ok {
-			http.Error(w, "authentication failure", http.StatusInternalServerError)
+			authorizeErrorRedirect(w, r, authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State, errServerError, "authentication failure")
 			return
 		}
 
+		amr, _ := r.Context().Value(routing.CTX_AMR).([]string)
+		authTime, _ := r.Context().Value(routing.CTX_AUTH_TIME).(time.Time)
+
 		// authorization request
 		authorizationRequest, err := authorizationservice.NewAuthorizationRequest(
 			authorizeRequestDTO.ResponseType,
@@ -79,15 +142,17 @@ func AuthorizeResponseTypeCodeHandler() routing.HandlerFunc {
 			authorizationservice.WithRedirectURI(authorizeRequestDTO.RedirectURI),
 			authorizationservice.WithState(authorizeRequestDTO.State),
 			authorizationservice.WithNonce(authorizeRequestDTO.Nonce),
-			authorizationservice.WithUser(user))
+			authorizationservice.WithUser(user),
+			authorizationservice.WithAMR(amr),
+			authorizationservice.WithAuthTime(authTime))
 		if err != nil {
 			slog.Error("invalid authorize request", "request", routing.RequestIDLogValue(r), "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			authorizeErrorRedirect(w, r, authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State, authorizeErrorCode(err, errInvalidRequest), err.Error())
 			return
 		}
 		if err := authZSrv.Validate(authorizationRequest); err != nil {
 			slog.Error("invalid authorize request", "request", routing.RequestIDLogValue(r), "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			authorizeErrorRedirect(w, r, authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State, authorizeErrorCode(err, errInvalidRequest), err.Error())
 			return
 		}
 
@@ -95,13 +160,13 @@ func AuthorizeResponseTypeCodeHandler() routing.HandlerFunc {
 		code, err := authZSrv.Store(authorizationRequest)
 		if err != nil {
 			slog.Error("AuthorizePostHandler authorization code generation failed", "request", routing.RequestIDLogValue(r), "error", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			authorizeErrorRedirect(w, r, authorizeRequestDTO.RedirectURI, authorizeRequestDTO.State, errServerError, "authorization code generation failed")
 			return
 		}
 		redirectURL, err := url.Parse(authorizationRequest.GetRedirectURI())
 		if err != nil {
 			slog.Error("invalid redirect uel format", "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, "invalid redirect_uri")
 			return
 		}
 		redirectURLQuery := redirectURL.Query()
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+)
+
+func TestAuthorizeRequestMiddleware(t *testing.T) {
+	r := newTestRealm(t, "")
+	openidConfig := testOpenIDConfiguration()
+	user, err := r.Users.GetUser("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// login stands in for the user authentication, the authorization request must be validated before it runs
+	var loginCalled bool
+	login := func(next routing.HandlerFunc) routing.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			loginCalled = true
+			next(w, r.WithContext(context.WithValue(r.Context(), routing.CTX_USER, user)))
+		}
+	}
+	h := AuthorizeRequestMiddleware(openidConfig, r.Clients, r.Consents)(
+		login(AuthorizeResponseTypeCodeHandler(openidConfig, r.Clients, r.Consents, r.Authorizations)))
+
+	tests := []struct {
+		name       string
+		query      url.Values
+		wantStatus int
+		wantError  string
+		wantLogin  bool
+	}{
+		{
+			name:       "valid request",
+			query:      url.Values{"client_id": {"ACME"}, "redirect_uri": {"http://localhost/callback"}, "scope": {"openid profile"}},
+			wantStatus: http.StatusSeeOther,
+			wantLogin:  true,
+		},
+		{
+			name:       "unknown client",
+			query:      url.Values{"client_id": {"UNKNOWN"}, "redirect_uri": {"http://localhost/callback"}, "scope": {"openid"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "bad redirect_uri",
+			query:      url.Values{"client_id": {"ACME"}, "redirect_uri": {"http://attacker.example/callback"}, "scope": {"openid"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  errInvalidRequest,
+		},
+		{
+			name:       "invalid scope",
+			query:      url.Values{"client_id": {"ACME"}, "redirect_uri": {"http://localhost/callback"}, "scope": {"openid unknown"}},
+			wantStatus: http.StatusFound,
+			wantError:  errInvalidScope,
+		},
+		{
+			name:       "token profile scope",
+			query:      url.Values{"client_id": {"ACME"}, "redirect_uri": {"http://localhost/callback"}, "scope": {"openid token_profile:expired"}},
+			wantStatus: http.StatusSeeOther,
+			wantLogin:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loginCalled = false
+			tt.query.Set("response_type", "code")
+			tt.query.Set("state", "xyz")
+			w := serve(h, http.MethodGet, "/authorize?"+tt.query.Encode(), nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if loginCalled != tt.wantLogin {
+				t.Errorf("login called = %v, want %v", loginCalled, tt.wantLogin)
+			}
+
+			var gotError string
+			switch w.Code {
+			case http.StatusBadRequest:
+				gotError, _ = decodeJSON(t, w)["error"].(string)
+			default:
+				location, err := url.Parse(w.Header().Get("Location"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if location.Host != "localhost" || location.Query().Get("state") != "xyz" {
+					t.Errorf("redirected to %s, want the redirect URI with the state", location)
+				}
+				if !tt.wantLogin {
+					gotError = location.Query().Get("error")
+				} else if location.Query().Get("code") == "" {
+					t.Errorf("redirected to %s, want an authorization code", location)
+				}
+			}
+			if gotError != tt.wantError {
+				t.Errorf("error = %q, want %q", gotError, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestAuthorizeErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: errs.New("login required", errs.ErrUnauthenticated), want: errAccessDenied},
+		{err: errs.New("client not allowed", errs.ErrPermissionDenied), want: errUnauthorizedClient},
+		{err: errs.New("undefined scope api", consentservice.ErrUndefinedScope), want: errInvalidScope},
+		{err: errs.New("missing state", errs.ErrInvalidArgument), want: errInvalidRequest},
+		{err: errs.New("store failed", errs.ErrInternal), want: errServerError},
+		{err: errors.New("other"), want: errInvalidRequest},
+	}
+	for _, tt := range tests {
+		if got := authorizeErrorCode(tt.err, errInvalidRequest); got != tt.want {
+			t.Errorf("authorizeErrorCode(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
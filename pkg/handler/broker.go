@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/auth"
+	"github.com/axent-pl/oauth2mock/pkg/brokerservice"
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+	"github.com/google/uuid"
+)
+
+// brokerLoginState is kept in the session while the user logs in at the upstream
+type brokerLoginState struct {
+	Upstream string
+	State    string
+	Nonce    string
+	ReturnTo string
+}
+
+const sessionKeyBroker = "broker"
+
+func init() {
+	sessionservice.RegisterValue(sessionKeyBroker, sessionservice.DecodeAs[brokerLoginState])
+}
+
+// brokerRedirectURI is the absolute URL of the broker callback endpoint of the realm
+func brokerRedirectURI(r *http.Request, openidConfig auth.OpenIDConfiguration, callbackPath string) string {
+	issuer := openidConfig.Issuer
+	if openidConfig.UseOrigin {
+		issuer = getOriginFromRequest(r) + openidConfig.IssuerPath
+	}
+	return strings.TrimSuffix(issuer, openidConfig.IssuerSuffix) + callbackPath
+}
+
+// isLocalPath prevents open redirects, only paths of this server are accepted as return URLs
+func isLocalPath(returnTo string) bool {
+	return strings.HasPrefix(returnTo, "/") && !strings.HasPrefix(returnTo, "//") && !strings.HasPrefix(returnTo, "/\\")
+}
+
+func getSessionData(r *http.Request, sessionSrv sessionservice.Service) (string, sessionservice.SessionData, bool) {
+	sessionID, ok := r.Context().Value(routing.CTX_SESSION_ID).(string)
+	if !ok {
+		return "", nil, false
+	}
+	sessionData, ok := sessionSrv.Get(sessionID)
+	return sessionID, sessionData, ok
+}
+
+// BrokerLoginHandler starts the login at the upstream given by the upstream query parameter,
+// the user returns to the return query parameter (the login form URL) once authenticated
+func BrokerLoginHandler(openidConfig auth.OpenIDConfiguration, brokerSrv brokerservice.Service, sessionSrv sessionservice.Service, callbackPath string) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler BrokerLoginHandler started", "request", routing.RequestIDLogValue(r))
+
+		upstream, err := brokerSrv.GetUpstream(r.URL.Query().Get("upstream"))
+		if err != nil {
+			slog.Error("invalid upstream", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "unknown upstream", http.StatusBadRequest)
+			return
+		}
+		returnTo := r.URL.Query().Get("return")
+		if !isLocalPath(returnTo) {
+			slog.Error("invalid return URL", "request", routing.RequestIDLogValue(r), "return", returnTo)
+			http.Error(w, "invalid return URL", http.StatusBadRequest)
+			return
+		}
+
+		sessionID, sessionData, ok := getSessionData(r, sessionSrv)
+		if !ok {
+			http.Error(w, "user session not initialized", http.StatusInternalServerError)
+			return
+		}
+		loginState := brokerLoginState{
+			Upstream: upstream.Alias(),
+			State:    uuid.NewString(),
+			Nonce:    uuid.NewString(),
+			ReturnTo: returnTo,
+		}
+
+		authorizationURL, err := brokerSrv.AuthorizationURL(upstream, brokerRedirectURI(r, openidConfig, callbackPath), loginState.State, loginState.Nonce)
+		if err != nil {
+			slog.Error("upstream unavailable", "request", routing.RequestIDLogValue(r), "upstream", upstream.Alias(), "error", err)
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+			return
+		}
+		sessionData[sessionKeyBroker] = loginState
+		sessionSrv.Put(sessionID, sessionData)
+
+		slog.Info("BrokerLoginHandler redirecting", "request", routing.RequestIDLogValue(r), "upstream", upstream.Alias())
+		http.Redirect(w, r, authorizationURL, http.StatusSeeOther)
+	}
+}
+
+// BrokerCallbackHandler completes the upstream login: the code is exchanged, the upstream identity
+// is mapped to a local user which becomes the user of the session
+func BrokerCallbackHandler(openidConfig auth.OpenIDConfiguration, brokerSrv brokerservice.Service, userSrv userservice.Service, consentSrv consentservice.Service, sessionSrv sessionservice.Service, callbackPath string) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler BrokerCallbackHandler started", "request", routing.RequestIDLogValue(r))
+
+		sessionID, sessionData, ok := getSessionData(r, sessionSrv)
+		if !ok {
+			http.Error(w, "user session not initialized", http.StatusInternalServerError)
+			return
+		}
+		loginState, ok := sessionData[sessionKeyBroker].(brokerLoginState)
+		query := r.URL.Query()
+		if !ok || query.Get("state") != loginState.State {
+			slog.Error("invalid broker state", "request", routing.RequestIDLogValue(r))
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		delete(sessionData, sessionKeyBroker)
+		sessionSrv.Put(sessionID, sessionData)
+
+		if upstreamError := query.Get("error"); upstreamError != "" {
+			slog.Error("upstream login failed", "request", routing.RequestIDLogValue(r), "upstream", loginState.Upstream, "error", upstreamError)
+			http.Error(w, "upstream login failed: "+upstreamError+" "+query.Get("error_description"), http.StatusUnauthorized)
+			return
+		}
+
+		upstream, err := brokerSrv.GetUpstream(loginState.Upstream)
+		if err != nil {
+			http.Error(w, "unknown upstream", http.StatusBadRequest)
+			return
+		}
+		claims, err := brokerSrv.Exchange(upstream, query.Get("code"), brokerRedirectURI(r, openidConfig, callbackPath), loginState.Nonce)
+		if err != nil {
+			slog.Error("upstream code exchange failed", "request", routing.RequestIDLogValue(r), "upstream", upstream.Alias(), "error", err)
+			http.Error(w, "upstream login failed", http.StatusUnauthorized)
+			return
+		}
+		user, err := brokerservice.Provision(upstream, claims, userSrv, consentSrv)
+		if err != nil {
+			slog.Error("brokered user provisioning failed", "request", routing.RequestIDLogValue(r), "upstream", upstream.Alias(), "error", err)
+			http.Error(w, "upstream login failed", http.StatusUnauthorized)
+			return
+		}
+
+		// the authentication methods of the upstream are unknown
+		routing.SignIn(sessionData, user, nil)
+		sessionSrv.Put(sessionID, sessionData)
+		slog.Info("BrokerCallbackHandler redirecting", "request", routing.RequestIDLogValue(r), "upstream", upstream.Alias(), "userId", user.Id())
+		http.Redirect(w, r, loginState.ReturnTo, http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+)
+
+// clockRequestDTO changes the virtual time, set is applied before advance
+type clockRequestDTO struct {
+	Set     *time.Time `json:"set"`
+	Advance string     `json:"advance"` // Go duration, e.g. 90s or -1h30m
+	Frozen  *bool      `json:"frozen"`
+}
+
+// ClockAdminHandler controls the virtual clock of the server: GET shows the virtual time,
+// POST freezes, resumes, sets or advances it and DELETE returns to the real time
+func ClockAdminHandler(virtualClock *clock.VirtualClock) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler ClockAdminHandler started", "request", routing.RequestIDLogValue(r))
+
+		switch r.Method {
+		case http.MethodPost:
+			requestDTO := clockRequestDTO{}
+			if err := decodeJSONBody(r, &requestDTO); err != nil {
+				http.Error(w, "invalid clock request", http.StatusBadRequest)
+				return
+			}
+			var advance time.Duration
+			if requestDTO.Advance != "" {
+				var err error
+				if advance, err = time.ParseDuration(requestDTO.Advance); err != nil {
+					http.Error(w, "invalid advance duration", http.StatusBadRequest)
+					return
+				}
+			}
+			// the clock stops before it is moved, so that a frozen time is exactly the one requested
+			if requestDTO.Frozen != nil && *requestDTO.Frozen {
+				virtualClock.Freeze()
+			}
+			if requestDTO.Set != nil {
+				virtualClock.Set(*requestDTO.Set)
+			}
+			virtualClock.Advance(advance)
+			if requestDTO.Frozen != nil && !*requestDTO.Frozen {
+				virtualClock.Resume()
+			}
+		case http.MethodDelete:
+			virtualClock.Reset()
+		}
+
+		state := virtualClock.State()
+		if r.Method != http.MethodGet {
+			slog.Warn("virtual clock changed", "request", routing.RequestIDLogValue(r), "now", state.Now, "frozen", state.Frozen, "offsetSeconds", state.OffsetSeconds)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	}
+}
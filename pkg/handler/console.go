@@ -0,0 +1,592 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/service/template"
+	"github.com/axent-pl/oauth2mock/pkg/state"
+	"github.com/axent-pl/oauth2mock/pkg/tokenservice"
+	"github.com/axent-pl/oauth2mock/pkg/tpl"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+	"github.com/google/uuid"
+)
+
+// pages of the admin console with data of their own, the page query parameter selects one
+// (keys, sessions and tokens show the lists loaded for the overview)
+const (
+	consolePageLogin    = "login"
+	consolePageOverview = "overview"
+	consolePageUsers    = "users"
+	consolePageClients  = "clients"
+	consolePageClaims   = "claims"
+	consolePageScopes   = "scopes"
+)
+
+const (
+	consoleCookie     = "console_sid"
+	consoleSessionTTL = 8 * time.Hour
+)
+
+// consoleSessions are the admins signed in to the consoles. They are kept apart from the realm sessions
+// and follow the real time, so that neither a state reset, a config reload nor the virtual clock signs them out.
+type consoleSessions struct {
+	mu       sync.Mutex
+	sessions map[string]consoleSession
+}
+
+// consoleSession is valid for the console of one realm (path)
+type consoleSession struct {
+	admin     string
+	path      string
+	expiresAt time.Time
+}
+
+var consoleLogins = &consoleSessions{sessions: make(map[string]consoleSession)}
+
+func (s *consoleSessions) get(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(consoleCookie)
+	if err != nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[cookie.Value]
+	if !ok || clock.Now().After(session.expiresAt) {
+		delete(s.sessions, cookie.Value)
+		return "", false
+	}
+	if session.path != r.URL.Path {
+		return "", false
+	}
+	return session.admin, true
+}
+
+func (s *consoleSessions) start(w http.ResponseWriter, r *http.Request, admin string) {
+	sessionID := uuid.NewString()
+	s.mu.Lock()
+	s.sessions[sessionID] = consoleSession{admin: admin, path: r.URL.Path, expiresAt: clock.Now().Add(consoleSessionTTL)}
+	s.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name:     consoleCookie,
+		Value:    sessionID,
+		Path:     r.URL.Path,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(consoleSessionTTL.Seconds()),
+	})
+}
+
+func (s *consoleSessions) end(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(consoleCookie); err == nil {
+		s.mu.Lock()
+		delete(s.sessions, cookie.Value)
+		s.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: consoleCookie, Path: r.URL.Path, HttpOnly: true, MaxAge: -1})
+}
+
+// console renders and changes the runtime state of a realm
+type console struct {
+	clientSrv  clientservice.Service
+	userSrv    userservice.Service
+	claimSrv   claimservice.Service
+	consentSrv consentservice.Service
+	signingSrv signing.SigningServicer
+	tokenSrv   tokenservice.Service
+	stateful   map[string]state.Stateful
+
+	adminToken string
+	adminUsers []string
+}
+
+// ConsoleHandler serves the admin console of a realm: server-rendered pages to browse and edit the users,
+// clients, claims, scopes, consents and signing keys and to watch the sessions, the outstanding authorization
+// codes and the latest token issuances (sessions and codes are listed from the snapshots of the stateful services).
+//
+// Admins sign in with any username and the admin token as password, or as one of the adminUsers of the realm.
+// Forms post to the page itself with the action field naming the change.
+func ConsoleHandler(clientSrv clientservice.Service, userSrv userservice.Service, claimSrv claimservice.Service, consentSrv consentservice.Service, signingSrv signing.SigningServicer, tokenSrv tokenservice.Service, stateful map[string]state.Stateful, adminToken string, adminUsers []string) routing.HandlerFunc {
+	var templateSrv template.Service
+	templateSrv, wired := di.GiveMeInterface(templateSrv)
+	if !wired {
+		slog.Error("could not wire template service")
+	}
+	sessions := consoleLogins
+	c := &console{
+		clientSrv:  clientSrv,
+		userSrv:    userSrv,
+		claimSrv:   claimSrv,
+		consentSrv: consentSrv,
+		signingSrv: signingSrv,
+		tokenSrv:   tokenSrv,
+		stateful:   stateful,
+		adminToken: adminToken,
+		adminUsers: adminUsers,
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler ConsoleHandler started", "request", routing.RequestIDLogValue(r))
+		w.Header().Set("Cache-Control", "no-store")
+		data := tpl.ConsoleTemplateData{FormAction: r.URL.RequestURI()}
+
+		admin, signedIn := sessions.get(r)
+		if !signedIn {
+			if r.Method == http.MethodPost && r.PostFormValue("action") == "login" {
+				username := r.PostFormValue("username")
+				if c.login(username, r.PostFormValue("password")) {
+					slog.Warn("admin console login", "request", routing.RequestIDLogValue(r), "admin", username)
+					sessions.start(w, r, username)
+					http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+					return
+				}
+				slog.Error("admin console login failed", "request", routing.RequestIDLogValue(r), "admin", username)
+				data.ErrorMessage = "invalid credentials"
+			}
+			data.Page = consolePageLogin
+			templateSrv.Render(w, "console", data)
+			return
+		}
+
+		data.Admin = admin
+		if r.Method == http.MethodPost {
+			action := r.PostFormValue("action")
+			if action == "logout" {
+				sessions.end(w, r)
+				http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+				return
+			}
+			message, err := c.act(r, action)
+			if err == nil {
+				slog.Warn("admin console change", "request", routing.RequestIDLogValue(r), "admin", admin, "action", action)
+				query := r.URL.Query()
+				query.Set("message", message)
+				http.Redirect(w, r, r.URL.Path+"?"+query.Encode(), http.StatusSeeOther)
+				return
+			}
+			data.ErrorMessage = err.Error()
+		}
+
+		data.Message = r.URL.Query().Get("message")
+		if err := c.load(&data, r.URL.Query()); err != nil && data.ErrorMessage == "" {
+			data.ErrorMessage = err.Error()
+		}
+		templateSrv.Render(w, "console", data)
+	}
+}
+
+// login accepts any username with the admin token as password, or the credentials of an active admin user
+func (c *console) login(username string, password string) bool {
+	if username == "" || password == "" {
+		return false
+	}
+	if c.adminToken != "" && subtle.ConstantTimeCompare([]byte(password), []byte(c.adminToken)) == 1 {
+		return true
+	}
+	if !slices.Contains(c.adminUsers, username) {
+		return false
+	}
+	credentials, err := authentication.NewCredentials(authentication.FromUsernameAndPassword(username, password))
+	if err != nil {
+		return false
+	}
+	user, err := c.userSrv.Authenticate(credentials)
+	return err == nil && user.Active()
+}
+
+// act applies the change of the posted form and returns the message shown once it is done
+func (c *console) act(r *http.Request, action string) (string, error) {
+	form := r.PostFormValue
+	switch action {
+	case "save_user":
+		username := form("username")
+		if username == "" {
+			return "", errs.New("missing username", errs.ErrInvalidArgument)
+		}
+		active := form("active") != ""
+		userDTO := adminUserDTO{
+			Username:   username,
+			Password:   form("password"),
+			Active:     &active,
+			TOTPSecret: form("totp_secret"),
+			Email:      form("email"),
+		}
+		if err := unmarshalConsoleJSON("attributes", form("attributes"), &userDTO.Attributes); err != nil {
+			return "", err
+		}
+		if _, err := saveAdminUser(c.userSrv, username, userDTO); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("user %s saved", username), nil
+	case "delete_user":
+		if err := c.userSrv.DeleteUser(form("username")); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("user %s deleted", form("username")), nil
+
+	case "save_client":
+		clientId := form("client_id")
+		if clientId == "" {
+			return "", errs.New("missing client id", errs.ErrInvalidArgument)
+		}
+		config := clientservice.ClientConfig{}
+		if err := unmarshalConsoleJSON("settings", form("config"), &config); err != nil {
+			return "", err
+		}
+		// the form fields win over the advanced settings
+		config.Id = clientId
+		config.Secret = form("client_secret")
+		config.RedirectURI = form("redirect_uri")
+		config.AccessTokenFormat = form("access_token_format")
+		config.RequireMFA = form("require_mfa") != ""
+		if err := c.clientSrv.PutClient(clientId, config); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("client %s saved", clientId), nil
+	case "delete_client":
+		if err := c.clientSrv.DeleteClient(form("client_id")); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("client %s deleted", form("client_id")), nil
+
+	case "save_claims", "delete_claims":
+		put, remove, id := c.claimSrv.PutUserClaimsSet, c.claimSrv.DeleteUserClaimsSet, form("user")
+		if id == "" {
+			put, remove, id = c.claimSrv.PutClientClaimsSet, c.claimSrv.DeleteClientClaimsSet, form("client")
+		}
+		if id == "" {
+			return "", errs.New("either the user or the client is required", errs.ErrInvalidArgument)
+		}
+		if action == "delete_claims" {
+			if err := remove(id); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("claims of %s deleted", id), nil
+		}
+		claims := claimservice.ClaimsSet{}
+		if err := unmarshalConsoleJSON("claims", form("claims"), &claims); err != nil {
+			return "", err
+		}
+		if err := put(id, claims); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("claims of %s saved", id), nil
+
+	case "save_scope":
+		name := form("name")
+		if name == "" {
+			return "", errs.New("missing scope name", errs.ErrInvalidArgument)
+		}
+		if err := c.consentSrv.PutScope(name, consentservice.Scope{RequireConsent: form("require_consent") != ""}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("scope %s saved", name), nil
+	case "delete_scope":
+		if err := c.consentSrv.DeleteScope(form("name")); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("scope %s deleted", form("name")), nil
+	case "save_consents":
+		username := form("user")
+		// every listed scope is posted with its checkbox, unchecked scopes are revoked
+		consents := make(map[string]bool)
+		for _, scope := range r.PostForm["scope"] {
+			consents[scope] = false
+		}
+		for _, scope := range r.PostForm["granted"] {
+			consents[scope] = true
+		}
+		if err := c.consentSrv.PutUserConsents(username, consents); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("consents of %s saved", username), nil
+	case "delete_consents":
+		if err := c.consentSrv.DeleteUserConsents(form("user")); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("consents of %s revoked", form("user")), nil
+
+	case "add_key":
+		// the key is generated like the fromRandom provider of the signing.keys section
+		rawKeyConfig, _ := json.Marshal(map[string]any{
+			"provider": map[string]any{"fromRandom": map[string]any{"type": form("type")}},
+			"method":   form("method"),
+			"active":   form("active") != "",
+		})
+		keyConfig := signing.SigningServiceKeyConfig{}
+		if err := json.Unmarshal(rawKeyConfig, &keyConfig); err != nil {
+			return "", errs.New("invalid key", errs.ErrInvalidArgument).WithDetails(err.Error())
+		}
+		key, err := c.signingSrv.AddKey(keyConfig)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("key %s added", key.Kid), nil
+	case "activate_key", "deactivate_key":
+		if err := c.signingSrv.SetKeyActive(form("kid"), action == "activate_key"); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("key %s %sd", form("kid"), strings.TrimSuffix(action, "_key")), nil
+	case "delete_key":
+		if err := c.signingSrv.DeleteKey(form("kid")); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("key %s deleted", form("kid")), nil
+	}
+	return "", errs.New(fmt.Sprintf("unknown action '%s'", action), errs.ErrInvalidArgument)
+}
+
+// unmarshalConsoleJSON decodes the JSON text area of a form, an empty one leaves v alone
+func unmarshalConsoleJSON(field string, text string, v any) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(text), v); err != nil {
+		return errs.New(fmt.Sprintf("invalid %s JSON: %v", field, err), errs.ErrInvalidArgument)
+	}
+	return nil
+}
+
+func consoleJSON(v any) string {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+const consoleTimeFormat = "2006-01-02 15:04:05 MST"
+
+// load fills the lists of all pages (the overview shows their sizes) and the object edited on the page
+func (c *console) load(data *tpl.ConsoleTemplateData, query url.Values) error {
+	data.Page = query.Get("page")
+	if data.Page == "" {
+		data.Page = consolePageOverview
+	}
+
+	users, err := c.userSrv.GetUsers()
+	if err != nil {
+		return err
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name() < users[j].Name() })
+	for _, user := range users {
+		data.Users = append(data.Users, newConsoleUser(user))
+	}
+
+	clientConfigs := c.clientSrv.GetClientConfigs()
+	for _, clientId := range slices.Sorted(maps.Keys(clientConfigs)) {
+		data.Clients = append(data.Clients, newConsoleClient(clientConfigs[clientId]))
+	}
+
+	scopes := c.consentSrv.GetScopes()
+	for _, name := range slices.Sorted(maps.Keys(scopes)) {
+		data.Scopes = append(data.Scopes, tpl.ConsoleScope{Name: name, RequireConsent: scopes[name].RequireConsent})
+	}
+
+	for _, key := range c.signingSrv.GetKeys() {
+		data.Keys = append(data.Keys, tpl.ConsoleKey{Kid: key.Kid, Type: string(key.Type), Method: string(key.Method), Active: key.Active})
+	}
+	for keyType := range signing.KeyTypeSigningMethodCompatibility {
+		data.KeyTypes = append(data.KeyTypes, string(keyType))
+	}
+	for method := range signing.SigningMethodKeyTypeCompatibility {
+		data.SigningMethods = append(data.SigningMethods, string(method))
+	}
+	sort.Strings(data.KeyTypes)
+	sort.Strings(data.SigningMethods)
+
+	if err := c.loadSessions(data); err != nil {
+		return err
+	}
+	if err := c.loadCodes(data); err != nil {
+		return err
+	}
+	if journal, ok := c.tokenSrv.(tokenservice.Journal); ok {
+		for _, issuance := range journal.GetIssuances() {
+			data.Tokens = append(data.Tokens, tpl.ConsoleIssuance{
+				Time:     issuance.Time.Format(consoleTimeFormat),
+				ClientId: issuance.ClientId,
+				UserId:   issuance.UserId,
+				Scopes:   strings.Join(issuance.Scopes, " "),
+				Profile:  issuance.Profile,
+				Opaque:   issuance.Opaque,
+			})
+		}
+	}
+
+	// the object edited on the page
+	switch data.Page {
+	case consolePageUsers:
+		if id := query.Get("id"); id != "" {
+			user, err := c.userSrv.GetUser(id)
+			if err != nil {
+				return errs.New(fmt.Sprintf("user %s not found", id), errs.ErrNotFound)
+			}
+			data.User = newConsoleUser(user)
+		}
+	case consolePageClients:
+		if id := query.Get("id"); id != "" {
+			config, ok := clientConfigs[id]
+			if !ok {
+				return errs.New(fmt.Sprintf("client %s not found", id), errs.ErrNotFound)
+			}
+			data.Client = newConsoleClient(config)
+		}
+	case consolePageClaims:
+		data.ClaimsUser, data.ClaimsClient = query.Get("user"), query.Get("client")
+		get, id := c.claimSrv.GetUserClaimsSet, data.ClaimsUser
+		if id == "" {
+			get, id = c.claimSrv.GetClientClaimsSet, data.ClaimsClient
+		}
+		if id == "" {
+			return nil
+		}
+		claims, err := get(id)
+		if errors.Is(err, errs.ErrNotFound) {
+			// a skeleton to start from
+			claims, err = claimservice.ClaimsSet{Default: claimservice.ClaimsLayer{Base: map[string]interface{}{}}}, nil
+		}
+		if err != nil {
+			return err
+		}
+		data.ClaimsJSON = consoleJSON(claims)
+	case consolePageScopes:
+		data.ConsentsUser = query.Get("user")
+		if data.ConsentsUser == "" {
+			return nil
+		}
+		// the defined scopes and the ones the user decided on without a definition
+		consents := c.consentSrv.GetUserConsents(data.ConsentsUser)
+		for _, scope := range slices.Sorted(maps.Keys(scopes)) {
+			data.Consents = append(data.Consents, tpl.ConsoleConsent{Scope: scope, Granted: consents[scope]})
+		}
+		for _, scope := range slices.Sorted(maps.Keys(consents)) {
+			if _, defined := scopes[scope]; !defined {
+				data.Consents = append(data.Consents, tpl.ConsoleConsent{Scope: scope, Granted: consents[scope]})
+			}
+		}
+	}
+	return nil
+}
+
+func newConsoleUser(user userservice.Entity) tpl.ConsoleUser {
+	consoleUser := tpl.ConsoleUser{
+		Username:   user.Name(),
+		Email:      user.Email(),
+		Active:     user.Active(),
+		TOTP:       user.TOTPSecret() != "",
+		TOTPSecret: user.TOTPSecret(),
+	}
+	if attributes := user.GetAllAttributes(); len(attributes) > 0 {
+		consoleUser.AttributesJSON = consoleJSON(attributes)
+	}
+	return consoleUser
+}
+
+func newConsoleClient(config clientservice.ClientConfig) tpl.ConsoleClient {
+	return tpl.ConsoleClient{
+		Id:                config.Id,
+		RedirectURI:       config.RedirectURI,
+		AccessTokenFormat: config.AccessTokenFormat,
+		RequireMFA:        config.RequireMFA,
+		ConfigJSON:        consoleJSON(config),
+	}
+}
+
+// consoleSnapshot returns the snapshot of the stateful service, false when the provider of the realm keeps no state
+func (c *console) snapshot(service string, v any) (bool, error) {
+	stateful, ok := c.stateful[service]
+	if !ok {
+		return false, nil
+	}
+	raw, err := stateful.Snapshot()
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, fmt.Errorf("failed to read the %s snapshot: %w", service, err)
+	}
+	return true, nil
+}
+
+// consoleSnapshotUser is the part of a user of a snapshot the console shows
+type consoleSnapshotUser struct {
+	Username string `json:"username"`
+}
+
+func (c *console) loadSessions(data *tpl.ConsoleTemplateData) error {
+	snapshot := map[string]struct {
+		LastUsed time.Time                  `json:"lastUsed"`
+		Data     map[string]json.RawMessage `json:"data"`
+	}{}
+	if ok, err := c.snapshot("sessions", &snapshot); !ok {
+		return err
+	}
+	sessionIDs := slices.Collect(maps.Keys(snapshot))
+	sort.Slice(sessionIDs, func(i, j int) bool {
+		return snapshot[sessionIDs[i]].LastUsed.After(snapshot[sessionIDs[j]].LastUsed)
+	})
+	for _, sessionID := range sessionIDs {
+		session := snapshot[sessionID]
+		user := consoleSnapshotUser{}
+		json.Unmarshal(session.Data["user"], &user)
+		amr := []string{}
+		json.Unmarshal(session.Data["amr"], &amr)
+		// the session id is the cookie of the user, only its beginning is shown
+		data.Sessions = append(data.Sessions, tpl.ConsoleSession{
+			Id:       sessionID[:min(8, len(sessionID))] + "…",
+			Username: user.Username,
+			AMR:      strings.Join(amr, " "),
+			LastUsed: session.LastUsed.Format(consoleTimeFormat),
+		})
+	}
+	return nil
+}
+
+func (c *console) loadCodes(data *tpl.ConsoleTemplateData) error {
+	snapshot := map[string]struct {
+		ExpiresAt   time.Time           `json:"expiresAt"`
+		RedirectURI string              `json:"redirectUri"`
+		Scopes      []string            `json:"scopes"`
+		ClientId    string              `json:"clientId"`
+		User        consoleSnapshotUser `json:"user"`
+	}{}
+	if ok, err := c.snapshot("authorizations", &snapshot); !ok {
+		return err
+	}
+	codes := slices.Collect(maps.Keys(snapshot))
+	sort.Slice(codes, func(i, j int) bool { return snapshot[codes[i]].ExpiresAt.Before(snapshot[codes[j]].ExpiresAt) })
+	for _, code := range codes {
+		request := snapshot[code]
+		data.Codes = append(data.Codes, tpl.ConsoleCode{
+			Code:        code,
+			ClientId:    request.ClientId,
+			Username:    request.User.Username,
+			Scopes:      strings.Join(request.Scopes, " "),
+			RedirectURI: request.RedirectURI,
+			ExpiresAt:   request.ExpiresAt.Format(consoleTimeFormat),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/axent-pl/oauth2mock/pkg/faultservice"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+)
+
+// FaultsAdminHandler manages the fault injection rules at runtime:
+// GET lists them, PUT replaces them (the faults section), POST adds or replaces a rule,
+// PATCH switches the rule of the name query parameter (or all faults) on and off,
+// DELETE removes the rule of the name query parameter (or all rules)
+func FaultsAdminHandler(faultSrv faultservice.Service) routing.HandlerFunc {
+	writeConfig := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(faultservice.RuleSet{Enabled: faultSrv.Enabled(), Rules: faultSrv.GetRules()})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler FaultsAdminHandler started", "request", routing.RequestIDLogValue(r))
+		name := r.URL.Query().Get("name")
+
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			config := faultservice.RuleSet{}
+			if err := decodeJSONBody(r, &config); err != nil {
+				http.Error(w, "invalid faults config", http.StatusBadRequest)
+				return
+			}
+			if err = faultSrv.SetRules(config.Rules); err == nil {
+				faultSrv.SetEnabled(config.Enabled)
+			}
+		case http.MethodPost:
+			rule := faultservice.Rule{}
+			if err := decodeJSONBody(r, &rule); err != nil {
+				http.Error(w, "invalid rule", http.StatusBadRequest)
+				return
+			}
+			err = faultSrv.PutRule(rule)
+		case http.MethodPatch:
+			toggle := struct {
+				Enabled *bool `json:"enabled"`
+			}{}
+			if err := decodeJSONBody(r, &toggle); err != nil || toggle.Enabled == nil {
+				http.Error(w, "the body must set enabled", http.StatusBadRequest)
+				return
+			}
+			if name == "" {
+				faultSrv.SetEnabled(*toggle.Enabled)
+			} else {
+				err = faultSrv.SetRuleEnabled(name, *toggle.Enabled)
+			}
+		case http.MethodDelete:
+			if name == "" {
+				err = faultSrv.SetRules(nil)
+			} else {
+				err = faultSrv.DeleteRule(name)
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		if r.Method != http.MethodGet {
+			slog.Warn("fault injection rules changed", "request", routing.RequestIDLogValue(r), "method", r.Method, "name", name, "enabled", faultSrv.Enabled())
+		}
+		writeConfig(w)
+	}
+}
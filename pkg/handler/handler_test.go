@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/auth"
+	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/realm"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "http://localhost"
+
+// testConfig is the data file of the test realm, sections passed to newTestRealm replace its sections
+const testConfig = `{
+	"signing": {"keys": [{"provider": {"fromRandom": {"type": "P-256", "deterministic": true, "seed": "handler"}}, "method": "ES256", "active": true}]},
+	"tokens": {"provider": "memory", "lifetimes": {
+		"base": {"accessTokenSeconds": 3600, "idTokenSeconds": 300, "refreshTokenIdleSeconds": 1800, "refreshTokenAbsoluteSeconds": 28800},
+		"scopeOverrides": {"offline_access": {"refreshTokenIdleSeconds": 2592000, "refreshTokenAbsoluteSeconds": 7776000}}
+	}},
+	"users": {"provider": "json", "users": {
+		"demo": {"username": "demo", "password": "demo", "consents": {"openid": true, "profile": true},
+			"claims": {"default": {"base": {"preferred_username": "demo", "email": "demo@example.com"}}}}
+	}},
+	"claims": {"provider": "json"},
+	"clients": {
+		"ACME": {"client_id": "ACME", "client_secret": "acme-secret", "redirect_uri": "http://localhost/callback*",
+			"claims": {"default": {"base": {"azp": "ACME"}}}}
+	},
+	"consents": {"provider": "json", "scopes": {
+		"openid": {"requireConsent": false}, "profile": {"requireConsent": false}, "offline_access": {"requireConsent": true}
+	}},
+	"authorization": {"provider": "memory", "authorizationRequestTTLSeconds": 60, "authorizationCodeLength": 16},
+	"session": {"provider": "memory"}
+}`
+
+// newTestRealm loads the default realm of testConfig, sections (JSON object) replace the sections of testConfig
+func newTestRealm(t *testing.T, sections string) *realm.Realm {
+	t.Helper()
+	config := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(testConfig), &config); err != nil {
+		t.Fatal(err)
+	}
+	if sections != "" {
+		if err := json.Unmarshal([]byte(sections), &config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rawConfig, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	realms, err := realm.LoadAll(rawConfig, t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	return realms[0]
+}
+
+func testOpenIDConfiguration() auth.OpenIDConfiguration {
+	return auth.OpenIDConfiguration{Issuer: testIssuer}
+}
+
+// newRequest creates a request, form values are posted
+func newRequest(method string, target string, form url.Values) *http.Request {
+	if form == nil {
+		return httptest.NewRequest(method, target, nil)
+	}
+	r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// serve calls the handler with a request, form values are posted
+func serve(h routing.HandlerFunc, method string, target string, form url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h(w, newRequest(method, target, form))
+	return w
+}
+
+// serveInSession calls the handler like serve within the session sessionID
+func serveInSession(h routing.HandlerFunc, sessionID string, method string, target string, form url.Values) *httptest.ResponseRecorder {
+	r := newRequest(method, target, form)
+	w := httptest.NewRecorder()
+	h(w, r.WithContext(context.WithValue(r.Context(), routing.CTX_SESSION_ID, sessionID)))
+	return w
+}
+
+// serveJSON calls the handler with a JSON request body
+func serveJSON(h routing.HandlerFunc, method string, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// decodeJSON decodes the JSON body of a response
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	body := map[string]any{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+// tokenClaims returns the claims of a signed token without verifying it
+func tokenClaims(t *testing.T, token string) jwt.MapClaims {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatalf("ParseUnverified(%q) error = %v", token, err)
+	}
+	return claims
+}
+
+// testTemplates renders the name and the data of a template as JSON, see renderedPage
+type testTemplates struct{}
+
+func (*testTemplates) Render(w io.Writer, templateName string, data any) error {
+	return json.NewEncoder(w).Encode(map[string]any{"template": templateName, "data": data})
+}
+
+var registerTestTemplates sync.Once
+
+// useTestTemplates provides testTemplates to the handlers created afterwards
+func useTestTemplates() {
+	registerTestTemplates.Do(func() { di.Register(&testTemplates{}) })
+}
+
+// renderedPage returns the template name and data of a page rendered by testTemplates
+func renderedPage(t *testing.T, w *httptest.ResponseRecorder) (string, map[string]any) {
+	t.Helper()
+	page := decodeJSON(t, w)
+	name, _ := page["template"].(string)
+	data, _ := page["data"].(map[string]any)
+	return name, data
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/dto"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/http/request"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/tokenservice"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// resolveAccessToken returns the claims of a valid access token: opaque and encrypted access tokens
+// are looked up in the token store, JWT access tokens are verified. Other tokens (ID, refresh) fail.
+func resolveAccessToken(token string, userSvc userservice.Service, clientSvc clientservice.Service, claimSvc claimservice.Service, tokenSvc tokenservice.Service, keySvc signing.SigningServicer) (map[string]interface{}, error) {
+	ref, err := tokenSvc.Get(token)
+	if err == nil {
+		return referenceClaims(ref, userSvc, clientSvc, claimSvc)
+	}
+	if !errors.Is(err, errs.ErrNotFound) {
+		return nil, err
+	}
+	if !keySvc.Valid([]byte(token)) {
+		return nil, errs.New("invalid token", errs.ErrUnauthenticated).WithDetails("invalid or expired token")
+	}
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		return nil, errs.Wrap("invalid token", err).WithKind(errs.ErrUnauthenticated)
+	}
+	if typ, _ := claims["typ"].(string); typ != "Bearer" {
+		return nil, errs.New("invalid token", errs.ErrUnauthenticated).WithDetailsf("token type '%s' is not an access token", typ)
+	}
+	return claims, nil
+}
+
+// referenceClaims rebuilds the access token claims of a stored token reference.
+func referenceClaims(ref tokenservice.Reference, userSvc userservice.Service, clientSvc clientservice.Service, claimSvc claimservice.Service) (map[string]interface{}, error) {
+	client, err := clientSvc.GetClient(ref.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	var user userservice.Entity
+	if ref.UserId != "" {
+		user, err = userSvc.GetUser(ref.UserId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return accessTokenClaims(ref.Issuer, user, client, ref.Scopes, ref.ExtraClaims, ref.IssuedAt, ref.ExpiresAt, claimSvc)
+}
+
+// TokenIntrospectionHandler implements OAuth 2.0 Token Introspection (RFC 7662)
+// for JWT, encrypted and opaque access tokens.
+func TokenIntrospectionHandler(clientSvc clientservice.Service, userSvc userservice.Service, claimSvc claimservice.Service, tokenSvc tokenservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler TokenIntrospectionHandler started", "request", routing.RequestIDLogValue(r))
+		requstDTO := &dto.TokenIntrospectionRequestDTO{}
+		if valid, validator := request.UnmarshalAndValidate(r, requstDTO); !valid {
+			oauthError(w, errInvalidRequest, validationErrorDescription(validator))
+			slog.Error("request validation failed", "request", routing.RequestIDLogValue(r), "validationErrors", validator.Errors)
+			return
+		}
+
+		// Authenticate client
+		credentials, err := authentication.NewCredentials(authentication.FromCliendIdAndSecret(requstDTO.ClientId, requstDTO.ClientSecret))
+		if err != nil {
+			oauthError(w, errInvalidRequest, err.Error())
+			slog.Error("could not read client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
+			return
+		}
+		if _, err := clientSvc.Authenticate(credentials); err != nil {
+			oauthError(w, errInvalidClient, "client authentication failed")
+			slog.Error("invalid client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
+			return
+		}
+
+		response := map[string]interface{}{"active": false}
+		claims, err := resolveAccessToken(requstDTO.Token, userSvc, clientSvc, claimSvc, tokenSvc, keySvc)
+		if err != nil {
+			slog.Info("inactive token", "request", routing.RequestIDLogValue(r), "error", err)
+		}
+		if claims != nil {
+			for k, v := range claims {
+				response[k] = v
+			}
+			response["active"] = true
+			response["client_id"] = claims["azp"]
+			response["token_type"] = "Bearer"
+		}
+
+		responseBytes, err := json.Marshal(response)
+		if err != nil {
+			oauthError(w, errServerError, err.Error())
+			slog.Error("failed to marshal introspection response", "request", routing.RequestIDLogValue(r), "error", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(responseBytes)
+	}
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+)
+
+func TestTokenIntrospection(t *testing.T) {
+	encryptionKey, err := signing.NewSigningKeyHandlerFromRandom(signing.P256, true, "introspection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := encryptionKey.GetJWK()
+	jwk.Use, jwk.Alg = "enc", ""
+	jwks, err := json.Marshal(signing.JSONWebKeySet{Keys: []signing.JSONWebKey{jwk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRealm(t, fmt.Sprintf(`{"clients": {
+		"ACME": {"client_id": "ACME", "client_secret": "acme-secret", "redirect_uri": "*", "claims": {"default": {}}},
+		"OPAQUE": {"client_id": "OPAQUE", "client_secret": "opaque-secret", "redirect_uri": "*", "claims": {"default": {}},
+			"access_token_format": "opaque"},
+		"JWE": {"client_id": "JWE", "client_secret": "jwe-secret", "redirect_uri": "*", "claims": {"default": {}},
+			"access_token_encrypted_response_alg": "ECDH-ES", "access_token_encrypted_response_enc": "A256GCM", "jwks": %s}
+	}}`, jwks))
+	openidConfig := testOpenIDConfiguration()
+	passwordHandler := TokenPasswordHandler(openidConfig, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	introspectionHandler := TokenIntrospectionHandler(r.Clients, r.Users, r.Claims, r.Tokens, r.Signing)
+
+	tokens := func(clientId string) map[string]any {
+		w := serve(passwordHandler, http.MethodPost, "/token", url.Values{
+			"grant_type": {"password"}, "client_id": {clientId}, "client_secret": {strings.ToLower(clientId) + "-secret"},
+			"username": {"demo"}, "password": {"demo"}, "scope": {"openid"},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("password grant of %s status = %d, body %s", clientId, w.Code, w.Body.String())
+		}
+		return decodeJSON(t, w)
+	}
+	acme, opaque, encrypted := tokens("ACME"), tokens("OPAQUE"), tokens("JWE")
+	if parts := strings.Count(encrypted["access_token"].(string), ".") + 1; parts != 5 {
+		t.Fatalf("access token of JWE has %d parts, want an encrypted token", parts)
+	}
+
+	tests := []struct {
+		name       string
+		token      any
+		wantActive bool
+		wantClient string
+	}{
+		{name: "JWT access token", token: acme["access_token"], wantActive: true, wantClient: "ACME"},
+		{name: "opaque access token", token: opaque["access_token"], wantActive: true, wantClient: "OPAQUE"},
+		{name: "encrypted access token", token: encrypted["access_token"], wantActive: true, wantClient: "JWE"},
+		{name: "refresh token", token: acme["refresh_token"], wantActive: false},
+		{name: "ID token", token: acme["id_token"], wantActive: false},
+		{name: "unknown token", token: "unknown", wantActive: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(introspectionHandler, http.MethodPost, "/introspect", url.Values{
+				"client_id": {"ACME"}, "client_secret": {"acme-secret"}, "token": {tt.token.(string)},
+			})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+			body := decodeJSON(t, w)
+			if body["active"] != tt.wantActive {
+				t.Errorf("active = %v, want %v", body["active"], tt.wantActive)
+			}
+			if tt.wantActive && (body["client_id"] != tt.wantClient || body["sub"] != "demo") {
+				t.Errorf("client_id = %v, sub = %v, want %s and demo", body["client_id"], body["sub"], tt.wantClient)
+			}
+		})
+	}
+
+	w := serve(introspectionHandler, http.MethodPost, "/introspect", url.Values{
+		"client_id": {"ACME"}, "client_secret": {"wrong"}, "token": {acme["access_token"].(string)},
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status with invalid client credentials = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
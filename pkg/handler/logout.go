@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/dto"
+	"github.com/axent-pl/oauth2mock/pkg/http/request"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EndSessionHandler implements OpenID Connect RP-Initiated Logout: the user is signed out of the session
+// and redirected to post_logout_redirect_uri if it matches the client's redirect URIs
+func EndSessionHandler(clientSvc clientservice.Service, sessionSvc sessionservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler EndSessionHandler started", "request", routing.RequestIDLogValue(r))
+		requestDTO := &dto.EndSessionRequestDTO{}
+		request.Unmarshal(r, requestDTO)
+
+		// session
+		if sessionID, ok := r.Context().Value(routing.CTX_SESSION_ID).(string); ok {
+			if sessionData, ok := sessionSvc.Get(sessionID); ok {
+				routing.SignOut(sessionData)
+				sessionSvc.Put(sessionID, sessionData)
+			}
+		}
+
+		// client
+		clientId := requestDTO.ClientId
+		if clientId == "" && requestDTO.IdTokenHint != "" && keySvc.Valid([]byte(requestDTO.IdTokenHint)) {
+			idTokenClaims := jwt.MapClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(requestDTO.IdTokenHint, idTokenClaims); err == nil {
+				clientId, _ = idTokenClaims["aud"].(string)
+			}
+		}
+
+		if requestDTO.PostLogoutRedirectURI == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("You have been logged out."))
+			return
+		}
+		client, err := clientSvc.GetClient(clientId)
+		if err != nil {
+			slog.Error("invalid client", "request", routing.RequestIDLogValue(r), "error", err)
+			oauthError(w, errInvalidRequest, "post_logout_redirect_uri requires client_id or a valid id_token_hint")
+			return
+		}
+		if !client.ValidateRedirectURI(requestDTO.PostLogoutRedirectURI) {
+			slog.Error("invalid post logout redirect uri", "request", routing.RequestIDLogValue(r), "redirectURI", requestDTO.PostLogoutRedirectURI)
+			oauthError(w, errInvalidRequest, "invalid post_logout_redirect_uri")
+			return
+		}
+		redirectURL, err := url.Parse(requestDTO.PostLogoutRedirectURI)
+		if err != nil {
+			oauthError(w, errInvalidRequest, "invalid post_logout_redirect_uri")
+			return
+		}
+		if requestDTO.State != "" {
+			redirectURLQuery := redirectURL.Query()
+			redirectURLQuery.Set("state", requestDTO.State)
+			redirectURL.RawQuery = redirectURLQuery.Encode()
+		}
+		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+)
+
+func TestEndSessionClearsSession(t *testing.T) {
+	r := newTestRealm(t, "")
+	user, err := r.Users.GetUser("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Sessions.Put("sid", sessionservice.SessionData{
+		"user":           user,
+		"amr":            []string{"pwd", "otp"},
+		"auth_time":      time.Now(),
+		"mfa_user":       user,
+		"totp_enrolment": "secret",
+		"persona":        "demo",
+	})
+	h := EndSessionHandler(r.Clients, r.Sessions, r.Signing)
+
+	req := httptest.NewRequest(http.MethodGet, "/logout?client_id=ACME&post_logout_redirect_uri=http://localhost/callback&state=xyz", nil)
+	req = req.WithContext(context.WithValue(req.Context(), routing.CTX_SESSION_ID, "sid"))
+	w := httptest.NewRecorder()
+	h(w, req)
+
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "http://localhost/callback?state=xyz" {
+		t.Errorf("status = %d, Location = %q, want a redirect to the post logout redirect URI", w.Code, w.Header().Get("Location"))
+	}
+	sessionData, ok := r.Sessions.Get("sid")
+	if !ok {
+		t.Fatal("session not found")
+	}
+	if len(sessionData) != 0 {
+		t.Errorf("session data after logout = %v, want none", sessionData)
+	}
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/mailservice"
+)
+
+// MailOutboxHandler exposes the messages kept by the mailer: GET lists them (of the recipient
+// of the to query parameter), DELETE clears the outbox
+func MailOutboxHandler(mailSrv mailservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler MailOutboxHandler started", "request", routing.RequestIDLogValue(r))
+		outbox, ok := mailSrv.(mailservice.Outbox)
+		if !ok {
+			http.Error(w, "the mailer does not keep the sent messages", http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			outbox.ClearMessages()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(outbox.GetMessages(r.URL.Query().Get("to")))
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/mailservice"
+	"github.com/axent-pl/oauth2mock/pkg/realm"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+// emailLoginFlow is the login of a test realm with the email login enabled, it records the authenticated user
+type emailLoginFlow struct {
+	realm *realm.Realm
+	h     routing.HandlerFunc
+	user  userservice.Entity
+	amr   []string
+}
+
+func newEmailLoginFlow(t *testing.T) *emailLoginFlow {
+	t.Helper()
+	useTestTemplates()
+	f := &emailLoginFlow{realm: newTestRealm(t, `{"users": {"provider": "json", "users": {
+		"demo": {"username": "demo", "password": "demo", "email": "demo@example.com", "consents": {"openid": true}}
+	}}}`)}
+	f.h = routing.UserAuthenticationMiddleware(f.realm.Users, f.realm.Sessions, f.realm.Clients, routing.WithEmailLogin(f.realm.Mail))(
+		func(w http.ResponseWriter, r *http.Request) {
+			f.user, _ = r.Context().Value(routing.CTX_USER).(userservice.Entity)
+			f.amr, _ = r.Context().Value(routing.CTX_AMR).([]string)
+		})
+	return f
+}
+
+// requestEmail requests the email login in the session and returns the message sent
+func (f *emailLoginFlow) requestEmail(t *testing.T, sessionID string) mailservice.Message {
+	t.Helper()
+	f.realm.Sessions.Put(sessionID, sessionservice.SessionData{})
+	w := serveInSession(f.h, sessionID, http.MethodPost, "/authorize?client_id=ACME", url.Values{"email": {"demo@example.com"}})
+	if name, _ := renderedPage(t, w); name != "email" {
+		t.Fatalf("page after the email request = %s, want the email page", name)
+	}
+	messages := f.realm.Mail.(mailservice.Outbox).GetMessages("demo@example.com")
+	if len(messages) == 0 {
+		t.Fatal("no email sent")
+	}
+	return messages[len(messages)-1]
+}
+
+// signedIn repeats the request of the login and tells whether it reached the handler as demo signed in by email
+func (f *emailLoginFlow) signedIn(sessionID string) bool {
+	f.user, f.amr = nil, nil
+	serveInSession(f.h, sessionID, http.MethodGet, "/authorize?client_id=ACME", nil)
+	return f.user != nil && f.user.Id() == "demo" && slices.Equal(f.amr, []string{routing.AMREmail})
+}
+
+func TestEmailLoginCode(t *testing.T) {
+	f := newEmailLoginFlow(t)
+	message := f.requestEmail(t, "sid")
+	code, ok := strings.CutPrefix(message.Subject, "Your sign-in code is ")
+	if !ok || !strings.Contains(message.Text, code) {
+		t.Fatalf("email = %+v, want the code in the subject and the text", message)
+	}
+
+	w := serveInSession(f.h, "sid", http.MethodPost, "/authorize?client_id=ACME", url.Values{"email_code": {"not-the-code"}})
+	if name, page := renderedPage(t, w); name != "email" || page["FormErrorMessage"] != "invalid code" {
+		t.Fatalf("page after an invalid code = %s %v, want the email page with an error", name, page)
+	}
+
+	w = serveInSession(f.h, "sid", http.MethodPost, "/authorize?client_id=ACME", url.Values{"email_code": {code}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/authorize?client_id=ACME" {
+		t.Fatalf("status = %d, Location = %q, want the request repeated", w.Code, w.Header().Get("Location"))
+	}
+	if !f.signedIn("sid") {
+		t.Errorf("authenticated user = %v, amr = %v, want demo signed in by email", f.user, f.amr)
+	}
+}
+
+func TestEmailLoginCodeExpires(t *testing.T) {
+	f := newEmailLoginFlow(t)
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock.Default.Set(start)
+	defer clock.Default.Reset()
+
+	message := f.requestEmail(t, "sid")
+	code, _ := strings.CutPrefix(message.Subject, "Your sign-in code is ")
+	clock.Default.Set(start.Add(time.Hour))
+
+	w := serveInSession(f.h, "sid", http.MethodPost, "/authorize?client_id=ACME", url.Values{"email_code": {code}})
+	if name, page := renderedPage(t, w); name != "login" || page["FormErrorMessage"] != "the code has expired, request a new one" {
+		t.Fatalf("page after an expired code = %s %v, want the login page with an error", name, page)
+	}
+	if f.signedIn("sid") {
+		t.Error("expired code signed the user in")
+	}
+}
+
+func TestEmailLoginUnknownAddress(t *testing.T) {
+	f := newEmailLoginFlow(t)
+	f.realm.Sessions.Put("sid", sessionservice.SessionData{})
+
+	// the page does not tell whether the address is known
+	w := serveInSession(f.h, "sid", http.MethodPost, "/authorize", url.Values{"email": {"unknown@example.com"}})
+	if name, _ := renderedPage(t, w); name != "email" {
+		t.Errorf("page = %s, want the email page", name)
+	}
+	if messages := f.realm.Mail.(mailservice.Outbox).GetMessages(""); len(messages) != 0 {
+		t.Errorf("emails sent to an unknown address: %v", messages)
+	}
+}
+
+func TestEmailLoginMagicLink(t *testing.T) {
+	f := newEmailLoginFlow(t)
+	message := f.requestEmail(t, "sid")
+	var link *url.URL
+	for _, line := range strings.Split(message.Text, "\n") {
+		if strings.Contains(line, "login_token=") {
+			link, _ = url.Parse(strings.TrimSpace(line))
+		}
+	}
+	if link == nil {
+		t.Fatalf("email text %q has no magic link", message.Text)
+	}
+
+	// the link only works in the browser the login was started in
+	f.realm.Sessions.Put("other", sessionservice.SessionData{})
+	w := serveInSession(f.h, "other", http.MethodGet, link.RequestURI(), nil)
+	if name, page := renderedPage(t, w); name != "login" || page["FormErrorMessage"] != "the sign-in link is invalid or has expired" {
+		t.Errorf("page of the link in another session = %s %v, want the login page with an error", name, page)
+	}
+
+	w = serveInSession(f.h, "sid", http.MethodGet, link.RequestURI(), nil)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/authorize?client_id=ACME" {
+		t.Fatalf("status = %d, Location = %q, want the request repeated without the login token", w.Code, w.Header().Get("Location"))
+	}
+	if !f.signedIn("sid") {
+		t.Errorf("authenticated user = %v, amr = %v, want demo signed in by email", f.user, f.amr)
+	}
+}
+
+func TestMailOutbox(t *testing.T) {
+	r := newTestRealm(t, "")
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		if err := r.Mail.Send(mailservice.Message{To: to, Subject: "hello", Text: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := MailOutboxHandler(r.Mail)
+	messages := func(target string) []mailservice.Message {
+		t.Helper()
+		w := serve(h, http.MethodGet, target, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+		}
+		var messages []mailservice.Message
+		if err := json.Unmarshal(w.Body.Bytes(), &messages); err != nil {
+			t.Fatal(err)
+		}
+		return messages
+	}
+
+	if got := messages("/mail/outbox"); len(got) != 2 {
+		t.Errorf("outbox = %v, want both messages", got)
+	}
+	if got := messages("/mail/outbox?to=b@example.com"); len(got) != 1 || got[0].To != "b@example.com" {
+		t.Errorf("outbox of b@example.com = %v, want its message", got)
+	}
+	if w := serve(h, http.MethodDelete, "/mail/outbox", nil); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got := messages("/mail/outbox"); len(got) != 0 {
+		t.Errorf("outbox after DELETE = %v, want none", got)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/dto"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/http/request"
+)
+
+// OAuth 2.0 error codes (RFC 6749 sections 4.1.2.1 and 5.2, OpenID Connect Core section 3.1.2.6)
+const (
+	errInvalidRequest          = "invalid_request"
+	errInvalidClient           = "invalid_client"
+	errInvalidGrant            = "invalid_grant"
+	errUnauthorizedClient      = "unauthorized_client"
+	errUnsupportedGrantType    = "unsupported_grant_type"
+	errUnsupportedResponseType = "unsupported_response_type"
+	errInvalidScope            = "invalid_scope"
+	errServerError             = "server_error"
+	errInvalidRequestObject    = "invalid_request_object"
+	errAccessDenied            = "access_denied"
+)
+
+// oauthErrorCode maps the errs kind of err to an OAuth 2.0 error code, fallback is used for other errors
+func oauthErrorCode(err error, fallback string) string {
+	switch {
+	case errors.Is(err, consentservice.ErrUndefinedScope):
+		return errInvalidScope
+	case errors.Is(err, errs.ErrInternal):
+		return errServerError
+	case errors.Is(err, errs.ErrUnauthenticated):
+		return errInvalidClient
+	case errors.Is(err, errs.ErrPermissionDenied):
+		return errUnauthorizedClient
+	case errors.Is(err, errs.ErrInvalidArgument):
+		return errInvalidRequest
+	}
+	return fallback
+}
+
+// authorizeErrorCode maps the errs kind of err to an authorization error code (RFC 6749 section 4.1.2.1),
+// which has no invalid_client: an unauthenticated request is denied
+func authorizeErrorCode(err error, fallback string) string {
+	switch {
+	case errors.Is(err, consentservice.ErrUndefinedScope):
+		return errInvalidScope
+	case errors.Is(err, errs.ErrInternal):
+		return errServerError
+	case errors.Is(err, errs.ErrUnauthenticated):
+		return errAccessDenied
+	case errors.Is(err, errs.ErrPermissionDenied):
+		return errUnauthorizedClient
+	case errors.Is(err, errs.ErrInvalidArgument):
+		return errInvalidRequest
+	}
+	return fallback
+}
+
+// validationErrorDescription lists the validation errors in a stable order
+func validationErrorDescription(validator *request.Validator) string {
+	messages := make([]string, 0, len(validator.Errors))
+	for _, validationError := range validator.Errors {
+		messages = append(messages, validationError.ErrorMessage)
+	}
+	slices.Sort(messages)
+	return strings.Join(messages, ", ")
+}
+
+// oauthError writes a JSON error response, invalid_client is answered with 401 and a WWW-Authenticate challenge
+func oauthError(w http.ResponseWriter, code string, description string) {
+	status := http.StatusBadRequest
+	switch code {
+	case errInvalidClient:
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth2mock"`)
+	case errServerError:
+		status = http.StatusInternalServerError
+	}
+	body, err := json.Marshal(dto.ErrorResponseDTO{Error: code, ErrorDescription: description})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// authorizeErrorRedirect sends the error to the client's redirect URI (RFC 6749 section 4.1.2.1),
+// it must only be used once the redirect URI has been validated
+func authorizeErrorRedirect(w http.ResponseWriter, r *http.Request, redirectURI string, state string, code string, description string) {
+	redirectURL, err := url.Parse(redirectURI)
+	if err != nil {
+		oauthError(w, errInvalidRequest, "invalid redirect_uri")
+		return
+	}
+	redirectURLQuery := redirectURL.Query()
+	redirectURLQuery.Set("error", code)
+	if description != "" {
+		redirectURLQuery.Set("error_description", description)
+	}
+	if state != "" {
+		redirectURLQuery.Set("state", state)
+	}
+	redirectURL.RawQuery = redirectURLQuery.Encode()
+	slog.Info("authorize error redirect", "redirectURL", redirectURL.String())
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/realm"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+const personaUsers = `{"users": {"provider": "json", "users": {
+	"demo": {"username": "demo", "password": "demo", "attributes": {"persona": {"description": "Demo user"}},
+		"claims": {"default": {"base": {"realm_roles": ["ADMIN"], "roles": ["ADMIN", "AUDITOR"]}}}},
+	"alice": {"username": "alice", "password": "alice"}
+}}}`
+
+// personaLogin returns the login of the realm and a pointer to the user which reached the handler
+func personaLogin(r *realm.Realm, options ...routing.LoginOption) (routing.HandlerFunc, *userservice.Entity) {
+	var user userservice.Entity
+	h := routing.UserAuthenticationMiddleware(r.Users, r.Sessions, r.Clients, options...)(func(w http.ResponseWriter, req *http.Request) {
+		user, _ = req.Context().Value(routing.CTX_USER).(userservice.Entity)
+	})
+	return h, &user
+}
+
+func TestPersonaLoginPage(t *testing.T) {
+	useTestTemplates()
+	r := newTestRealm(t, personaUsers)
+	r.Sessions.Put("sid", sessionservice.SessionData{})
+	h, _ := personaLogin(r, routing.WithPersonaLogin(r.Claims))
+
+	w := serveInSession(h, "sid", http.MethodGet, "/authorize?client_id=ACME", nil)
+	name, page := renderedPage(t, w)
+	want := []any{
+		map[string]any{"Username": "alice", "Description": "", "Roles": []any{}},
+		map[string]any{"Username": "demo", "Description": "Demo user", "Roles": []any{"ADMIN", "AUDITOR"}},
+	}
+	if name != "login" || !reflect.DeepEqual(page["Personas"], want) {
+		t.Errorf("login page = %s %v, want the personas %v", name, page["Personas"], want)
+	}
+}
+
+func TestPersonaLogin(t *testing.T) {
+	useTestTemplates()
+
+	tests := []struct {
+		name     string
+		personas bool
+		method   string
+		target   string
+		form     url.Values
+		wantUser string
+		wantPage string
+		wantErr  string
+	}{
+		{name: "picked", personas: true, method: http.MethodPost, target: "/authorize", form: url.Values{"persona": {"demo"}}, wantUser: "demo"},
+		{name: "login hint", personas: true, method: http.MethodGet, target: "/authorize?login_hint=alice&dev_login=true", wantUser: "alice"},
+		{name: "unknown persona", personas: true, method: http.MethodPost, target: "/authorize", form: url.Values{"persona": {"nobody"}}, wantPage: "login", wantErr: "unknown persona"},
+		{name: "disabled", method: http.MethodPost, target: "/authorize", form: url.Values{"persona": {"demo"}}, wantPage: "login"},
+		{name: "disabled login hint", method: http.MethodGet, target: "/authorize?login_hint=alice&dev_login=true", wantPage: "login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRealm(t, personaUsers)
+			r.Sessions.Put("sid", sessionservice.SessionData{})
+			var options []routing.LoginOption
+			if tt.personas {
+				options = append(options, routing.WithPersonaLogin(r.Claims))
+			}
+			h, user := personaLogin(r, options...)
+
+			w := serveInSession(h, "sid", tt.method, tt.target, tt.form)
+			if tt.wantPage != "" {
+				name, page := renderedPage(t, w)
+				if name != tt.wantPage || (tt.wantErr != "" && page["FormErrorMessage"] != tt.wantErr) {
+					t.Errorf("page = %s %v, want %s with error %q", name, page, tt.wantPage, tt.wantErr)
+				}
+				if *user != nil {
+					t.Errorf("user %s signed in, want none", (*user).Id())
+				}
+				return
+			}
+
+			// the persona is signed in and the request repeated
+			if w.Code != http.StatusSeeOther {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, http.StatusSeeOther, w.Body.String())
+			}
+			serveInSession(h, "sid", http.MethodGet, w.Header().Get("Location"), nil)
+			if *user == nil || (*user).Id() != tt.wantUser {
+				t.Errorf("signed in user = %v, want %s", *user, tt.wantUser)
+			}
+		})
+	}
+}
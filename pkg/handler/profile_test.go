@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/realm"
+)
+
+// profileTokens returns the token response of a password grant of demo and the UserInfo response of its access token
+func profileTokens(t *testing.T, r *realm.Realm, clientId string, clientSecret string, scope string) (map[string]any, map[string]any) {
+	t.Helper()
+	passwordHandler := TokenPasswordHandler(testOpenIDConfiguration(), r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	w := serve(passwordHandler, http.MethodPost, "/token", url.Values{
+		"grant_type": {"password"}, "client_id": {clientId}, "client_secret": {clientSecret},
+		"username": {"demo"}, "password": {"demo"}, "scope": {scope},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("password grant status = %d, body %s", w.Code, w.Body.String())
+	}
+	tokens := decodeJSON(t, w)
+
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	w = httptest.NewRecorder()
+	UserinfoHandler(r.Users, r.Clients, r.Claims, r.Tokens, r.Signing)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("userinfo status = %d, body %s", w.Code, w.Body.String())
+	}
+	return tokens, decodeJSON(t, w)
+}
+
+func TestKeycloakProfileTokens(t *testing.T) {
+	r := newTestRealm(t, `{"profile": "keycloak", "users": {"provider": "json", "users": {
+		"demo": {"username": "demo", "password": "demo", "consents": {"openid": true, "profile": true},
+			"claims": {"default": {"base": {"preferred_username": "demo", "realm_roles": ["ADMIN"], "client_roles": ["DEMO"]}}}}
+	}}}`)
+	tokens, userinfo := profileTokens(t, r, "ACME", "acme-secret", "openid profile")
+
+	wantRealmAccess := map[string]any{"roles": []any{"ADMIN"}}
+	wantResourceAccess := map[string]any{"ACME": map[string]any{"roles": []any{"DEMO"}}}
+	shaped := map[string]map[string]any{
+		"access token": tokenClaims(t, tokens["access_token"].(string)),
+		"ID token":     tokenClaims(t, tokens["id_token"].(string)),
+		"userinfo":     userinfo,
+	}
+	for name, claims := range shaped {
+		if !reflect.DeepEqual(claims["realm_access"], wantRealmAccess) {
+			t.Errorf("%s realm_access = %v, want %v", name, claims["realm_access"], wantRealmAccess)
+		}
+		if !reflect.DeepEqual(claims["resource_access"], wantResourceAccess) {
+			t.Errorf("%s resource_access = %v, want %v", name, claims["resource_access"], wantResourceAccess)
+		}
+		if _, ok := claims["realm_roles"]; ok {
+			t.Errorf("%s keeps realm_roles: %v", name, claims)
+		}
+	}
+}
+
+func TestEntraProfileTokens(t *testing.T) {
+	r := newTestRealm(t, `{"profile": "entra", "entra": {"tenantId": "tenant-1", "apps": {
+		"orders-api": {"appId": "orders-app-id", "scopes": ["Orders.Read", "Orders.Write"],
+			"appRoles": {"Orders.Admin": ["demo"], "Orders.Sync": ["ACME"]}}
+	}}, "consents": {"provider": "json", "scopes": {
+		"openid": {"requireConsent": false}, "api://orders-api/.default": {"requireConsent": true}
+	}}, "users": {"provider": "json", "users": {
+		"demo": {"username": "demo", "password": "demo", "consents": {"openid": true, "api://orders-api/.default": true},
+			"claims": {"default": {"base": {"preferred_username": "demo"}}}}
+	}}}`)
+	tokens, _ := profileTokens(t, r, "ACME", "acme-secret", "openid api://orders-api/.default")
+
+	access := tokenClaims(t, tokens["access_token"].(string))
+	for claim, want := range map[string]any{
+		"tid": "tenant-1", "ver": "2.0", "aud": "orders-app-id", "scp": "Orders.Read Orders.Write", "roles": []any{"Orders.Admin"},
+	} {
+		if !reflect.DeepEqual(access[claim], want) {
+			t.Errorf("access token %s = %v, want %v", claim, access[claim], want)
+		}
+	}
+	if oid, _ := access["oid"].(string); oid == "" || oid == "demo" {
+		t.Errorf("access token oid = %q, want an object id", oid)
+	}
+	id := tokenClaims(t, tokens["id_token"].(string))
+	if id["tid"] != "tenant-1" || id["aud"] != "ACME" || id["oid"] != access["oid"] {
+		t.Errorf("ID token tid = %v, aud = %v, oid = %v, want the tenant, the client and the oid of the access token", id["tid"], id["aud"], id["oid"])
+	}
+
+	// app-only tokens carry the app roles of the client and no delegated permissions
+	clientCredentialsHandler := TokenClientCredentialsHandler(testOpenIDConfiguration(), r.Clients, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	w := serve(clientCredentialsHandler, http.MethodPost, "/token", url.Values{
+		"grant_type": {"client_credentials"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"}, "scope": {"api://orders-api/.default"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("client credentials grant status = %d, body %s", w.Code, w.Body.String())
+	}
+	app := tokenClaims(t, decodeJSON(t, w)["access_token"].(string))
+	if app["idtyp"] != "app" || app["aud"] != "orders-app-id" || !reflect.DeepEqual(app["roles"], []any{"Orders.Sync"}) {
+		t.Errorf("app-only access token = %v, want idtyp app, the API audience and the client roles", app)
+	}
+	if _, ok := app["scp"]; ok {
+		t.Errorf("app-only access token scp = %v, want none", app["scp"])
+	}
+}
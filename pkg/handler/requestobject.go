@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/dto"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	requestObjectMaxSize      = 64 * 1024
+	requestObjectFetchTimeout = 5 * time.Second
+)
+
+// applyRequestObject resolves the request object (RFC 9101) passed either by value (request)
+// or by reference (request_uri), verifies it with the client's registered keys and merges
+// its parameters into the authorization request. Request object parameters take precedence.
+func applyRequestObject(requestDTO *dto.AuthorizeRequestDTO, client clientservice.Entity, issuer string) error {
+	if requestDTO.Request != "" && requestDTO.RequestURI != "" {
+		return errs.New("invalid request object", errs.ErrInvalidArgument).WithDetails("request and request_uri must not be used together")
+	}
+
+	requestObject := requestDTO.Request
+	if requestDTO.RequestURI != "" {
+		fetched, err := fetchRequestObject(requestDTO.RequestURI, client)
+		if err != nil {
+			return err
+		}
+		requestObject = fetched
+	}
+
+	claims, err := verifyRequestObject(requestObject, client, issuer)
+	if err != nil {
+		return err
+	}
+
+	mergeRequestObject(requestDTO, claims)
+	return nil
+}
+
+// fetchRequestObject reads the request object from a file:// reference or a http(s) URL. Only the
+// request_uris registered for the client are fetched, redirects are not followed.
+func fetchRequestObject(requestURI string, client clientservice.Entity) (string, error) {
+	parsedURI, err := url.Parse(requestURI)
+	if err != nil {
+		return "", errs.Wrap("invalid request_uri", err).WithKind(errs.ErrInvalidArgument)
+	}
+	if parsedURI.Scheme == "file" {
+		// match the cleaned path, file:///allowed/../etc/passwd must not pass for file:///allowed/*
+		parsedURI.Path = filepath.Clean(parsedURI.Path)
+		requestURI = "file://" + parsedURI.Path
+	}
+	if !client.ValidateRequestURI(requestURI) {
+		return "", errs.New("invalid request_uri", errs.ErrInvalidArgument).WithDetailsf("request_uri '%s' is not registered for client '%s'", requestURI, client.Id())
+	}
+
+	var reader io.Reader
+	switch parsedURI.Scheme {
+	case "file":
+		f, err := os.Open(parsedURI.Path)
+		if err != nil {
+			return "", errs.Wrap("invalid request_uri", err).WithKind(errs.ErrInvalidArgument).WithDetailsf("could not open %s", parsedURI.Path)
+		}
+		defer f.Close()
+		reader = f
+	case "http", "https":
+		httpClient := http.Client{
+			Timeout: requestObjectFetchTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		resp, err := httpClient.Get(requestURI)
+		if err != nil {
+			return "", errs.Wrap("invalid request_uri", err).WithKind(errs.ErrInvalidArgument).WithDetailsf("could not fetch %s", requestURI)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", errs.New("invalid request_uri", errs.ErrInvalidArgument).WithDetailsf("fetching %s returned status %d", requestURI, resp.StatusCode)
+		}
+		reader = resp.Body
+	default:
+		return "", errs.New("invalid request_uri", errs.ErrInvalidArgument).WithDetailsf("unsupported scheme '%s'", parsedURI.Scheme)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, requestObjectMaxSize+1))
+	if err != nil {
+		return "", errs.Wrap("invalid request_uri", err).WithKind(errs.ErrInvalidArgument)
+	}
+	if len(data) > requestObjectMaxSize {
+		return "", errs.New("invalid request_uri", errs.ErrInvalidArgument).WithDetailsf("request object exceeds %d bytes", requestObjectMaxSize)
+	}
+	return string(data), nil
+}
+
+// verifyRequestObject checks the signature and the iss, aud and client_id claims of the request object.
+func verifyRequestObject(requestObject string, client clientservice.Entity, issuer string) (jwt.MapClaims, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(requestObject, jwt.MapClaims{})
+	if err != nil {
+		return nil, errs.Wrap("invalid request object", err).WithKind(errs.ErrInvalidArgument)
+	}
+	alg := unverified.Method.Alg()
+	if expected := client.RequestObjectSigningAlg(); expected != "" && expected != alg {
+		return nil, errs.New("invalid request object", errs.ErrInvalidArgument).WithDetailsf("got alg %s want %s", alg, expected)
+	}
+
+	claims, err := signing.VerifyWithJWKS(requestObject, client.JWKS(), client.AllowUnsignedRequestObject())
+	if err != nil {
+		return nil, errs.Wrap("invalid request object", err).WithKind(errs.ErrInvalidArgument)
+	}
+
+	if clientId, ok := claims["client_id"].(string); ok && clientId != client.Id() {
+		return nil, errs.New("invalid request object", errs.ErrInvalidArgument).WithDetailsf("client_id '%s' does not match '%s'", clientId, client.Id())
+	}
+	if iss, ok := claims["iss"].(string); ok && iss != client.Id() {
+		return nil, errs.New("invalid request object", errs.ErrInvalidArgument).WithDetailsf("iss '%s' does not match '%s'", iss, client.Id())
+	}
+	if _, ok := claims["aud"]; ok {
+		audience, err := claims.GetAudience()
+		if err != nil || !slices.Contains(audience, issuer) {
+			return nil, errs.New("invalid request object", errs.ErrInvalidArgument).WithDetailsf("aud does not contain '%s'", issuer)
+		}
+	}
+
+	return claims, nil
+}
+
+// mergeRequestObject overrides authorization request parameters with the request object ones.
+func mergeRequestObject(requestDTO *dto.AuthorizeRequestDTO, claims jwt.MapClaims) {
+	params := map[string]*string{
+		"response_type": &requestDTO.ResponseType,
+		"redirect_uri":  &requestDTO.RedirectURI,
+		"scope":         &requestDTO.Scope,
+		"state":         &requestDTO.State,
+		"nonce":         &requestDTO.Nonce,
+	}
+	for name, field := range params {
+		if value, ok := claims[name].(string); ok {
+			*field = value
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFetchRequestObject(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	if err := os.Mkdir(allowed, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"allowed/request.jwt": "request-object",
+		"allowed/large.jwt":   strings.Repeat("x", requestObjectMaxSize+1),
+		"secret.txt":          "secret",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/requests/request.jwt":
+			fmt.Fprint(w, "request-object")
+		case "/requests/redirect":
+			http.Redirect(w, r, "/internal", http.StatusFound)
+		default:
+			fmt.Fprint(w, "internal")
+		}
+	}))
+	defer server.Close()
+
+	clientSrv, err := clientservice.NewFromConfig([]byte(fmt.Sprintf(`{"clients": {"ACME": {
+		"client_id": "ACME", "client_secret": "s", "redirect_uri": "*",
+		"request_uris": ["file://%s/*", "%s/requests/*"]
+	}}}`, allowed, server.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := clientSrv.GetClient("ACME")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		requestURI string
+		want       string
+		wantErr    bool
+	}{
+		{name: "registered file", requestURI: "file://" + allowed + "/request.jwt", want: "request-object"},
+		{name: "registered URL", requestURI: server.URL + "/requests/request.jwt", want: "request-object"},
+		{name: "file outside the registered path", requestURI: "file://" + dir + "/secret.txt", wantErr: true},
+		{name: "path traversal", requestURI: "file://" + allowed + "/../secret.txt", wantErr: true},
+		{name: "unregistered URL", requestURI: server.URL + "/internal", wantErr: true},
+		{name: "redirect is not followed", requestURI: server.URL + "/requests/redirect", wantErr: true},
+		{name: "too large", requestURI: "file://" + allowed + "/large.jwt", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fetchRequestObject(tt.requestURI, client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchRequestObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("fetchRequestObject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestObject(t *testing.T) {
+	key, err := signing.NewSigningKeyHandlerFromRandom(signing.P256, true, "request-object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(signing.JSONWebKeySet{Keys: []signing.JSONWebKey{key.GetJWK()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSrv, err := clientservice.NewFromConfig([]byte(fmt.Sprintf(`{"clients": {
+		"SIGNED": {"client_id": "SIGNED", "client_secret": "s", "redirect_uri": "*", "jwks": %s},
+		"UNSIGNED": {"client_id": "UNSIGNED", "client_secret": "s", "redirect_uri": "*", "allow_unsigned_request_object": true}
+	}}`, jwks)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock.Default.Set(start)
+	defer clock.Default.Reset()
+
+	signed := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"client_id": "SIGNED", "exp": start.Add(time.Minute).Unix()})
+	signed.Header["kid"] = key.GetID()
+	signedObject, err := signed.SignedString(key.GetKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsignedObject, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"scope": "openid"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		clientId string
+		object   string
+		now      time.Time
+		wantErr  bool
+	}{
+		{name: "signed", clientId: "SIGNED", object: signedObject, now: start},
+		{name: "expired", clientId: "SIGNED", object: signedObject, now: start.Add(2 * time.Minute), wantErr: true},
+		{name: "unsigned allowed", clientId: "UNSIGNED", object: unsignedObject, now: start},
+		{name: "unsigned not allowed", clientId: "SIGNED", object: unsignedObject, now: start, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Default.Set(tt.now)
+			client, err := clientSrv.GetClient(tt.clientId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := verifyRequestObject(tt.object, client, testIssuer); (err != nil) != tt.wantErr {
+				t.Errorf("verifyRequestObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWellKnownRequestObjectSigningAlgs(t *testing.T) {
+	r := newTestRealm(t, "")
+	h := WellKnownHandler(testOpenIDConfiguration(), r.Clients)
+	algs := func() []any {
+		algs, _ := decodeJSON(t, serve(h, http.MethodGet, "/.well-known/openid-configuration", nil))["request_object_signing_alg_values_supported"].([]any)
+		return algs
+	}
+
+	if got := algs(); len(got) == 0 || slices.Contains(got, any("none")) {
+		t.Errorf("request_object_signing_alg_values_supported = %v, want the signing algorithms without none", got)
+	}
+	if err := r.Clients.PutClient("DEV", clientservice.ClientConfig{Id: "DEV", Secret: "s", RedirectURI: "*", AllowUnsignedRequestObject: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := algs(); !slices.Contains(got, any("none")) {
+		t.Errorf("request_object_signing_alg_values_supported = %v, want none while a client accepts unsigned request objects", got)
+	}
+}
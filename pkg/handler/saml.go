@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/auth"
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/saml"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+const samlAssertionLifetime = 5 * time.Minute
+
+// samlSessionIndexKey keys the session indexes, they stay the same for a session and SP while the server runs
+var samlSessionIndexKey = rand.Text()
+
+// samlSessionIndex derives an opaque SessionIndex from the login session, the session ID (the session
+// cookie) is never disclosed and the service providers of one session do not share the index
+func samlSessionIndex(sessionID string, entityID string) string {
+	if sessionID == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(samlSessionIndexKey))
+	mac.Write([]byte(entityID + "\x00" + sessionID))
+	return "_" + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// samlPostForm delivers the SAMLResponse to the assertion consumer service (HTTP-POST binding)
+var samlPostForm = template.Must(template.New("samlPostForm").Parse(`<!doctype html>
+<html>
+<body onload="document.forms[0].submit()">
+    <form method="POST" action="{{ .Action }}">
+        <input type="hidden" name="SAMLResponse" value="{{ .SAMLResponse }}">
+        {{ if .RelayState }}<input type="hidden" name="RelayState" value="{{ .RelayState }}">{{ end }}
+        <noscript><button type="submit">Continue</button></noscript>
+    </form>
+</body>
+</html>`))
+
+func samlPost(w http.ResponseWriter, acsURL string, response string, relayState string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	samlPostForm.Execute(w, map[string]string{
+		"Action":       acsURL,
+		"SAMLResponse": base64.StdEncoding.EncodeToString([]byte(response)),
+		"RelayState":   relayState,
+	})
+}
+
+func samlIssuer(r *http.Request, openidConfig auth.OpenIDConfiguration) string {
+	if openidConfig.UseOrigin {
+		return getOriginFromRequest(r) + openidConfig.IssuerPath
+	}
+	return openidConfig.Issuer
+}
+
+// SAMLMetadataHandler serves the IdP metadata, the entity ID of the IdP is the issuer
+func SAMLMetadataHandler(openidConfig auth.OpenIDConfiguration, keySvc signing.SigningServicer, ssoPath string, ssoPostPath string) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler SAMLMetadataHandler started", "request", routing.RequestIDLogValue(r))
+		cert, _, err := keySvc.GetCertificateKey()
+		if err != nil {
+			slog.Error("no certificate for SAML signatures", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "SAML is not available: no certificate signing key", http.StatusNotFound)
+			return
+		}
+		issuer := samlIssuer(r, openidConfig)
+		base := strings.TrimSuffix(issuer, openidConfig.IssuerSuffix)
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		w.Write(saml.Metadata(issuer, base+ssoPath, base+ssoPostPath, cert))
+	}
+}
+
+// SAMLPostBindingHandler accepts AuthnRequests of the HTTP-POST binding and hands them over
+// to the HTTP-Redirect binding endpoint, so that the login form keeps the request in its URL
+func SAMLPostBindingHandler(ssoPath string) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler SAMLPostBindingHandler started", "request", routing.RequestIDLogValue(r))
+		samlRequest, err := saml.PostToRedirectRequest(r.PostFormValue("SAMLRequest"))
+		if err != nil {
+			slog.Error("invalid SAML request", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := url.Values{}
+		query.Set("SAMLRequest", samlRequest)
+		if relayState := r.PostFormValue("RelayState"); relayState != "" {
+			query.Set("RelayState", relayState)
+		}
+		http.Redirect(w, r, ssoPath+"?"+query.Encode(), http.StatusSeeOther)
+	}
+}
+
+// SAMLSSOHandler answers AuthnRequests of the HTTP-Redirect binding of authenticated users
+// with a signed assertion posted to the assertion consumer service of the service provider
+func SAMLSSOHandler(openidConfig auth.OpenIDConfiguration, clientSvc clientservice.Service, claimSvc claimservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler SAMLSSOHandler started", "request", routing.RequestIDLogValue(r))
+		// the login form posts back to this URL, the request always comes in the query
+		query := r.URL.Query()
+		relayState := query.Get("RelayState")
+		authnRequest, err := saml.DecodeRedirectRequest(query.Get("SAMLRequest"))
+		if err != nil {
+			slog.Error("invalid SAML request", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// service provider
+		client, err := clientSvc.GetClientBySAMLEntityID(authnRequest.Issuer)
+		if err != nil {
+			slog.Error("unknown service provider", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "unknown service provider", http.StatusBadRequest)
+			return
+		}
+		sp := client.SAML()
+		acsURL := authnRequest.AssertionConsumerServiceURL
+		if acsURL == "" {
+			acsURL = sp.ACSURL
+		}
+		if acsURL == "" || !clientservice.MatchesWildcard(acsURL, sp.ACSURL) {
+			slog.Error("invalid assertion consumer service URL", "request", routing.RequestIDLogValue(r), "acsURL", acsURL, "ClientId", client.Id())
+			http.Error(w, "invalid assertion consumer service URL", http.StatusBadRequest)
+			return
+		}
+
+		issuer := samlIssuer(r, openidConfig)
+		now := clock.Now()
+		if authnRequest.ProtocolBinding != "" && authnRequest.ProtocolBinding != saml.BindingHTTPPost {
+			samlPost(w, acsURL, saml.NewErrorResponse(issuer, acsURL, authnRequest.ID, now, saml.StatusRequester, "only the HTTP-POST binding is supported for responses"), relayState)
+			return
+		}
+
+		// user
+		user, ok := r.Context().Value(routing.CTX_USER).(userservice.Entity)
+		if !ok {
+			http.Error(w, "authentication failure", http.StatusInternalServerError)
+			return
+		}
+		attributes, err := claimSvc.GetUserClaims(user, client, nil, string(claimservice.PurposeSAML))
+		if err != nil {
+			slog.Error("failed to get claims", "request", routing.RequestIDLogValue(r), "error", err)
+			samlPost(w, acsURL, saml.NewErrorResponse(issuer, acsURL, authnRequest.ID, now, saml.StatusRequester, "failed to get user attributes"), relayState)
+			return
+		}
+		delete(attributes, "scope")
+
+		nameIDFormat := sp.NameIDFormat
+		if authnRequest.NameIDPolicy.Format != "" && authnRequest.NameIDPolicy.Format != saml.NameIDFormatUnspecified {
+			nameIDFormat = authnRequest.NameIDPolicy.Format
+		}
+		nameID := user.Id()
+		if email, ok := attributes["email"].(string); ok && nameIDFormat == saml.NameIDFormatEmailAddress {
+			nameID = email
+		}
+
+		sessionID, _ := r.Context().Value(routing.CTX_SESSION_ID).(string)
+		cert, signer, err := keySvc.GetCertificateKey()
+		if err != nil {
+			slog.Error("no certificate for SAML signatures", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "SAML is not available: no certificate signing key", http.StatusInternalServerError)
+			return
+		}
+		response, err := saml.NewResponse(saml.Assertion{
+			Issuer:       issuer,
+			Audience:     sp.EntityID,
+			Recipient:    acsURL,
+			InResponseTo: authnRequest.ID,
+			NameID:       nameID,
+			NameIDFormat: nameIDFormat,
+			SessionIndex: samlSessionIndex(sessionID, sp.EntityID),
+			Attributes:   attributes,
+			IssuedAt:     now,
+			Lifetime:     samlAssertionLifetime,
+		}, cert, signer)
+		if errors.Is(err, saml.ErrUnsupportedKey) {
+			slog.Error("unsupported key for SAML signatures", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "SAML is not available: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			slog.Error("failed to build SAML response", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "failed to build SAML response", http.StatusInternalServerError)
+			return
+		}
+		slog.Info("SAMLSSOHandler posting assertion", "request", routing.RequestIDLogValue(r), "acsURL", acsURL, "ClientId", client.Id())
+		samlPost(w, acsURL, response, relayState)
+	}
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSAMLSessionIndex(t *testing.T) {
+	const sessionID = "6f1c2d0e-session"
+	index := samlSessionIndex(sessionID, "https://sp1.example.com")
+
+	if index == "" || strings.Contains(index, sessionID) {
+		t.Errorf("samlSessionIndex() = %q, want an opaque value", index)
+	}
+	if again := samlSessionIndex(sessionID, "https://sp1.example.com"); again != index {
+		t.Errorf("samlSessionIndex() = %q then %q, want the same index for the session and SP", index, again)
+	}
+	if other := samlSessionIndex(sessionID, "https://sp2.example.com"); other == index {
+		t.Errorf("samlSessionIndex() of another SP = %q, want a different index", other)
+	}
+	if other := samlSessionIndex("other-session", "https://sp1.example.com"); other == index {
+		t.Errorf("samlSessionIndex() of another session = %q, want a different index", other)
+	}
+	if got := samlSessionIndex("", "https://sp1.example.com"); got != "" {
+		t.Errorf("samlSessionIndex() without a session = %q, want none", got)
+	}
+}
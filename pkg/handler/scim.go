@@ -7,7 +7,6 @@ import (
 	"log/slog"
 	"net/http"
 
-	"github.com/axent-pl/oauth2mock/pkg/di"
 	"github.com/axent-pl/oauth2mock/pkg/http/request"
 	"github.com/axent-pl/oauth2mock/pkg/http/routing"
 	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
@@ -45,14 +44,7 @@ type SCIMListResponseDTO struct {
 
 // ---------- handlers
 
-func SCIMPostHandler() routing.HandlerFunc {
-	var wired bool
-	var userService userservice.Service
-	userService, wired = di.GiveMeInterface(userService)
-	if !wired {
-		slog.Error("could not wire user service")
-		return nil
-	}
+func SCIMPostHandler(userService userservice.Service) routing.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("request handler SCIMPostHandler started")
 		var userDTO = &SCIMUserCreateRequestDTO{}
@@ -121,14 +113,7 @@ func SCIMPostHandler() routing.HandlerFunc {
 	}
 }
 
-func SCIMGetHandler() routing.HandlerFunc {
-	var wired bool
-	var userService userservice.Service
-	userService, wired = di.GiveMeInterface(userService)
-	if !wired {
-		slog.Error("could not wire user service")
-		return nil
-	}
+func SCIMGetHandler(userService userservice.Service) routing.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// get users from service
 		users, err := userService.GetUsers()
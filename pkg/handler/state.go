@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/state"
+)
+
+// selectStateful returns the services named by the comma separated services query parameter (all when absent)
+func selectStateful(r *http.Request, services map[string]state.Stateful) (map[string]state.Stateful, error) {
+	names := r.URL.Query().Get("services")
+	if names == "" {
+		return services, nil
+	}
+	selected := make(map[string]state.Stateful)
+	for _, name := range strings.Split(names, ",") {
+		service, ok := services[name]
+		if !ok {
+			return nil, errs.New(fmt.Sprintf("unknown service '%s'", name), errs.ErrInvalidArgument)
+		}
+		selected[name] = service
+	}
+	return selected, nil
+}
+
+// ResetAdminHandler drops the runtime state (sessions, authorization codes, opaque tokens,
+// users and consents added at runtime) of the services, they return to the state loaded from the config
+func ResetAdminHandler(services map[string]state.Stateful) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler ResetAdminHandler started", "request", routing.RequestIDLogValue(r))
+		selected, err := selectStateful(r, services)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		reset := make([]string, 0, len(selected))
+		for name, service := range selected {
+			if err := service.Reset(); err != nil {
+				slog.Error("failed to reset state", "request", routing.RequestIDLogValue(r), "service", name, "error", err)
+				http.Error(w, fmt.Sprintf("failed to reset %s", name), errorStatus(err))
+				return
+			}
+			reset = append(reset, name)
+		}
+		sort.Strings(reset)
+		slog.Warn("runtime state reset", "request", routing.RequestIDLogValue(r), "services", reset)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"reset": reset})
+	}
+}
+
+// SnapshotAdminHandler serializes the runtime state of the services: GET returns a snapshot
+// (an object with one member per service), PUT restores one. Services missing from the restored
+// snapshot keep their state. A restore is all or nothing, the state changes only when every
+// section of the snapshot is valid.
+func SnapshotAdminHandler(services map[string]state.Stateful) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler SnapshotAdminHandler started", "request", routing.RequestIDLogValue(r))
+		selected, err := selectStateful(r, services)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			snapshot := make(map[string]json.RawMessage, len(selected))
+			for name, service := range selected {
+				if snapshot[name], err = service.Snapshot(); err != nil {
+					slog.Error("failed to snapshot state", "request", routing.RequestIDLogValue(r), "service", name, "error", err)
+					http.Error(w, fmt.Sprintf("failed to snapshot %s", name), errorStatus(err))
+					return
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snapshot)
+		case http.MethodPut:
+			snapshot := make(map[string]json.RawMessage)
+			if err := decodeJSONBody(r, &snapshot); err != nil {
+				http.Error(w, "invalid snapshot", http.StatusBadRequest)
+				return
+			}
+			for name := range snapshot {
+				if _, ok := selected[name]; !ok {
+					http.Error(w, fmt.Sprintf("unknown service '%s'", name), http.StatusBadRequest)
+					return
+				}
+			}
+			commits := make([]func(), 0, len(snapshot))
+			for name, rawState := range snapshot {
+				commit, err := selected[name].Restore(rawState)
+				if err != nil {
+					slog.Error("failed to restore state", "request", routing.RequestIDLogValue(r), "service", name, "error", err)
+					http.Error(w, err.Error(), errorStatus(err))
+					return
+				}
+				commits = append(commits, commit)
+			}
+			for _, commit := range commits {
+				commit()
+			}
+			slog.Warn("runtime state restored", "request", routing.RequestIDLogValue(r))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
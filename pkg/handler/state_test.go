@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+)
+
+func TestSnapshotRestoreIsAtomic(t *testing.T) {
+	r := newTestRealm(t, "")
+	h := SnapshotAdminHandler(r.StatefulServices())
+
+	w := serve(h, http.MethodGet, "/admin/snapshot", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, body %s", w.Code, w.Body.String())
+	}
+	before := w.Body.String()
+
+	// the consents section is valid, the sessions section is not
+	w = serveJSON(h, http.MethodPut, "/admin/snapshot", `{
+		"consents": {"demo": {"openid": false}},
+		"users": {},
+		"sessions": {"sid": []}
+	}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT of a corrupt snapshot status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if after := serve(h, http.MethodGet, "/admin/snapshot", nil).Body.String(); after != before {
+		t.Errorf("state after a rejected restore =\n%s\nwant\n%s", after, before)
+	}
+
+	w = serveJSON(h, http.MethodPut, "/admin/snapshot", `{"consents": {"demo": {"openid": false}}}`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("PUT status = %d, body %s", w.Code, w.Body.String())
+	}
+	if consents := r.Consents.GetUserConsents("demo"); consents["openid"] || len(consents) != 1 {
+		t.Errorf("consents of demo after restore = %v, want openid not granted", consents)
+	}
+}
+
+func TestSnapshotOmitsPasswords(t *testing.T) {
+	r := newTestRealm(t, "")
+	h := SnapshotAdminHandler(r.StatefulServices())
+	passwordHandler := TokenPasswordHandler(testOpenIDConfiguration(), r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+
+	// alice is added at runtime with a TOTP secret and deleted before the restore
+	if w := serveJSON(AdminUsersHandler(r.Users), http.MethodPut, "/admin/users?id=alice", `{"password": "alice", "totpSecret": "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT alice status = %d, body %s", w.Code, w.Body.String())
+	}
+
+	w := serve(h, http.MethodGet, "/admin/snapshot?services=users", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, body %s", w.Code, w.Body.String())
+	}
+	snapshot := w.Body.String()
+	if strings.Contains(snapshot, "passwordHash") {
+		t.Errorf("snapshot contains a password hash: %s", snapshot)
+	}
+	if strings.Contains(snapshot, "totpSecret") {
+		t.Errorf("snapshot contains a TOTP secret: %s", snapshot)
+	}
+	if err := r.Users.DeleteUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// restored users keep their passwords
+	if w := serveJSON(h, http.MethodPut, "/admin/snapshot", snapshot); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT status = %d, body %s", w.Code, w.Body.String())
+	}
+	w = serve(passwordHandler, http.MethodPost, "/token", url.Values{
+		"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+		"username": {"demo"}, "password": {"demo"}, "scope": {"openid"},
+	})
+	if w.Code != http.StatusOK {
+		t.Errorf("password grant after restore status = %d, body %s", w.Code, w.Body.String())
+	}
+
+	// and so do the users deleted since the snapshot
+	credentials, err := authentication.NewCredentials(authentication.FromUsernameAndPassword("alice", "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := r.Users.Authenticate(credentials)
+	if err != nil {
+		t.Fatalf("Authenticate() of the restored alice error = %v, want the password restored", err)
+	}
+	if alice.TOTPSecret() != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("TOTP secret of the restored alice = %q, want it restored", alice.TOTPSecret())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,13 +12,18 @@ import (
 	"github.com/axent-pl/oauth2mock/pkg/authorizationservice"
 	"github.com/axent-pl/oauth2mock/pkg/claimservice"
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
 	"github.com/axent-pl/oauth2mock/pkg/consentservice"
 	"github.com/axent-pl/oauth2mock/pkg/dto"
 	"github.com/axent-pl/oauth2mock/pkg/http/request"
 	"github.com/axent-pl/oauth2mock/pkg/http/routing"
 	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/encryption"
 	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/tokenservice"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 func subClaim(user userservice.Entity, client clientservice.Entity) string {
@@ -34,20 +40,44 @@ func userOrClientClaims(claimSvc claimservice.Service, user userservice.Entity,
 	return claimSvc.GetClientClaims(client, scopes, purpose)
 }
 
-func tokenReponse(issuer string, user userservice.Entity, client clientservice.Entity, scopes []string, extraClaims map[string]interface{}, claimSvc claimservice.Service, keyService signing.SigningServicer) (dto.TokenResponseDTO, error) {
-	tokenResponse := dto.TokenResponseDTO{TokenType: "Bearer", Expires: 3600}
+// encryptToken wraps the signed token into a JWE if encryption is configured (nested sign-then-encrypt).
+func encryptToken(signedToken []byte, settings clientservice.EncryptionSettings) ([]byte, error) {
+	if !settings.Enabled() {
+		return signedToken, nil
+	}
+	return encryption.EncryptJWT(signedToken, settings.Keys, encryption.KeyManagementAlgorithm(settings.Alg), encryption.ContentEncryptionAlgorithm(settings.Enc))
+}
 
-	// access token
+// shapeClaims applies the claim shaping of the realm profile (see profile.WrapClaimService) to the final claims
+func shapeClaims(claimSvc claimservice.Service, purpose string, claims map[string]interface{}, client clientservice.Entity, scopes []string) {
+	shaper, ok := claimSvc.(interface {
+		ShapeClaims(string, map[string]interface{}, clientservice.Entity, []string)
+	})
+	if ok {
+		shaper.ShapeClaims(purpose, claims, client, scopes)
+	}
+}
+
+func userId(user userservice.Entity) string {
+	if user != nil {
+		return user.Id()
+	}
+	return ""
+}
+
+// accessTokenClaims builds the access token claims. It is used both for JWT access tokens
+// and to resolve the claims of opaque access tokens at introspection time.
+func accessTokenClaims(issuer string, user userservice.Entity, client clientservice.Entity, scopes []string, extraClaims map[string]interface{}, issuedAt time.Time, expiresAt time.Time, claimSvc claimservice.Service) (map[string]interface{}, error) {
 	access_claims, err := userOrClientClaims(claimSvc, user, client, scopes, "access")
 	if err != nil {
-		return dto.TokenResponseDTO{}, err
+		return nil, err
 	}
 	access_token_claims := make(map[string]interface{})
 	access_token_claims["iss"] = issuer
 	access_token_claims["sub"] = subClaim(user, client)
 	access_token_claims["azp"] = client.Id()
-	access_token_claims["exp"] = time.Now().Add(time.Hour * 1).Unix()
-	access_token_claims["iat"] = time.Now().Unix()
+	access_token_claims["exp"] = expiresAt.Unix()
+	access_token_claims["iat"] = issuedAt.Unix()
 	access_token_claims["typ"] = "Bearer"
 	for k, v := range access_claims {
 		access_token_claims[k] = v
@@ -55,11 +85,87 @@ func tokenReponse(issuer string, user userservice.Entity, client clientservice.E
 	for k, v := range extraClaims {
 		access_token_claims[k] = v
 	}
-	access_token, err := keyService.Sign(access_token_claims)
+	shapeClaims(claimSvc, "access", access_token_claims, client, scopes)
+	return access_token_claims, nil
+}
+
+// refreshGrantScopeClaim of the refresh token keeps the scopes of the grant: the scope claim lists the
+// consented scopes only and a refresh may narrow the scopes of the issued tokens down
+const refreshGrantScopeClaim = "grant_scope"
+
+// tokenReponse issues the tokens of a grant, grantScopes are the scopes kept by the refresh token (nil means scopes)
+func tokenReponse(issuer string, user userservice.Entity, client clientservice.Entity, scopes []string, grantScopes []string, extraClaims map[string]interface{}, lifetimes tokenservice.Lifetimes, profilePolicy *tokenservice.ProfilePolicy, authTime time.Time, claimSvc claimservice.Service, tokenSvc tokenservice.Service, keyService signing.SigningServicer) (dto.TokenResponseDTO, error) {
+	tokenResponse := dto.TokenResponseDTO{TokenType: "Bearer", Expires: lifetimes.AccessTokenSeconds}
+	now := clock.Now()
+
+	// user tokens of one grant share a session id, it is kept when the tokens are refreshed
+	if _, ok := extraClaims["sid"]; !ok && user != nil {
+		extraClaims["sid"] = uuid.NewString()
+	}
+
+	// token profiles make the tokens defective on purpose, the profile scope is not granted
+	userProfile := ""
+	if user != nil {
+		userProfile, _ = user.GetAttributesGroup(userservice.AttributesGroupTokens)["profile"].(string)
+	}
+	profile, scopes, err := profilePolicy.Resolve(client.Id(), userProfile, scopes)
+	if err != nil {
+		return dto.TokenResponseDTO{}, err
+	}
+	if grantScopes == nil {
+		grantScopes = scopes
+	}
+	sign := func(kind string, claims map[string]interface{}) ([]byte, error) {
+		if !profile.Applies(kind) {
+			return keyService.Sign(claims)
+		}
+		slog.Warn("issuing defective token", "profile", profile.Name, "token", kind, "clientId", client.Id())
+		profile.Mutate(claims, now)
+		switch {
+		case profile.UnknownKey:
+			return keyService.SignWithUnknownKey(claims)
+		case profile.AlgMismatch:
+			return keyService.SignWithAlgMismatch(claims)
+		}
+		return keyService.Sign(claims)
+	}
+
+	// access token
+	access_token_claims, err := accessTokenClaims(issuer, user, client, scopes, extraClaims, now, now.Add(lifetimes.AccessTokenTTL()), claimSvc)
 	if err != nil {
 		return dto.TokenResponseDTO{}, err
 	}
-	tokenResponse.AccessToken = string(access_token)
+	reference := tokenservice.Reference{
+		Issuer:      issuer,
+		UserId:      userId(user),
+		ClientId:    client.Id(),
+		Scopes:      scopes,
+		ExtraClaims: extraClaims,
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(lifetimes.AccessTokenTTL()),
+	}
+	if client.AccessTokenFormat() == clientservice.AccessTokenFormatOpaque {
+		access_token, err := tokenSvc.Store(reference)
+		if err != nil {
+			return dto.TokenResponseDTO{}, err
+		}
+		tokenResponse.AccessToken = access_token
+	} else {
+		access_token, err := sign(tokenservice.TokenAccess, access_token_claims)
+		if err != nil {
+			return dto.TokenResponseDTO{}, err
+		}
+		if client.AccessTokenEncryption().Enabled() {
+			if access_token, err = encryptToken(access_token, client.AccessTokenEncryption()); err != nil {
+				return dto.TokenResponseDTO{}, err
+			}
+			// the server can not decrypt the token, introspection and userinfo look it up
+			if err := tokenSvc.Put(string(access_token), reference); err != nil {
+				return dto.TokenResponseDTO{}, err
+			}
+		}
+		tokenResponse.AccessToken = string(access_token)
+	}
 
 	// refresh token
 	refresh_claims, err := userOrClientClaims(claimSvc, user, client, scopes, "refresh")
@@ -70,8 +176,9 @@ func tokenReponse(issuer string, user userservice.Entity, client clientservice.E
 	refresh_token_claims["iss"] = issuer
 	refresh_token_claims["sub"] = subClaim(user, client)
 	refresh_token_claims["azp"] = client.Id()
-	refresh_token_claims["exp"] = time.Now().Add(time.Hour * 1).Unix()
-	refresh_token_claims["iat"] = time.Now().Unix()
+	refresh_token_claims["exp"] = lifetimes.RefreshTokenExpiry(now, authTime).Unix()
+	refresh_token_claims["iat"] = now.Unix()
+	refresh_token_claims["auth_time"] = authTime.Unix()
 	refresh_token_claims["typ"] = "Refresh"
 	for k, v := range refresh_claims {
 		refresh_token_claims[k] = v
@@ -79,13 +186,15 @@ func tokenReponse(issuer string, user userservice.Entity, client clientservice.E
 	for k, v := range extraClaims {
 		refresh_token_claims[k] = v
 	}
-	refresh_token, err := keyService.Sign(refresh_token_claims)
+	shapeClaims(claimSvc, "refresh", refresh_token_claims, client, scopes)
+	refresh_token_claims[refreshGrantScopeClaim] = strings.Join(grantScopes, " ")
+	refresh_token, err := sign(tokenservice.TokenRefresh, refresh_token_claims)
 	if err != nil {
 		return dto.TokenResponseDTO{}, err
 	}
 	tokenResponse.RefreshToken = string(refresh_token)
 
-	// refresh token
+	// id token
 	id_claims, err := userOrClientClaims(claimSvc, user, client, scopes, "id")
 	if err != nil {
 		return dto.TokenResponseDTO{}, err
@@ -94,8 +203,9 @@ func tokenReponse(issuer string, user userservice.Entity, client clientservice.E
 	id_token_claims["iss"] = issuer
 	id_token_claims["sub"] = subClaim(user, client)
 	id_token_claims["aud"] = client.Id()
-	id_token_claims["exp"] = time.Now().Add(time.Hour * 1).Unix()
-	id_token_claims["iat"] = time.Now().Unix()
+	id_token_claims["exp"] = now.Add(lifetimes.IDTokenTTL()).Unix()
+	id_token_claims["iat"] = now.Unix()
+	id_token_claims["auth_time"] = authTime.Unix()
 	id_token_claims["typ"] = "ID"
 	for k, v := range id_claims {
 		id_token_claims[k] = v
@@ -103,28 +213,47 @@ func tokenReponse(issuer string, user userservice.Entity, client clientservice.E
 	for k, v := range extraClaims {
 		id_token_claims[k] = v
 	}
-	id_token, err := keyService.Sign(id_token_claims)
+	shapeClaims(claimSvc, "id", id_token_claims, client, scopes)
+	id_token, err := sign(tokenservice.TokenID, id_token_claims)
+	if err != nil {
+		return dto.TokenResponseDTO{}, err
+	}
+	id_token, err = encryptToken(id_token, client.IDTokenEncryption())
 	if err != nil {
 		return dto.TokenResponseDTO{}, err
 	}
 	tokenResponse.IDToken = string(id_token)
 
+	if journal, ok := tokenSvc.(tokenservice.Journal); ok {
+		issuance := tokenservice.Issuance{
+			Time:     now,
+			ClientId: client.Id(),
+			UserId:   userId(user),
+			Scopes:   scopes,
+			Opaque:   client.AccessTokenFormat() == clientservice.AccessTokenFormatOpaque,
+		}
+		if profile != nil {
+			issuance.Profile = profile.Name
+		}
+		journal.Record(issuance)
+	}
+
 	return tokenResponse, nil
 }
 
-func TokenAuthorizationCodeHandler(openidConfig auth.OpenIDConfiguration, clientSvc clientservice.Service, consentSvc consentservice.Service, authCodeSvc authorizationservice.Service, claimSvc claimservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
+func TokenAuthorizationCodeHandler(openidConfig auth.OpenIDConfiguration, clientSvc clientservice.Service, consentSvc consentservice.Service, authCodeSvc authorizationservice.Service, claimSvc claimservice.Service, lifetimePolicy *tokenservice.LifetimePolicy, profilePolicy *tokenservice.ProfilePolicy, tokenSvc tokenservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("request handler TokenAuthorizationCodeHandler started", "request", routing.RequestIDLogValue(r))
 		requstDTO := &dto.TokenAuthorizationCodeRequestDTO{}
 		requestValidator := request.NewValidator()
 		request.Unmarshal(r, requstDTO)
 		if !requestValidator.Validate(requstDTO) {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, validationErrorDescription(requestValidator))
 			slog.Error("request validation failed", "request", routing.RequestIDLogValue(r), "validationErrors", requestValidator.Errors)
 			return
 		}
 		if requstDTO.GrantType != "authorization_code" {
-			http.Error(w, "invalid grant type", http.StatusBadRequest)
+			oauthError(w, errUnsupportedGrantType, "unsupported grant_type")
 			slog.Error("invalid grant type", "request", routing.RequestIDLogValue(r))
 			return
 		}
@@ -132,13 +261,13 @@ func TokenAuthorizationCodeHandler(openidConfig auth.OpenIDConfiguration, client
 		// Authenticate client
 		credentials, err := authentication.NewCredentials(authentication.FromCliendIdAndSecret(requstDTO.ClientId, requstDTO.ClientSecret))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, err.Error())
 			slog.Error("could not read client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
 			return
 		}
 		client, err := clientSvc.Authenticate(credentials)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidClient, "client authentication failed")
 			slog.Error("invalid client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
 			return
 		}
@@ -146,19 +275,19 @@ func TokenAuthorizationCodeHandler(openidConfig auth.OpenIDConfiguration, client
 		// Get authorization request data
 		authorizationRequest, err := authCodeSvc.Get(requstDTO.Code)
 		if err != nil {
-			http.Error(w, "invalid code", http.StatusBadRequest)
+			oauthError(w, errInvalidGrant, "invalid authorization code")
 			slog.Error("invalid authorization code", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.Code, "error", err)
 			return
 		}
 
 		// Validate request DTO with authCodeData
 		if requstDTO.ClientId != authorizationRequest.GetClient().Id() {
-			http.Error(w, "invalid code", http.StatusBadRequest)
+			oauthError(w, errInvalidGrant, "authorization code was issued to another client")
 			slog.Error("authorization code client does not match", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.Code)
 			return
 		}
 		if requstDTO.RedirectURI != authorizationRequest.GetRedirectURI() {
-			http.Error(w, "invalid code", http.StatusBadRequest)
+			oauthError(w, errInvalidGrant, "redirect_uri does not match the authorization request")
 			slog.Error("authorization code redirect URI does not match", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.Code)
 			return
 		}
@@ -170,21 +299,30 @@ func TokenAuthorizationCodeHandler(openidConfig auth.OpenIDConfiguration, client
 		if authorizationRequest.GetNonce() != "" {
 			extraClaims["nonce"] = authorizationRequest.GetNonce()
 		}
+		if amr := authorizationRequest.GetAMR(); len(amr) > 0 {
+			extraClaims["amr"] = amr
+		}
 
 		issuer := openidConfig.Issuer
 		if openidConfig.UseOrigin {
-			issuer = getOriginFromRequest(r)
+			issuer = getOriginFromRequest(r) + openidConfig.IssuerPath
 		}
 
-		tokenResponse, err := tokenReponse(issuer, subject, client, scopes, extraClaims, claimSvc, keySvc)
+		// the tokens tell when the user authenticated, not when the code was redeemed
+		authTime := authorizationRequest.GetAuthTime()
+		if authTime.IsZero() {
+			authTime = clock.Now()
+		}
+		lifetimes := lifetimePolicy.Resolve(client.Id(), scopes)
+		tokenResponse, err := tokenReponse(issuer, subject, client, scopes, nil, extraClaims, lifetimes, profilePolicy, authTime, claimSvc, tokenSvc, keySvc)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, oauthErrorCode(err, errServerError), err.Error())
 			slog.Error("failed to construct token response", "request", routing.RequestIDLogValue(r), "error", err)
 			return
 		}
 		tokenResponseBytes, err := json.Marshal(tokenResponse)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errServerError, err.Error())
 			slog.Error("failed to marshal token response", "request", routing.RequestIDLogValue(r), "error", err)
 			return
 		}
@@ -197,19 +335,19 @@ func TokenAuthorizationCodeHandler(openidConfig auth.OpenIDConfiguration, client
 	}
 }
 
-func TokenClientCredentialsHandler(openidConfig auth.OpenIDConfiguration, clientDB clientservice.Service, claimsDB claimservice.Service, keyService signing.SigningServicer) routing.HandlerFunc {
+func TokenClientCredentialsHandler(openidConfig auth.OpenIDConfiguration, clientDB clientservice.Service, claimsDB claimservice.Service, consentSvc consentservice.Service, lifetimePolicy *tokenservice.LifetimePolicy, profilePolicy *tokenservice.ProfilePolicy, tokenSvc tokenservice.Service, keyService signing.SigningServicer) routing.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("request handler TokenClientCredentialsHandler started", "request", routing.RequestIDLogValue(r))
 		requstDTO := &dto.TokenClientCredentialsHandlerRequestDTO{}
 		requestValidator := request.NewValidator()
 		request.Unmarshal(r, requstDTO)
 		if !requestValidator.Validate(requstDTO) {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, validationErrorDescription(requestValidator))
 			slog.Error("request validation failed", "request", routing.RequestIDLogValue(r), "validationErrors", requestValidator.Errors)
 			return
 		}
 		if requstDTO.GrantType != "client_credentials" {
-			http.Error(w, "invalid grant type", http.StatusBadRequest)
+			oauthError(w, errUnsupportedGrantType, "unsupported grant_type")
 			slog.Error("invalid grant type", "request", routing.RequestIDLogValue(r))
 			return
 		}
@@ -217,13 +355,13 @@ func TokenClientCredentialsHandler(openidConfig auth.OpenIDConfiguration, client
 		// Authenticate client
 		credentials, err := authentication.NewCredentials(authentication.FromCliendIdAndSecret(requstDTO.ClientId, requstDTO.ClientSecret))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, err.Error())
 			slog.Error("could not read client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
 			return
 		}
 		client, err := clientDB.Authenticate(credentials)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidClient, "client authentication failed")
 			slog.Error("invalid client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
 			return
 		}
@@ -232,20 +370,26 @@ func TokenClientCredentialsHandler(openidConfig auth.OpenIDConfiguration, client
 		if len(requstDTO.Scope) > 0 {
 			scope = strings.Split(requstDTO.Scope, " ")
 		}
+		if scope, undefined := undefinedScope(scope, consentSvc); undefined {
+			oauthError(w, errInvalidScope, "scope '"+scope+"' is not defined")
+			slog.Error("invalid scope", "request", routing.RequestIDLogValue(r), "scope", scope)
+			return
+		}
 		issuer := openidConfig.Issuer
 		if openidConfig.UseOrigin {
-			issuer = getOriginFromRequest(r)
+			issuer = getOriginFromRequest(r) + openidConfig.IssuerPath
 		}
 		extraClaims := make(map[string]interface{})
-		tokenResponse, err := tokenReponse(issuer, nil, client, scope, extraClaims, claimsDB, keyService)
+		lifetimes := lifetimePolicy.Resolve(client.Id(), scope)
+		tokenResponse, err := tokenReponse(issuer, nil, client, scope, nil, extraClaims, lifetimes, profilePolicy, clock.Now(), claimsDB, tokenSvc, keyService)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, oauthErrorCode(err, errServerError), err.Error())
 			slog.Error("failed to construct token response", "request", routing.RequestIDLogValue(r), "error", err)
 			return
 		}
 		tokenResponseBytes, err := json.Marshal(tokenResponse)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errServerError, err.Error())
 			slog.Error("failed to marshal token response", "request", routing.RequestIDLogValue(r), "error", err)
 			return
 		}
@@ -258,19 +402,19 @@ func TokenClientCredentialsHandler(openidConfig auth.OpenIDConfiguration, client
 	}
 }
 
-func TokenPasswordHandler(openidConfig auth.OpenIDConfiguration, clientSvc clientservice.Service, userSvc userservice.Service, claimSvc claimservice.Service, consentSvc consentservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
+func TokenPasswordHandler(openidConfig auth.OpenIDConfiguration, clientSvc clientservice.Service, userSvc userservice.Service, claimSvc claimservice.Service, consentSvc consentservice.Service, lifetimePolicy *tokenservice.LifetimePolicy, profilePolicy *tokenservice.ProfilePolicy, tokenSvc tokenservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("request handler TokenPasswordHandler started")
 		requstDTO := &dto.TokenPasswrodRequestDTO{}
 		requestValidator := request.NewValidator()
 		request.Unmarshal(r, requstDTO)
 		if !requestValidator.Validate(requstDTO) {
-			http.Error(w, "bad request", http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, validationErrorDescription(requestValidator))
 			slog.Error("request validation failed", "request", routing.RequestIDLogValue(r), "validationErrors", requestValidator.Errors)
 			return
 		}
 		if requstDTO.GrantType != "password" {
-			http.Error(w, "invalid grant type", http.StatusBadRequest)
+			oauthError(w, errUnsupportedGrantType, "unsupported grant_type")
 			slog.Error("invalid grant type", "request", routing.RequestIDLogValue(r))
 			return
 		}
@@ -278,13 +422,13 @@ func TokenPasswordHandler(openidConfig auth.OpenIDConfiguration, clientSvc clien
 		// Authenticate client
 		clientCredentials, err := authentication.NewCredentials(authentication.FromCliendIdAndSecret(requstDTO.ClientId, requstDTO.ClientSecret))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, err.Error())
 			slog.Error("could not read client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
 			return
 		}
 		client, err := clientSvc.Authenticate(clientCredentials)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidClient, "client authentication failed")
 			slog.Error("invalid client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
 			return
 		}
@@ -292,36 +436,196 @@ func TokenPasswordHandler(openidConfig auth.OpenIDConfiguration, clientSvc clien
 		// Authenticate user
 		userCredenmtials, err := authentication.NewCredentials(authentication.FromUsernameAndPassword(requstDTO.Username, requstDTO.Password))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errInvalidRequest, err.Error())
 			slog.Error("could not read user credentials", "request", routing.RequestIDLogValue(r), "Username", requstDTO.Username, "error", err)
 			return
 		}
 		user, err := userSvc.Authenticate(userCredenmtials)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			slog.Error("invalid client credentials", "request", routing.RequestIDLogValue(r), "Username", requstDTO.Username, "error", err)
+			oauthError(w, errInvalidGrant, "invalid resource owner credentials")
+			slog.Error("invalid user credentials", "request", routing.RequestIDLogValue(r), "Username", requstDTO.Username, "error", err)
 			return
 		}
 
+		// second factor, users with a TOTP secret and users of clients requiring MFA send the code along
+		amr := []string{routing.AMRPassword}
+		if user.TOTPSecret() != "" || client.RequireMFA() {
+			if user.TOTPSecret() == "" || !authentication.ValidateTOTP(user.TOTPSecret(), requstDTO.OTP, clock.Now()) {
+				oauthError(w, errInvalidGrant, "invalid or missing one-time password")
+				slog.Error("invalid one-time password", "request", routing.RequestIDLogValue(r), "Username", requstDTO.Username)
+				return
+			}
+			amr = append(amr, routing.AMROTP)
+		}
+
 		scope := make([]string, 0)
 		if len(requstDTO.Scope) > 0 {
 			scope = strings.Split(requstDTO.Scope, " ")
 		}
+		if scope, undefined := undefinedScope(scope, consentSvc); undefined {
+			oauthError(w, errInvalidScope, "scope '"+scope+"' is not defined")
+			slog.Error("invalid scope", "request", routing.RequestIDLogValue(r), "scope", scope)
+			return
+		}
+
+		issuer := openidConfig.Issuer
+		if openidConfig.UseOrigin {
+			issuer = getOriginFromRequest(r) + openidConfig.IssuerPath
+		}
+		extraClaims := map[string]interface{}{"amr": amr}
+		lifetimes := lifetimePolicy.Resolve(client.Id(), scope)
+		tokenResponse, err := tokenReponse(issuer, user, client, scope, nil, extraClaims, lifetimes, profilePolicy, clock.Now(), claimSvc, tokenSvc, keySvc)
+		if err != nil {
+			oauthError(w, oauthErrorCode(err, errServerError), err.Error())
+			slog.Error("failed to construct token response", "request", routing.RequestIDLogValue(r), "error", err)
+			return
+		}
+		tokenResponseBytes, err := json.Marshal(tokenResponse)
+		if err != nil {
+			oauthError(w, errServerError, err.Error())
+			slog.Error("failed to marshal token response", "request", routing.RequestIDLogValue(r), "error", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+		w.Write(tokenResponseBytes)
+
+		slog.Info("token response successful", "request", routing.RequestIDLogValue(r))
+	}
+}
+
+func TokenRefreshTokenHandler(openidConfig auth.OpenIDConfiguration, clientSvc clientservice.Service, userSvc userservice.Service, claimSvc claimservice.Service, consentSvc consentservice.Service, lifetimePolicy *tokenservice.LifetimePolicy, profilePolicy *tokenservice.ProfilePolicy, tokenSvc tokenservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler TokenRefreshTokenHandler started", "request", routing.RequestIDLogValue(r))
+		requstDTO := &dto.TokenRefreshTokenRequestDTO{}
+		requestValidator := request.NewValidator()
+		request.Unmarshal(r, requstDTO)
+		if !requestValidator.Validate(requstDTO) {
+			oauthError(w, errInvalidRequest, validationErrorDescription(requestValidator))
+			slog.Error("request validation failed", "request", routing.RequestIDLogValue(r), "validationErrors", requestValidator.Errors)
+			return
+		}
+		if requstDTO.GrantType != "refresh_token" {
+			oauthError(w, errUnsupportedGrantType, "unsupported grant_type")
+			slog.Error("invalid grant type", "request", routing.RequestIDLogValue(r))
+			return
+		}
+
+		// Authenticate client
+		credentials, err := authentication.NewCredentials(authentication.FromCliendIdAndSecret(requstDTO.ClientId, requstDTO.ClientSecret))
+		if err != nil {
+			oauthError(w, errInvalidRequest, err.Error())
+			slog.Error("could not read client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
+			return
+		}
+		client, err := clientSvc.Authenticate(credentials)
+		if err != nil {
+			oauthError(w, errInvalidClient, "client authentication failed")
+			slog.Error("invalid client credentials", "request", routing.RequestIDLogValue(r), "ClientId", requstDTO.ClientId, "error", err)
+			return
+		}
+
+		// Validate refresh token
+		if !keySvc.Valid([]byte(requstDTO.RefreshToken)) {
+			oauthError(w, errInvalidGrant, "invalid or expired refresh token")
+			slog.Error("invalid or expired refresh token", "request", routing.RequestIDLogValue(r))
+			return
+		}
+		refreshClaims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(requstDTO.RefreshToken, refreshClaims); err != nil {
+			oauthError(w, errInvalidGrant, "invalid refresh token")
+			slog.Error("could not parse refresh token", "request", routing.RequestIDLogValue(r), "error", err)
+			return
+		}
+		if typ, _ := refreshClaims["typ"].(string); typ != "Refresh" {
+			oauthError(w, errInvalidGrant, "token is not a refresh token")
+			slog.Error("token is not a refresh token", "request", routing.RequestIDLogValue(r), "typ", typ)
+			return
+		}
+		if azp, _ := refreshClaims["azp"].(string); azp != client.Id() {
+			oauthError(w, errInvalidGrant, "refresh token was issued to another client")
+			slog.Error("refresh token client does not match", "request", routing.RequestIDLogValue(r), "azp", azp, "ClientId", client.Id())
+			return
+		}
+
+		// Resolve subject
+		var user userservice.Entity
+		if sub, _ := refreshClaims["sub"].(string); sub != client.Id() {
+			user, err = userSvc.GetUser(sub)
+			if err != nil {
+				oauthError(w, errInvalidGrant, "refresh token subject not found")
+				slog.Error("refresh token subject not found", "request", routing.RequestIDLogValue(r), "sub", sub, "error", err)
+				return
+			}
+		}
+
+		// Scopes can only be narrowed down, the refresh token keeps the scopes of the grant
+		grantScopeStr, ok := refreshClaims[refreshGrantScopeClaim].(string)
+		if !ok {
+			grantScopeStr, _ = refreshClaims["scope"].(string)
+		}
+		grantScopes := strings.Fields(grantScopeStr)
+		scopes := grantScopes
+		if len(requstDTO.Scope) > 0 {
+			requestedScopes := strings.Fields(requstDTO.Scope)
+			for _, requestedScope := range requestedScopes {
+				if !slices.Contains(grantScopes, requestedScope) {
+					oauthError(w, errInvalidScope, "requested scope exceeds the original grant")
+					slog.Error("requested scope exceeds the original grant", "request", routing.RequestIDLogValue(r), "scope", requestedScope)
+					return
+				}
+			}
+			scopes = requestedScopes
+		}
+		// scopes may have been deleted at runtime since the grant
+		if scope, undefined := undefinedScope(scopes, consentSvc); undefined {
+			oauthError(w, errInvalidScope, "scope '"+scope+"' is not defined")
+			slog.Error("invalid scope", "request", routing.RequestIDLogValue(r), "scope", scope)
+			return
+		}
+
+		authTime := clock.Now()
+		if authTimeRaw, ok := refreshClaims["auth_time"].(float64); ok {
+			authTime = time.Unix(int64(authTimeRaw), 0)
+		}
+		lifetimes := lifetimePolicy.Resolve(client.Id(), grantScopes)
+		if !lifetimes.RefreshTokenExpiry(clock.Now(), authTime).After(clock.Now()) {
+			oauthError(w, errInvalidGrant, "refresh token absolute lifetime exceeded")
+			slog.Error("refresh token absolute lifetime exceeded", "request", routing.RequestIDLogValue(r))
+			return
+		}
 
 		issuer := openidConfig.Issuer
 		if openidConfig.UseOrigin {
-			issuer = getOriginFromRequest(r)
+			issuer = getOriginFromRequest(r) + openidConfig.IssuerPath
 		}
 		extraClaims := make(map[string]interface{})
-		tokenResponse, err := tokenReponse(issuer, user, client, scope, extraClaims, claimSvc, keySvc)
+		if sid, ok := refreshClaims["sid"].(string); ok {
+			extraClaims["sid"] = sid
+		}
+		if amr, ok := refreshClaims["amr"].([]interface{}); ok {
+			extraClaims["amr"] = amr
+		}
+		// refresh tokens are rotated, the refresh token of the request can not be used again
+		expiresAt := lifetimes.RefreshTokenExpiry(clock.Now(), authTime)
+		if exp, _ := refreshClaims.GetExpirationTime(); exp != nil {
+			expiresAt = exp.Time
+		}
+		if err := tokenSvc.UseRefreshToken(requstDTO.RefreshToken, expiresAt); err != nil {
+			oauthError(w, errInvalidGrant, "refresh token has already been used")
+			slog.Error("refresh token reused", "request", routing.RequestIDLogValue(r), "error", err)
+			return
+		}
+		tokenResponse, err := tokenReponse(issuer, user, client, scopes, grantScopes, extraClaims, lifetimes, profilePolicy, authTime, claimSvc, tokenSvc, keySvc)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, oauthErrorCode(err, errServerError), err.Error())
 			slog.Error("failed to construct token response", "request", routing.RequestIDLogValue(r), "error", err)
 			return
 		}
 		tokenResponseBytes, err := json.Marshal(tokenResponse)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			oauthError(w, errServerError, err.Error())
 			slog.Error("failed to marshal token response", "request", routing.RequestIDLogValue(r), "error", err)
 			return
 		}
@@ -333,3 +637,17 @@ func TokenPasswordHandler(openidConfig auth.OpenIDConfiguration, clientSvc clien
 		slog.Info("token response successful", "request", routing.RequestIDLogValue(r))
 	}
 }
+
+// TokenUnsupportedGrantTypeHandler answers token requests not matched by any of the grant type handlers
+func TokenUnsupportedGrantTypeHandler() routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		grantType := r.PostFormValue("grant_type")
+		if grantType == "" {
+			oauthError(w, errInvalidRequest, "grant_type is required")
+			slog.Error("missing grant type", "request", routing.RequestIDLogValue(r))
+			return
+		}
+		oauthError(w, errUnsupportedGrantType, "grant_type '"+grantType+"' is not supported")
+		slog.Error("unsupported grant type", "request", routing.RequestIDLogValue(r), "grantType", grantType)
+	}
+}
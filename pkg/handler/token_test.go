@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/authorizationservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+)
+
+func TestTokenRefreshKeepsGrantLifetimes(t *testing.T) {
+	r := newTestRealm(t, "")
+	openidConfig := testOpenIDConfiguration()
+	passwordHandler := TokenPasswordHandler(openidConfig, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	refreshHandler := TokenRefreshTokenHandler(openidConfig, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock.Default.Set(start)
+	defer clock.Default.Reset()
+
+	w := serve(passwordHandler, http.MethodPost, "/token", url.Values{
+		"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+		"username": {"demo"}, "password": {"demo"}, "scope": {"openid offline_access"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("password grant status = %d, body %s", w.Code, w.Body.String())
+	}
+	refreshToken, _ := decodeJSON(t, w)["refresh_token"].(string)
+
+	// offline_access is not consented, the scope claim does not list it but its lifetimes apply
+	const offlineIdleSeconds = 2592000
+	for i := 1; i <= 2; i++ {
+		clock.Default.Set(start.Add(time.Duration(i) * time.Hour))
+		w := serve(refreshHandler, http.MethodPost, "/token", url.Values{
+			"grant_type": {"refresh_token"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+			"refresh_token": {refreshToken},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("refresh %d status = %d, body %s", i, w.Code, w.Body.String())
+		}
+		refreshToken, _ = decodeJSON(t, w)["refresh_token"].(string)
+		claims := tokenClaims(t, refreshToken)
+		if exp, _ := claims["exp"].(float64); int64(exp) != clock.Now().Unix()+offlineIdleSeconds {
+			t.Errorf("refresh %d: exp = %d, want %d", i, int64(exp), clock.Now().Unix()+offlineIdleSeconds)
+		}
+		if authTime, _ := claims["auth_time"].(float64); int64(authTime) != start.Unix() {
+			t.Errorf("refresh %d: auth_time = %d, want %d", i, int64(authTime), start.Unix())
+		}
+		if grantScope := claims[refreshGrantScopeClaim]; grantScope != "openid offline_access" {
+			t.Errorf("refresh %d: %s = %v, want the scopes of the grant", i, refreshGrantScopeClaim, grantScope)
+		}
+	}
+}
+
+func TestTokenUndefinedScope(t *testing.T) {
+	r := newTestRealm(t, "")
+	openidConfig := testOpenIDConfiguration()
+	passwordHandler := TokenPasswordHandler(openidConfig, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	if err := r.Consents.PutScope("api", consentservice.Scope{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the scopes of grants issued before a scope is deleted are checked again
+	w := serve(passwordHandler, http.MethodPost, "/token", url.Values{
+		"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+		"username": {"demo"}, "password": {"demo"}, "scope": {"openid api"},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("password grant status = %d, body %s", w.Code, w.Body.String())
+	}
+	refreshToken, _ := decodeJSON(t, w)["refresh_token"].(string)
+	client, err := r.Clients.GetClient("ACME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := r.Users.GetUser("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizationRequest, err := authorizationservice.NewAuthorizationRequest("code", []string{"openid", "api"}, client,
+		authorizationservice.WithRedirectURI("http://localhost/callback"), authorizationservice.WithUser(user))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := r.Authorizations.Store(authorizationRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Consents.DeleteScope("api"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		h    routing.HandlerFunc
+		form url.Values
+	}{
+		{
+			name: "authorization code",
+			h:    TokenAuthorizationCodeHandler(openidConfig, r.Clients, r.Consents, r.Authorizations, r.Claims, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing),
+			form: url.Values{"grant_type": {"authorization_code"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"}, "code": {code}, "redirect_uri": {"http://localhost/callback"}},
+		},
+		{
+			name: "password",
+			h:    passwordHandler,
+			form: url.Values{"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"}, "username": {"demo"}, "password": {"demo"}, "scope": {"openid email bogus"}},
+		},
+		{
+			name: "client credentials",
+			h:    TokenClientCredentialsHandler(openidConfig, r.Clients, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing),
+			form: url.Values{"grant_type": {"client_credentials"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"}, "scope": {"bogus"}},
+		},
+		{
+			name: "refresh token",
+			h:    TokenRefreshTokenHandler(openidConfig, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing),
+			form: url.Values{"grant_type": {"refresh_token"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"}, "refresh_token": {refreshToken}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.h, http.MethodPost, "/token", tt.form)
+			if w.Code != http.StatusBadRequest || decodeJSON(t, w)["error"] != errInvalidScope {
+				t.Errorf("status = %d, body %s, want 400 invalid_scope", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokenRefreshRotation(t *testing.T) {
+	r := newTestRealm(t, "")
+	openidConfig := testOpenIDConfiguration()
+	passwordHandler := TokenPasswordHandler(openidConfig, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	refreshHandler := TokenRefreshTokenHandler(openidConfig, r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		return serve(refreshHandler, http.MethodPost, "/token", url.Values{
+			"grant_type": {"refresh_token"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+			"refresh_token": {refreshToken},
+		})
+	}
+
+	w := serve(passwordHandler, http.MethodPost, "/token", url.Values{
+		"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+		"username": {"demo"}, "password": {"demo"}, "scope": {"openid"},
+	})
+	first, _ := decodeJSON(t, w)["refresh_token"].(string)
+	w = refresh(first)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d, body %s", w.Code, w.Body.String())
+	}
+	second, _ := decodeJSON(t, w)["refresh_token"].(string)
+
+	// the replayed refresh token is rejected, the rotated one works once
+	if w := refresh(first); w.Code != http.StatusBadRequest || decodeJSON(t, w)["error"] != errInvalidGrant {
+		t.Errorf("replay status = %d, body %s, want invalid_grant", w.Code, w.Body.String())
+	}
+	if w := refresh(second); w.Code != http.StatusOK {
+		t.Errorf("refresh with the rotated token status = %d, body %s", w.Code, w.Body.String())
+	}
+	if w := refresh(second); w.Code != http.StatusBadRequest {
+		t.Errorf("second use of the rotated token status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
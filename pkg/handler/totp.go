@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/service/template"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/axent-pl/oauth2mock/pkg/tpl"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+// the login flow offers the same secret while the user enrols
+const sessionKeyTOTPEnrolment = "totp_enrolment"
+
+// TOTPEnrolmentHandler lets the authenticated user enrol (or replace) the TOTP authenticator:
+// the page shows a new secret as a QR code and saves it once a valid code is posted
+func TOTPEnrolmentHandler(userSrv userservice.Service, sessionSrv sessionservice.Service) routing.HandlerFunc {
+	var templateSrv template.Service
+	templateSrv, wired := di.GiveMeInterface(templateSrv)
+	if !wired {
+		slog.Error("could not wire template service")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler TOTPEnrolmentHandler started", "request", routing.RequestIDLogValue(r))
+		user, ok := r.Context().Value(routing.CTX_USER).(userservice.Entity)
+		if !ok {
+			http.Error(w, "authentication failure", http.StatusInternalServerError)
+			return
+		}
+		sessionID, sessionData, ok := getSessionData(r, sessionSrv)
+		if !ok {
+			http.Error(w, "user session not initialized", http.StatusInternalServerError)
+			return
+		}
+
+		secret, _ := sessionData[sessionKeyTOTPEnrolment].(string)
+		if secret == "" {
+			var err error
+			if secret, err = authentication.NewTOTPSecret(); err != nil {
+				http.Error(w, "could not generate TOTP secret", http.StatusInternalServerError)
+				return
+			}
+			sessionData[sessionKeyTOTPEnrolment] = secret
+			sessionSrv.Put(sessionID, sessionData)
+		}
+		otpData := tpl.OTPTemplateData{
+			FormAction: r.URL.String(),
+			Secret:     secret,
+			KeyURI:     authentication.TOTPKeyURI(r.Host, user.Id(), secret),
+		}
+
+		// the login form posts the credentials to this page before it is shown
+		code := r.PostFormValue("otp")
+		if _, submitted := r.PostForm["otp"]; r.Method != http.MethodPost || !submitted {
+			templateSrv.Render(w, "otp", otpData)
+			return
+		}
+		if !authentication.ValidateTOTP(secret, code, clock.Now()) {
+			otpData.FormErrorMessage = "invalid code"
+			templateSrv.Render(w, "otp", otpData)
+			return
+		}
+		user.SetTOTPSecret(secret)
+		if err := userSrv.UpdateUser(user); err != nil {
+			slog.Error("failed to enrol TOTP", "request", routing.RequestIDLogValue(r), "userId", user.Id(), "error", err)
+			otpData.FormErrorMessage = "could not enrol the authenticator"
+			templateSrv.Render(w, "otp", otpData)
+			return
+		}
+		delete(sessionData, sessionKeyTOTPEnrolment)
+		sessionSrv.Put(sessionID, sessionData)
+
+		slog.Info("TOTP enrolled", "request", routing.RequestIDLogValue(r), "userId", user.Id())
+		templateSrv.Render(w, "otp", tpl.OTPTemplateData{Enrolled: true})
+	}
+}
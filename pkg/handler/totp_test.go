@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func testTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+	return testTOTPCodeAt(t, secret, clock.Now())
+}
+
+func testTOTPCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := authentication.TOTPCode(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPEnrolment(t *testing.T) {
+	useTestTemplates()
+	r := newTestRealm(t, "")
+	user, err := r.Users.GetUser("demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Sessions.Put("sid", sessionservice.SessionData{})
+	enrolment := TOTPEnrolmentHandler(r.Users, r.Sessions)
+	h := func(w http.ResponseWriter, req *http.Request) {
+		enrolment(w, req.WithContext(context.WithValue(req.Context(), routing.CTX_USER, user)))
+	}
+
+	w := serveInSession(h, "sid", http.MethodGet, "/mfa/totp", nil)
+	name, page := renderedPage(t, w)
+	secret, _ := page["Secret"].(string)
+	if name != "otp" || secret == "" {
+		t.Fatalf("enrolment page = %s %v, want the otp page with a secret", name, page)
+	}
+	if sessionData, _ := r.Sessions.Get("sid"); sessionData[sessionKeyTOTPEnrolment] != secret {
+		t.Errorf("session enrolment secret = %v, want %s", sessionData[sessionKeyTOTPEnrolment], secret)
+	}
+
+	w = serveInSession(h, "sid", http.MethodPost, "/mfa/totp", url.Values{"otp": {"000000"}})
+	if _, page := renderedPage(t, w); page["FormErrorMessage"] != "invalid code" || page["Secret"] != secret {
+		t.Errorf("page after an invalid code = %v, want an error and the same secret", page)
+	}
+	if stored, _ := r.Users.GetUser("demo"); stored.TOTPSecret() != "" {
+		t.Fatal("invalid code enrolled the secret")
+	}
+
+	w = serveInSession(h, "sid", http.MethodPost, "/mfa/totp", url.Values{"otp": {testTOTPCode(t, secret)}})
+	if _, page := renderedPage(t, w); page["Enrolled"] != true {
+		t.Errorf("page after a valid code = %v, want enrolled", page)
+	}
+	if stored, _ := r.Users.GetUser("demo"); stored.TOTPSecret() != secret {
+		t.Errorf("TOTP secret of the user = %q, want %q", stored.TOTPSecret(), secret)
+	}
+	if sessionData, _ := r.Sessions.Get("sid"); sessionData[sessionKeyTOTPEnrolment] != nil {
+		t.Error("enrolment secret left in the session")
+	}
+}
+
+func TestTOTPLogin(t *testing.T) {
+	useTestTemplates()
+	r := newTestRealm(t, `{"users": {"provider": "json", "users": {
+		"demo": {"username": "demo", "password": "demo", "totpSecret": "`+testTOTPSecret+`", "consents": {"openid": true}}
+	}}}`)
+	r.Sessions.Put("sid", sessionservice.SessionData{})
+
+	var gotUser userservice.Entity
+	var gotAMR []string
+	h := routing.UserAuthenticationMiddleware(r.Users, r.Sessions, r.Clients)(func(w http.ResponseWriter, req *http.Request) {
+		gotUser, _ = req.Context().Value(routing.CTX_USER).(userservice.Entity)
+		gotAMR, _ = req.Context().Value(routing.CTX_AMR).([]string)
+	})
+
+	// the password is the first factor, the one-time password follows
+	w := serveInSession(h, "sid", http.MethodPost, "/authorize", url.Values{"username": {"demo"}, "password": {"demo"}})
+	if name, page := renderedPage(t, w); name != "otp" || page["Secret"] != "" {
+		t.Fatalf("page after the password = %s %v, want the otp page without enrolment", name, page)
+	}
+	w = serveInSession(h, "sid", http.MethodPost, "/authorize", url.Values{"otp": {"000000"}})
+	if name, page := renderedPage(t, w); name != "otp" || page["FormErrorMessage"] != "invalid code" {
+		t.Fatalf("page after an invalid code = %s %v, want the otp page with an error", name, page)
+	}
+	if gotUser != nil {
+		t.Fatal("invalid code authenticated the user")
+	}
+
+	w = serveInSession(h, "sid", http.MethodPost, "/authorize", url.Values{"otp": {testTOTPCode(t, testTOTPSecret)}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/authorize" {
+		t.Fatalf("status = %d, Location = %q, want the request repeated", w.Code, w.Header().Get("Location"))
+	}
+	serveInSession(h, "sid", http.MethodGet, "/authorize", nil)
+	if gotUser == nil || gotUser.Id() != "demo" || !slices.Equal(gotAMR, []string{routing.AMRPassword, routing.AMROTP}) {
+		t.Errorf("authenticated user = %v, amr = %v, want demo with pwd and otp", gotUser, gotAMR)
+	}
+}
+
+func TestTOTPPasswordGrant(t *testing.T) {
+	r := newTestRealm(t, `{"users": {"provider": "json", "users": {
+		"demo": {"username": "demo", "password": "demo", "totpSecret": "`+testTOTPSecret+`", "consents": {"openid": true}}
+	}}}`)
+	h := TokenPasswordHandler(testOpenIDConfiguration(), r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	form := func(otp string) url.Values {
+		return url.Values{
+			"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+			"username": {"demo"}, "password": {"demo"}, "scope": {"openid"}, "otp": {otp},
+		}
+	}
+
+	for _, otp := range []string{"", "000000"} {
+		w := serve(h, http.MethodPost, "/token", form(otp))
+		if w.Code != http.StatusBadRequest || decodeJSON(t, w)["error"] != errInvalidGrant {
+			t.Errorf("otp %q: status = %d, body %s, want invalid_grant", otp, w.Code, w.Body.String())
+		}
+	}
+
+	w := serve(h, http.MethodPost, "/token", form(testTOTPCode(t, testTOTPSecret)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	amr, _ := tokenClaims(t, decodeJSON(t, w)["id_token"].(string))["amr"].([]any)
+	if !slices.Equal(amr, []any{routing.AMRPassword, routing.AMROTP}) {
+		t.Errorf("amr = %v, want pwd and otp", amr)
+	}
+}
+
+func TestTOTPUsesClock(t *testing.T) {
+	r := newTestRealm(t, `{"users": {"provider": "json", "users": {
+		"demo": {"username": "demo", "password": "demo", "totpSecret": "`+testTOTPSecret+`", "consents": {"openid": true}}
+	}}}`)
+	h := TokenPasswordHandler(testOpenIDConfiguration(), r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock.Default.Set(start)
+	defer clock.Default.Reset()
+	status := func(otp string) int {
+		return serve(h, http.MethodPost, "/token", url.Values{
+			"grant_type": {"password"}, "client_id": {"ACME"}, "client_secret": {"acme-secret"},
+			"username": {"demo"}, "password": {"demo"}, "scope": {"openid"}, "otp": {otp},
+		}).Code
+	}
+
+	code := testTOTPCodeAt(t, testTOTPSecret, start)
+	if got := status(testTOTPCodeAt(t, testTOTPSecret, time.Now())); got != http.StatusBadRequest {
+		t.Errorf("code of the real time: status = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := status(code); got != http.StatusOK {
+		t.Errorf("code of the virtual time: status = %d, want %d", got, http.StatusOK)
+	}
+	// a few steps later the code has expired
+	clock.Default.Set(start.Add(5 * time.Minute))
+	if got := status(code); got != http.StatusBadRequest {
+		t.Errorf("code after the clock was advanced: status = %d, want %d", got, http.StatusBadRequest)
+	}
+}
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 
 	"encoding/json"
 	"strings"
@@ -10,49 +12,111 @@ import (
 	"github.com/axent-pl/oauth2mock/pkg/claimservice"
 	"github.com/axent-pl/oauth2mock/pkg/clientservice"
 	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/encryption"
 	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/tokenservice"
 	"github.com/axent-pl/oauth2mock/pkg/userservice"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func UserinfoHandler(userSvc userservice.Service, clientSvc clientservice.Service, claimSvc claimservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
-			return
-		}
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if !keySvc.Valid([]byte(tokenString)) {
-			http.Error(w, "Invalid token signature", http.StatusUnauthorized)
-			return
+// bearerToken extracts the access token from the Authorization header
+// or, for POST requests, from the access_token form field (RFC 6750 section 2.2)
+func bearerToken(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	if r.Method == http.MethodPost {
+		return r.PostFormValue("access_token")
+	}
+	return ""
+}
+
+// bearerError writes an RFC 6750 error response with the WWW-Authenticate header
+func bearerError(w http.ResponseWriter, status int, errorCode string, description string) {
+	challenge := `Bearer realm="userinfo"`
+	if errorCode != "" {
+		challenge = fmt.Sprintf(`Bearer error="%s", error_description="%s"`, errorCode, description)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, description, status)
+}
+
+// userinfoResponse encodes the claims according to the client's registration:
+// plain JSON, a signed JWT, an encrypted JSON or a nested (signed then encrypted) JWT
+func userinfoResponse(userinfo map[string]interface{}, issuer string, client clientservice.Entity, keySvc signing.SigningServicer) (string, []byte, error) {
+	if client == nil || (client.UserinfoSignedResponseAlg() == "" && !client.UserinfoEncryption().Enabled()) {
+		body, err := json.Marshal(userinfo)
+		return "application/json", body, err
+	}
+
+	encryptionSettings := client.UserinfoEncryption()
+	if client.UserinfoSignedResponseAlg() == "" {
+		body, err := json.Marshal(userinfo)
+		if err != nil {
+			return "", nil, err
 		}
-		// Parse token claims
-		parsedToken, _, err := new(jwt.Parser).ParseUnverified(tokenString, jwt.MapClaims{})
+		key, err := encryption.SelectEncryptionKey(encryptionSettings.Keys, encryption.KeyManagementAlgorithm(encryptionSettings.Alg))
 		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return "", nil, err
+		}
+		body, err = encryption.Encrypt(body, key, encryption.KeyManagementAlgorithm(encryptionSettings.Alg), encryption.ContentEncryptionAlgorithm(encryptionSettings.Enc), "")
+		return "application/jwt", body, err
+	}
+
+	payload := make(map[string]interface{}, len(userinfo)+2)
+	for k, v := range userinfo {
+		payload[k] = v
+	}
+	payload["iss"] = issuer
+	payload["aud"] = client.Id()
+	body, err := keySvc.SignWithMethod(payload, signing.SigningMethod(client.UserinfoSignedResponseAlg()))
+	if err != nil {
+		return "", nil, err
+	}
+	body, err = encryptToken(body, encryptionSettings)
+	return "application/jwt", body, err
+}
+
+func UserinfoHandler(userSvc userservice.Service, clientSvc clientservice.Service, claimSvc claimservice.Service, tokenSvc tokenservice.Service, keySvc signing.SigningServicer) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := bearerToken(r)
+		if tokenString == "" {
+			bearerError(w, http.StatusUnauthorized, "", "Missing or invalid Authorization header")
 			return
 		}
-		claims, ok := parsedToken.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid claims", http.StatusUnauthorized)
+		claims, err := resolveAccessToken(tokenString, userSvc, clientSvc, claimSvc, tokenSvc, keySvc)
+		if err != nil {
+			bearerError(w, http.StatusUnauthorized, "invalid_token", "Invalid token")
 			return
 		}
 		userId, _ := claims["sub"].(string)
 		clientId, _ := claims["azp"].(string)
-		scopeStr, _ := claims["scope"].(string)
+		issuer, _ := claims["iss"].(string)
+		scopeStr, hasScope := claims["scope"].(string)
 		scopes := strings.Fields(scopeStr)
 		var user userservice.Entity
 		var client clientservice.Entity
-		var errUser, errClient error
-		if userId != "" {
-			user, errUser = userSvc.GetUser(userId)
-		}
 		if clientId != "" {
-			client, errClient = clientSvc.GetClient(clientId)
+			client, err = clientSvc.GetClient(clientId)
+			if err != nil {
+				bearerError(w, http.StatusUnauthorized, "invalid_token", "Client not found")
+				return
+			}
+		}
+		// the subject of app-only tokens is the client, any other subject must still exist
+		if userId != "" && userId != clientId {
+			user, err = userSvc.GetUser(userId)
+			if err != nil {
+				slog.Error("userinfo subject not found", "request", routing.RequestIDLogValue(r), "sub", userId, "error", err)
+				bearerError(w, http.StatusUnauthorized, "invalid_token", "User not found")
+				return
+			}
+		}
+		if user == nil && client == nil {
+			bearerError(w, http.StatusUnauthorized, "invalid_token", "User or client not found")
+			return
 		}
-		if errUser != nil && errClient != nil {
-			http.Error(w, "User or client not found", http.StatusUnauthorized)
+		if user != nil && hasScope && !slices.Contains(scopes, "openid") {
+			bearerError(w, http.StatusForbidden, "insufficient_scope", "The access token was not granted the openid scope")
 			return
 		}
 		var userinfo map[string]interface{}
@@ -67,7 +131,16 @@ func UserinfoHandler(userSvc userservice.Service, clientSvc clientservice.Servic
 			http.Error(w, "Failed to get claims", http.StatusInternalServerError)
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(userinfo)
+		shapeClaims(claimSvc, "userinfo", userinfo, client, scopes)
+		// the sub claim is required and must match the sub of the ID token (OpenID Connect Core section 5.3.2)
+		userinfo["sub"] = userId
+		contentType, body, err := userinfoResponse(userinfo, issuer, client, keySvc)
+		if err != nil {
+			slog.Error("failed to build userinfo response", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "Failed to build userinfo response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
 	}
 }
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUserinfo(t *testing.T) {
+	r := newTestRealm(t, `{"clients": {
+		"ACME": {"client_id": "ACME", "client_secret": "acme-secret", "redirect_uri": "*", "claims": {"default": {}}},
+		"SIGNED": {"client_id": "SIGNED", "client_secret": "signed-secret", "redirect_uri": "*", "claims": {"default": {}},
+			"userinfo_signed_response_alg": "ES256"}
+	}}`)
+	passwordHandler := TokenPasswordHandler(testOpenIDConfiguration(), r.Clients, r.Users, r.Claims, r.Consents, r.LifetimePolicy, r.TokenProfiles, r.Tokens, r.Signing)
+	h := UserinfoHandler(r.Users, r.Clients, r.Claims, r.Tokens, r.Signing)
+
+	accessToken := func(clientId string, scope string) string {
+		w := serve(passwordHandler, http.MethodPost, "/token", url.Values{
+			"grant_type": {"password"}, "client_id": {clientId}, "client_secret": {strings.ToLower(clientId) + "-secret"},
+			"username": {"demo"}, "password": {"demo"}, "scope": {scope},
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("password grant of %s status = %d, body %s", clientId, w.Code, w.Body.String())
+		}
+		token, _ := decodeJSON(t, w)["access_token"].(string)
+		return token
+	}
+	acme, signed, profileOnly := accessToken("ACME", "openid profile"), accessToken("SIGNED", "openid profile"), accessToken("ACME", "profile")
+
+	tests := []struct {
+		name            string
+		method          string
+		header          string
+		form            url.Values
+		wantStatus      int
+		wantContentType string
+		wantChallenge   string
+	}{
+		{name: "bearer header", method: http.MethodGet, header: "Bearer " + acme, wantStatus: http.StatusOK, wantContentType: "application/json"},
+		{name: "form body", method: http.MethodPost, form: url.Values{"access_token": {acme}}, wantStatus: http.StatusOK, wantContentType: "application/json"},
+		{name: "signed response", method: http.MethodGet, header: "Bearer " + signed, wantStatus: http.StatusOK, wantContentType: "application/jwt"},
+		{name: "missing token", method: http.MethodGet, wantStatus: http.StatusUnauthorized, wantChallenge: `Bearer realm="userinfo"`},
+		{name: "invalid token", method: http.MethodGet, header: "Bearer invalid", wantStatus: http.StatusUnauthorized, wantChallenge: `error="invalid_token"`},
+		{name: "no openid scope", method: http.MethodGet, header: "Bearer " + profileOnly, wantStatus: http.StatusForbidden, wantChallenge: `error="insufficient_scope"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			if tt.form != nil {
+				req = httptest.NewRequest(tt.method, "/userinfo", strings.NewReader(tt.form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(tt.method, "/userinfo", nil)
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, tt.wantChallenge) {
+				t.Errorf("WWW-Authenticate = %q, want %q", challenge, tt.wantChallenge)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != tt.wantContentType {
+				t.Fatalf("Content-Type = %q, want %q", contentType, tt.wantContentType)
+			}
+			var userinfo map[string]any
+			if tt.wantContentType == "application/jwt" {
+				userinfo = tokenClaims(t, w.Body.String())
+				if userinfo["iss"] != testIssuer || userinfo["aud"] != "SIGNED" {
+					t.Errorf("signed userinfo iss = %v, aud = %v, want %s and the client", userinfo["iss"], userinfo["aud"], testIssuer)
+				}
+			} else {
+				userinfo = decodeJSON(t, w)
+			}
+			if userinfo["preferred_username"] != "demo" || userinfo["sub"] != "demo" {
+				t.Errorf("userinfo = %v, want the claims and the sub of demo", userinfo)
+			}
+		})
+	}
+
+	// the token of a deleted user is not answered with the claims of its client
+	if err := r.Users.DeleteUser("demo"); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+acme)
+	w := httptest.NewRecorder()
+	h(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Errorf("userinfo of a deleted user status = %d, WWW-Authenticate = %q, want 401 invalid_token", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
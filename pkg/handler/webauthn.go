@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/template"
+	"github.com/axent-pl/oauth2mock/pkg/service/webauthn"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/axent-pl/oauth2mock/pkg/tpl"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+	"github.com/axent-pl/oauth2mock/pkg/webauthnservice"
+)
+
+// the challenge of a ceremony is kept in the session until the browser posts the response
+const (
+	sessionKeyPasskeyRegistration = "webauthn_registration"
+	sessionKeyPasskeyLogin        = "webauthn_login"
+)
+
+const passkeyCeremonyTimeout = 120000 // milliseconds
+
+// publicKeyCredential is the JSON serialization (PublicKeyCredential.toJSON()) of the browser response
+type publicKeyCredential struct {
+	RawId    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type publicKeyCredentialDescriptor struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+// relyingParty completes the relying party of the realm with the host and origin of the request
+func relyingParty(r *http.Request, webauthnSrv webauthnservice.Service) webauthn.RelyingParty {
+	rp := webauthnSrv.RelyingParty()
+	if rp.ID == "" {
+		rp.ID = r.Host
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			rp.ID = host
+		}
+	}
+	if rp.Name == "" {
+		rp.Name = rp.ID
+	}
+	if len(rp.Origins) == 0 {
+		rp.Origins = []string{getOriginFromRequest(r)}
+	}
+	return rp
+}
+
+func readPublicKeyCredential(r *http.Request) (*publicKeyCredential, error) {
+	credential := &publicKeyCredential{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func decodeBase64URL(values ...string) ([][]byte, error) {
+	decoded := make([][]byte, len(values))
+	for i, value := range values {
+		var err error
+		if decoded[i], err = webauthn.Encoding.DecodeString(value); err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
+
+// PasskeyRegistrationHandler registers passkeys of the authenticated user: the page starts the
+// registration ceremony in the browser and posts the new credential back to the same URL
+func PasskeyRegistrationHandler(webauthnSrv webauthnservice.Service, sessionSrv sessionservice.Service) routing.HandlerFunc {
+	var templateSrv template.Service
+	templateSrv, wired := di.GiveMeInterface(templateSrv)
+	if !wired {
+		slog.Error("could not wire template service")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler PasskeyRegistrationHandler started", "request", routing.RequestIDLogValue(r))
+		user, ok := r.Context().Value(routing.CTX_USER).(userservice.Entity)
+		if !ok {
+			http.Error(w, "authentication failure", http.StatusInternalServerError)
+			return
+		}
+		sessionID, sessionData, ok := getSessionData(r, sessionSrv)
+		if !ok {
+			http.Error(w, "user session not initialized", http.StatusInternalServerError)
+			return
+		}
+		rp := relyingParty(r, webauthnSrv)
+
+		// the login form posts the credentials to this page before it is shown
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			challenge, err := webauthn.NewChallenge()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			sessionData[sessionKeyPasskeyRegistration] = challenge
+			sessionSrv.Put(sessionID, sessionData)
+
+			credentials := webauthnSrv.GetCredentials(user.Id())
+			excludeCredentials := make([]publicKeyCredentialDescriptor, 0, len(credentials))
+			for _, credential := range credentials {
+				excludeCredentials = append(excludeCredentials, publicKeyCredentialDescriptor{Type: "public-key", Id: webauthn.Encoding.EncodeToString(credential.Id())})
+			}
+			pubKeyCredParams := make([]map[string]interface{}, 0, len(webauthn.SupportedAlgorithms))
+			for _, alg := range webauthn.SupportedAlgorithms {
+				pubKeyCredParams = append(pubKeyCredParams, map[string]interface{}{"type": "public-key", "alg": alg})
+			}
+			options, _ := json.Marshal(map[string]interface{}{
+				"publicKey": map[string]interface{}{
+					"rp": map[string]string{"id": rp.ID, "name": rp.Name},
+					"user": map[string]string{
+						"id":          webauthn.Encoding.EncodeToString([]byte(user.Id())),
+						"name":        user.Name(),
+						"displayName": user.Name(),
+					},
+					"challenge":          challenge,
+					"pubKeyCredParams":   pubKeyCredParams,
+					"timeout":            passkeyCeremonyTimeout,
+					"excludeCredentials": excludeCredentials,
+					"authenticatorSelection": map[string]interface{}{
+						"residentKey":        "required",
+						"requireResidentKey": true,
+						"userVerification":   "preferred",
+					},
+					"attestation": "none",
+				},
+			})
+			templateSrv.Render(w, "passkey", tpl.PasskeyTemplateData{
+				FormAction:  r.URL.String(),
+				Options:     string(options),
+				Credentials: len(credentials),
+			})
+			return
+		}
+
+		challenge, _ := sessionData[sessionKeyPasskeyRegistration].(string)
+		delete(sessionData, sessionKeyPasskeyRegistration)
+		sessionSrv.Put(sessionID, sessionData)
+
+		response, err := readPublicKeyCredential(r)
+		if err != nil {
+			http.Error(w, "invalid credential", http.StatusBadRequest)
+			return
+		}
+		decoded, err := decodeBase64URL(response.Response.ClientDataJSON, response.Response.AttestationObject)
+		if err != nil {
+			http.Error(w, "invalid credential encoding", http.StatusBadRequest)
+			return
+		}
+		credential, err := webauthn.VerifyRegistration(rp, challenge, decoded[0], decoded[1])
+		if err != nil {
+			slog.Error("passkey registration failed", "request", routing.RequestIDLogValue(r), "userId", user.Id(), "error", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := webauthnSrv.AddCredential(webauthnservice.NewCredential(credential.ID, user.Id(), credential.PublicKey, credential.SignCount)); err != nil {
+			slog.Error("passkey registration failed", "request", routing.RequestIDLogValue(r), "userId", user.Id(), "error", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		slog.Info("passkey registered", "request", routing.RequestIDLogValue(r), "userId", user.Id())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(publicKeyCredentialDescriptor{Type: "public-key", Id: webauthn.Encoding.EncodeToString(credential.ID)})
+	}
+}
+
+// PasskeyLoginHandler is the passwordless login of the login form: GET returns the options of the
+// authentication ceremony, POST verifies the assertion and makes the owner of the passkey the user of the session
+func PasskeyLoginHandler(userSrv userservice.Service, webauthnSrv webauthnservice.Service, sessionSrv sessionservice.Service) routing.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("request handler PasskeyLoginHandler started", "request", routing.RequestIDLogValue(r))
+		sessionID, sessionData, ok := getSessionData(r, sessionSrv)
+		if !ok {
+			http.Error(w, "user session not initialized", http.StatusInternalServerError)
+			return
+		}
+		rp := relyingParty(r, webauthnSrv)
+
+		if r.Method == http.MethodGet {
+			challenge, err := webauthn.NewChallenge()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			sessionData[sessionKeyPasskeyLogin] = challenge
+			sessionSrv.Put(sessionID, sessionData)
+
+			// discoverable credentials, the authenticator lets the user pick the account
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"publicKey": map[string]interface{}{
+					"rpId":             rp.ID,
+					"challenge":        challenge,
+					"timeout":          passkeyCeremonyTimeout,
+					"userVerification": "preferred",
+				},
+			})
+			return
+		}
+
+		challenge, _ := sessionData[sessionKeyPasskeyLogin].(string)
+		delete(sessionData, sessionKeyPasskeyLogin)
+		sessionSrv.Put(sessionID, sessionData)
+
+		response, err := readPublicKeyCredential(r)
+		if err != nil {
+			http.Error(w, "invalid credential", http.StatusBadRequest)
+			return
+		}
+		decoded, err := decodeBase64URL(response.RawId, response.Response.ClientDataJSON, response.Response.AuthenticatorData, response.Response.Signature, response.Response.UserHandle)
+		if err != nil {
+			http.Error(w, "invalid credential encoding", http.StatusBadRequest)
+			return
+		}
+		credential, err := webauthnSrv.GetCredential(decoded[0])
+		if err != nil {
+			slog.Error("passkey login failed", "request", routing.RequestIDLogValue(r), "error", err)
+			http.Error(w, "unknown passkey", http.StatusUnauthorized)
+			return
+		}
+		if len(decoded[4]) > 0 && string(decoded[4]) != credential.UserId() {
+			http.Error(w, "passkey of another user", http.StatusUnauthorized)
+			return
+		}
+		assertion, err := webauthn.VerifyAssertion(rp, challenge, credential.PublicKey(), credential.SignCount(), decoded[1], decoded[2], decoded[3])
+		if err != nil {
+			slog.Error("passkey login failed", "request", routing.RequestIDLogValue(r), "userId", credential.UserId(), "error", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		credential.SetSignCount(assertion.SignCount)
+		if err := webauthnSrv.UpdateCredential(credential); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		user, err := userSrv.GetUser(credential.UserId())
+		if err != nil || !user.Active() {
+			slog.Error("passkey login failed", "request", routing.RequestIDLogValue(r), "userId", credential.UserId(), "error", err)
+			http.Error(w, "unknown user", http.StatusUnauthorized)
+			return
+		}
+
+		// proof of possession of the key with a user presence test, verified users passed a second factor
+		amr := []string{routing.AMRHardwareKey, routing.AMRUserPresence}
+		if assertion.UserVerified {
+			amr = append(amr, routing.AMRMultiFactor)
+		}
+		routing.SignIn(sessionData, user, amr)
+		sessionSrv.Put(sessionID, sessionData)
+
+		slog.Info("passkey login succeeded", "request", routing.RequestIDLogValue(r), "userId", user.Id())
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
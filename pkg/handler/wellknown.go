@@ -6,16 +6,21 @@ import (
 	"net/http"
 
 	"github.com/axent-pl/oauth2mock/pkg/auth"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
 	"github.com/axent-pl/oauth2mock/pkg/http/routing"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
 )
 
-func WellKnownHandler(openidConfig auth.OpenIDConfiguration) routing.HandlerFunc {
+// WellKnownHandler serves the discovery document, alg "none" is listed for request objects
+// while a client of the realm accepts unsigned request objects
+func WellKnownHandler(openidConfig auth.OpenIDConfiguration, clientSrv clientservice.Service) routing.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("request handler WellKnownHandler started")
 		openidConfigCopy := openidConfig
+		openidConfigCopy.RequestObjectSigningAlgValuesSupported = signing.SupportedVerificationMethods(allowsUnsignedRequestObjects(clientSrv))
 
 		if openidConfig.UseOrigin {
-			origin := getOriginFromRequest(r)
+			origin := getOriginFromRequest(r) + openidConfig.IssuerPath
 			openidConfigCopy.SetIssuer(origin)
 		} else {
 			openidConfigCopy.SetIssuer(openidConfigCopy.Issuer)
@@ -31,3 +36,12 @@ func WellKnownHandler(openidConfig auth.OpenIDConfiguration) routing.HandlerFunc
 
 	}
 }
+
+func allowsUnsignedRequestObjects(clientSrv clientservice.Service) bool {
+	for _, clientConfig := range clientSrv.GetClientConfigs() {
+		if clientConfig.AllowUnsignedRequestObject {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package routing
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AdminPathPrefix is the path (below the realm) of the endpoints which manage the mock itself, they are never faulted
+const AdminPathPrefix = "/admin/"
+
+// AdminAuthenticationMiddleware protects the management API. The bearer token of the request must be
+// the admin token (when configured) or a JWT access token of the realm (signed by signingSrv) whose
+// scope claim contains adminScope.
+func AdminAuthenticationMiddleware(adminToken string, adminScope string, signingSrv signing.SigningServicer) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			token, ok := strings.CutPrefix(authHeader, "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, "missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+				next(w, r)
+				return
+			}
+
+			if !signingSrv.Valid([]byte(token)) {
+				slog.Error("invalid admin token", "request", RequestIDLogValue(r))
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="Invalid token"`)
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			claims := jwt.MapClaims{}
+			if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			typ, _ := claims["typ"].(string)
+			scope, _ := claims["scope"].(string)
+			if typ != "Bearer" || !slices.Contains(strings.Fields(scope), adminScope) {
+				slog.Error("admin scope missing", "request", RequestIDLogValue(r), "sub", claims["sub"], "scope", scope)
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", error_description="The access token was not granted the admin scope"`)
+				http.Error(w, "insufficient scope", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
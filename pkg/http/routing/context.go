@@ -5,9 +5,13 @@ package routing
 type CTX_USER_TYPE string
 type CTX_REQUEST_ID_TYPE string
 type CTX_SESSION_ID_TYPE string
+type CTX_AMR_TYPE string
+type CTX_AUTH_TIME_TYPE string
 
 const (
 	CTX_USER       CTX_USER_TYPE       = "user"
 	CTX_REQUEST_ID CTX_REQUEST_ID_TYPE = "RequestID"
 	CTX_SESSION_ID CTX_SESSION_ID_TYPE = "SessionID"
+	CTX_AMR        CTX_AMR_TYPE        = "AMR"
+	CTX_AUTH_TIME  CTX_AUTH_TIME_TYPE  = "AuthTime"
 )
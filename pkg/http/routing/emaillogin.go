@@ -0,0 +1,111 @@
+package routing
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/mailservice"
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+	"github.com/google/uuid"
+)
+
+const (
+	emailLoginTTL         = 10 * time.Minute
+	emailLoginMaxAttempts = 5
+	emailLoginCodeDigits  = 6
+	emailLoginTokenParam  = "login_token" // query parameter of the magic link
+)
+
+// emailLogin is the pending email login of a session, the code and the magic link
+// only work in the browser which requested them
+type emailLogin struct {
+	UserId   string
+	Code     string
+	Token    string
+	Expires  time.Time
+	Attempts int
+}
+
+func (l emailLogin) expired() bool {
+	return clock.Now().After(l.Expires) || l.Attempts >= emailLoginMaxAttempts
+}
+
+func (l emailLogin) validCode(code string) bool {
+	return subtle.ConstantTimeCompare([]byte(l.Code), []byte(code)) == 1
+}
+
+func (l emailLogin) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(l.Token), []byte(token)) == 1
+}
+
+// findUserByEmail returns the active user with the email address, users without one are matched by a name which is an address
+func findUserByEmail(userSrv userservice.Service, address string) (userservice.Entity, error) {
+	users, err := userSrv.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		email := user.Email()
+		if email == "" && strings.Contains(user.Name(), "@") {
+			email = user.Name()
+		}
+		if email != "" && strings.EqualFold(email, address) && user.Active() {
+			return user, nil
+		}
+	}
+	return nil, errors.New("no user with the email address")
+}
+
+// sendEmailLogin starts the email login of the user, the message carries a one-time code
+// and the magic link (loginURL with the login token)
+func sendEmailLogin(mailSrv mailservice.Service, user userservice.Entity, address string, loginURL string) (emailLogin, error) {
+	code, err := authentication.NewOneTimeCode(emailLoginCodeDigits)
+	if err != nil {
+		return emailLogin{}, err
+	}
+	login := emailLogin{
+		UserId:  user.Id(),
+		Code:    code,
+		Token:   uuid.NewString(),
+		Expires: clock.Now().Add(emailLoginTTL),
+	}
+	separator := "?"
+	if strings.Contains(loginURL, "?") {
+		separator = "&"
+	}
+	link := loginURL + separator + emailLoginTokenParam + "=" + login.Token
+
+	err = mailSrv.Send(mailservice.Message{
+		To:      address,
+		Subject: "Your sign-in code is " + code,
+		Text: fmt.Sprintf("Hi %s,\n\nyour sign-in code is %s, or open the link below to sign in:\n\n%s\n\n"+
+			"The code and the link expire in %d minutes and only work in the browser the sign-in was started in.\n",
+			user.Name(), code, link, int(emailLoginTTL.Minutes())),
+	})
+	return login, err
+}
+
+// withoutLoginToken returns the URL of the request without the magic link token
+func withoutLoginToken(r *http.Request) string {
+	url := *r.URL
+	query := url.Query()
+	if !query.Has(emailLoginTokenParam) {
+		return r.URL.String()
+	}
+	query.Del(emailLoginTokenParam)
+	url.RawQuery = query.Encode()
+	return url.String()
+}
+
+func requestOrigin(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
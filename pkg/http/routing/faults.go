@@ -0,0 +1,103 @@
+package routing
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/dto"
+	"github.com/axent-pl/oauth2mock/pkg/faultservice"
+)
+
+// malformedJSON looks like the start of a token response
+const malformedJSON = `{"access_token":"eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJzdWIiOiJk`
+
+// FaultInjectionMiddleware injects the fault of the first rule of faultSrv matching the request,
+// the paths of the rules are relative to basePath (the path of the realm)
+func FaultInjectionMiddleware(faultSrv faultservice.Service, basePath string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			// without rules the body is left alone, reading the form would consume it
+			if !faultSrv.Enabled() || len(faultSrv.GetRules()) == 0 {
+				next(w, r)
+				return
+			}
+			if strings.HasPrefix(strings.TrimPrefix(r.URL.Path, basePath), AdminPathPrefix) {
+				next(w, r)
+				return
+			}
+			request := faultRequest(r, basePath)
+			rule, ok := faultSrv.Match(request)
+			if !ok {
+				next(w, r)
+				return
+			}
+			slog.Warn("fault injected", "request", RequestIDLogValue(r), "rule", rule.Name, "clientId", request.ClientId, "user", request.User)
+
+			if rule.LatencyMs > 0 {
+				select {
+				case <-time.After(time.Duration(rule.LatencyMs) * time.Millisecond):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			switch {
+			case rule.Drop:
+				// the server closes the connection without writing a response
+				panic(http.ErrAbortHandler)
+			case rule.MalformedJSON:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(statusOr(rule.Status, http.StatusOK))
+				w.Write([]byte(malformedJSON))
+			case rule.Error != "":
+				body, _ := json.Marshal(dto.ErrorResponseDTO{Error: rule.Error, ErrorDescription: rule.ErrorDescription})
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "no-store")
+				w.WriteHeader(statusOr(rule.Status, http.StatusBadRequest))
+				w.Write(body)
+			case rule.Status != 0:
+				http.Error(w, http.StatusText(rule.Status), rule.Status)
+			default:
+				// latency only
+				next(w, r)
+			}
+		}
+	}
+}
+
+// faultRequest collects the attributes of the request the rules select by, the client is
+// taken from the client_id parameter or the basic authentication, the user from the username
+// (password grant) or the login_hint (authorization request) parameter
+func faultRequest(r *http.Request, basePath string) faultservice.Request {
+	request := faultservice.Request{
+		Path:   strings.TrimPrefix(r.URL.Path, basePath),
+		Method: r.Method,
+	}
+	if request.Path == "" {
+		request.Path = "/"
+	}
+
+	request.ClientId = r.URL.Query().Get("client_id")
+	if request.ClientId == "" {
+		request.ClientId = r.PostFormValue("client_id")
+	}
+	if request.ClientId == "" {
+		request.ClientId, _, _ = r.BasicAuth()
+	}
+
+	request.User = r.PostFormValue("username")
+	if request.User == "" {
+		request.User = r.URL.Query().Get("login_hint")
+	}
+	return request
+}
+
+func statusOr(status int, fallback int) int {
+	if status == 0 {
+		return fallback
+	}
+	return status
+}
@@ -0,0 +1,50 @@
+package routing
+
+import (
+	"github.com/axent-pl/oauth2mock/pkg/brokerservice"
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/mailservice"
+)
+
+// LoginOption enables a login method of UserAuthenticationMiddleware besides the password
+type LoginOption func(*loginOptions)
+
+type loginOptions struct {
+	brokerSrv        brokerservice.Service
+	brokerLoginPath  string
+	passkeyLoginPath string
+	mailSrv          mailservice.Service
+	personaClaimSrv  claimservice.Service
+	personas         bool
+}
+
+// WithBrokerLogin links the upstreams of brokerSrv through the broker login endpoint brokerLoginPath
+func WithBrokerLogin(brokerSrv brokerservice.Service, brokerLoginPath string) LoginOption {
+	return func(o *loginOptions) {
+		o.brokerSrv = brokerSrv
+		o.brokerLoginPath = brokerLoginPath
+	}
+}
+
+// WithPasskeyLogin offers the passkey login of the endpoint passkeyLoginPath
+func WithPasskeyLogin(passkeyLoginPath string) LoginOption {
+	return func(o *loginOptions) {
+		o.passkeyLoginPath = passkeyLoginPath
+	}
+}
+
+// WithEmailLogin lets users request a one-time code and a magic link sent through mailSrv
+func WithEmailLogin(mailSrv mailservice.Service) LoginOption {
+	return func(o *loginOptions) {
+		o.mailSrv = mailSrv
+	}
+}
+
+// WithPersonaLogin lists the users on the login page to sign in with one click, without any credentials.
+// The roles shown are taken from the claims of claimSrv. Development only!
+func WithPersonaLogin(claimSrv claimservice.Service) LoginOption {
+	return func(o *loginOptions) {
+		o.personas = true
+		o.personaClaimSrv = claimSrv
+	}
+}
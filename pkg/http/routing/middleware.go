@@ -2,10 +2,16 @@ package routing
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
 	"github.com/axent-pl/oauth2mock/pkg/di"
 	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
 	"github.com/axent-pl/oauth2mock/pkg/service/template"
@@ -30,13 +36,11 @@ func RateLimitMiddleware(rps float64, burst int) Middleware {
 	}
 }
 
-func SessionMiddleware() Middleware {
-	var wired bool
-	var sessionSrv sessionservice.Service
-	sessionSrv, wired = di.GiveMeInterface(sessionSrv)
-	if !wired {
-		slog.Error("could not wire session service")
-		return nil
+// SessionMiddleware binds the request to a session of sessionSrv, the session cookie is scoped to cookiePath
+// so that realms hosted under different paths do not share sessions
+func SessionMiddleware(sessionSrv sessionservice.Service, cookiePath string) Middleware {
+	if cookiePath == "" {
+		cookiePath = "/"
 	}
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
@@ -63,7 +67,7 @@ func SessionMiddleware() Middleware {
 				http.SetCookie(w, &http.Cookie{
 					Name:     cookieSID,
 					Value:    sessionID,
-					Path:     "/",
+					Path:     cookiePath,
 					HttpOnly: true,
 					SameSite: http.SameSiteLaxMode,
 					MaxAge:   int(cookieTTL.Seconds()),
@@ -76,32 +80,100 @@ func SessionMiddleware() Middleware {
 	}
 }
 
-func UserAuthenticationMiddleware() Middleware {
+// session keys of the login flow
+const (
+	sessionKeyUser          = "user"
+	sessionKeyAMR           = "amr"            // authentication methods (RFC 8176) of the session user
+	sessionKeyAuthTime      = "auth_time"      // when the session user authenticated
+	sessionKeyMFAUser       = "mfa_user"       // user who passed the first factor and owes the second
+	sessionKeyTOTPEnrolment = "totp_enrolment" // secret offered to a user who has not enrolled TOTP yet
+	sessionKeyEmailLogin    = "email_login"    // code and magic link sent to the user
+	sessionKeyPersona       = "persona"        // user requested by the login hint of the persona login
+)
+
+// the typed session values of the login flow survive a session snapshot
+func init() {
+	decodeUser := func(raw json.RawMessage) (any, error) { return userservice.UnmarshalEntity(raw) }
+	sessionservice.RegisterValue(sessionKeyUser, decodeUser)
+	sessionservice.RegisterValue(sessionKeyMFAUser, decodeUser)
+	sessionservice.RegisterValue(sessionKeyAMR, sessionservice.DecodeAs[[]string])
+	sessionservice.RegisterValue(sessionKeyAuthTime, sessionservice.DecodeAs[time.Time])
+	sessionservice.RegisterValue(sessionKeyEmailLogin, sessionservice.DecodeAs[emailLogin])
+}
+
+// SignIn makes user the authenticated user of the session, amr are the authentication methods
+// (RFC 8176) the user passed, the authentication time is now
+func SignIn(sessionData sessionservice.SessionData, user userservice.Entity, amr []string) {
+	sessionData[sessionKeyUser] = user
+	if len(amr) > 0 {
+		sessionData[sessionKeyAMR] = amr
+	} else {
+		delete(sessionData, sessionKeyAMR)
+	}
+	sessionData[sessionKeyAuthTime] = clock.Now()
+	delete(sessionData, sessionKeyMFAUser)
+}
+
+// SignOut clears the session: the user, the authentication state (amr, auth_time, a pending second
+// factor, TOTP enrolment, email login, persona) and the state of logins in progress
+func SignOut(sessionData sessionservice.SessionData) {
+	clear(sessionData)
+}
+
+// authentication method references (RFC 8176)
+const (
+	AMRPassword     = "pwd"
+	AMROTP          = "otp"
+	AMRHardwareKey  = "hwk"
+	AMRUserPresence = "user"
+	AMRMultiFactor  = "mfa"
+	AMREmail        = "email" // one-time code or magic link sent by email (not registered by RFC 8176)
+)
+
+// multiFactor tells whether the authentication methods satisfy clients requiring MFA
+func multiFactor(amr []string) bool {
+	return slices.Contains(amr, AMROTP) || slices.Contains(amr, AMRMultiFactor)
+}
+
+// UserAuthenticationMiddleware renders the login form until the user of the session is authenticated,
+// options add the login methods besides the password (upstream providers, passkeys, email, personas).
+// Users with a TOTP secret, and all users of clients requiring MFA, have to pass a one-time password
+// as the second step, users without a secret enrol one on the way.
+func UserAuthenticationMiddleware(userSrv userservice.Service, sessionSrv sessionservice.Service, clientSrv clientservice.Service, options ...LoginOption) Middleware {
 	var wired bool
 	var templateSrv template.Service
-	var userSrv userservice.Service
-	var sessionSrv sessionservice.Service
+
+	login := loginOptions{}
+	for _, option := range options {
+		option(&login)
+	}
+	mailSrv := login.mailSrv
 
 	templateSrv, wired = di.GiveMeInterface(templateSrv)
 	if !wired {
 		slog.Error("could not wire template service")
 		return nil
 	}
-	userSrv, wired = di.GiveMeInterface(userSrv)
-	if !wired {
-		slog.Error("could not wire user service")
-		return nil
-	}
-	sessionSrv, wired = di.GiveMeInterface(sessionSrv)
-	if !wired {
-		slog.Error("could not wire session service")
-		return nil
-	}
 
 	return func(next HandlerFunc) HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
+			// the magic link token is consumed by the login, it is not passed on
+			returnURL := withoutLoginToken(r)
 			templateData := tpl.LoginTemplateData{
-				FormAction: r.URL.String(),
+				FormAction:      returnURL,
+				PasskeyLoginURL: login.passkeyLoginPath,
+				EmailLogin:      mailSrv != nil,
+			}
+			if login.brokerSrv != nil {
+				for _, upstream := range login.brokerSrv.GetUpstreams() {
+					query := url.Values{}
+					query.Set("upstream", upstream.Alias())
+					query.Set("return", returnURL)
+					templateData.Upstreams = append(templateData.Upstreams, tpl.UpstreamLink{
+						DisplayName: upstream.DisplayName(),
+						URL:         login.brokerLoginPath + "?" + query.Encode(),
+					})
+				}
 			}
 
 			valid := true
@@ -117,15 +189,164 @@ func UserAuthenticationMiddleware() Middleware {
 				http.Error(w, "user session not initialized", http.StatusInternalServerError)
 				return
 			}
-			if userRaw, ok := sessionData["user"]; ok {
+
+			// the client of an authorization request may require the second factor
+			mfaRequired := false
+			client, err := clientSrv.GetClient(r.URL.Query().Get("client_id"))
+			if err == nil {
+				mfaRequired = client.RequireMFA()
+			} else {
+				client = nil
+			}
+			if login.personas {
+				templateData.Personas = getPersonas(userSrv, login.personaClaimSrv, client)
+			}
+
+			authenticated := func(user userservice.Entity, amr []string) {
+				ctx := context.WithValue(r.Context(), CTX_USER, user)
+				ctx = context.WithValue(ctx, CTX_AMR, amr)
+				if authTime, ok := sessionData[sessionKeyAuthTime].(time.Time); ok {
+					ctx = context.WithValue(ctx, CTX_AUTH_TIME, authTime)
+				}
+				next(w, r.WithContext(ctx))
+			}
+
+			// persona login, the user of the login hint replaces the user of the session
+			query := r.URL.Query()
+			if hint := query.Get("login_hint"); login.personas && hint != "" && query.Get(personaLoginParam) == "true" {
+				if current, ok := sessionData[sessionKeyUser].(userservice.Entity); !ok || current.Name() != hint {
+					delete(sessionData, sessionKeyUser)
+					delete(sessionData, sessionKeyMFAUser)
+					sessionData[sessionKeyPersona] = hint
+				}
+			}
+
+			if userRaw, ok := sessionData[sessionKeyUser]; ok {
 				user, casted := userRaw.(userservice.Entity)
 				if !casted {
 					http.Error(w, "could not fetch user from session", http.StatusInternalServerError)
 					return
 				}
-				ctx := context.WithValue(r.Context(), CTX_USER, user)
-				r = r.WithContext(ctx)
-				next(w, r)
+				amr, _ := sessionData[sessionKeyAMR].([]string)
+				if !mfaRequired || multiFactor(amr) {
+					authenticated(user, amr)
+					return
+				}
+				// step-up, the session lacks the second factor the client requires
+				sessionData[sessionKeyMFAUser] = user
+				sessionSrv.Put(sessionID, sessionData)
+			}
+
+			// second factor, the form is shown right after the first factor which does not post an otp field
+			secondFactor := func(user userservice.Entity) {
+				otpData := tpl.OTPTemplateData{
+					FormAction: returnURL,
+				}
+				secret := user.TOTPSecret()
+				enrolment := secret == ""
+				if enrolment {
+					secret, _ = sessionData[sessionKeyTOTPEnrolment].(string)
+					if secret == "" {
+						var err error
+						if secret, err = authentication.NewTOTPSecret(); err != nil {
+							http.Error(w, "could not generate TOTP secret", http.StatusInternalServerError)
+							return
+						}
+						sessionData[sessionKeyTOTPEnrolment] = secret
+						sessionSrv.Put(sessionID, sessionData)
+					}
+					otpData.Secret = secret
+					otpData.KeyURI = authentication.TOTPKeyURI(r.Host, user.Id(), secret)
+				}
+
+				code := r.PostFormValue("otp")
+				if _, submitted := r.PostForm["otp"]; r.Method != http.MethodPost || !submitted {
+					templateSrv.Render(w, "otp", otpData)
+					return
+				}
+				if !authentication.ValidateTOTP(secret, code, clock.Now()) {
+					otpData.FormErrorMessage = "invalid code"
+					templateSrv.Render(w, "otp", otpData)
+					return
+				}
+				if enrolment {
+					user.SetTOTPSecret(secret)
+					if err := userSrv.UpdateUser(user); err != nil {
+						slog.Error("failed to enrol TOTP", "userId", user.Id(), "error", err)
+						otpData.FormErrorMessage = "could not enrol the authenticator"
+						templateSrv.Render(w, "otp", otpData)
+						return
+					}
+					delete(sessionData, sessionKeyTOTPEnrolment)
+				}
+
+				amr, _ := sessionData[sessionKeyAMR].([]string)
+				SignIn(sessionData, user, append(slices.Clone(amr), AMROTP))
+				sessionSrv.Put(sessionID, sessionData)
+				// the posted code must not reach the handler, the request is repeated with the authenticated session
+				http.Redirect(w, r, returnURL, http.StatusSeeOther)
+			}
+
+			if user, ok := sessionData[sessionKeyMFAUser].(userservice.Entity); ok {
+				secondFactor(user)
+				return
+			}
+
+			// firstFactor completes the login or continues with the second factor, the request is repeated
+			// when its parameters (email code or magic link) must not reach the handler
+			firstFactor := func(user userservice.Entity, amr []string, repeat bool) {
+				sessionData[sessionKeyAMR] = amr
+				if user.TOTPSecret() != "" || mfaRequired {
+					sessionData[sessionKeyMFAUser] = user
+					sessionSrv.Put(sessionID, sessionData)
+					secondFactor(user)
+					return
+				}
+				SignIn(sessionData, user, amr)
+				sessionSrv.Put(sessionID, sessionData)
+				if repeat {
+					http.Redirect(w, r, returnURL, http.StatusSeeOther)
+					return
+				}
+				authenticated(user, amr)
+			}
+
+			// persona login, requested by the login hint or picked on the login page
+			persona, _ := sessionData[sessionKeyPersona].(string)
+			delete(sessionData, sessionKeyPersona)
+			if r.Method == http.MethodPost {
+				if picked := r.PostFormValue("persona"); picked != "" {
+					persona = picked
+				}
+			}
+			if persona != "" && login.personas {
+				user, err := userSrv.GetUser(persona)
+				if err != nil || !user.Active() {
+					templateData.FormErrorMessage = "unknown persona"
+					templateSrv.Render(w, "login", templateData)
+					return
+				}
+				slog.Warn("PERSONA LOGIN: user signed in without credentials", "userId", user.Id())
+				firstFactor(user, nil, true)
+				return
+			}
+
+			// email login, the magic link
+			if token := r.URL.Query().Get(emailLoginTokenParam); token != "" && mailSrv != nil {
+				pending, ok := sessionData[sessionKeyEmailLogin].(emailLogin)
+				if !ok || pending.expired() || !pending.validToken(token) {
+					templateData.FormErrorMessage = "the sign-in link is invalid or has expired"
+					templateSrv.Render(w, "login", templateData)
+					return
+				}
+				delete(sessionData, sessionKeyEmailLogin)
+				user, err := userSrv.GetUser(pending.UserId)
+				if err != nil {
+					templateData.FormErrorMessage = "invalid credentials"
+					templateSrv.Render(w, "login", templateData)
+					return
+				}
+				firstFactor(user, []string{AMREmail}, true)
 				return
 			}
 
@@ -135,6 +356,56 @@ func UserAuthenticationMiddleware() Middleware {
 				return
 			}
 
+			// email login, the code is requested for an address and then entered
+			address := strings.TrimSpace(r.PostFormValue("email")) // parses the form
+			if _, requested := r.PostForm["email"]; requested && mailSrv != nil {
+				emailData := tpl.EmailLoginTemplateData{FormAction: returnURL, Email: address}
+				user, err := findUserByEmail(userSrv, address)
+				if err != nil {
+					// the page does not tell whether the address is known
+					slog.Warn("email login for an unknown address", "email", address)
+					templateSrv.Render(w, "email", emailData)
+					return
+				}
+				pending, err := sendEmailLogin(mailSrv, user, address, requestOrigin(r)+returnURL)
+				if err != nil {
+					slog.Error("failed to send the email login", "userId", user.Id(), "error", err)
+					templateData.FormErrorMessage = "could not send the email"
+					templateSrv.Render(w, "login", templateData)
+					return
+				}
+				sessionData[sessionKeyEmailLogin] = pending
+				sessionSrv.Put(sessionID, sessionData)
+				templateSrv.Render(w, "email", emailData)
+				return
+			}
+			if _, entered := r.PostForm["email_code"]; entered && mailSrv != nil {
+				pending, ok := sessionData[sessionKeyEmailLogin].(emailLogin)
+				if !ok || pending.expired() {
+					delete(sessionData, sessionKeyEmailLogin)
+					sessionSrv.Put(sessionID, sessionData)
+					templateData.FormErrorMessage = "the code has expired, request a new one"
+					templateSrv.Render(w, "login", templateData)
+					return
+				}
+				if !pending.validCode(r.PostFormValue("email_code")) {
+					pending.Attempts++
+					sessionData[sessionKeyEmailLogin] = pending
+					sessionSrv.Put(sessionID, sessionData)
+					templateSrv.Render(w, "email", tpl.EmailLoginTemplateData{FormAction: returnURL, FormErrorMessage: "invalid code"})
+					return
+				}
+				delete(sessionData, sessionKeyEmailLogin)
+				user, err := userSrv.GetUser(pending.UserId)
+				if err != nil {
+					templateData.FormErrorMessage = "invalid credentials"
+					templateSrv.Render(w, "login", templateData)
+					return
+				}
+				firstFactor(user, []string{AMREmail}, true)
+				return
+			}
+
 			// form validation
 			username := r.PostFormValue("username")
 			if username == "" {
@@ -171,11 +442,7 @@ func UserAuthenticationMiddleware() Middleware {
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), CTX_USER, user)
-			r = r.WithContext(ctx)
-			sessionData["user"] = user
-			sessionSrv.Put(sessionID, sessionData)
-			next(w, r)
+			firstFactor(user, []string{AMRPassword}, false)
 		}
 	}
 }
@@ -0,0 +1,64 @@
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/tpl"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+// personaLoginParam signs in the user of the login_hint parameter without the login page
+const personaLoginParam = "dev_login"
+
+// personaRoleClaims are shown as the roles of a persona
+var personaRoleClaims = []string{"realm_roles", "client_roles", "roles", "groups"}
+
+// getPersonas returns the active users with their description and, when the client is known, their roles
+func getPersonas(userSrv userservice.Service, claimSrv claimservice.Service, client clientservice.Entity) []tpl.Persona {
+	users, err := userSrv.GetUsers()
+	if err != nil {
+		return nil
+	}
+	personas := make([]tpl.Persona, 0, len(users))
+	for _, user := range users {
+		if !user.Active() {
+			continue
+		}
+		persona := tpl.Persona{Username: user.Name()}
+		if description, ok := user.GetAttributesGroup(userservice.AttributesGroupPersona)["description"].(string); ok {
+			persona.Description = description
+		}
+		if client != nil && claimSrv != nil {
+			if claims, err := claimSrv.GetUserClaims(user, client, nil, string(claimservice.PurposeAccess)); err == nil {
+				persona.Roles = personaRoles(claims)
+			}
+		}
+		personas = append(personas, persona)
+	}
+	sort.Slice(personas, func(i, j int) bool { return personas[i].Username < personas[j].Username })
+	return personas
+}
+
+func personaRoles(claims map[string]interface{}) []string {
+	roles := make([]string, 0)
+	for _, claim := range personaRoleClaims {
+		values, ok := claims[claim].([]interface{})
+		if !ok {
+			if value, ok := claims[claim].([]string); ok {
+				for _, v := range value {
+					values = append(values, v)
+				}
+			}
+		}
+		for _, value := range values {
+			if role := fmt.Sprint(value); !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
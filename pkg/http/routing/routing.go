@@ -3,6 +3,7 @@ package routing
 import (
 	"context"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"time"
@@ -13,6 +14,7 @@ import (
 // Types for routing and middleware
 type route struct {
 	method        string
+	host          string
 	path          string
 	postFormValue map[string]string
 	queryValue    map[string]string
@@ -37,6 +39,14 @@ func WithPath(path string) RouteOption {
 	}
 }
 
+// WithHost restricts the route to requests for the given host (with or without port)
+func WithHost(host string) RouteOption {
+	return func(r *route) error {
+		r.host = host
+		return nil
+	}
+}
+
 func WithMethod(method string) RouteOption {
 	return func(r *route) error {
 		r.method = method
@@ -86,6 +96,9 @@ func (r *route) matches(req *http.Request) bool {
 	if len(r.method) > 0 && r.method != req.Method {
 		return false
 	}
+	if len(r.host) > 0 && r.host != req.Host && r.host != hostWithoutPort(req.Host) {
+		return false
+	}
 	if len(r.path) > 0 && r.path != req.URL.Path {
 		return false
 	}
@@ -105,6 +118,14 @@ func (r *route) matches(req *http.Request) bool {
 	return true
 }
 
+func hostWithoutPort(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
+}
+
 // ServeHTTP with per-route middleware chaining
 func (h *Router) ServeHTTP(w http.ResponseWriter, routedRequest *http.Request) {
 	ctx := context.WithValue(routedRequest.Context(), CTX_REQUEST_ID, uuid.New().String())
@@ -0,0 +1,26 @@
+package routing
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Switch serves the requests with the current router, a config reload replaces all routes at once
+type Switch struct {
+	router atomic.Pointer[Router]
+}
+
+func NewSwitch(router *Router) *Switch {
+	s := &Switch{}
+	s.router.Store(router)
+	return s
+}
+
+// Set replaces the router, requests in flight finish with the previous one
+func (s *Switch) Set(router *Router) {
+	s.router.Store(router)
+}
+
+func (s *Switch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.Load().ServeHTTP(w, r)
+}
@@ -4,8 +4,6 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
-
-	"github.com/axent-pl/oauth2mock/pkg/http/routing"
 )
 
 type Serverer interface {
@@ -13,14 +11,15 @@ type Serverer interface {
 }
 
 type server struct {
-	Addr   string
-	Router routing.Router
+	Addr    string
+	Handler http.Handler
 }
 
-func NewServer(address string, router routing.Router) (Serverer, error) {
+// NewServer serves the handler (a routing.Router or routing.Switch) on the address
+func NewServer(address string, handler http.Handler) (Serverer, error) {
 	s := &server{
-		Addr:   address,
-		Router: router,
+		Addr:    address,
+		Handler: handler,
 	}
 	return s, nil
 }
@@ -28,7 +27,7 @@ func NewServer(address string, router routing.Router) (Serverer, error) {
 func (s *server) Start(ctx context.Context) error {
 	httpServer := &http.Server{
 		Addr:    s.Addr,
-		Handler: &s.Router,
+		Handler: s.Handler,
 	}
 
 	done := make(chan error, 1)
@@ -0,0 +1,514 @@
+// Package kcimport translates Keycloak realm exports into Axes data files.
+package kcimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ----- Keycloak realm export -----
+
+type realmExport struct {
+	Realm   string `json:"realm"`
+	Enabled *bool  `json:"enabled"`
+
+	Clients      []kcClient      `json:"clients"`
+	Users        []kcUser        `json:"users"`
+	Groups       []kcGroup       `json:"groups"`
+	ClientScopes []kcClientScope `json:"clientScopes"`
+	Roles        struct {
+		Realm  []kcRole            `json:"realm"`
+		Client map[string][]kcRole `json:"client"`
+	} `json:"roles"`
+
+	AccessTokenLifespan   int `json:"accessTokenLifespan"`
+	SsoSessionIdleTimeout int `json:"ssoSessionIdleTimeout"`
+	SsoSessionMaxLifespan int `json:"ssoSessionMaxLifespan"`
+
+	IdentityProviders   []json.RawMessage `json:"identityProviders"`
+	AuthenticationFlows []json.RawMessage `json:"authenticationFlows"`
+}
+
+type kcClient struct {
+	ClientId                     string             `json:"clientId"`
+	Secret                       string             `json:"secret"`
+	Enabled                      *bool              `json:"enabled"`
+	Protocol                     string             `json:"protocol"`
+	PublicClient                 bool               `json:"publicClient"`
+	BearerOnly                   bool               `json:"bearerOnly"`
+	ConsentRequired              bool               `json:"consentRequired"`
+	RedirectUris                 []string           `json:"redirectUris"`
+	ProtocolMappers              []kcProtocolMapper `json:"protocolMappers"`
+	ClientAuthenticatorType      string             `json:"clientAuthenticatorType"`
+	AuthorizationServicesEnabled bool               `json:"authorizationServicesEnabled"`
+}
+
+type kcUser struct {
+	Username               string              `json:"username"`
+	Enabled                *bool               `json:"enabled"`
+	Email                  string              `json:"email"`
+	EmailVerified          bool                `json:"emailVerified"`
+	FirstName              string              `json:"firstName"`
+	LastName               string              `json:"lastName"`
+	Attributes             map[string][]string `json:"attributes"`
+	Credentials            []kcCredential      `json:"credentials"`
+	RealmRoles             []string            `json:"realmRoles"`
+	ClientRoles            map[string][]string `json:"clientRoles"`
+	Groups                 []string            `json:"groups"`
+	RequiredActions        []string            `json:"requiredActions"`
+	ServiceAccountClientId string              `json:"serviceAccountClientId"`
+	FederationLink         string              `json:"federationLink"`
+}
+
+type kcCredential struct {
+	Type  string `json:"type"`
+	Value string `json:"value"` // only present in hand written import files, exports carry hashes
+}
+
+type kcGroup struct {
+	Name        string              `json:"name"`
+	Path        string              `json:"path"`
+	RealmRoles  []string            `json:"realmRoles"`
+	ClientRoles map[string][]string `json:"clientRoles"`
+	SubGroups   []kcGroup           `json:"subGroups"`
+}
+
+type kcRole struct {
+	Name       string `json:"name"`
+	Composite  bool   `json:"composite"`
+	Composites struct {
+		Realm  []string            `json:"realm"`
+		Client map[string][]string `json:"client"`
+	} `json:"composites"`
+}
+
+type kcClientScope struct {
+	Name       string            `json:"name"`
+	Protocol   string            `json:"protocol"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+type kcProtocolMapper struct {
+	Name           string `json:"name"`
+	ProtocolMapper string `json:"protocolMapper"`
+}
+
+// ----- Axes data file -----
+
+type Config struct {
+	Profile  string                 `json:"profile"`
+	Signing  map[string]interface{} `json:"signing"`
+	Users    usersSection           `json:"users"`
+	Claims   map[string]string      `json:"claims"`
+	Clients  map[string]client      `json:"clients"`
+	Consents consentsSection        `json:"consents"`
+
+	Authorization map[string]interface{} `json:"authorization"`
+	Session       map[string]interface{} `json:"session"`
+	Tokens        map[string]interface{} `json:"tokens"`
+}
+
+type usersSection struct {
+	Provider string          `json:"provider"`
+	Users    map[string]user `json:"users"`
+}
+
+type user struct {
+	Username   string                            `json:"username"`
+	Password   string                            `json:"password"`
+	Email      string                            `json:"email,omitempty"`
+	Attributes map[string]map[string]interface{} `json:"attributes,omitempty"`
+	Claims     claimsSet                         `json:"claims"`
+	Consents   map[string]bool                   `json:"consents,omitempty"`
+}
+
+type client struct {
+	Id          string    `json:"client_id"`
+	Secret      string    `json:"client_secret"`
+	RedirectURI string    `json:"redirect_uri"`
+	Claims      claimsSet `json:"claims"`
+}
+
+type claimsSet struct {
+	Default claims `json:"default"`
+}
+
+type claims struct {
+	Base map[string]interface{} `json:"base"`
+}
+
+type consentsSection struct {
+	Provider string           `json:"provider"`
+	Scopes   map[string]scope `json:"scopes"`
+}
+
+type scope struct {
+	RequireConsent bool `json:"requireConsent"`
+}
+
+// Import translates a Keycloak realm export (as produced by kc.sh export or the admin console)
+// into an Axes data file using the keycloak profile. The second result lists everything
+// which could not be translated.
+func Import(data []byte) (*Config, []string, error) {
+	export := realmExport{}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse realm export: %w", err)
+	}
+
+	im := &importer{export: export}
+	return im.run(), im.report, nil
+}
+
+type importer struct {
+	export realmExport
+	report []string
+}
+
+func (im *importer) reportf(format string, args ...interface{}) {
+	im.report = append(im.report, fmt.Sprintf(format, args...))
+}
+
+func (im *importer) run() *Config {
+	config := &Config{
+		Profile: "keycloak",
+		Signing: map[string]interface{}{
+			"keys": []interface{}{
+				map[string]interface{}{
+					"provider": map[string]interface{}{"fromRandom": map[string]interface{}{"type": "RSA256"}},
+					"method":   "RS256",
+					"active":   true,
+				},
+			},
+		},
+		Users:    usersSection{Provider: "json", Users: make(map[string]user)},
+		Claims:   map[string]string{"provider": "json"},
+		Clients:  make(map[string]client),
+		Consents: consentsSection{Provider: "json", Scopes: make(map[string]scope)},
+
+		Authorization: map[string]interface{}{"provider": "memory", "authorizationCodeLength": 16, "authorizationRequestTTLSeconds": 60},
+		Session:       map[string]interface{}{"provider": "memory", "config": map[string]interface{}{"ttlSeconds": 60}},
+		Tokens:        map[string]interface{}{"provider": "memory"},
+	}
+	if lifetimes := im.lifetimes(); len(lifetimes) > 0 {
+		config.Tokens["lifetimes"] = map[string]interface{}{"base": lifetimes}
+	}
+	im.reportf("realm keys are not imported, a random RS256 signing key is used")
+
+	consentRequired := im.importClients(config)
+	im.importScopes(config, consentRequired)
+	im.importUsers(config)
+
+	if len(im.export.IdentityProviders) > 0 {
+		im.reportf("%d identity providers are not supported", len(im.export.IdentityProviders))
+	}
+	if len(im.export.AuthenticationFlows) > 0 {
+		im.reportf("authentication flows are not supported")
+	}
+	return config
+}
+
+// lifetimes translates the realm token settings into the base token lifetimes
+func (im *importer) lifetimes() map[string]int {
+	lifetimes := make(map[string]int)
+	if im.export.AccessTokenLifespan > 0 {
+		lifetimes["accessTokenSeconds"] = im.export.AccessTokenLifespan
+		lifetimes["idTokenSeconds"] = im.export.AccessTokenLifespan
+	}
+	if im.export.SsoSessionIdleTimeout > 0 {
+		lifetimes["refreshTokenIdleSeconds"] = im.export.SsoSessionIdleTimeout
+	}
+	if im.export.SsoSessionMaxLifespan > 0 {
+		lifetimes["refreshTokenAbsoluteSeconds"] = im.export.SsoSessionMaxLifespan
+	}
+	return lifetimes
+}
+
+// importClients translates the OpenID Connect clients and reports
+// whether any of them requires consent
+func (im *importer) importClients(config *Config) bool {
+	consentRequired := false
+	for _, kc := range im.export.Clients {
+		if kc.Protocol != "" && kc.Protocol != "openid-connect" {
+			im.reportf("client %s: protocol %s is not supported, skipped", kc.ClientId, kc.Protocol)
+			continue
+		}
+		if kc.BearerOnly {
+			im.reportf("client %s: bearer-only clients cannot obtain tokens, skipped", kc.ClientId)
+			continue
+		}
+		if kc.Enabled != nil && !*kc.Enabled {
+			im.reportf("client %s: disabled, skipped", kc.ClientId)
+			continue
+		}
+		if isBuiltinClient(kc.ClientId) {
+			continue
+		}
+
+		c := client{
+			Id:     kc.ClientId,
+			Secret: kc.Secret,
+			Claims: claimsSet{Default: claims{Base: map[string]interface{}{}}},
+		}
+		if c.Secret == "" || kc.PublicClient || strings.HasPrefix(c.Secret, "**") {
+			c.Secret = kc.ClientId
+			im.reportf("client %s: no client secret in the export (public client or masked secret), secret set to the client id", kc.ClientId)
+		}
+		if kc.ClientAuthenticatorType != "" && kc.ClientAuthenticatorType != "client-secret" {
+			im.reportf("client %s: authenticator %s is not supported, client secret is used", kc.ClientId, kc.ClientAuthenticatorType)
+		}
+
+		redirectURIs := slices.DeleteFunc(slices.Clone(kc.RedirectUris), func(uri string) bool { return uri == "+" || uri == "" })
+		switch len(redirectURIs) {
+		case 0:
+			c.RedirectURI = ""
+		case 1:
+			c.RedirectURI = redirectURIs[0]
+		default:
+			// Axes matches a single wildcard pattern
+			c.RedirectURI = commonPattern(redirectURIs)
+			im.reportf("client %s: %d redirect URIs merged into the pattern %s", kc.ClientId, len(redirectURIs), c.RedirectURI)
+		}
+
+		for _, mapper := range kc.ProtocolMappers {
+			im.reportf("client %s: protocol mapper %s (%s) is not supported", kc.ClientId, mapper.Name, mapper.ProtocolMapper)
+		}
+		if kc.AuthorizationServicesEnabled {
+			im.reportf("client %s: authorization services are not supported", kc.ClientId)
+		}
+		consentRequired = consentRequired || kc.ConsentRequired
+		config.Clients[kc.ClientId] = c
+	}
+	return consentRequired
+}
+
+// importScopes translates the OpenID Connect client scopes into consents.scopes,
+// consent is required for scopes shown on the consent screen when any client requires consent
+func (im *importer) importScopes(config *Config, consentRequired bool) {
+	config.Consents.Scopes["openid"] = scope{RequireConsent: false}
+	for _, kc := range im.export.ClientScopes {
+		if kc.Protocol != "" && kc.Protocol != "openid-connect" {
+			continue
+		}
+		config.Consents.Scopes[kc.Name] = scope{
+			RequireConsent: consentRequired && kc.Attributes["display.on.consent.screen"] != "false",
+		}
+	}
+}
+
+func (im *importer) importUsers(config *Config) {
+	groups := make(map[string]kcGroup)
+	collectGroups(im.export.Groups, "", groups)
+
+	for _, kc := range im.export.Users {
+		if kc.Enabled != nil && !*kc.Enabled {
+			im.reportf("user %s: disabled, skipped", kc.Username)
+			continue
+		}
+		if kc.FederationLink != "" {
+			im.reportf("user %s: federated users are not supported, skipped", kc.Username)
+			continue
+		}
+
+		realmRoles := slices.Clone(kc.RealmRoles)
+		clientRoles := make(map[string][]string)
+		for clientId, roles := range kc.ClientRoles {
+			clientRoles[clientId] = slices.Clone(roles)
+		}
+		for _, path := range kc.Groups {
+			im.applyGroupRoles(path, groups, &realmRoles, clientRoles)
+		}
+		realmRoles, clientRoles = im.expandComposites(realmRoles, clientRoles)
+
+		// service account users carry the roles of the client credentials tokens
+		if kc.ServiceAccountClientId != "" {
+			if c, ok := config.Clients[kc.ServiceAccountClientId]; ok {
+				setRoleClaims(c.Claims.Default.Base, realmRoles, clientRoles)
+				config.Clients[kc.ServiceAccountClientId] = c
+			}
+			continue
+		}
+
+		u := user{
+			Username: kc.Username,
+			Email:    kc.Email,
+			Claims:   claimsSet{Default: claims{Base: map[string]interface{}{"preferred_username": kc.Username}}},
+		}
+		base := u.Claims.Default.Base
+		if kc.Email != "" {
+			base["email"] = kc.Email
+			base["email_verified"] = kc.EmailVerified
+		}
+		if kc.FirstName != "" {
+			base["given_name"] = kc.FirstName
+		}
+		if kc.LastName != "" {
+			base["family_name"] = kc.LastName
+		}
+		if name := strings.TrimSpace(kc.FirstName + " " + kc.LastName); name != "" {
+			base["name"] = name
+		}
+		setRoleClaims(base, realmRoles, clientRoles)
+
+		if len(kc.Attributes) > 0 {
+			custom := make(map[string]interface{}, len(kc.Attributes))
+			for name, values := range kc.Attributes {
+				if len(values) == 1 {
+					custom[name] = values[0]
+				} else {
+					custom[name] = values
+				}
+			}
+			u.Attributes = map[string]map[string]interface{}{"custom": custom}
+		}
+
+		for _, credential := range kc.Credentials {
+			switch {
+			case credential.Type == "password" && credential.Value != "":
+				u.Password = credential.Value
+			case credential.Type == "password":
+				im.reportf("user %s: password hashes cannot be imported", kc.Username)
+			default:
+				im.reportf("user %s: %s credentials are not supported", kc.Username, credential.Type)
+			}
+		}
+		if u.Password == "" {
+			u.Password = kc.Username
+			im.reportf("user %s: password set to the username", kc.Username)
+		}
+		// Keycloak grants scopes without consent implicitly, Axes needs the user consent
+		u.Consents = make(map[string]bool)
+		for name, s := range config.Consents.Scopes {
+			if !s.RequireConsent {
+				u.Consents[name] = true
+			}
+		}
+		if len(kc.RequiredActions) > 0 {
+			im.reportf("user %s: required actions %s are ignored", kc.Username, strings.Join(kc.RequiredActions, ", "))
+		}
+
+		config.Users.Users[kc.Username] = u
+	}
+}
+
+func (im *importer) applyGroupRoles(path string, groups map[string]kcGroup, realmRoles *[]string, clientRoles map[string][]string) {
+	// members of a subgroup inherit the roles of its parents
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range segments {
+		groupPath := "/" + strings.Join(segments[:i+1], "/")
+		group, ok := groups[groupPath]
+		if !ok {
+			im.reportf("group %s: not found in the export", groupPath)
+			return
+		}
+		*realmRoles = append(*realmRoles, group.RealmRoles...)
+		for clientId, roles := range group.ClientRoles {
+			clientRoles[clientId] = append(clientRoles[clientId], roles...)
+		}
+	}
+}
+
+// expandComposites adds the roles contained in composite roles
+func (im *importer) expandComposites(realmRoles []string, clientRoles map[string][]string) ([]string, map[string][]string) {
+	realmIndex := make(map[string]kcRole)
+	for _, role := range im.export.Roles.Realm {
+		realmIndex[role.Name] = role
+	}
+	clientIndex := make(map[string]kcRole)
+	for clientId, roles := range im.export.Roles.Client {
+		for _, role := range roles {
+			clientIndex[clientId+"/"+role.Name] = role
+		}
+	}
+
+	seen := make(map[string]bool)
+	var visit func(role kcRole)
+	visit = func(role kcRole) {
+		if !role.Composite {
+			return
+		}
+		for _, name := range role.Composites.Realm {
+			if !seen["/"+name] {
+				seen["/"+name] = true
+				realmRoles = append(realmRoles, name)
+				visit(realmIndex[name])
+			}
+		}
+		for clientId, names := range role.Composites.Client {
+			for _, name := range names {
+				if !seen[clientId+"/"+name] {
+					seen[clientId+"/"+name] = true
+					clientRoles[clientId] = append(clientRoles[clientId], name)
+					visit(clientIndex[clientId+"/"+name])
+				}
+			}
+		}
+	}
+	for _, name := range slices.Clone(realmRoles) {
+		seen["/"+name] = true
+		visit(realmIndex[name])
+	}
+	for clientId, names := range clientRoles {
+		for _, name := range slices.Clone(names) {
+			seen[clientId+"/"+name] = true
+			visit(clientIndex[clientId+"/"+name])
+		}
+	}
+	return realmRoles, clientRoles
+}
+
+// setRoleClaims stores the roles in the claims the keycloak profile maps to realm_access and resource_access
+func setRoleClaims(base map[string]interface{}, realmRoles []string, clientRoles map[string][]string) {
+	if roles := uniqueSorted(realmRoles); len(roles) > 0 {
+		base["realm_roles"] = roles
+	}
+	resourceRoles := make(map[string]interface{})
+	for clientId, roles := range clientRoles {
+		if roles := uniqueSorted(roles); len(roles) > 0 {
+			resourceRoles[clientId] = roles
+		}
+	}
+	if len(resourceRoles) > 0 {
+		base["client_roles"] = resourceRoles
+	}
+}
+
+func collectGroups(groups []kcGroup, parent string, index map[string]kcGroup) {
+	for _, group := range groups {
+		path := group.Path
+		if path == "" {
+			path = parent + "/" + group.Name
+		}
+		index[path] = group
+		collectGroups(group.SubGroups, path, index)
+	}
+}
+
+// commonPattern builds a single wildcard pattern matching all the given URIs
+func commonPattern(uris []string) string {
+	prefix := strings.TrimSuffix(uris[0], "*")
+	for _, uri := range uris[1:] {
+		uri = strings.TrimSuffix(uri, "*")
+		for !strings.HasPrefix(uri, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix + "*"
+}
+
+func uniqueSorted(values []string) []string {
+	result := slices.Clone(values)
+	sort.Strings(result)
+	return slices.Compact(result)
+}
+
+// isBuiltinClient reports the clients every Keycloak realm contains
+func isBuiltinClient(clientId string) bool {
+	switch clientId {
+	case "account", "account-console", "admin-cli", "broker", "realm-management", "security-admin-console":
+		return true
+	}
+	return strings.HasSuffix(clientId, "-realm")
+}
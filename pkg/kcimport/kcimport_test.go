@@ -0,0 +1,57 @@
+package kcimport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	export := `{
+		"roles": {"realm": [{"name": "default-roles-demo", "composite": true, "composites": {"realm": ["offline_access"]}}]},
+		"groups": [{"name": "staff", "realmRoles": ["admin"], "subGroups": [{"name": "editors", "clientRoles": {"web": ["editor"]}}]}],
+		"clients": [
+			{"clientId": "web", "secret": "web-secret", "redirectUris": ["http://localhost:3000/*", "http://localhost:3001/cb"]},
+			{"clientId": "saml-app", "protocol": "saml"},
+			{"clientId": "svc", "secret": "svc-secret"}
+		],
+		"users": [
+			{"username": "alice", "realmRoles": ["default-roles-demo"], "groups": ["/staff/editors"], "credentials": [{"type": "password", "value": "secret"}]},
+			{"username": "service-account-svc", "serviceAccountClientId": "svc", "realmRoles": ["admin"]}
+		]
+	}`
+
+	cfg, report, err := Import([]byte(export))
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	if _, ok := cfg.Clients["saml-app"]; ok {
+		t.Errorf("saml client imported")
+	}
+	if got := cfg.Clients["web"].RedirectURI; got != "http://localhost:300*" {
+		t.Errorf("RedirectURI = %q, want %q", got, "http://localhost:300*")
+	}
+	if got := cfg.Clients["svc"].Claims.Default.Base["realm_roles"]; !reflect.DeepEqual(got, []string{"admin"}) {
+		t.Errorf("service account realm_roles = %v", got)
+	}
+	if _, ok := cfg.Users.Users["service-account-svc"]; ok {
+		t.Errorf("service account imported as user")
+	}
+
+	alice := cfg.Users.Users["alice"]
+	if alice.Password != "secret" {
+		t.Errorf("Password = %q, want %q", alice.Password, "secret")
+	}
+	wantRealmRoles := []string{"admin", "default-roles-demo", "offline_access"}
+	if got := alice.Claims.Default.Base["realm_roles"]; !reflect.DeepEqual(got, wantRealmRoles) {
+		t.Errorf("realm_roles = %v, want %v", got, wantRealmRoles)
+	}
+	wantClientRoles := map[string]interface{}{"web": []string{"editor"}}
+	if got := alice.Claims.Default.Base["client_roles"]; !reflect.DeepEqual(got, wantClientRoles) {
+		t.Errorf("client_roles = %v, want %v", got, wantClientRoles)
+	}
+
+	if len(report) == 0 {
+		t.Errorf("expected untranslated items to be reported")
+	}
+}
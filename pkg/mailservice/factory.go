@@ -0,0 +1,58 @@
+package mailservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+type MailServiceFactory func(json.RawMessage) (Service, error)
+
+var (
+	mailServiceFactoryRegistryMU sync.RWMutex
+	mailServiceFactoryRegistry   = map[string]MailServiceFactory{}
+)
+
+func Register(name string, f MailServiceFactory) {
+	mailServiceFactoryRegistryMU.Lock()
+	defer mailServiceFactoryRegistryMU.Unlock()
+	mailServiceFactoryRegistry[name] = f
+}
+
+type Config struct {
+	MailConfig json.RawMessage `json:"mail"`
+}
+
+// NewFromConfig initializes the mailer of the mail section,
+// a missing section yields the in-memory outbox
+func NewFromConfig(rawConfig []byte) (Service, error) {
+	slog.Info("init started", "module", "mailservice")
+	config := Config{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, errors.New("failed to unmarshal config")
+	}
+
+	provider := "outbox"
+	if config.MailConfig != nil {
+		var mailConfig map[string]json.RawMessage
+		if err := json.Unmarshal(config.MailConfig, &mailConfig); err != nil {
+			return nil, errors.New("failed to parse mail config")
+		}
+		if providerRaw, ok := mailConfig["provider"]; ok {
+			if err := json.Unmarshal(providerRaw, &provider); err != nil {
+				return nil, errors.New("invalid mail.provider")
+			}
+		}
+	}
+
+	mailServiceFactoryRegistryMU.RLock()
+	factory, ok := mailServiceFactoryRegistry[provider]
+	mailServiceFactoryRegistryMU.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown mail service provider: %s", provider)
+	}
+
+	return factory(config.MailConfig)
+}
@@ -0,0 +1,25 @@
+package mailservice
+
+import "time"
+
+// Message is a plain text email
+type Message struct {
+	Id      string    `json:"id"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Text    string    `json:"text"`
+	Date    time.Time `json:"date"`
+}
+
+type Service interface {
+	// Send delivers the message, the mailer sets the id, the date and (when empty) the sender
+	Send(Message) error
+}
+
+// Outbox is implemented by mailers which keep the sent messages for inspection
+type Outbox interface {
+	// GetMessages returns the sent messages (of the recipient when to is not empty) oldest first
+	GetMessages(to string) []Message
+	ClearMessages()
+}
@@ -0,0 +1,137 @@
+package mailservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSender      = "no-reply@axes.localhost"
+	defaultOutboxLimit = 100
+)
+
+type outboxMailServiceConfig struct {
+	Provider string `json:"provider"`
+	From     string `json:"from"`
+	Dir      string `json:"dir"`
+	Limit    int    `json:"limit"`
+}
+
+// outboxMailService does not deliver the messages, it keeps the latest ones in memory
+// and optionally writes every message as an .eml file to dir
+type outboxMailService struct {
+	from  string
+	dir   string
+	limit int
+
+	messagesMU sync.RWMutex
+	messages   []Message
+}
+
+func NewOutboxMailService(rawConfig json.RawMessage) (Service, error) {
+	config := outboxMailServiceConfig{}
+	if rawConfig != nil {
+		if err := json.Unmarshal(rawConfig, &config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal mail service config: %w", err)
+		}
+	}
+	service := &outboxMailService{
+		from:  config.From,
+		dir:   config.Dir,
+		limit: config.Limit,
+	}
+	if service.from == "" {
+		service.from = defaultSender
+	}
+	if _, err := mail.ParseAddress(service.from); err != nil {
+		return nil, fmt.Errorf("invalid mail.from: %w", err)
+	}
+	if service.limit <= 0 {
+		service.limit = defaultOutboxLimit
+	}
+	if service.dir != "" {
+		if err := os.MkdirAll(service.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create mail.dir: %w", err)
+		}
+	}
+	return service, nil
+}
+
+func (s *outboxMailService) Send(message Message) error {
+	if message.From == "" {
+		message.From = s.from
+	}
+	for _, address := range []string{message.From, message.To} {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return errs.New("invalid address", errs.ErrInvalidArgument).WithDetailsf("'%s': %v", address, err)
+		}
+	}
+	if strings.ContainsAny(message.Subject, "\r\n") {
+		return errs.New("invalid subject", errs.ErrInvalidArgument)
+	}
+	message.Id = uuid.NewString()
+	message.Date = clock.Now()
+
+	if s.dir != "" {
+		if err := os.WriteFile(filepath.Join(s.dir, message.Id+".eml"), formatEML(message), 0o644); err != nil {
+			return fmt.Errorf("failed to write message: %w", err)
+		}
+	}
+
+	s.messagesMU.Lock()
+	defer s.messagesMU.Unlock()
+	s.messages = append(s.messages, message)
+	if len(s.messages) > s.limit {
+		s.messages = s.messages[len(s.messages)-s.limit:]
+	}
+	return nil
+}
+
+func (s *outboxMailService) GetMessages(to string) []Message {
+	s.messagesMU.RLock()
+	defer s.messagesMU.RUnlock()
+	messages := make([]Message, 0)
+	for _, message := range s.messages {
+		if to == "" || strings.EqualFold(message.To, to) {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func (s *outboxMailService) ClearMessages() {
+	s.messagesMU.Lock()
+	defer s.messagesMU.Unlock()
+	s.messages = nil
+}
+
+// formatEML serializes the message (RFC 5322) as read by mail clients
+func formatEML(message Message) []byte {
+	var b strings.Builder
+	b.WriteString("Message-ID: <" + message.Id + "@axes>\r\n")
+	b.WriteString("Date: " + message.Date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("From: " + message.From + "\r\n")
+	b.WriteString("To: " + message.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Text, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func init() {
+	Register("outbox", NewOutboxMailService)
+}
@@ -0,0 +1,188 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/google/uuid"
+)
+
+// graphAppId is the audience of Entra tokens which were not requested for a specific API
+const graphAppId = "00000003-0000-0000-c000-000000000000"
+
+// entraProfile emulates the Microsoft Entra ID (Azure AD) v2.0 endpoints of a single tenant:
+//
+//	/{tenant}/v2.0/.well-known/openid-configuration
+//	/{tenant}/oauth2/v2.0/{authorize,token,logout}
+//	/{tenant}/discovery/v2.0/keys
+//
+// Access tokens carry tid, oid, ver, scp and roles. Scopes of the APIs registered in the
+// entra section use the api://{app}/{scope} form, api://{app}/.default requests all of them.
+type entraProfile struct {
+	tenantId  string
+	namespace uuid.UUID // namespace of the object ids derived from user and client ids
+	apps      []entraApp
+}
+
+// entraApp is an API registered in the tenant
+type entraApp struct {
+	Name          string              `json:"-"`
+	AppId         string              `json:"appId"`         // audience of the access tokens, defaults to the app name
+	IdentifierUri string              `json:"identifierUri"` // scope prefix, defaults to api://{name}
+	Scopes        []string            `json:"scopes"`        // delegated permissions (scp)
+	AppRoles      map[string][]string `json:"appRoles"`      // app role to the users and clients it is assigned to (roles)
+}
+
+type entraConfig struct {
+	Entra struct {
+		TenantId string              `json:"tenantId"`
+		Apps     map[string]entraApp `json:"apps"`
+	} `json:"entra"`
+}
+
+func init() {
+	Register("entra", NewEntraProfile)
+}
+
+func NewEntraProfile(rawConfig []byte) (Profile, error) {
+	config := entraConfig{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse entra config: %w", err)
+	}
+	if config.Entra.TenantId == "" {
+		return nil, errors.New("missing entra.tenantId")
+	}
+
+	p := &entraProfile{
+		tenantId:  config.Entra.TenantId,
+		namespace: uuid.NewSHA1(uuid.NameSpaceURL, []byte(config.Entra.TenantId)),
+	}
+	for name, app := range config.Entra.Apps {
+		app.Name = name
+		if app.AppId == "" {
+			app.AppId = name
+		}
+		if app.IdentifierUri == "" {
+			app.IdentifierUri = "api://" + name
+		}
+		p.apps = append(p.apps, app)
+	}
+	slices.SortFunc(p.apps, func(a, b entraApp) int { return strings.Compare(a.Name, b.Name) })
+	return p, nil
+}
+
+func (p *entraProfile) Name() string {
+	return "entra"
+}
+
+// BasePath serves the realm under the tenant id
+func (p *entraProfile) BasePath() string {
+	return "/" + p.tenantId
+}
+
+func (p *entraProfile) Endpoints() Endpoints {
+	return Endpoints{
+		WellKnown:     "/v2.0/.well-known/openid-configuration",
+		Authorization: "/oauth2/v2.0/authorize",
+		Token:         "/oauth2/v2.0/token",
+		UserInfo:      "/oidc/userinfo",
+		Introspection: "/oauth2/v2.0/introspect",
+		JWKS:          "/discovery/v2.0/keys",
+		EndSession:    "/oauth2/v2.0/logout",
+		IssuerSuffix:  "/v2.0",
+	}
+}
+
+func (p *entraProfile) ShapeClaims(purpose string, claims map[string]interface{}, client clientservice.Entity, scopes []string) {
+	if purpose != "access" && purpose != "id" {
+		return
+	}
+
+	sub, _ := claims["sub"].(string)
+	appOnly := client != nil && sub == client.Id()
+	claims["tid"] = p.tenantId
+	claims["ver"] = "2.0"
+	if _, ok := claims["oid"]; !ok && sub != "" {
+		claims["oid"] = uuid.NewSHA1(p.namespace, []byte(sub)).String()
+	}
+	if purpose != "access" {
+		return
+	}
+
+	// user tokens carry the granted scopes only, app-only tokens the requested ones
+	granted := scopes
+	if scopeStr, ok := claims["scope"].(string); ok {
+		granted = strings.Fields(scopeStr)
+	}
+	delete(claims, "scope")
+
+	app, permissions := p.resolveScopes(granted)
+	if app == nil {
+		claims["aud"] = graphAppId
+		if !appOnly && len(granted) > 0 {
+			claims["scp"] = strings.Join(granted, " ")
+		}
+		return
+	}
+
+	claims["aud"] = app.AppId
+	if !appOnly && len(permissions) > 0 {
+		claims["scp"] = strings.Join(permissions, " ")
+	}
+	if appOnly {
+		claims["idtyp"] = "app"
+	}
+	roles := app.rolesOf(sub)
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+}
+
+// resolveScopes finds the API the scopes were requested for and the permissions requested,
+// like Entra a token is issued for a single API (the first one requested)
+func (p *entraProfile) resolveScopes(scopes []string) (*entraApp, []string) {
+	var app *entraApp
+	permissions := make([]string, 0)
+	for _, scope := range scopes {
+		for i := range p.apps {
+			candidate := &p.apps[i]
+			permission, ok := candidate.permission(scope)
+			if !ok || (app != nil && app != candidate) {
+				continue
+			}
+			app = candidate
+			if permission == ".default" {
+				permissions = append(permissions, candidate.Scopes...)
+			} else {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	slices.Sort(permissions)
+	return app, slices.Compact(permissions)
+}
+
+// permission strips the identifier URI (or api://{appId}) from a scope of the app
+func (a *entraApp) permission(scope string) (string, bool) {
+	for _, prefix := range []string{a.IdentifierUri + "/", "api://" + a.AppId + "/"} {
+		if permission, ok := strings.CutPrefix(scope, prefix); ok && permission != "" {
+			return permission, true
+		}
+	}
+	return "", false
+}
+
+func (a *entraApp) rolesOf(principal string) []string {
+	roles := make([]string, 0)
+	for role, principals := range a.AppRoles {
+		if slices.Contains(principals, principal) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
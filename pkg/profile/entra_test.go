@@ -0,0 +1,68 @@
+package profile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEntraShapeClaims(t *testing.T) {
+	p, err := NewFromConfig("entra", []byte(`{"entra":{"tenantId":"tenant-1","apps":{
+		"orders-api":{"appId":"orders-app-id","scopes":["Orders.Read","Orders.Write"],"appRoles":{"Orders.Admin":["admin"]}}
+	}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "default scope of an api",
+			claims: map[string]interface{}{"sub": "admin", "oid": "oid-1", "scope": "openid api://orders-api/.default"},
+			want: map[string]interface{}{
+				"sub":   "admin",
+				"oid":   "oid-1",
+				"tid":   "tenant-1",
+				"ver":   "2.0",
+				"aud":   "orders-app-id",
+				"scp":   "Orders.Read Orders.Write",
+				"roles": []string{"Orders.Admin"},
+			},
+		},
+		{
+			name:   "single permission by app id",
+			claims: map[string]interface{}{"sub": "demo", "oid": "oid-2", "scope": "api://orders-app-id/Orders.Read"},
+			want: map[string]interface{}{
+				"sub": "demo",
+				"oid": "oid-2",
+				"tid": "tenant-1",
+				"ver": "2.0",
+				"aud": "orders-app-id",
+				"scp": "Orders.Read",
+			},
+		},
+		{
+			name:   "no api scope",
+			claims: map[string]interface{}{"sub": "demo", "oid": "oid-2", "scope": "openid profile"},
+			want: map[string]interface{}{
+				"sub": "demo",
+				"oid": "oid-2",
+				"tid": "tenant-1",
+				"ver": "2.0",
+				"aud": graphAppId,
+				"scp": "openid profile",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.ShapeClaims("access", tt.claims, nil, nil)
+			if !reflect.DeepEqual(tt.claims, tt.want) {
+				t.Errorf("ShapeClaims() = %v, want %v", tt.claims, tt.want)
+			}
+		})
+	}
+}
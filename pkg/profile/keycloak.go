@@ -0,0 +1,85 @@
+package profile
+
+import (
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+)
+
+// keycloakProfile mimics the Keycloak endpoint layout (/realms/{realm}/protocol/openid-connect/...)
+// and token shape. Roles are taken from the realm_roles and client_roles claims:
+//
+//	"realm_roles": ["ADMIN"]                      -> "realm_access": {"roles": ["ADMIN"]}
+//	"client_roles": ["DEMO"]                      -> "resource_access": {"<azp>": {"roles": ["DEMO"]}}
+//	"client_roles": {"other-client": ["READER"]}  -> "resource_access": {"other-client": {"roles": ["READER"]}}
+type keycloakProfile struct{}
+
+const (
+	realmRolesClaim  = "realm_roles"
+	clientRolesClaim = "client_roles"
+)
+
+func init() {
+	Register(keycloakProfile{}.Name(), func([]byte) (Profile, error) {
+		return keycloakProfile{}, nil
+	})
+}
+
+func (keycloakProfile) Name() string {
+	return "keycloak"
+}
+
+func (keycloakProfile) Endpoints() Endpoints {
+	return Endpoints{
+		WellKnown:     "/.well-known/openid-configuration",
+		Authorization: "/protocol/openid-connect/auth",
+		Token:         "/protocol/openid-connect/token",
+		UserInfo:      "/protocol/openid-connect/userinfo",
+		Introspection: "/protocol/openid-connect/token/introspect",
+		JWKS:          "/protocol/openid-connect/certs",
+		EndSession:    "/protocol/openid-connect/logout",
+	}
+}
+
+func (keycloakProfile) ShapeClaims(purpose string, claims map[string]interface{}, client clientservice.Entity, scopes []string) {
+	if sid, ok := claims["sid"]; ok {
+		claims["session_state"] = sid
+	}
+
+	if realmRoles, ok := claims[realmRolesClaim]; ok {
+		claims["realm_access"] = map[string]interface{}{"roles": toStrings(realmRoles)}
+		delete(claims, realmRolesClaim)
+	}
+
+	if clientRoles, ok := claims[clientRolesClaim]; ok {
+		resourceAccess := make(map[string]interface{})
+		switch roles := clientRoles.(type) {
+		case map[string]interface{}:
+			for clientId, clientRoles := range roles {
+				resourceAccess[clientId] = map[string]interface{}{"roles": toStrings(clientRoles)}
+			}
+		default:
+			if client != nil {
+				resourceAccess[client.Id()] = map[string]interface{}{"roles": toStrings(roles)}
+			}
+		}
+		claims["resource_access"] = resourceAccess
+		delete(claims, clientRolesClaim)
+	}
+}
+
+func toStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	case string:
+		return []string{v}
+	}
+	return []string{}
+}
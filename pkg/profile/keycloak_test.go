@@ -0,0 +1,30 @@
+package profile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeycloakShapeClaims(t *testing.T) {
+	p, err := NewFromConfig("keycloak", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{
+		"sid":          "session-1",
+		"realm_roles":  []interface{}{"ADMIN"},
+		"client_roles": map[string]interface{}{"API": []interface{}{"READER"}},
+	}
+	p.ShapeClaims("access", claims, nil, nil)
+
+	want := map[string]interface{}{
+		"sid":             "session-1",
+		"session_state":   "session-1",
+		"realm_access":    map[string]interface{}{"roles": []string{"ADMIN"}},
+		"resource_access": map[string]interface{}{"API": map[string]interface{}{"roles": []string{"READER"}}},
+	}
+	if !reflect.DeepEqual(claims, want) {
+		t.Errorf("ShapeClaims() = %v, want %v", claims, want)
+	}
+}
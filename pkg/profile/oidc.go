@@ -0,0 +1,31 @@
+package profile
+
+import "github.com/axent-pl/oauth2mock/pkg/clientservice"
+
+// oidcProfile is the native Axes layout, tokens are not reshaped
+type oidcProfile struct{}
+
+func init() {
+	Register(oidcProfile{}.Name(), func([]byte) (Profile, error) {
+		return oidcProfile{}, nil
+	})
+}
+
+func (oidcProfile) Name() string {
+	return DefaultProfile
+}
+
+func (oidcProfile) Endpoints() Endpoints {
+	return Endpoints{
+		WellKnown:     "/.well-known/openid-configuration",
+		Authorization: "/authorize",
+		Token:         "/token",
+		UserInfo:      "/userinfo",
+		Introspection: "/introspect",
+		JWKS:          "/.well-known/jwks.json",
+		EndSession:    "/logout",
+	}
+}
+
+func (oidcProfile) ShapeClaims(purpose string, claims map[string]interface{}, client clientservice.Entity, scopes []string) {
+}
@@ -0,0 +1,83 @@
+package profile
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+)
+
+// Endpoints are the endpoint paths relative to the issuer
+type Endpoints struct {
+	WellKnown     string
+	Authorization string
+	Token         string
+	UserInfo      string
+	Introspection string
+	JWKS          string
+	EndSession    string
+
+	// IssuerSuffix is appended to the realm path to form the issuer,
+	// the endpoints do not share it (e.g. /v2.0 for Entra)
+	IssuerSuffix string
+}
+
+// Profile adapts the endpoint layout and the token shape to a well-known identity provider
+type Profile interface {
+	Name() string
+	Endpoints() Endpoints
+	// ShapeClaims adapts the final claims of a token or UserInfo response in place,
+	// purpose is one of "access", "id", "refresh" or "userinfo"
+	ShapeClaims(purpose string, claims map[string]interface{}, client clientservice.Entity, scopes []string)
+}
+
+const DefaultProfile = "oidc"
+
+// ProfileFactory creates a profile from the raw config of the realm
+type ProfileFactory func(rawConfig []byte) (Profile, error)
+
+var (
+	profileFactoryRegistryMU sync.RWMutex
+	profileFactoryRegistry   = map[string]ProfileFactory{}
+)
+
+func Register(name string, f ProfileFactory) {
+	profileFactoryRegistryMU.Lock()
+	defer profileFactoryRegistryMU.Unlock()
+	profileFactoryRegistry[name] = f
+}
+
+// NewFromConfig creates the named profile for a realm, empty name resolves to the default profile
+func NewFromConfig(name string, rawConfig []byte) (Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profileFactoryRegistryMU.RLock()
+	factory, ok := profileFactoryRegistry[name]
+	profileFactoryRegistryMU.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s", name)
+	}
+	return factory(rawConfig)
+}
+
+// claimService decorates a claim service with the claim shaping of a profile,
+// handlers look for the ShapeClaims method when building tokens
+type claimService struct {
+	claimservice.Service
+	profile Profile
+}
+
+func WrapClaimService(svc claimservice.Service, p Profile) claimservice.Service {
+	return &claimService{Service: svc, profile: p}
+}
+
+// Unwrap returns the decorated claim service
+func (s *claimService) Unwrap() claimservice.Service {
+	return s.Service
+}
+
+func (s *claimService) ShapeClaims(purpose string, claims map[string]interface{}, client clientservice.Entity, scopes []string) {
+	s.profile.ShapeClaims(purpose, claims, client, scopes)
+}
@@ -0,0 +1,376 @@
+package realm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/axent-pl/oauth2mock/pkg/authorizationservice"
+	"github.com/axent-pl/oauth2mock/pkg/brokerservice"
+	"github.com/axent-pl/oauth2mock/pkg/claimservice"
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/config"
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/faultservice"
+	"github.com/axent-pl/oauth2mock/pkg/mailservice"
+	"github.com/axent-pl/oauth2mock/pkg/profile"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/sessionservice"
+	"github.com/axent-pl/oauth2mock/pkg/state"
+	"github.com/axent-pl/oauth2mock/pkg/tokenservice"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+	"github.com/axent-pl/oauth2mock/pkg/webauthnservice"
+)
+
+// PathPrefix is the path below which path-based realms are served
+const PathPrefix = "/realms/"
+
+// inheritedSections are taken from the root config when a realm does not define them.
+// Identities (users, clients, claims, consents, brokers, passkeys) and signing keys are never inherited.
+var inheritedSections = []string{"session", "authorization", "tokens", "mail"}
+
+var realmNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Realm is an isolated set of clients, users, claims, consents and signing keys
+// served under its own issuer. Each realm owns its own service instances.
+type Realm struct {
+	Name   string // empty for the default (root) realm
+	Host   string // realm is matched by Host header instead of path when set
+	Path   string // issuer path below the origin, e.g. /realms/{name}
+	Issuer string // explicit issuer, overrides the server-wide issuer
+
+	Profile profile.Profile // endpoint layout and token shape
+
+	Clients        clientservice.Service
+	Users          userservice.Service
+	Claims         claimservice.Service
+	Consents       consentservice.Service
+	Authorizations authorizationservice.Service
+	Sessions       sessionservice.Service
+	Signing        signing.SigningServicer
+	LifetimePolicy *tokenservice.LifetimePolicy
+	TokenProfiles  *tokenservice.ProfilePolicy
+	Tokens         tokenservice.Service
+	Brokers        brokerservice.Service
+	WebAuthn       webauthnservice.Service
+	Mail           mailservice.Service
+	Faults         faultservice.Service
+}
+
+// realmConfig holds the realm settings which live next to the regular config sections
+type realmConfig struct {
+	File    string `json:"file"`
+	Host    string `json:"host"`
+	Issuer  string `json:"issuer"`
+	Profile string `json:"profile"`
+}
+
+type rootConfig struct {
+	Profile string                     `json:"profile"`
+	Realms  map[string]json.RawMessage `json:"realms"`
+}
+
+func (r *Realm) String() string {
+	if r.Name == "" {
+		return "default"
+	}
+	return r.Name
+}
+
+// NewFromConfig instantiates all services of a realm from its raw config
+func NewFromConfig(name string, profileName string, rawConfig []byte) (*Realm, error) {
+	return newFromConfig(name, profileName, rawConfig, nil)
+}
+
+// newFromConfig instantiates the services of a realm, the runtime stores of the previous
+// instance of the realm (when given) are kept instead of new ones
+func newFromConfig(name string, profileName string, rawConfig []byte, previous *Realm) (*Realm, error) {
+	var err error
+	r := &Realm{Name: name}
+
+	if r.Profile, err = profile.NewFromConfig(profileName, rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: %w", r, err)
+	}
+	// some profiles dictate the path of the realm (e.g. the tenant of Entra)
+	if based, ok := r.Profile.(interface{ BasePath() string }); ok {
+		r.Path = based.BasePath()
+	}
+
+	if previous != nil {
+		r.Sessions, r.Authorizations, r.Tokens = previous.Sessions, previous.Authorizations, previous.Tokens
+		r.WebAuthn, r.Mail = previous.WebAuthn, previous.Mail
+	} else if err = r.newRuntimeStores(rawConfig); err != nil {
+		return nil, err
+	}
+	if r.Clients, err = clientservice.NewFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize client service: %w", r, err)
+	}
+	if r.Users, err = userservice.NewFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize user service: %w", r, err)
+	}
+	if r.Claims, err = claimservice.NewFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize claim service: %w", r, err)
+	}
+	if r.Consents, err = consentservice.NewFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize consent service: %w", r, err)
+	}
+	if r.LifetimePolicy, err = tokenservice.NewLifetimePolicyFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize token lifetime policy: %w", r, err)
+	}
+	if r.TokenProfiles, err = tokenservice.NewProfilePolicyFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize token profiles: %w", r, err)
+	}
+	if r.Signing, err = signing.NewFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize signing service: %w", r, err)
+	}
+	if r.Brokers, err = brokerservice.NewFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize broker service: %w", r, err)
+	}
+	if r.Faults, err = faultservice.NewFromConfig(rawConfig); err != nil {
+		return nil, fmt.Errorf("realm %s: failed to initialize fault service: %w", r, err)
+	}
+
+	// wire the realm's services with each other (instead of the global di registry)
+	if consumer, ok := r.Claims.(interface {
+		InjectConsentService(consentservice.Service)
+	}); ok {
+		consumer.InjectConsentService(r.Consents)
+	}
+	if previous == nil {
+		r.bindRuntimeStores()
+	} else {
+		r.keepRuntimeChanges(previous)
+	}
+	r.Claims = profile.WrapClaimService(r.Claims, r.Profile)
+
+	slog.Info("realm initialized", "realm", r.String(), "profile", r.Profile.Name())
+	return r, nil
+}
+
+// newRuntimeStores instantiates the services which keep the runtime state of the realm
+// (sessions, authorization codes, opaque tokens, passkeys and the mail outbox), a reload keeps them
+func (r *Realm) newRuntimeStores(rawConfig []byte) error {
+	var err error
+	if r.Sessions, err = sessionservice.NewFromConfig(rawConfig); err != nil {
+		return fmt.Errorf("realm %s: failed to initialize session service: %w", r, err)
+	}
+	if r.Authorizations, err = authorizationservice.NewFromConfig(rawConfig); err != nil {
+		return fmt.Errorf("realm %s: failed to initialize authorization service: %w", r, err)
+	}
+	if r.Tokens, err = tokenservice.NewFromConfig(rawConfig); err != nil {
+		return fmt.Errorf("realm %s: failed to initialize token service: %w", r, err)
+	}
+	if r.WebAuthn, err = webauthnservice.NewFromConfig(rawConfig); err != nil {
+		return fmt.Errorf("realm %s: failed to initialize webauthn service: %w", r, err)
+	}
+	if r.Mail, err = mailservice.NewFromConfig(rawConfig); err != nil {
+		return fmt.Errorf("realm %s: failed to initialize mail service: %w", r, err)
+	}
+	return nil
+}
+
+// bindRuntimeStores wires the runtime stores with the config services of the realm,
+// a reload binds the kept stores once the new config has been loaded completely
+func (r *Realm) bindRuntimeStores() {
+	if consumer, ok := r.Authorizations.(interface {
+		InjectClientService(clientservice.Service)
+	}); ok {
+		consumer.InjectClientService(r.Clients)
+	}
+}
+
+// keepRuntimeChanges carries the changes made at runtime to the config services of the previous realm
+// (clients, users, claims, scopes and consents, signing keys and faults changed by the management API,
+// users provisioned just in time, TOTP enrolments) over to the services of the reloaded config
+func (r *Realm) keepRuntimeChanges(previous *Realm) {
+	if keeper, ok := r.Clients.(interface{ KeepRuntimeChanges(clientservice.Service) }); ok {
+		keeper.KeepRuntimeChanges(previous.Clients)
+	}
+	if keeper, ok := r.Users.(interface{ KeepRuntimeChanges(userservice.Service) }); ok {
+		keeper.KeepRuntimeChanges(previous.Users)
+	}
+	if keeper, ok := r.Claims.(interface{ KeepRuntimeChanges(claimservice.Service) }); ok {
+		previousClaims := previous.Claims
+		if wrapped, ok := previousClaims.(interface{ Unwrap() claimservice.Service }); ok {
+			previousClaims = wrapped.Unwrap()
+		}
+		keeper.KeepRuntimeChanges(previousClaims)
+	}
+	if keeper, ok := r.Consents.(interface{ KeepRuntimeChanges(consentservice.Service) }); ok {
+		keeper.KeepRuntimeChanges(previous.Consents)
+	}
+	if keeper, ok := r.Signing.(interface{ KeepRuntimeChanges(signing.SigningServicer) }); ok {
+		keeper.KeepRuntimeChanges(previous.Signing)
+	}
+	if keeper, ok := r.Faults.(interface{ KeepRuntimeChanges(faultservice.Service) }); ok {
+		keeper.KeepRuntimeChanges(previous.Faults)
+	}
+}
+
+// StatefulServices returns the services of the realm which keep runtime state, by the name
+// of their part of the snapshot. Services backed by external storage (e.g. a database) are left out.
+func (r *Realm) StatefulServices() map[string]state.Stateful {
+	services := map[string]any{
+		"sessions":       r.Sessions,
+		"authorizations": r.Authorizations,
+		"tokens":         r.Tokens,
+		"users":          r.Users,
+		"consents":       r.Consents,
+	}
+	stateful := make(map[string]state.Stateful)
+	for name, service := range services {
+		if s, ok := service.(state.Stateful); ok {
+			stateful[name] = s
+		}
+	}
+	return stateful
+}
+
+// LoadAll creates the default realm from the root config and one realm for every entry
+// of its realms section. A realm entry is either an inline config or a reference
+// to a separate JSON or YAML data file ("file", relative to baseDir).
+func LoadAll(rawConfig []byte, baseDir string) ([]*Realm, error) {
+	return loadAll(rawConfig, baseDir, nil)
+}
+
+// Reload creates the realms of a changed config like LoadAll. Realms which existed before keep
+// their runtime stores (sessions, authorization codes, opaque tokens, passkeys and the mail outbox)
+// and the changes made at runtime to their config services, which win over the config; everything
+// else is read from the config again. The previous realms are left untouched when it fails.
+func Reload(rawConfig []byte, baseDir string, previous []*Realm) ([]*Realm, error) {
+	previousByName := make(map[string]*Realm, len(previous))
+	for _, r := range previous {
+		previousByName[r.Name] = r
+	}
+	realms, err := loadAll(rawConfig, baseDir, previousByName)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range realms {
+		if _, kept := previousByName[r.Name]; kept {
+			r.bindRuntimeStores()
+		}
+	}
+	return realms, nil
+}
+
+func loadAll(rawConfig []byte, baseDir string, previous map[string]*Realm) ([]*Realm, error) {
+	root := rootConfig{}
+	if err := json.Unmarshal(rawConfig, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse realms config: %w", err)
+	}
+	var rootSections map[string]json.RawMessage
+	if err := json.Unmarshal(rawConfig, &rootSections); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	defaultRealm, err := newFromConfig("", root.Profile, rawConfig, previous[""])
+	if err != nil {
+		return nil, err
+	}
+	realms := []*Realm{defaultRealm}
+
+	names := make([]string, 0, len(root.Realms))
+	for name := range root.Realms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !realmNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid realm name '%s'", name)
+		}
+		realmRawConfig, settings, err := resolveRealmConfig(root.Realms[name], rootSections, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("realm %s: %w", name, err)
+		}
+		r, err := newFromConfig(name, settings.Profile, realmRawConfig, previous[name])
+		if err != nil {
+			return nil, err
+		}
+		r.Host = settings.Host
+		r.Issuer = settings.Issuer
+		if r.Host == "" && r.Path == "" {
+			r.Path = PathPrefix + name
+		}
+		realms = append(realms, r)
+	}
+
+	return realms, nil
+}
+
+func resolveRealmConfig(rawRealm json.RawMessage, rootSections map[string]json.RawMessage, baseDir string) ([]byte, realmConfig, error) {
+	settings := realmConfig{}
+	if err := json.Unmarshal(rawRealm, &settings); err != nil {
+		return nil, settings, fmt.Errorf("failed to parse realm config: %w", err)
+	}
+
+	data := []byte(rawRealm)
+	if settings.File != "" {
+		path := settings.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		fileData, err := config.ReadDataFile(path, baseDir)
+		if err != nil {
+			return nil, settings, fmt.Errorf("failed to read realm config file: %w", err)
+		}
+		data = fileData
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil, settings, fmt.Errorf("failed to parse realm config: %w", err)
+	}
+	for _, section := range inheritedSections {
+		if _, ok := sections[section]; !ok {
+			if rootSection, ok := rootSections[section]; ok {
+				sections[section] = rootSection
+			}
+		}
+	}
+	delete(sections, "realms")
+
+	merged, err := json.Marshal(sections)
+	if err != nil {
+		return nil, settings, err
+	}
+	return merged, settings, nil
+}
+
+// ExpandFiles returns the config with the content of every realm file (see LoadAll) merged into its realm
+// entry, e.g. to find out whether a config changed including the realm files it references.
+func ExpandFiles(rawConfig []byte, baseDir string) ([]byte, error) {
+	root := map[string]any{}
+	if err := json.Unmarshal(rawConfig, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	realms, _ := root["realms"].(map[string]any)
+	for name, entry := range realms {
+		rawRealm, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		settings := realmConfig{}
+		if err := json.Unmarshal(rawRealm, &settings); err != nil || settings.File == "" {
+			continue
+		}
+		path := settings.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		fileData, err := config.ReadDataFile(path, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("realm %s: failed to read realm config file: %w", name, err)
+		}
+		var content any
+		if err := json.Unmarshal(fileData, &content); err != nil {
+			return nil, fmt.Errorf("realm %s: failed to parse realm config: %w", name, err)
+		}
+		realms[name] = config.Merge(content, entry)
+	}
+	return json.Marshal(root)
+}
@@ -0,0 +1,265 @@
+package realm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clientservice"
+	"github.com/axent-pl/oauth2mock/pkg/config"
+	"github.com/axent-pl/oauth2mock/pkg/consentservice"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+	"github.com/axent-pl/oauth2mock/pkg/userservice"
+)
+
+func TestResolveRealmConfig(t *testing.T) {
+	rootSections := map[string]json.RawMessage{
+		"session": json.RawMessage(`{"provider":"memory"}`),
+		"tokens":  json.RawMessage(`{"provider":"memory"}`),
+		"users":   json.RawMessage(`{"provider":"json","users":{"root":{}}}`),
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "team.json"), []byte(`{"tokens":{"provider":"other"},"clients":{}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		rawRealm     string
+		wantHost     string
+		wantSections map[string]string
+	}{
+		{
+			name:     "inline realm inherits infrastructure sections only",
+			rawRealm: `{"host":"team.localhost","clients":{}}`,
+			wantHost: "team.localhost",
+			wantSections: map[string]string{
+				"session": `{"provider":"memory"}`,
+				"tokens":  `{"provider":"memory"}`,
+				"users":   "",
+			},
+		},
+		{
+			name:     "file realm keeps its own sections",
+			rawRealm: `{"file":"team.json"}`,
+			wantSections: map[string]string{
+				"session": `{"provider":"memory"}`,
+				"tokens":  `{"provider":"other"}`,
+				"users":   "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, settings, err := resolveRealmConfig(json.RawMessage(tt.rawRealm), rootSections, dir)
+			if err != nil {
+				t.Fatalf("resolveRealmConfig() error = %v", err)
+			}
+			if settings.Host != tt.wantHost {
+				t.Errorf("Host = %q, want %q", settings.Host, tt.wantHost)
+			}
+			var sections map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &sections); err != nil {
+				t.Fatal(err)
+			}
+			for section, want := range tt.wantSections {
+				if got := string(sections[section]); got != want {
+					t.Errorf("section %s = %q, want %q", section, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAllRejectsInvalidRealmName(t *testing.T) {
+	rawConfig := []byte(`{
+		"session": {"provider": "memory"},
+		"users": {"provider": "json", "users": {}},
+		"claims": {"provider": "json"},
+		"authorization": {"provider": "memory", "authorizationRequestTTLSeconds": 60},
+		"consents": {"provider": "json"},
+		"realms": {"bad/name": {}}
+	}`)
+	if _, err := LoadAll(rawConfig, t.TempDir()); err == nil {
+		t.Fatal("LoadAll() expected an error for an invalid realm name")
+	}
+}
+
+func TestReloadKeepsRuntimeChanges(t *testing.T) {
+	reloadConfig := func(redirectURI string, extraClient string) []byte {
+		return []byte(`{
+			"signing": {"keys": [{"provider": {"fromRandom": {"type": "P-256", "deterministic": true, "seed": "realm"}}, "method": "ES256", "active": true}]},
+			"session": {"provider": "memory"},
+			"users": {"provider": "json", "users": {"alice": {"username": "alice", "password": "alice"}}},
+			"claims": {"provider": "json"},
+			"authorization": {"provider": "memory", "authorizationRequestTTLSeconds": 60},
+			"consents": {"provider": "json", "scopes": {"openid": {"requireConsent": false}}},
+			"faults": {"enabled": true, "rules": [{"name": "slow", "enabled": true, "latencyMs": 100}]},
+			"clients": {
+				"A": {"client_id": "A", "client_secret": "a", "redirect_uri": "` + redirectURI + `"},
+				"B": {"client_id": "B", "client_secret": "b", "redirect_uri": "http://b.localhost/callback"}` + extraClient + `
+			}
+		}`)
+	}
+	realms, err := LoadAll(reloadConfig("http://a.localhost/callback", ""), t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	r := realms[0]
+
+	// changes made at runtime, e.g. by the management API or just in time provisioning
+	if err := r.Clients.PutClient("C", clientservice.ClientConfig{Id: "C", Secret: "c", RedirectURI: "http://c.localhost/callback"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Clients.DeleteClient("B"); err != nil {
+		t.Fatal(err)
+	}
+	jit, err := userservice.NewUserHandler("jit", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Users.AddUser(jit); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := r.Users.GetUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.SetTOTPSecret("JBSWY3DPEHPK3PXP")
+	if err := r.Users.UpdateUser(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Faults.SetRuleEnabled("slow", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Consents.PutScope("api", consentservice.Scope{RequireConsent: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := Reload(reloadConfig("http://a2.localhost/callback", `,
+				"D": {"client_id": "D", "client_secret": "d", "redirect_uri": "http://d.localhost/callback"}`), t.TempDir(), realms)
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	r2 := reloaded[0]
+
+	if r2.Sessions != r.Sessions {
+		t.Error("Reload() replaced the session store")
+	}
+	if a, err := r2.Clients.GetClient("A"); err != nil || a.RedirectURIPattern() != "http://a2.localhost/callback" {
+		t.Errorf("client A after Reload() = %v, %v, want the redirect URI of the new config", a, err)
+	}
+	for id, want := range map[string]bool{"B": false, "C": true, "D": true} {
+		if _, err := r2.Clients.GetClient(id); (err == nil) != want {
+			t.Errorf("client %s after Reload() found = %v, want %v", id, err == nil, want)
+		}
+	}
+	if _, err := r2.Users.GetUser("jit"); err != nil {
+		t.Errorf("user provisioned at runtime after Reload() error = %v", err)
+	}
+	if alice, err := r2.Users.GetUser("alice"); err != nil || alice.TOTPSecret() != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("user alice after Reload() = %v, %v, want the TOTP enrolment kept", alice, err)
+	}
+	if rules := r2.Faults.GetRules(); len(rules) != 1 || rules[0].Enabled {
+		t.Errorf("fault rules after Reload() = %+v, want the rule switched off at runtime", rules)
+	}
+	if _, ok := r2.Consents.GetScopes()["api"]; !ok {
+		t.Error("scope added at runtime lost by Reload()")
+	}
+
+	// an unchanged realm reloaded again keeps the changes too
+	again, err := Reload(reloadConfig("http://a2.localhost/callback", ""), t.TempDir(), reloaded)
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := again[0].Clients.GetClient("C"); err != nil {
+		t.Errorf("client C after the second Reload() error = %v", err)
+	}
+	if _, err := again[0].Clients.GetClient("D"); err == nil {
+		t.Error("client D removed from the config still found after Reload()")
+	}
+}
+
+func TestExpandFiles(t *testing.T) {
+	// a conf.d layout, the realm file and the secret it references are relative to the base directory
+	dir := t.TempDir()
+	files := map[string]string{
+		"realms/team.yaml": "clients:\n  T:\n    client_secret: ${file:secrets/team}\n",
+		"secrets/team":     "t3am\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expanded, err := ExpandFiles([]byte(`{"profile":"keycloak","realms":{"team":{"file":"realms/team.yaml","host":"team.localhost"},"inline":{"clients":{}}}}`), dir)
+	if err != nil {
+		t.Fatalf("ExpandFiles() error = %v", err)
+	}
+	want := `{"profile":"keycloak","realms":{"inline":{"clients":{}},"team":{"clients":{"T":{"client_secret":"t3am"}},"file":"realms/team.yaml","host":"team.localhost"}}}`
+	if string(expanded) != want {
+		t.Errorf("ExpandFiles() = %s, want %s", expanded, want)
+	}
+}
+
+func TestLoadAllShippedConfig(t *testing.T) {
+	var dataFiles []string
+	for _, name := range []string{"config.json", "config.yaml"} {
+		path, err := filepath.Abs(filepath.Join("..", "..", "assets", "config", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dataFiles = append(dataFiles, path)
+	}
+
+	// the keys of the shipped config are generated by make run-keygen, their paths are relative to the working directory
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Join("assets", "key"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for path, keyType := range map[string]signing.KeyType{"assets/key/key.rsa256.pem": signing.RSA256, "assets/key/key.rsa384.pem": signing.RSA384} {
+		key, err := signing.NewSigningKeyHandlerFromRandom(keyType, false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := key.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := signing.NewCertSigningKeyFromRandom(signing.RSA512, signing.NewRandReader(false, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Save("assets/key/cert.cert.rsa512.pem", "assets/key/cert.key.rsa512.pem"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dataFile := range dataFiles {
+		t.Run(filepath.Base(dataFile), func(t *testing.T) {
+			data, err := config.ReadDataFile(dataFile, config.DataFileBaseDir(dataFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded := make(chan error, 1)
+			go func() {
+				_, err := LoadAll(data, config.DataFileBaseDir(dataFile))
+				loaded <- err
+			}()
+			select {
+			case err := <-loaded:
+				if err != nil {
+					t.Fatalf("LoadAll() error = %v", err)
+				}
+			case <-time.After(30 * time.Second):
+				t.Fatal("LoadAll() of the shipped config did not finish in 30s")
+			}
+		})
+	}
+}
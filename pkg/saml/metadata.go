@@ -0,0 +1,31 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+)
+
+// Metadata renders the IdP metadata (EntityDescriptor with an IDPSSODescriptor)
+func Metadata(entityID string, ssoRedirectURL string, ssoPostURL string, cert *x509.Certificate) []byte {
+	children := []string{}
+	if cert != nil {
+		children = append(children,
+			element("md:KeyDescriptor", nil, []attr{{"use", "signing"}},
+				element("ds:KeyInfo", []attr{{"ds", NamespaceDSig}}, nil,
+					element("ds:X509Data", nil, nil,
+						text("ds:X509Certificate", nil, base64.StdEncoding.EncodeToString(cert.Raw))))))
+	}
+	for _, format := range SupportedNameIDFormats {
+		children = append(children, text("md:NameIDFormat", nil, format))
+	}
+	children = append(children,
+		element("md:SingleSignOnService", nil, []attr{{"Binding", BindingHTTPRedirect}, {"Location", ssoRedirectURL}}),
+		element("md:SingleSignOnService", nil, []attr{{"Binding", BindingHTTPPost}, {"Location", ssoPostURL}}))
+
+	descriptor := element("md:IDPSSODescriptor", nil,
+		[]attr{{"WantAuthnRequestsSigned", "false"}, {"protocolSupportEnumeration", NamespaceProtocol}},
+		children...)
+
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		element("md:EntityDescriptor", []attr{{"md", NamespaceMetadata}}, []attr{{"entityID", entityID}}, descriptor))
+}
@@ -0,0 +1,232 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	algExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algECDSASHA256  = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algDigestSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+)
+
+// Assertion holds the statements of an assertion issued to a service provider
+type Assertion struct {
+	Issuer       string
+	Audience     string // entity ID of the service provider
+	Recipient    string // assertion consumer service URL
+	InResponseTo string // ID of the AuthnRequest
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	Attributes   map[string]interface{}
+	IssuedAt     time.Time
+	Lifetime     time.Duration
+}
+
+// ErrUnsupportedKey is returned for signing keys other than RSA and ECDSA keys
+var ErrUnsupportedKey = errors.New("SAML signatures need an RSA or ECDSA key")
+
+// NewResponse builds a successful Response with a signed assertion (enveloped RSA-SHA256 or ECDSA-SHA256 signature, by the key)
+func NewResponse(a Assertion, cert *x509.Certificate, signer crypto.Signer) (string, error) {
+	assertionID := newID()
+	assertion, err := signAssertion(assertionID, buildAssertion(assertionID, a), cert, signer)
+	if err != nil {
+		return "", err
+	}
+	return buildResponse(a.Issuer, a.Recipient, a.InResponseTo, a.IssuedAt, StatusSuccess, "", assertion), nil
+}
+
+// NewErrorResponse builds an unsigned Response with an error status
+func NewErrorResponse(issuer, destination, inResponseTo string, issuedAt time.Time, status, message string) string {
+	return buildResponse(issuer, destination, inResponseTo, issuedAt, status, message, "")
+}
+
+func buildResponse(issuer, destination, inResponseTo string, issuedAt time.Time, status, message, assertion string) string {
+	statusChildren := []string{element("samlp:StatusCode", nil, []attr{{"Value", status}})}
+	if message != "" {
+		statusChildren = append(statusChildren, text("samlp:StatusMessage", nil, message))
+	}
+	attrs := []attr{{"ID", newID()}, {"IssueInstant", timestamp(issuedAt)}, {"Version", "2.0"}, {"Destination", destination}}
+	if inResponseTo != "" {
+		attrs = append(attrs, attr{"InResponseTo", inResponseTo})
+	}
+	return element("samlp:Response",
+		[]attr{{"samlp", NamespaceProtocol}, {"saml", NamespaceAssertion}},
+		attrs,
+		text("saml:Issuer", nil, issuer),
+		element("samlp:Status", nil, nil, statusChildren...),
+		assertion)
+}
+
+func buildAssertion(id string, a Assertion) string {
+	notOnOrAfter := timestamp(a.IssuedAt.Add(a.Lifetime))
+	nameIDFormat := a.NameIDFormat
+	if nameIDFormat == "" {
+		nameIDFormat = NameIDFormatUnspecified
+	}
+
+	subjectConfirmationAttrs := []attr{{"NotOnOrAfter", notOnOrAfter}, {"Recipient", a.Recipient}}
+	if a.InResponseTo != "" {
+		subjectConfirmationAttrs = append(subjectConfirmationAttrs, attr{"InResponseTo", a.InResponseTo})
+	}
+
+	children := []string{
+		text("saml:Issuer", nil, a.Issuer),
+		element("saml:Subject", nil, nil,
+			text("saml:NameID", []attr{{"Format", nameIDFormat}}, a.NameID),
+			element("saml:SubjectConfirmation", nil, []attr{{"Method", confirmationMethodBearer}},
+				element("saml:SubjectConfirmationData", nil, subjectConfirmationAttrs))),
+		element("saml:Conditions", nil, []attr{{"NotBefore", timestamp(a.IssuedAt.Add(-time.Minute))}, {"NotOnOrAfter", notOnOrAfter}},
+			element("saml:AudienceRestriction", nil, nil,
+				text("saml:Audience", nil, a.Audience))),
+		element("saml:AuthnStatement", nil, []attr{{"AuthnInstant", timestamp(a.IssuedAt)}, {"SessionIndex", a.SessionIndex}},
+			element("saml:AuthnContext", nil, nil,
+				text("saml:AuthnContextClassRef", nil, authnContextPassword))),
+	}
+	if statement := buildAttributeStatement(a.Attributes); statement != "" {
+		children = append(children, statement)
+	}
+
+	return element("saml:Assertion",
+		[]attr{{"saml", NamespaceAssertion}},
+		[]attr{{"ID", id}, {"IssueInstant", timestamp(a.IssuedAt)}, {"Version", "2.0"}},
+		children...)
+}
+
+// buildAttributeStatement renders the claims as attributes, lists become multi-valued attributes
+// and structured values are JSON encoded
+func buildAttributeStatement(attributes map[string]interface{}) string {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statements := make([]string, 0, len(names))
+	for _, name := range names {
+		values := make([]string, 0)
+		for _, value := range attributeValues(attributes[name]) {
+			values = append(values, text("saml:AttributeValue", nil, value))
+		}
+		if len(values) == 0 {
+			continue
+		}
+		statements = append(statements, element("saml:Attribute", nil, []attr{{"Name", name}, {"NameFormat", attributeNameFormatBasic}}, values...))
+	}
+	if len(statements) == 0 {
+		return ""
+	}
+	return element("saml:AttributeStatement", nil, nil, statements...)
+}
+
+func attributeValues(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, attributeValues(item)...)
+		}
+		return values
+	case map[string]interface{}:
+		encoded, _ := json.Marshal(v)
+		return []string{string(encoded)}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// signAssertion inserts the enveloped signature after the Issuer of the assertion
+func signAssertion(id string, assertion string, cert *x509.Certificate, signer crypto.Signer) (string, error) {
+	signatureMethod, err := signatureMethodOf(signer)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(assertion))
+	signedInfo := element("ds:SignedInfo", []attr{{"ds", NamespaceDSig}}, nil,
+		element("ds:CanonicalizationMethod", nil, []attr{{"Algorithm", algExcC14N}}),
+		element("ds:SignatureMethod", nil, []attr{{"Algorithm", signatureMethod}}),
+		element("ds:Reference", nil, []attr{{"URI", "#" + id}},
+			element("ds:Transforms", nil, nil,
+				element("ds:Transform", nil, []attr{{"Algorithm", algEnveloped}}),
+				element("ds:Transform", nil, []attr{{"Algorithm", algExcC14N}})),
+			element("ds:DigestMethod", nil, []attr{{"Algorithm", algDigestSHA256}}),
+			text("ds:DigestValue", nil, base64.StdEncoding.EncodeToString(digest[:]))))
+
+	signedInfoDigest := sha256.Sum256([]byte(signedInfo))
+	signatureValue, err := signer.Sign(rand.Reader, signedInfoDigest[:], crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign assertion: %w", err)
+	}
+	if key, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		if signatureValue, err = rawECDSASignature(signatureValue, key); err != nil {
+			return "", err
+		}
+	}
+
+	// within the Signature element the ds namespace is declared by the parent already
+	signature := element("ds:Signature", []attr{{"ds", NamespaceDSig}}, nil,
+		strings.Replace(signedInfo, ` xmlns:ds="`+NamespaceDSig+`"`, "", 1),
+		text("ds:SignatureValue", nil, base64.StdEncoding.EncodeToString(signatureValue)),
+		element("ds:KeyInfo", nil, nil,
+			element("ds:X509Data", nil, nil,
+				text("ds:X509Certificate", nil, base64.StdEncoding.EncodeToString(cert.Raw)))))
+
+	// the signature goes right after the assertion Issuer (SAML core 5.4.1)
+	issuerEnd := strings.Index(assertion, "</saml:Issuer>") + len("</saml:Issuer>")
+	return assertion[:issuerEnd] + signature + assertion[issuerEnd:], nil
+}
+
+// signatureMethodOf returns the XML signature algorithm for the key of signer
+func signatureMethodOf(signer crypto.Signer) (string, error) {
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		return algRSASHA256, nil
+	case *ecdsa.PublicKey:
+		return algECDSASHA256, nil
+	}
+	return "", fmt.Errorf("%w, got %T", ErrUnsupportedKey, signer.Public())
+}
+
+// rawECDSASignature converts the ASN.1 signature of crypto.Signer to the concatenation of r and s
+// (each as long as the curve order) required by XML signatures
+func rawECDSASignature(signature []byte, key *ecdsa.PublicKey) ([]byte, error) {
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(signature, &rs); err != nil {
+		return nil, fmt.Errorf("failed to sign assertion: %w", err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	raw := make([]byte, 2*size)
+	rs.R.FillBytes(raw[:size])
+	rs.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// newID returns an xs:ID, which must not start with a digit
+func newID() string {
+	return "_" + uuid.NewString()
+}
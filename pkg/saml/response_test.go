@@ -0,0 +1,150 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestNewResponseSignature(t *testing.T) {
+	cert, key := testCertificate(t)
+
+	response, err := NewResponse(Assertion{
+		Issuer:       "http://idp.example.com",
+		Audience:     "https://sp.example.com",
+		Recipient:    "https://sp.example.com/acs",
+		InResponseTo: "_req1",
+		NameID:       "demo",
+		SessionIndex: "session-1",
+		Attributes:   map[string]interface{}{"roles": []interface{}{"A", "B&C"}, "name": "<Demo>"},
+		IssuedAt:     time.Now(),
+		Lifetime:     time.Minute,
+	}, cert, key)
+	if err != nil {
+		t.Fatalf("NewResponse() error = %v", err)
+	}
+
+	if err := xml.Unmarshal([]byte(response), new(struct{})); err != nil {
+		t.Fatalf("response is not well-formed: %v", err)
+	}
+
+	// enveloped-signature transform, the assertion is already in its canonical form
+	assertion := response[strings.Index(response, "<saml:Assertion") : strings.Index(response, "</saml:Assertion>")+len("</saml:Assertion>")]
+	signature := regexp.MustCompile(`<ds:Signature .*</ds:Signature>`).FindString(assertion)
+	digest := sha256.Sum256([]byte(strings.Replace(assertion, signature, "", 1)))
+	if !strings.Contains(signature, "<ds:DigestValue>"+base64.StdEncoding.EncodeToString(digest[:])+"</ds:DigestValue>") {
+		t.Errorf("digest does not match the assertion")
+	}
+
+	// exclusive canonicalization of SignedInfo renders the ds namespace on SignedInfo
+	signedInfo := regexp.MustCompile(`<ds:SignedInfo>.*</ds:SignedInfo>`).FindString(signature)
+	signedInfo = strings.Replace(signedInfo, "<ds:SignedInfo>", `<ds:SignedInfo xmlns:ds="`+NamespaceDSig+`">`, 1)
+	signatureValue, err := base64.StdEncoding.DecodeString(regexp.MustCompile(`<ds:SignatureValue>(.*)</ds:SignatureValue>`).FindStringSubmatch(signature)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedInfoDigest := sha256.Sum256([]byte(signedInfo))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, signedInfoDigest[:], signatureValue); err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+
+	for _, want := range []string{
+		`<saml:AttributeValue>B&amp;C</saml:AttributeValue>`,
+		`<saml:AttributeValue>&lt;Demo&gt;</saml:AttributeValue>`,
+		`<saml:Audience>https://sp.example.com</saml:Audience>`,
+	} {
+		if !strings.Contains(response, want) {
+			t.Errorf("response does not contain %s", want)
+		}
+	}
+}
+
+func TestNewResponseSignatureMethod(t *testing.T) {
+	cert, _ := testCertificate(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion := Assertion{Issuer: "http://idp.example.com", Audience: "https://sp.example.com", NameID: "demo", IssuedAt: time.Now(), Lifetime: time.Minute}
+
+	response, err := NewResponse(assertion, cert, ecKey)
+	if err != nil {
+		t.Fatalf("NewResponse() with an ECDSA key error = %v", err)
+	}
+	if !strings.Contains(response, `<ds:SignatureMethod Algorithm="`+algECDSASHA256+`"></ds:SignatureMethod>`) {
+		t.Errorf("response of an ECDSA key is not signed with %s", algECDSASHA256)
+	}
+	signature := regexp.MustCompile(`<ds:Signature .*</ds:Signature>`).FindString(response)
+	signedInfo := regexp.MustCompile(`<ds:SignedInfo>.*</ds:SignedInfo>`).FindString(signature)
+	signedInfo = strings.Replace(signedInfo, "<ds:SignedInfo>", `<ds:SignedInfo xmlns:ds="`+NamespaceDSig+`">`, 1)
+	signatureValue, err := base64.StdEncoding.DecodeString(regexp.MustCompile(`<ds:SignatureValue>(.*)</ds:SignatureValue>`).FindStringSubmatch(signature)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signatureValue) != 64 {
+		t.Fatalf("ECDSA signature has %d bytes, want r and s (64 bytes)", len(signatureValue))
+	}
+	signedInfoDigest := sha256.Sum256([]byte(signedInfo))
+	r, s := new(big.Int).SetBytes(signatureValue[:32]), new(big.Int).SetBytes(signatureValue[32:])
+	if !ecdsa.Verify(&ecKey.PublicKey, signedInfoDigest[:], r, s) {
+		t.Error("invalid ECDSA signature")
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewResponse(assertion, cert, edKey); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("NewResponse() with an Ed25519 key error = %v, want %v", err, ErrUnsupportedKey)
+	}
+}
+
+func TestDecodeRedirectRequest(t *testing.T) {
+	encoded, err := EncodeRedirectRequest([]byte(`<samlp:AuthnRequest xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_req1" Version="2.0" AssertionConsumerServiceURL="https://sp.example.com/acs"><saml:Issuer>https://sp.example.com</saml:Issuer></samlp:AuthnRequest>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := DecodeRedirectRequest(encoded)
+	if err != nil {
+		t.Fatalf("DecodeRedirectRequest() error = %v", err)
+	}
+	if req.ID != "_req1" || req.Issuer != "https://sp.example.com" || req.AssertionConsumerServiceURL != "https://sp.example.com/acs" {
+		t.Errorf("DecodeRedirectRequest() = %+v", req)
+	}
+}
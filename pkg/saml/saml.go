@@ -0,0 +1,121 @@
+// Package saml implements the SAML 2.0 Web Browser SSO profile of an identity provider:
+// AuthnRequest decoding, signed assertions and IdP metadata.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	NamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	NamespaceDSig      = "http://www.w3.org/2000/09/xmldsig#"
+
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+	StatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	StatusRequester = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+
+	attributeNameFormatBasic = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	authnContextPassword     = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+	confirmationMethodBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// SupportedNameIDFormats are the NameID formats the identity provider issues
+var SupportedNameIDFormats = []string{NameIDFormatUnspecified, NameIDFormatEmailAddress, NameIDFormatPersistent, NameIDFormatTransient}
+
+// AuthnRequest is the part of a SAML AuthnRequest the identity provider uses
+type AuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                struct {
+		Format string `xml:"Format,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+// DecodeRedirectRequest decodes a SAMLRequest of the HTTP-Redirect binding (base64 of the DEFLATE-compressed XML)
+func DecodeRedirectRequest(samlRequest string) (*AuthnRequest, error) {
+	compressed, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAMLRequest encoding: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAMLRequest compression: %w", err)
+	}
+	return parseAuthnRequest(data)
+}
+
+// DecodePostRequest decodes a SAMLRequest of the HTTP-POST binding (base64 of the XML)
+func DecodePostRequest(samlRequest string) (*AuthnRequest, error) {
+	data, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAMLRequest encoding: %w", err)
+	}
+	return parseAuthnRequest(data)
+}
+
+// EncodeRedirectRequest encodes the XML of a request for the HTTP-Redirect binding
+func EncodeRedirectRequest(data []byte) (string, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// PostToRedirectRequest re-encodes a SAMLRequest of the HTTP-POST binding for the HTTP-Redirect binding
+func PostToRedirectRequest(samlRequest string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return "", fmt.Errorf("invalid SAMLRequest encoding: %w", err)
+	}
+	if _, err := parseAuthnRequest(data); err != nil {
+		return "", err
+	}
+	return EncodeRedirectRequest(data)
+}
+
+func parseAuthnRequest(data []byte) (*AuthnRequest, error) {
+	req := &AuthnRequest{}
+	if err := xml.Unmarshal(data, req); err != nil {
+		return nil, fmt.Errorf("invalid AuthnRequest: %w", err)
+	}
+	if req.ID == "" {
+		return nil, fmt.Errorf("invalid AuthnRequest: missing ID")
+	}
+	if req.Version != "2.0" {
+		return nil, fmt.Errorf("invalid AuthnRequest: unsupported version '%s'", req.Version)
+	}
+	return req, nil
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
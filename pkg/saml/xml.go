@@ -0,0 +1,53 @@
+package saml
+
+import (
+	"sort"
+	"strings"
+)
+
+// The documents are written directly in their exclusive canonical form (xml-exc-c14n):
+// namespace declarations first, attributes sorted by name, no self-closing tags, no whitespace
+// between elements and c14n escaping. This way the signed octets are the document itself
+// and no XML canonicalization library is needed.
+
+type attr struct {
+	name  string
+	value string
+}
+
+// element renders an element, ns are the namespace declarations (prefix, URI) of the element
+func element(name string, ns []attr, attrs []attr, children ...string) string {
+	var b strings.Builder
+	b.WriteString("<" + name)
+	sort.Slice(ns, func(i, j int) bool { return ns[i].name < ns[j].name })
+	for _, n := range ns {
+		b.WriteString(` xmlns:` + n.name + `="` + escapeAttr(n.value) + `"`)
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].name < attrs[j].name })
+	for _, a := range attrs {
+		b.WriteString(` ` + a.name + `="` + escapeAttr(a.value) + `"`)
+	}
+	b.WriteString(">")
+	for _, c := range children {
+		b.WriteString(c)
+	}
+	b.WriteString("</" + name + ">")
+	return b.String()
+}
+
+// text renders an element with text content
+func text(name string, attrs []attr, value string) string {
+	return element(name, nil, attrs, escapeText(value))
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
@@ -0,0 +1,16 @@
+package authentication
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// NewOneTimeCode returns a random numeric code of the given number of digits, e.g. to be sent by email
+func NewOneTimeCode(digits int) (string, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate one-time code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
@@ -70,6 +70,21 @@ func WithUsernameAndPassword(username, password string) SchemeOption {
 	}
 }
 
+// WithUsernameAndPasswordHash is WithUsernameAndPassword for a password hashed already (e.g. restored from a snapshot)
+func WithUsernameAndPasswordHash(username, passwordHash string) SchemeOption {
+	return func(s *schemeHandler) error {
+		if username == "" {
+			return errs.New("missing username", errs.ErrInvalidArgument)
+		}
+		if passwordHash == "" {
+			return errs.New("missing password", errs.ErrInvalidArgument)
+		}
+		s.Username = username
+		s.Password = passwordHash
+		return nil
+	}
+}
+
 func WithClientAssertion(assertionType, assertionClaim string, assertionJWKS string) SchemeOption {
 	return func(s *schemeHandler) error {
 		if assertionType == "" {
@@ -0,0 +1,62 @@
+package authentication
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 with the ASCII secret "12345678901234567890"
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		if got := hotp(key, uint64(tt.unix/30), 8); got != tt.want {
+			t.Errorf("hotp(T=%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "081804" {
+		t.Errorf("TOTPCode() = %s, want 081804", code)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		code string
+		want bool
+	}{
+		{"current step", now, code, true},
+		{"previous step", now.Add(30 * time.Second), code, true},
+		{"next step", now.Add(-30 * time.Second), code, true},
+		{"expired", now.Add(90 * time.Second), code, false},
+		{"wrong code", now, "000000", false},
+		{"wrong length", now, "81804", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateTOTP(secret, tt.code, tt.at); got != tt.want {
+				t.Errorf("ValidateTOTP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+)
+
+type jweHeader struct {
+	Alg string          `json:"alg"`
+	Enc string          `json:"enc"`
+	Kid string          `json:"kid,omitempty"`
+	Cty string          `json:"cty,omitempty"`
+	Epk *ephemeralKeyEC `json:"epk,omitempty"`
+}
+
+type ephemeralKeyEC struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// EncryptJWT wraps a signed JWT into a compact JWE (nested sign-then-encrypt, cty "JWT")
+// using the first suitable encryption key of the recipient key set.
+func EncryptJWT(signedJWT []byte, recipient signing.JSONWebKeySet, alg KeyManagementAlgorithm, enc ContentEncryptionAlgorithm) ([]byte, error) {
+	jwk, err := SelectEncryptionKey(recipient, alg)
+	if err != nil {
+		return nil, err
+	}
+	return Encrypt(signedJWT, jwk, alg, enc, "JWT")
+}
+
+// SelectEncryptionKey returns the first key usable for the given algorithm (kty matches and use is "enc" or unset).
+func SelectEncryptionKey(recipient signing.JSONWebKeySet, alg KeyManagementAlgorithm) (signing.JSONWebKey, error) {
+	kty, ok := keyTypeForAlgorithm[alg]
+	if !ok {
+		return signing.JSONWebKey{}, errs.New("unsupported encryption algorithm", errs.ErrInvalidArgument).WithDetailsf("alg '%s' is not supported", alg)
+	}
+	for _, k := range recipient.Keys {
+		if k.Kty == kty && (k.Use == "" || k.Use == "enc") {
+			return k, nil
+		}
+	}
+	return signing.JSONWebKey{}, errs.New("no encryption key", errs.ErrNotFound).WithDetailsf("no %s key usable for %s", kty, alg)
+}
+
+// Encrypt produces a compact serialized JWE of the payload for the recipient key.
+func Encrypt(payload []byte, recipient signing.JSONWebKey, alg KeyManagementAlgorithm, enc ContentEncryptionAlgorithm, cty string) ([]byte, error) {
+	if enc != A256GCM {
+		return nil, errs.New("unsupported encryption algorithm", errs.ErrInvalidArgument).WithDetailsf("enc '%s' is not supported", enc)
+	}
+	publicKey, err := recipient.PublicKey()
+	if err != nil {
+		return nil, errs.Wrap("invalid encryption key", err).WithKind(errs.ErrInvalidArgument)
+	}
+
+	header := jweHeader{Alg: string(alg), Enc: string(enc), Kid: recipient.Kid, Cty: cty}
+	var cek, encryptedKey []byte
+
+	switch alg {
+	case RSAOAEP256:
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errs.New("invalid encryption key", errs.ErrInvalidArgument).WithDetailsf("%s requires an RSA key", alg)
+		}
+		cek = make([]byte, 32)
+		if _, err := rand.Read(cek); err != nil {
+			return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal)
+		}
+		encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaKey, cek, nil)
+		if err != nil {
+			return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal).WithDetails("failed to encrypt content encryption key")
+		}
+	case ECDHES:
+		ecKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errs.New("invalid encryption key", errs.ErrInvalidArgument).WithDetailsf("%s requires an EC key", alg)
+		}
+		recipientKey, err := ecKey.ECDH()
+		if err != nil {
+			return nil, errs.Wrap("invalid encryption key", err).WithKind(errs.ErrInvalidArgument)
+		}
+		ephemeralKey, err := recipientKey.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal)
+		}
+		sharedSecret, err := ephemeralKey.ECDH(recipientKey)
+		if err != nil {
+			return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal)
+		}
+		header.Epk = newEphemeralKeyEC(recipient.Crv, ephemeralKey.PublicKey())
+		cek = concatKDF(sharedSecret, string(enc), nil, nil, 256)
+	default:
+		return nil, errs.New("unsupported encryption algorithm", errs.ErrInvalidArgument).WithDetailsf("alg '%s' is not supported", alg)
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal)
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerBytes)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal)
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errs.Wrap("internal error", err).WithKind(errs.ErrInternal)
+	}
+	sealed := gcm.Seal(nil, iv, payload, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	parts := []string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}
+	return []byte(strings.Join(parts, ".")), nil
+}
+
+func newEphemeralKeyEC(crv string, publicKey *ecdh.PublicKey) *ephemeralKeyEC {
+	// uncompressed point: 0x04 || X || Y
+	point := publicKey.Bytes()
+	size := (len(point) - 1) / 2
+	return &ephemeralKeyEC{
+		Kty: "EC",
+		Crv: crv,
+		X:   base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+		Y:   base64.RawURLEncoding.EncodeToString(point[1+size:]),
+	}
+}
+
+// concatKDF implements the Concat KDF (NIST SP 800-56A) as profiled by RFC 7518 section 4.6.2,
+// Encrypt sends no apu/apv header so it derives with empty PartyUInfo and PartyVInfo.
+func concatKDF(sharedSecret []byte, algorithmID string, partyUInfo []byte, partyVInfo []byte, keyDataLenBits int) []byte {
+	otherInfo := make([]byte, 0)
+	otherInfo = appendLengthPrefixed(otherInfo, []byte(algorithmID))
+	otherInfo = appendLengthPrefixed(otherInfo, partyUInfo)
+	otherInfo = appendLengthPrefixed(otherInfo, partyVInfo)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keyDataLenBits))
+
+	keyLen := keyDataLenBits / 8
+	derived := make([]byte, 0, keyLen+sha256.Size)
+	for counter := uint32(1); len(derived) < keyLen; counter++ {
+		h := sha256.New()
+		h.Write(binary.BigEndian.AppendUint32(nil, counter))
+		h.Write(sharedSecret)
+		h.Write(otherInfo)
+		derived = h.Sum(derived)
+	}
+	return derived[:keyLen]
+}
+
+func appendLengthPrefixed(dst []byte, data []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(data)))
+	return append(dst, data...)
+}
@@ -0,0 +1,195 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+)
+
+// decrypt is the recipient side of Encrypt written from RFC 7516 section 5.2 and RFC 7518
+// with the standard library only, it shares no code with Encrypt.
+func decrypt(t *testing.T, compact []byte, privateKey any) []byte {
+	t.Helper()
+	parts := strings.Split(string(compact), ".")
+	if len(parts) != 5 {
+		t.Fatalf("want 5 JWE parts, got %d", len(parts))
+	}
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("base64 decode error = %v", err)
+		}
+		return b
+	}
+	header := jweHeader{}
+	if err := json.Unmarshal(decode(parts[0]), &header); err != nil {
+		t.Fatalf("header unmarshal error = %v", err)
+	}
+
+	var cek []byte
+	switch KeyManagementAlgorithm(header.Alg) {
+	case RSAOAEP256:
+		var err error
+		cek, err = rsa.DecryptOAEP(sha256.New(), nil, privateKey.(*rsa.PrivateKey), decode(parts[1]), nil)
+		if err != nil {
+			t.Fatalf("DecryptOAEP() error = %v", err)
+		}
+	case ECDHES:
+		recipientKey, err := privateKey.(*ecdsa.PrivateKey).ECDH()
+		if err != nil {
+			t.Fatalf("ECDH() error = %v", err)
+		}
+		point := append([]byte{0x04}, decode(header.Epk.X)...)
+		point = append(point, decode(header.Epk.Y)...)
+		ephemeralKey, err := ecdh.P256().NewPublicKey(point)
+		if err != nil {
+			t.Fatalf("NewPublicKey() error = %v", err)
+		}
+		sharedSecret, err := recipientKey.ECDH(ephemeralKey)
+		if err != nil {
+			t.Fatalf("ECDH() error = %v", err)
+		}
+		// single round Concat KDF of RFC 7518 section 4.6.2, 256 bits are one SHA-256 block:
+		// SHA-256(counter 1 || Z || len(enc) || enc || len(apu) 0 || len(apv) 0 || keydatalen 256)
+		h := sha256.New()
+		h.Write([]byte{0, 0, 0, 1})
+		h.Write(sharedSecret)
+		h.Write([]byte{0, 0, 0, byte(len(header.Enc))})
+		h.Write([]byte(header.Enc))
+		h.Write([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0})
+		cek = h.Sum(nil)
+	default:
+		t.Fatalf("unexpected alg %s", header.Alg)
+	}
+
+	if header.Enc != string(A256GCM) || header.Cty != "JWT" {
+		t.Fatalf("header enc = %s, cty = %s, want A256GCM and JWT", header.Enc, header.Cty)
+	}
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, decode(parts[2]), append(decode(parts[3]), decode(parts[4])...), []byte(parts[0]))
+	if err != nil {
+		t.Fatalf("gcm.Open() error = %v", err)
+	}
+	return plaintext
+}
+
+func TestEncryptJWT(t *testing.T) {
+	rsaPrivateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	rsaKey, err := signing.NewRSASigningKeyFromPrivateKey(rsaPrivateKey)
+	if err != nil {
+		t.Fatalf("NewRSASigningKeyFromPrivateKey() error = %v", err)
+	}
+	ecKey, err := signing.NewSigningKeyHandlerFromRandom(signing.P256, true, "jwe")
+	if err != nil {
+		t.Fatalf("NewSigningKeyHandlerFromRandom() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		alg  KeyManagementAlgorithm
+		key  signing.SigningKeyHandler
+	}{
+		{name: "RSA-OAEP-256", alg: RSAOAEP256, key: rsaKey},
+		{name: "ECDH-ES", alg: ECDHES, key: ecKey},
+	}
+	payload := []byte("header.payload.signature")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwk := tt.key.GetJWK()
+			jwk.Use = "enc"
+			compact, err := EncryptJWT(payload, signing.JSONWebKeySet{Keys: []signing.JSONWebKey{jwk}}, tt.alg, A256GCM)
+			if err != nil {
+				t.Fatalf("EncryptJWT() error = %v", err)
+			}
+			if got := decrypt(t, compact, tt.key.GetKey()); string(got) != string(payload) {
+				t.Errorf("decrypted payload = %s, want %s", got, payload)
+			}
+		})
+	}
+}
+
+func TestEncryptRSAOAEP256UsesSHA256(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	key, err := signing.NewRSASigningKeyFromPrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("NewRSASigningKeyFromPrivateKey() error = %v", err)
+	}
+	compact, err := Encrypt([]byte("payload"), key.GetJWK(), RSAOAEP256, A256GCM, "")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	encryptedKey, err := base64.RawURLEncoding.DecodeString(strings.Split(string(compact), ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RSA-OAEP (RFC 7518 section 4.3) uses SHA-1, RSA-OAEP-256 SHA-256 for the hash and MGF1
+	if _, err := rsa.DecryptOAEP(sha1.New(), nil, privateKey, encryptedKey, nil); err == nil {
+		t.Errorf("encrypted key decrypts as RSA-OAEP (SHA-1)")
+	}
+	cek, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, encryptedKey, nil)
+	if err != nil {
+		t.Fatalf("DecryptOAEP(SHA-256) error = %v", err)
+	}
+	if len(cek) != 32 {
+		t.Errorf("CEK length = %d, want 32 for A256GCM", len(cek))
+	}
+}
+
+// TestConcatKDF checks the key agreement against the ECDH-ES example of RFC 7518 appendix C.
+func TestConcatKDF(t *testing.T) {
+	decode := func(s string) []byte {
+		t.Helper()
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	jwk := func(x, y, d string) *ecdh.PrivateKey {
+		t.Helper()
+		privateKey, err := ecdh.P256().NewPrivateKey(decode(d))
+		if err != nil {
+			t.Fatalf("NewPrivateKey() error = %v", err)
+		}
+		point := append(append([]byte{0x04}, decode(x)...), decode(y)...)
+		if string(privateKey.PublicKey().Bytes()) != string(point) {
+			t.Fatalf("d of the example key does not match x and y")
+		}
+		return privateKey
+	}
+	alice := jwk("gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0", "SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps", "0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo")
+	bob := jwk("weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ", "e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck", "VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw")
+
+	sharedSecret, err := alice.ECDH(bob.PublicKey())
+	if err != nil {
+		t.Fatalf("ECDH() error = %v", err)
+	}
+	wantSharedSecret := []byte{158, 86, 217, 29, 129, 113, 53, 211, 114, 131, 66, 131, 191, 132, 38, 156,
+		251, 49, 110, 163, 218, 128, 106, 72, 246, 218, 167, 121, 140, 254, 144, 196}
+	if string(sharedSecret) != string(wantSharedSecret) {
+		t.Fatalf("Z = %v, want %v", sharedSecret, wantSharedSecret)
+	}
+
+	derived := concatKDF(sharedSecret, "A128GCM", []byte("Alice"), []byte("Bob"), 128)
+	if got := base64.RawURLEncoding.EncodeToString(derived); got != "VqqN6vgjbSBcIijNcacQGg" {
+		t.Errorf("concatKDF() = %s, want VqqN6vgjbSBcIijNcacQGg", got)
+	}
+}
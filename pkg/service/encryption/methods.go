@@ -0,0 +1,25 @@
+package encryption
+
+type KeyManagementAlgorithm string
+type ContentEncryptionAlgorithm string
+
+const (
+	RSAOAEP256 KeyManagementAlgorithm = "RSA-OAEP-256"
+	ECDHES     KeyManagementAlgorithm = "ECDH-ES"
+)
+
+const (
+	A256GCM ContentEncryptionAlgorithm = "A256GCM"
+)
+
+// SupportedKeyManagementAlgorithms lists the JWE alg values that can be advertised in discovery.
+var SupportedKeyManagementAlgorithms = []string{string(RSAOAEP256), string(ECDHES)}
+
+// SupportedContentEncryptionAlgorithms lists the JWE enc values that can be advertised in discovery.
+var SupportedContentEncryptionAlgorithms = []string{string(A256GCM)}
+
+// keyTypeForAlgorithm maps the key management algorithm to the JWK kty it requires.
+var keyTypeForAlgorithm = map[KeyManagementAlgorithm]string{
+	RSAOAEP256: "RSA",
+	ECDHES:     "EC",
+}
@@ -0,0 +1,75 @@
+package signing
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"maps"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Deliberately broken signatures for negative testing of token validation.
+
+// SignWithUnknownKey signs the payload like Sign but with a throwaway key of the same type,
+// the kid of the header is not published in the JWKS
+func (s *signingService) SignWithUnknownKey(payload map[string]any) ([]byte, error) {
+	key, err := s.getActiveKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	signingMethod, err := toJWTSigningMethod(key.config.Method)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map signing method: %w", err)
+	}
+
+	s.unknownKeysMU.Lock()
+	unknownKey, ok := s.unknownKeys[key.handler.GetType()]
+	if !ok {
+		if unknownKey, err = NewSigningKeyHandlerFromRandom(key.handler.GetType(), false, ""); err != nil {
+			s.unknownKeysMU.Unlock()
+			return nil, fmt.Errorf("failed to generate unknown signing key: %w", err)
+		}
+		if s.unknownKeys == nil {
+			s.unknownKeys = make(map[KeyType]SigningKeyHandler)
+		}
+		s.unknownKeys[key.handler.GetType()] = unknownKey
+	}
+	s.unknownKeysMU.Unlock()
+
+	claims := jwt.MapClaims{}
+	maps.Copy(claims, payload)
+	token := jwt.NewWithClaims(signingMethod, claims)
+	token.Header["kid"] = unknownKey.GetID()
+
+	tokenString, err := token.SignedString(unknownKey.GetKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return []byte(tokenString), nil
+}
+
+// SignWithAlgMismatch signs the payload with HS256, the secret being the PEM encoded public key
+// of the active key, whose kid is set in the header (the algorithm confusion attack)
+func (s *signingService) SignWithAlgMismatch(payload map[string]any) ([]byte, error) {
+	key, err := s.getActiveKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(key.handler.GetPublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	secret := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+
+	claims := jwt.MapClaims{}
+	maps.Copy(claims, payload)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = key.handler.GetID()
+
+	tokenString, err := token.SignedString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return []byte(tokenString), nil
+}
@@ -97,6 +97,9 @@ func NewCertSigningKeyFromRandom(keyType KeyType, randReader io.Reader) (Signing
 	default:
 		return nil, fmt.Errorf("unsupported key type: %v", keyType)
 	}
+	if isDeterministic(randReader) {
+		return nil, errDeterministicRSA
+	}
 
 	privateKey, err := rsa.GenerateKey(randReader, keySize)
 	if err != nil {
@@ -171,6 +174,11 @@ func (kh *certSigningKey) GetPublicKey() any {
 	return &kh.certificate.PublicKey
 }
 
+// GetCertificate returns the X.509 certificate of the key
+func (kh *certSigningKey) GetCertificate() *x509.Certificate {
+	return kh.certificate
+}
+
 func (kh *certSigningKey) Save(paths ...string) error {
 	if len(paths) != 2 {
 		return errors.New("exactly two paths are required: certPath and keyPath")
@@ -64,6 +64,9 @@ func NewRSASigningKeyFromPrivateKey(privateKey *rsa.PrivateKey) (SigningKeyHandl
 
 func NewRSASigningKeyFromRandom(keyType KeyType, randReader io.Reader) (SigningKeyHandler, error) {
 	slog.Info("generating RSA key from random", "keyType", keyType)
+	if isDeterministic(randReader) {
+		return nil, errDeterministicRSA
+	}
 	kh := &rsaSigningKey{}
 	switch keyType {
 	case RSA256:
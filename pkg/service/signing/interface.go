@@ -1,5 +1,10 @@
 package signing
 
+import (
+	"crypto"
+	"crypto/x509"
+)
+
 type SigningKeyHandler interface {
 	GetID() string
 	GetKey() any
@@ -15,4 +20,14 @@ type SigningServicer interface {
 	Sign(payload map[string]any) ([]byte, error)
 	Valid(tokenBytes []byte) bool
 	SignWithMethod(payload map[string]any, method SigningMethod) ([]byte, error)
+	GetCertificateKey() (*x509.Certificate, crypto.Signer, error)
+	// SignWithUnknownKey and SignWithAlgMismatch produce invalid signatures for negative testing
+	SignWithUnknownKey(payload map[string]any) ([]byte, error)
+	SignWithAlgMismatch(payload map[string]any) ([]byte, error)
+
+	// runtime management (admin API) of the keys, a kid is the id of a key
+	GetKeys() []KeyInfo
+	AddKey(config SigningServiceKeyConfig) (KeyInfo, error)
+	SetKeyActive(kid string, active bool) error
+	DeleteKey(kid string) error
 }
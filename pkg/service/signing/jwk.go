@@ -1,8 +1,13 @@
 package signing
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"math/big"
 	"net/url"
 )
 
@@ -27,6 +32,55 @@ type JSONWebKeySet struct {
 	Keys []JSONWebKey `json:"keys"`
 }
 
+// PublicKey converts the JWK into *rsa.PublicKey or *ecdsa.PublicKey.
+func (k JSONWebKey) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		if k.N == nil || k.E == nil {
+			return nil, fmt.Errorf("RSA key %s is missing n or e", k.Kid)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(k.N.data),
+			E: int(new(big.Int).SetBytes(k.E.data).Int64()),
+		}, nil
+	case "EC":
+		if k.X == nil || k.Y == nil {
+			return nil, fmt.Errorf("EC key %s is missing x or y", k.Kid)
+		}
+		var curve elliptic.Curve
+		switch KeyType(k.Crv) {
+		case P256:
+			curve = elliptic.P256()
+		case P384:
+			curve = elliptic.P384()
+		case P521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(k.X.data),
+			Y:     new(big.Int).SetBytes(k.Y.data),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// Find returns the key with the given kid. An empty kid matches the only key of a single-key set.
+func (s JSONWebKeySet) Find(kid string) (JSONWebKey, bool) {
+	if kid == "" && len(s.Keys) == 1 {
+		return s.Keys[0], true
+	}
+	for _, k := range s.Keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return JSONWebKey{}, false
+}
+
 type byteBuffer struct {
 	data []byte
 }
@@ -35,6 +89,19 @@ func (b *byteBuffer) MarshalJSON() ([]byte, error) {
 	return json.Marshal(b.base64())
 }
 
+func (b *byteBuffer) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	b.data = decoded
+	return nil
+}
+
 func (b *byteBuffer) base64() string {
 	return base64.RawURLEncoding.EncodeToString(b.data)
 }
@@ -0,0 +1,114 @@
+package signing
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+)
+
+// KeyInfo describes a key of the signing service
+type KeyInfo struct {
+	Kid    string        `json:"kid"`
+	Type   KeyType       `json:"type"`
+	Method SigningMethod `json:"method"`
+	Active bool          `json:"active"`
+}
+
+func (k signingServiceKey) info() KeyInfo {
+	return KeyInfo{Kid: k.handler.GetID(), Type: k.handler.GetType(), Method: k.config.Method, Active: k.config.Active}
+}
+
+func (s *signingService) GetKeys() []KeyInfo {
+	keys := s.currentKeys()
+	infos := make([]KeyInfo, len(keys))
+	for i, k := range keys {
+		infos[i] = k.info()
+	}
+	return infos
+}
+
+// AddKey initializes the key of the config (the entry of the signing.keys section) and adds it,
+// the key is published in the JWKS right away
+func (s *signingService) AddKey(config SigningServiceKeyConfig) (KeyInfo, error) {
+	if config.Provider == nil {
+		return KeyInfo{}, errs.New("missing key provider", errs.ErrInvalidArgument)
+	}
+	handler, err := config.Provider.Init()
+	if err != nil {
+		return KeyInfo{}, errs.New(fmt.Sprintf("failed to initialize signing key: %v", err), errs.ErrInvalidArgument)
+	}
+	if !slices.Contains(KeyTypeSigningMethodCompatibility[handler.GetType()], config.Method) {
+		return KeyInfo{}, errs.New(fmt.Sprintf("method '%s' can not be used with %s keys", config.Method, handler.GetType()), errs.ErrInvalidArgument)
+	}
+	key := signingServiceKey{config: config, handler: handler}
+
+	s.keysMU.Lock()
+	defer s.keysMU.Unlock()
+	if slices.ContainsFunc(s.keys, func(k signingServiceKey) bool { return k.handler.GetID() == handler.GetID() }) {
+		return KeyInfo{}, errs.New(fmt.Sprintf("key '%s' already exists", handler.GetID()), errs.ErrAlreadyExists)
+	}
+	s.keys = append(slices.Clone(s.keys), key)
+	s.changed[handler.GetID()] = true
+	return key.info(), nil
+}
+
+// SetKeyActive switches signing with the key on or off, inactive keys stay in the JWKS
+func (s *signingService) SetKeyActive(kid string, active bool) error {
+	s.keysMU.Lock()
+	defer s.keysMU.Unlock()
+	i := s.keyIndex(kid)
+	if i < 0 {
+		return errs.New(fmt.Sprintf("key '%s' not found", kid), errs.ErrNotFound)
+	}
+	keys := slices.Clone(s.keys)
+	keys[i].config.Active = active
+	s.keys = keys
+	s.changed[kid] = true
+	return nil
+}
+
+// DeleteKey removes the key, tokens signed with it no longer validate
+func (s *signingService) DeleteKey(kid string) error {
+	s.keysMU.Lock()
+	defer s.keysMU.Unlock()
+	i := s.keyIndex(kid)
+	if i < 0 {
+		return errs.New(fmt.Sprintf("key '%s' not found", kid), errs.ErrNotFound)
+	}
+	s.keys = slices.Delete(slices.Clone(s.keys), i, i+1)
+	s.changed[kid] = true
+	return nil
+}
+
+// KeepRuntimeChanges carries the keys added, switched on or off or deleted at runtime over from
+// previous (the service of the config before a reload), they win over the config
+func (s *signingService) KeepRuntimeChanges(previous SigningServicer) {
+	p, ok := previous.(*signingService)
+	if !ok || p == s {
+		return
+	}
+	p.keysMU.RLock()
+	defer p.keysMU.RUnlock()
+	s.keysMU.Lock()
+	defer s.keysMU.Unlock()
+	keys := slices.Clone(s.keys)
+	for kid := range p.changed {
+		i := slices.IndexFunc(keys, func(k signingServiceKey) bool { return k.handler.GetID() == kid })
+		j := p.keyIndex(kid)
+		switch {
+		case j >= 0 && i >= 0:
+			keys[i] = p.keys[j]
+		case j >= 0:
+			keys = append(keys, p.keys[j])
+		case i >= 0:
+			keys = slices.Delete(keys, i, i+1)
+		}
+		s.changed[kid] = true
+	}
+	s.keys = keys
+}
+
+func (s *signingService) keyIndex(kid string) int {
+	return slices.IndexFunc(s.keys, func(k signingServiceKey) bool { return k.handler.GetID() == kid })
+}
@@ -3,9 +3,13 @@ package signing
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"io"
 )
 
+// errDeterministicRSA is returned for RSA keys from a deterministic reader, its 32-byte cycle never yields a prime
+var errDeterministicRSA = errors.New("RSA keys cannot be generated deterministically, use a PEM key or an EC key")
+
 func NewRandReader(deterministic bool, seed string) io.Reader {
 	if deterministic {
 		return newDeterministicReader(seed)
@@ -37,3 +41,8 @@ func (r *deterministicReader) Read(p []byte) (int, error) {
 	}
 	return n, nil
 }
+
+func isDeterministic(r io.Reader) bool {
+	_, ok := r.(*deterministicReader)
+	return ok
+}
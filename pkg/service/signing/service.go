@@ -1,20 +1,30 @@
 package signing
 
 import (
+	"crypto"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"maps"
 	"os"
+	"sync"
 
-	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type signingService struct {
 	// here we need configuration (and below the implementation) of the key rotation (roundrobin, ...)
-	keys []signingServiceKey
+	// the slice is replaced (never changed in place) when keys are managed at runtime
+	keys    []signingServiceKey
+	changed map[string]bool // kids of the keys added, switched or deleted at runtime
+	keysMU  sync.RWMutex
+
+	// throwaway keys of SignWithUnknownKey (by type)
+	unknownKeysMU sync.Mutex
+	unknownKeys   map[KeyType]SigningKeyHandler
 }
 
 type signingServiceKey struct {
@@ -23,6 +33,15 @@ type signingServiceKey struct {
 }
 
 func NewSigningService(jsonFilepath string) (SigningServicer, error) {
+	data, err := os.ReadFile(jsonFilepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing config file: %w", err)
+	}
+	return NewFromConfig(data)
+}
+
+// NewFromConfig builds the signing service from the signing section of the raw config
+func NewFromConfig(rawConfig []byte) (SigningServicer, error) {
 	type jsonConfigStruct struct {
 		Signing struct {
 			Keys []SigningServiceKeyConfig `json:"keys"`
@@ -30,32 +49,36 @@ func NewSigningService(jsonFilepath string) (SigningServicer, error) {
 	}
 	f := jsonConfigStruct{}
 
-	data, err := os.ReadFile(jsonFilepath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read signing config file: %w", err)
-	}
-
-	if err := json.Unmarshal(data, &f); err != nil {
+	if err := json.Unmarshal(rawConfig, &f); err != nil {
 		return nil, fmt.Errorf("failed to parse signing config file: %w", err)
 	}
 
-	s := &signingService{}
+	s := &signingService{changed: make(map[string]bool)}
 
 	for _, keyConfig := range f.Signing.Keys {
 		signingKey, err := keyConfig.Provider.Init()
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize signing key: %w", err)
 		}
+		// the kid is derived from the key, the JWKS could not tell the methods of one key apart
+		if i := s.keyIndex(signingKey.GetID()); i >= 0 {
+			return nil, fmt.Errorf("signing key '%s' is configured for %s and %s, a key can be used with one method only", signingKey.GetID(), s.keys[i].config.Method, keyConfig.Method)
+		}
 		s.keys = append(s.keys, signingServiceKey{config: keyConfig, handler: signingKey})
 	}
 
-	di.Register(s)
-
 	return s, nil
 }
 
+// currentKeys returns the keys, safe to iterate while keys are added or removed
+func (s *signingService) currentKeys() []signingServiceKey {
+	s.keysMU.RLock()
+	defer s.keysMU.RUnlock()
+	return s.keys
+}
+
 func (s *signingService) getActiveKey() (signingServiceKey, error) {
-	for _, k := range s.keys {
+	for _, k := range s.currentKeys() {
 		if k.config.Active {
 			return k, nil
 		}
@@ -65,7 +88,7 @@ func (s *signingService) getActiveKey() (signingServiceKey, error) {
 }
 
 func (s *signingService) getActiveKeyByMethod(method SigningMethod) (signingServiceKey, error) {
-	for _, k := range s.keys {
+	for _, k := range s.currentKeys() {
 		if k.config.Active && k.config.Method == method {
 			return k, nil
 		}
@@ -73,12 +96,36 @@ func (s *signingService) getActiveKeyByMethod(method SigningMethod) (signingServ
 	return signingServiceKey{}, fmt.Errorf("no active signing key for method: %s", method)
 }
 
+// GetCertificateKey returns a certificate-backed key (see certSigningKey) for XML signatures,
+// active keys are preferred
+func (s *signingService) GetCertificateKey() (*x509.Certificate, crypto.Signer, error) {
+	var found *signingServiceKey
+	keys := s.currentKeys()
+	for i, k := range keys {
+		if _, ok := k.handler.(interface{ GetCertificate() *x509.Certificate }); !ok {
+			continue
+		}
+		if found == nil || (k.config.Active && !found.config.Active) {
+			found = &keys[i]
+		}
+	}
+	if found == nil {
+		return nil, nil, errors.New("no certificate signing key")
+	}
+	signer, ok := found.handler.GetKey().(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("certificate signing key can not sign")
+	}
+	return found.handler.(interface{ GetCertificate() *x509.Certificate }).GetCertificate(), signer, nil
+}
+
 func (s *signingService) GetJWKS() ([]byte, error) {
+	keys := s.currentKeys()
 	jwks := JSONWebKeySet{
-		Keys: make([]JSONWebKey, len(s.keys)),
+		Keys: make([]JSONWebKey, len(keys)),
 	}
 
-	for i, k := range s.keys {
+	for i, k := range keys {
 		jwks.Keys[i] = k.handler.GetJWK()
 		jwks.Keys[i].Alg = string(k.config.Method)
 	}
@@ -87,8 +134,9 @@ func (s *signingService) GetJWKS() ([]byte, error) {
 }
 
 func (s *signingService) GetSigningMethods() []string {
-	methods := make([]string, len(s.keys))
-	for i, k := range s.keys {
+	keys := s.currentKeys()
+	methods := make([]string, len(keys))
+	for i, k := range keys {
 		methods[i] = string(k.config.Method)
 	}
 	return methods
@@ -120,14 +168,14 @@ func (s *signingService) Sign(payload map[string]any) ([]byte, error) {
 
 func (s *signingService) Valid(tokenBytes []byte) bool {
 	tokenString := string(tokenBytes)
-	for _, key := range s.keys {
+	for _, key := range s.currentKeys() {
 		if !key.config.Active {
 			continue
 		}
 
 		parsedToken, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			return key.handler.GetPublicKey(), nil
-		})
+		}, jwt.WithTimeFunc(clock.Now))
 		if err == nil && parsedToken != nil && parsedToken.Valid {
 			return true
 		}
@@ -0,0 +1,55 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewFromConfigRejectsDuplicateKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyConfig := func(method string) string {
+		return fmt.Sprintf(`{"provider": {"fromPEM": {"path": %q}}, "method": %q, "active": true}`, path, method)
+	}
+
+	if _, err := NewFromConfig([]byte(`{"signing": {"keys": [` + keyConfig("ES256") + `]}}`)); err != nil {
+		t.Fatalf("NewFromConfig() error = %v", err)
+	}
+	if _, err := NewFromConfig([]byte(`{"signing": {"keys": [` + keyConfig("ES256") + `, ` + keyConfig("ES384") + `]}}`)); err == nil {
+		t.Error("NewFromConfig() accepted one key for two methods, want an error")
+	}
+}
+
+func TestNewFromConfigRejectsDeterministicRSA(t *testing.T) {
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewFromConfig([]byte(`{"signing": {"keys": [{"provider": {"fromRandom": {"type": "RSA256", "deterministic": true, "seed": "ps256"}}, "method": "PS256", "active": true}]}}`))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("NewFromConfig() error = nil, want the deterministic RSA key rejected")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("NewFromConfig() did not return in 10s")
+	}
+}
@@ -0,0 +1,48 @@
+package signing
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// VerifyWithJWKS parses the JWT and verifies its signature against the public keys of the given key set.
+// Unsigned tokens (alg "none") are accepted only when allowUnsigned is true.
+func VerifyWithJWKS(tokenString string, jwks JSONWebKeySet, allowUnsigned bool) (jwt.MapClaims, error) {
+	validMethods := SupportedVerificationMethods(allowUnsigned)
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method == jwt.SigningMethodNone {
+			return jwt.UnsafeAllowNoneSignatureType, nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		jwk, ok := jwks.Find(kid)
+		if !ok {
+			return nil, fmt.Errorf("no key with kid '%s'", kid)
+		}
+		if jwk.Alg != "" && jwk.Alg != token.Method.Alg() {
+			return nil, fmt.Errorf("key '%s' does not allow alg %s", kid, token.Method.Alg())
+		}
+		return jwk.PublicKey()
+	}, jwt.WithValidMethods(validMethods), jwt.WithTimeFunc(clock.Now))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// SupportedVerificationMethods returns the JWS algorithms accepted by VerifyWithJWKS.
+func SupportedVerificationMethods(allowUnsigned bool) []string {
+	methods := make([]string, 0, len(SigningMethodKeyTypeCompatibility)+1)
+	for method := range SigningMethodKeyTypeCompatibility {
+		methods = append(methods, string(method))
+	}
+	slices.Sort(methods)
+	if allowUnsigned {
+		methods = append(methods, jwt.SigningMethodNone.Alg())
+	}
+	return methods
+}
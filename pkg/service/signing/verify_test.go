@@ -0,0 +1,85 @@
+package signing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestVerifyWithJWKS(t *testing.T) {
+	key, err := NewSigningKeyHandlerFromRandom(P256, true, "verify")
+	if err != nil {
+		t.Fatalf("NewSigningKeyHandlerFromRandom() error = %v", err)
+	}
+	otherKey, err := NewSigningKeyHandlerFromRandom(P256, true, "other")
+	if err != nil {
+		t.Fatalf("NewSigningKeyHandlerFromRandom() error = %v", err)
+	}
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{key.GetJWK()}}
+
+	sign := func(k SigningKeyHandler) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"client_id": "ACME"})
+		token.Header["kid"] = k.GetID()
+		signed, err := token.SignedString(k.GetKey())
+		if err != nil {
+			t.Fatalf("SignedString() error = %v", err)
+		}
+		return signed
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"client_id": "ACME"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		allowUnsigned bool
+		wantErr       bool
+	}{
+		{name: "signed with registered key", token: sign(key), wantErr: false},
+		{name: "signed with unknown key", token: sign(otherKey), wantErr: true},
+		{name: "unsigned allowed", token: unsigned, allowUnsigned: true, wantErr: false},
+		{name: "unsigned not allowed", token: unsigned, allowUnsigned: false, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := VerifyWithJWKS(tt.token, jwks, tt.allowUnsigned)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyWithJWKS() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && claims["client_id"] != "ACME" {
+				t.Errorf("VerifyWithJWKS() client_id = %v, want ACME", claims["client_id"])
+			}
+		})
+	}
+}
+
+func TestVerifyWithJWKSUsesClock(t *testing.T) {
+	key, err := NewSigningKeyHandlerFromRandom(P256, true, "verify")
+	if err != nil {
+		t.Fatalf("NewSigningKeyHandlerFromRandom() error = %v", err)
+	}
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{key.GetJWK()}}
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock.Default.Set(start)
+	defer clock.Default.Reset()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"client_id": "ACME", "nbf": start.Unix(), "exp": start.Add(time.Minute).Unix()})
+	token.Header["kid"] = key.GetID()
+	signed, err := token.SignedString(key.GetKey())
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	if _, err := VerifyWithJWKS(signed, jwks, false); err != nil {
+		t.Errorf("VerifyWithJWKS() at the virtual time error = %v", err)
+	}
+	clock.Default.Set(start.Add(2 * time.Minute))
+	if _, err := VerifyWithJWKS(signed, jwks, false); err == nil {
+		t.Error("VerifyWithJWKS() accepted a token expired by the virtual clock")
+	}
+}
@@ -0,0 +1,110 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms (RFC 9053) of the supported credentials
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms are offered to the authenticators in order of preference
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters
+const (
+	coseKeyType      = 1
+	coseKeyAlgorithm = 3
+	coseKeyCurve     = -1 // EC2 and OKP
+	coseKeyX         = -2 // EC2 and OKP
+	coseKeyY         = -3 // EC2
+	coseKeyN         = -1 // RSA
+	coseKeyE         = -2 // RSA
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// ParsePublicKey returns the public key and the algorithm of a COSE_Key encoded credential public key
+func ParsePublicKey(coseKey []byte) (crypto.PublicKey, int64, error) {
+	item, rest, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, 0, errors.New("invalid credential public key: trailing data")
+	}
+	key, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, errors.New("invalid credential public key: not a map")
+	}
+	keyType, _ := key[int64(coseKeyType)].(int64)
+	alg, _ := key[int64(coseKeyAlgorithm)].(int64)
+
+	switch {
+	case keyType == coseKeyTypeEC2 && alg == AlgES256:
+		curve, _ := key[int64(coseKeyCurve)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		y, _ := key[int64(coseKeyY)].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, 0, errors.New("invalid credential public key: unsupported EC2 key")
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, 0, errors.New("invalid credential public key: point is not on the curve")
+		}
+		return publicKey, alg, nil
+	case keyType == coseKeyTypeOKP && alg == AlgEdDSA:
+		curve, _ := key[int64(coseKeyCurve)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, 0, errors.New("invalid credential public key: unsupported OKP key")
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case keyType == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := key[int64(coseKeyN)].([]byte)
+		e, _ := key[int64(coseKeyE)].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, 0, errors.New("invalid credential public key: unsupported RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, alg, nil
+	default:
+		return nil, 0, fmt.Errorf("invalid credential public key: unsupported key type %d with algorithm %d", keyType, alg)
+	}
+}
+
+// verifySignature checks the signature of data made with the private key of publicKey using alg
+func verifySignature(publicKey crypto.PublicKey, alg int64, data []byte, signature []byte) error {
+	digest := sha256.Sum256(data)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if alg == AlgES256 && ecdsa.VerifyASN1(key, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if alg == AlgEdDSA && ed25519.Verify(key, data, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if alg == AlgRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
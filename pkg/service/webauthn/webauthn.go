@@ -0,0 +1,243 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+const challengeSize = 32
+
+// Encoding is the base64url encoding WebAuthn uses for binary values in JSON
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty identifies the server towards the authenticators
+type RelyingParty struct {
+	ID      string   // effective domain the credentials are scoped to, e.g. localhost
+	Name    string   // shown by the authenticator
+	Origins []string // accepted origins of the client data, e.g. http://localhost:8222
+}
+
+// Credential is a public key credential verified by the registration ceremony
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte // COSE_Key
+	Algorithm    int64
+	SignCount    uint32
+	UserVerified bool
+}
+
+// Assertion is the result of the authentication ceremony
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash            []byte
+	flags               byte
+	signCount           uint32
+	credentialID        []byte
+	credentialPublicKey []byte
+}
+
+// NewChallenge returns a random base64url encoded challenge
+func NewChallenge() (string, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return Encoding.EncodeToString(challenge), nil
+}
+
+// VerifyRegistration verifies the response of navigator.credentials.create() to the challenge
+// and returns the new credential. Attestation statements are verified for the none and packed
+// formats, other formats are accepted without verification as the server does not request attestation.
+func VerifyRegistration(rp RelyingParty, challenge string, clientDataJSON []byte, attestationObject []byte) (*Credential, error) {
+	if err := verifyClientData(rp, "webauthn.create", challenge, clientDataJSON); err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyAuthenticatorData(rp, authData); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return nil, errors.New("invalid authenticator data: missing attested credential data")
+	}
+	publicKey, alg, err := ParsePublicKey(authData.credentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(slices.Clone(rawAuthData), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return nil, errors.New("invalid attestation: none with a statement")
+		}
+	case "packed":
+		statementAlg, _ := statement["alg"].(int64)
+		signature, _ := statement["sig"].([]byte)
+		if chain, ok := statement["x5c"].([]interface{}); ok && len(chain) > 0 {
+			// basic attestation, the chain is not validated against trust anchors
+			raw, _ := chain[0].([]byte)
+			certificate, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid attestation certificate: %w", err)
+			}
+			if err := verifySignature(certificate.PublicKey, statementAlg, signed, signature); err != nil {
+				return nil, fmt.Errorf("invalid attestation: %w", err)
+			}
+		} else {
+			// self attestation
+			if statementAlg != alg {
+				return nil, errors.New("invalid attestation: algorithm mismatch")
+			}
+			if err := verifySignature(publicKey, alg, signed, signature); err != nil {
+				return nil, fmt.Errorf("invalid attestation: %w", err)
+			}
+		}
+	case "":
+		return nil, errors.New("invalid attestation object: missing format")
+	}
+
+	return &Credential{
+		ID:           authData.credentialID,
+		PublicKey:    authData.credentialPublicKey,
+		Algorithm:    alg,
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion verifies the response of navigator.credentials.get() to the challenge against the
+// public key (COSE_Key) and the last sign count of the credential. A sign count which does not increase
+// indicates a cloned authenticator, authenticators without a counter always report zero.
+func VerifyAssertion(rp RelyingParty, challenge string, publicKey []byte, signCount uint32, clientDataJSON []byte, rawAuthData []byte, signature []byte) (*Assertion, error) {
+	if err := verifyClientData(rp, "webauthn.get", challenge, clientDataJSON); err != nil {
+		return nil, err
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyAuthenticatorData(rp, authData); err != nil {
+		return nil, err
+	}
+
+	key, alg, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if err := verifySignature(key, alg, append(slices.Clone(rawAuthData), clientDataHash[:]...), signature); err != nil {
+		return nil, err
+	}
+
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return nil, errors.New("invalid assertion: sign count did not increase")
+	}
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+func verifyClientData(rp RelyingParty, ceremony string, challenge string, clientDataJSON []byte) error {
+	data := clientData{}
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("invalid client data: %w", err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("invalid client data: unexpected type '%s'", data.Type)
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return errors.New("invalid client data: challenge mismatch")
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return fmt.Errorf("invalid client data: unexpected origin '%s'", data.Origin)
+	}
+	return nil
+}
+
+func verifyAuthenticatorData(rp RelyingParty, authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return errors.New("invalid authenticator data: relying party mismatch")
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return errors.New("invalid authenticator data: user not present")
+	}
+	return nil
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("invalid authenticator data: too short")
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagAttested == 0 {
+		return authData, nil
+	}
+
+	// attested credential data: AAGUID (16), credential id length (2), credential id, COSE_Key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errors.New("invalid authenticator data: truncated credential data")
+	}
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, errors.New("invalid authenticator data: truncated credential id")
+	}
+	authData.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+	_, extensions, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authenticator data: %w", err)
+	}
+	authData.credentialPublicKey = rest[:len(rest)-len(extensions)]
+	return authData, nil
+}
@@ -0,0 +1,70 @@
+package webauthn_test
+
+import (
+	"testing"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/webauthn"
+	"github.com/axent-pl/oauth2mock/pkg/service/webauthn/webauthntest"
+)
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	rp := webauthn.RelyingParty{ID: "localhost", Origins: []string{"http://localhost:8222"}}
+	authenticator := webauthntest.NewAuthenticator("http://localhost:8222")
+	authenticator.SignCount = 1
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration, err := authenticator.Create(rp.ID, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := webauthn.VerifyRegistration(rp, challenge, registration.ClientDataJSON, registration.AttestationObject)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() error = %v", err)
+	}
+	if string(credential.ID) != string(registration.CredentialID) || credential.Algorithm != webauthn.AlgES256 || !credential.UserVerified {
+		t.Errorf("VerifyRegistration() credential = %+v", credential)
+	}
+	if _, err := webauthn.VerifyRegistration(rp, "other-challenge", registration.ClientDataJSON, registration.AttestationObject); err == nil {
+		t.Errorf("VerifyRegistration() accepted a challenge mismatch")
+	}
+
+	tests := []struct {
+		name      string
+		rpID      string
+		origin    string
+		signCount uint32
+		wantErr   bool
+	}{
+		{"valid", rp.ID, "http://localhost:8222", 0, false},
+		{"other relying party", "example.com", "http://localhost:8222", 0, true},
+		{"other origin", rp.ID, "http://evil.test", 0, true},
+		{"cloned authenticator", rp.ID, "http://localhost:8222", 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator.Origin = tt.origin
+			challenge, _ := webauthn.NewChallenge()
+			login, err := authenticator.Get(tt.rpID, registration.CredentialID, []byte("demo"), challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertion, err := webauthn.VerifyAssertion(rp, challenge, credential.PublicKey, tt.signCount, login.ClientDataJSON, login.AuthenticatorData, login.Signature)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyAssertion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && assertion.SignCount != authenticator.SignCount {
+				t.Errorf("VerifyAssertion() sign count = %d, want %d", assertion.SignCount, authenticator.SignCount)
+			}
+		})
+	}
+
+	authenticator.Origin = "http://localhost:8222"
+	login, _ := authenticator.Get(rp.ID, registration.CredentialID, nil, challenge)
+	login.Signature[len(login.Signature)-1] ^= 0xff
+	if _, err := webauthn.VerifyAssertion(rp, challenge, credential.PublicKey, 0, login.ClientDataJSON, login.AuthenticatorData, login.Signature); err == nil {
+		t.Errorf("VerifyAssertion() accepted an invalid signature")
+	}
+}
@@ -0,0 +1,208 @@
+// Package webauthntest provides a software authenticator for tests of WebAuthn relying parties.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Authenticator is a software authenticator with ES256 credentials and "none" attestation,
+// it produces the responses a browser returns from navigator.credentials.create() and get()
+type Authenticator struct {
+	Origin       string // origin of the client data
+	UserVerified bool   // sets the UV flag (e.g. a PIN or biometrics were checked)
+	SignCount    uint32 // incremented by every assertion, a zero counter stays zero
+
+	keys map[string]*ecdsa.PrivateKey
+}
+
+// Registration is the response of a registration ceremony (AuthenticatorAttestationResponse)
+type Registration struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// Login is the response of an authentication ceremony (AuthenticatorAssertionResponse)
+type Login struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
+
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerified: true, keys: make(map[string]*ecdsa.PrivateKey)}
+}
+
+// Create registers a new credential for the relying party rpID in response to the challenge
+func (a *Authenticator) Create(rpID string, challenge string) (*Registration, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+	a.keys[string(credentialID)] = key
+
+	coseKey := encode(map[interface{}]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: key.X.FillBytes(make([]byte, 32)),
+		-3: key.Y.FillBytes(make([]byte, 32)),
+	})
+	credentialData := make([]byte, 18, 18+len(credentialID)+len(coseKey))
+	binary.BigEndian.PutUint16(credentialData[16:], uint16(len(credentialID)))
+	credentialData = append(append(credentialData, credentialID...), coseKey...)
+
+	return &Registration{
+		CredentialID:   credentialID,
+		ClientDataJSON: a.clientData("webauthn.create", challenge),
+		AttestationObject: encode(map[interface{}]interface{}{
+			"fmt":      "none",
+			"attStmt":  map[interface{}]interface{}{},
+			"authData": a.authenticatorData(rpID, 0x40, 0, credentialData),
+		}),
+	}, nil
+}
+
+// Get signs the challenge with the credential for the relying party rpID
+func (a *Authenticator) Get(rpID string, credentialID []byte, userHandle []byte, challenge string) (*Login, error) {
+	key, ok := a.keys[string(credentialID)]
+	if !ok {
+		return nil, fmt.Errorf("unknown credential")
+	}
+	if a.SignCount > 0 {
+		a.SignCount++
+	}
+	clientDataJSON := a.clientData("webauthn.get", challenge)
+	authData := a.authenticatorData(rpID, 0, a.SignCount, nil)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	return &Login{
+		CredentialID:      credentialID,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+		UserHandle:        userHandle,
+	}, nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge string) []byte {
+	clientData, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return clientData
+}
+
+func (a *Authenticator) authenticatorData(rpID string, flags byte, signCount uint32, credentialData []byte) []byte {
+	flags |= 0x01 // user present
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], signCount)
+	return append(data, credentialData...)
+}
+
+// JSON returns the registration as serialized by PublicKeyCredential.toJSON()
+func (r *Registration) JSON() []byte {
+	id := base64.RawURLEncoding.EncodeToString(r.CredentialID)
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(r.ClientDataJSON),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(r.AttestationObject),
+		},
+	})
+	return body
+}
+
+// JSON returns the login as serialized by PublicKeyCredential.toJSON()
+func (l *Login) JSON() []byte {
+	id := base64.RawURLEncoding.EncodeToString(l.CredentialID)
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(l.ClientDataJSON),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(l.AuthenticatorData),
+			"signature":         base64.RawURLEncoding.EncodeToString(l.Signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(l.UserHandle),
+		},
+	})
+	return body
+}
+
+// encode serializes v as CBOR, map keys are sorted canonically (CTAP2)
+func encode(v interface{}) []byte {
+	switch value := v.(type) {
+	case int:
+		if value < 0 {
+			return encodeHead(1, uint64(-1-value))
+		}
+		return encodeHead(0, uint64(value))
+	case []byte:
+		return append(encodeHead(2, uint64(len(value))), value...)
+	case string:
+		return append(encodeHead(3, uint64(len(value))), value...)
+	case map[interface{}]interface{}:
+		keys := make([][]byte, 0, len(value))
+		encoded := make(map[string][]byte, len(value))
+		for key, item := range value {
+			encodedKey := encode(key)
+			keys = append(keys, encodedKey)
+			encoded[string(encodedKey)] = encode(item)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return string(keys[i]) < string(keys[j])
+		})
+		data := encodeHead(5, uint64(len(value)))
+		for _, key := range keys {
+			data = append(append(data, key...), encoded[string(key)]...)
+		}
+		return data
+	default:
+		panic(fmt.Sprintf("webauthntest: cannot encode %T", v))
+	}
+}
+
+func encodeHead(major byte, argument uint64) []byte {
+	switch {
+	case argument < 24:
+		return []byte{major<<5 | byte(argument)}
+	case argument <= 0xff:
+		return []byte{major<<5 | 24, byte(argument)}
+	case argument <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(argument))
+	case argument <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(argument))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, argument)
+	}
+}
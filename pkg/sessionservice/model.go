@@ -1,5 +1,10 @@
 package sessionservice
 
+import (
+	"encoding/json"
+	"sync"
+)
+
 // SessionData represents arbitrary key-value pairs stored in a session.
 // Use a map of string to interface{} to allow any type of value.
 //
@@ -10,3 +15,36 @@ package sessionservice
 // Note: Values stored in SessionData should be serializable if the
 // backing store requires persistence across process restarts.
 type SessionData map[string]any
+
+// ValueDecoder restores a session value from its JSON form
+type ValueDecoder func(json.RawMessage) (any, error)
+
+var (
+	valueDecodersMU sync.RWMutex
+	valueDecoders   = map[string]ValueDecoder{}
+)
+
+// RegisterValue declares how the values stored under the session key are restored from a snapshot.
+// Values of other keys come back as decoded by encoding/json (strings, float64, maps).
+func RegisterValue(key string, decode ValueDecoder) {
+	valueDecodersMU.Lock()
+	defer valueDecodersMU.Unlock()
+	valueDecoders[key] = decode
+}
+
+// DecodeAs is the ValueDecoder of values of type T
+func DecodeAs[T any](raw json.RawMessage) (any, error) {
+	var value T
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+func decodeValue(key string, raw json.RawMessage) (any, error) {
+	valueDecodersMU.RLock()
+	decode, ok := valueDecoders[key]
+	valueDecodersMU.RUnlock()
+	if !ok {
+		decode = DecodeAs[any]
+	}
+	return decode(raw)
+}
@@ -2,18 +2,22 @@ package sessionservice
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
-	"github.com/axent-pl/oauth2mock/pkg/di"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
 )
 
 // sessionMemoryService is an in-memory implementation of SessionService.
 // It uses a sync.RWMutex to allow concurrent safe access to the session data.
+// Sessions not used for ttl (when set) expire.
 type sessionMemoryService struct {
-	dataMU sync.RWMutex
-	data   map[string]SessionData
-	ttl    time.Duration
+	dataMU   sync.RWMutex
+	data     map[string]SessionData
+	lastUsed map[string]time.Time
+	ttl      time.Duration
 }
 
 type sessionMemoryServiceConfig struct {
@@ -29,12 +33,11 @@ func NewSessionMemoryServiceFromConfig(rawConfig json.RawMessage) (Service, erro
 		return nil, err
 	}
 	s := &sessionMemoryService{
-		data: make(map[string]SessionData),
-		ttl:  time.Second * time.Duration(config.Config.TTLSeconds),
+		data:     make(map[string]SessionData),
+		lastUsed: make(map[string]time.Time),
+		ttl:      time.Second * time.Duration(config.Config.TTLSeconds),
 	}
 
-	di.Register(s)
-
 	return s, nil
 }
 
@@ -46,19 +49,29 @@ func NewSessionMemoryServiceFromConfig(rawConfig json.RawMessage) (Service, erro
 // implementations (for example, if initialization fails).
 func NewSessionMemoryService() (Service, error) {
 	s := &sessionMemoryService{
-		data: make(map[string]SessionData),
+		data:     make(map[string]SessionData),
+		lastUsed: make(map[string]time.Time),
 	}
-	di.Register(s)
 	return s, nil
 }
 
 // Get retrieves the session data for the specified sessionID.
-// If the sessionID does not exist, the returned boolean is false.
+// If the sessionID does not exist or has expired, the returned boolean is false.
 func (s *sessionMemoryService) Get(sessionID string) (SessionData, bool) {
-	s.dataMU.RLock()
-	defer s.dataMU.RUnlock()
+	s.dataMU.Lock()
+	defer s.dataMU.Unlock()
 	d, ok := s.data[sessionID]
-	return d, ok
+	if !ok {
+		return nil, false
+	}
+	now := clock.Now()
+	if s.ttl > 0 && now.After(s.lastUsed[sessionID].Add(s.ttl)) {
+		delete(s.data, sessionID)
+		delete(s.lastUsed, sessionID)
+		return nil, false
+	}
+	s.lastUsed[sessionID] = now
+	return d, true
 }
 
 // Put stores or updates the session data for the specified sessionID.
@@ -67,6 +80,70 @@ func (s *sessionMemoryService) Put(sessionID string, data SessionData) {
 	s.dataMU.Lock()
 	defer s.dataMU.Unlock()
 	s.data[sessionID] = data
+	s.lastUsed[sessionID] = clock.Now()
+}
+
+// sessionSnapshot is the serialized form of a session, see RegisterValue
+type sessionSnapshot struct {
+	LastUsed time.Time                  `json:"lastUsed"`
+	Data     map[string]json.RawMessage `json:"data"`
+}
+
+// Reset drops all sessions
+func (s *sessionMemoryService) Reset() error {
+	s.dataMU.Lock()
+	defer s.dataMU.Unlock()
+	s.data = make(map[string]SessionData)
+	s.lastUsed = make(map[string]time.Time)
+	return nil
+}
+
+// Snapshot returns the sessions by session id
+func (s *sessionMemoryService) Snapshot() (json.RawMessage, error) {
+	s.dataMU.RLock()
+	defer s.dataMU.RUnlock()
+	snapshot := make(map[string]sessionSnapshot, len(s.data))
+	for sessionID, data := range s.data {
+		session := sessionSnapshot{LastUsed: s.lastUsed[sessionID], Data: make(map[string]json.RawMessage, len(data))}
+		for key, value := range data {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal session value %s: %w", key, err)
+			}
+			session.Data[key] = raw
+		}
+		snapshot[sessionID] = session
+	}
+	return json.Marshal(snapshot)
+}
+
+func (s *sessionMemoryService) Restore(rawSnapshot json.RawMessage) (func(), error) {
+	snapshot := make(map[string]sessionSnapshot)
+	if err := json.Unmarshal(rawSnapshot, &snapshot); err != nil {
+		return nil, errs.New("invalid sessions snapshot", errs.ErrInvalidArgument).WithDetails(err.Error())
+	}
+	data := make(map[string]SessionData, len(snapshot))
+	lastUsed := make(map[string]time.Time, len(snapshot))
+	for sessionID, session := range snapshot {
+		data[sessionID] = make(SessionData, len(session.Data))
+		for key, raw := range session.Data {
+			value, err := decodeValue(key, raw)
+			if err != nil {
+				return nil, errs.New(fmt.Sprintf("invalid sessions snapshot: session value %s: %v", key, err), errs.ErrInvalidArgument)
+			}
+			data[sessionID][key] = value
+		}
+		lastUsed[sessionID] = session.LastUsed
+		if session.LastUsed.IsZero() {
+			lastUsed[sessionID] = clock.Now()
+		}
+	}
+	return func() {
+		s.dataMU.Lock()
+		defer s.dataMU.Unlock()
+		s.data = data
+		s.lastUsed = lastUsed
+	}, nil
 }
 
 func init() {
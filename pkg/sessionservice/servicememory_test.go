@@ -0,0 +1,48 @@
+package sessionservice
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSessionMemoryServiceSnapshot(t *testing.T) {
+	RegisterValue("test_amr", DecodeAs[[]string])
+
+	service, _ := NewSessionMemoryService()
+	service.Put("sid", SessionData{"test_amr": []string{"pwd", "otp"}, "persona": "demo"})
+
+	stateful := service.(*sessionMemoryService)
+	snapshot, err := stateful.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := stateful.Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if _, ok := service.Get("sid"); ok {
+		t.Fatal("session survived Reset()")
+	}
+
+	commit, err := stateful.Restore(snapshot)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, ok := service.Get("sid"); ok {
+		t.Fatal("session restored before commit")
+	}
+	commit()
+	data, ok := service.Get("sid")
+	if !ok {
+		t.Fatal("session not restored")
+	}
+	if amr, ok := data["test_amr"].([]string); !ok || !slices.Equal(amr, []string{"pwd", "otp"}) {
+		t.Errorf("test_amr = %#v, want []string{pwd otp}", data["test_amr"])
+	}
+	if data["persona"] != "demo" {
+		t.Errorf("persona = %#v, want demo", data["persona"])
+	}
+
+	if _, err := stateful.Restore([]byte(`{"sid": []}`)); err == nil {
+		t.Error("Restore() accepted an invalid snapshot")
+	}
+}
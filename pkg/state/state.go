@@ -0,0 +1,16 @@
+package state
+
+import "encoding/json"
+
+// Stateful is implemented by the services keeping runtime state (sessions, authorization codes,
+// users and consents added at runtime), so that tests can start from a clean server
+// or return to a known one.
+type Stateful interface {
+	// Reset drops the runtime state and returns to the state loaded from the config
+	Reset() error
+	// Snapshot returns the runtime state serialized as JSON
+	Snapshot() (json.RawMessage, error)
+	// Restore decodes and validates a Snapshot, commit replaces the runtime state with it.
+	// Nothing changes before commit is called, so that several services can be restored at once.
+	Restore(json.RawMessage) (commit func(), err error)
+}
@@ -0,0 +1,68 @@
+package tokenservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+type TokenServiceFactory func(rawTokensConfig json.RawMessage, rawConfig json.RawMessage) (Service, error)
+
+var (
+	tokenServiceFactoryRegistryMU sync.RWMutex
+	tokenServiceFactoryRegistry   = map[string]TokenServiceFactory{}
+)
+
+func Register(name string, f TokenServiceFactory) {
+	tokenServiceFactoryRegistryMU.Lock()
+	defer tokenServiceFactoryRegistryMU.Unlock()
+	tokenServiceFactoryRegistry[name] = f
+}
+
+type Config struct {
+	TokensConfig json.RawMessage `json:"tokens"`
+}
+
+// NewFromConfig initializes the token store configured in the tokens section.
+// The memory provider is used when the section (or its provider) is missing.
+func NewFromConfig(rawConfig []byte) (Service, error) {
+	slog.Info("init started", "module", "tokenservice")
+	config := Config{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, errors.New("failed to unmarshal config")
+	}
+	if len(config.TokensConfig) == 0 {
+		config.TokensConfig = json.RawMessage(`{}`)
+	}
+
+	var tokensConfig map[string]json.RawMessage
+	if err := json.Unmarshal(config.TokensConfig, &tokensConfig); err != nil {
+		return nil, errors.New("failed to parse tokens config")
+	}
+
+	provider := "memory"
+	if providerRaw, ok := tokensConfig["provider"]; ok {
+		if err := json.Unmarshal(providerRaw, &provider); err != nil {
+			return nil, errors.New("invalid tokens.provider")
+		}
+	}
+
+	slog.Info("tokenservice factory registry search", "provider", provider)
+	tokenServiceFactoryRegistryMU.RLock()
+	factory, ok := tokenServiceFactoryRegistry[provider]
+	tokenServiceFactoryRegistryMU.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown tokens service provider: %s", provider)
+	}
+
+	service, err := factory(config.TokensConfig, rawConfig)
+	if err != nil {
+		slog.Error("init failed", "module", "tokenservice", "error", err)
+	} else {
+		slog.Info("init done", "module", "tokenservice")
+	}
+
+	return service, err
+}
@@ -0,0 +1,61 @@
+package tokenservice
+
+import "time"
+
+// Service stores opaque (reference) tokens. The stored Reference is used
+// to resolve the token claims at introspection or userinfo time.
+type Service interface {
+	// Store saves the reference and returns a newly generated token handle.
+	Store(Reference) (string, error)
+
+	// Put saves the reference under a token issued by the server, e.g. an encrypted
+	// access token the server can not decrypt to read its claims.
+	Put(string, Reference) error
+
+	// Get returns the reference for the given token handle.
+	// It fails if the token is unknown, expired or revoked.
+	Get(string) (Reference, error)
+
+	// Revoke removes the token handle from the store.
+	Revoke(string) error
+
+	// UseRefreshToken records a refresh token as used until it expires at expiresAt, refresh tokens are
+	// rotated. It fails if the refresh token has been used before.
+	UseRefreshToken(token string, expiresAt time.Time) error
+}
+
+// Reference holds everything needed to rebuild the claims of an opaque token.
+type Reference struct {
+	Issuer      string         `json:"issuer"`
+	UserId      string         `json:"userId,omitempty"` // empty for tokens issued to the client itself
+	ClientId    string         `json:"clientId"`
+	Scopes      []string       `json:"scopes"`
+	ExtraClaims map[string]any `json:"extraClaims,omitempty"`
+	IssuedAt    time.Time      `json:"issuedAt"`
+	ExpiresAt   time.Time      `json:"expiresAt"`
+}
+
+// Subject returns the sub claim value of the token.
+func (r Reference) Subject() string {
+	if r.UserId != "" {
+		return r.UserId
+	}
+	return r.ClientId
+}
+
+// Issuance records a token response of the server
+type Issuance struct {
+	Time     time.Time `json:"time"`
+	ClientId string    `json:"clientId"`
+	UserId   string    `json:"userId,omitempty"` // empty for tokens issued to the client itself
+	Scopes   []string  `json:"scopes"`
+	Profile  string    `json:"profile,omitempty"` // token profile of defective tokens
+	Opaque   bool      `json:"opaque,omitempty"`  // the access token is a reference token
+}
+
+// Journal is implemented by token services which keep the latest issuances for inspection
+type Journal interface {
+	Record(Issuance)
+	// GetIssuances returns the kept issuances newest first
+	GetIssuances() []Issuance
+}
@@ -0,0 +1,134 @@
+package tokenservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const defaultLifetimeSeconds = 3600
+
+// Lifetimes holds token lifetimes in seconds. Zero values mean "inherit from the previous layer".
+type Lifetimes struct {
+	AccessTokenSeconds          int `json:"accessTokenSeconds"`
+	IDTokenSeconds              int `json:"idTokenSeconds"`
+	RefreshTokenIdleSeconds     int `json:"refreshTokenIdleSeconds"`
+	RefreshTokenAbsoluteSeconds int `json:"refreshTokenAbsoluteSeconds"`
+}
+
+// A layer of lifetimes: base values + per-scope overrides.
+// Example JSON:
+//
+//	"tokenLifetimes": {
+//	  "base": { "accessTokenSeconds": 300, "idTokenSeconds": 60 },
+//	  "scopeOverrides": {
+//	    "offline_access": { "refreshTokenIdleSeconds": 2592000 }
+//	  }
+//	}
+type lifetimesLayer struct {
+	Base           Lifetimes            `json:"base"`
+	ScopeOverrides map[string]Lifetimes `json:"scopeOverrides"`
+}
+
+type lifetimePolicyConfig struct {
+	Tokens struct {
+		Lifetimes lifetimesLayer `json:"lifetimes"`
+	} `json:"tokens"`
+	Clients map[string]struct {
+		TokenLifetimes lifetimesLayer `json:"tokenLifetimes"`
+	} `json:"clients"`
+}
+
+// LifetimePolicy resolves token lifetimes for a client and a set of scopes.
+//
+// Layers are applied in order (later wins): built-in defaults, global base,
+// global scope overrides, client base, client scope overrides.
+type LifetimePolicy struct {
+	global  lifetimesLayer
+	clients map[string]lifetimesLayer
+}
+
+func NewLifetimePolicyFromConfig(rawConfig []byte) (*LifetimePolicy, error) {
+	slog.Info("init started", "module", "tokenservice", "component", "lifetime")
+	config := lifetimePolicyConfig{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token lifetimes config: %w", err)
+	}
+
+	policy := &LifetimePolicy{
+		global:  config.Tokens.Lifetimes,
+		clients: make(map[string]lifetimesLayer),
+	}
+	for clientId, clientData := range config.Clients {
+		policy.clients[clientId] = clientData.TokenLifetimes
+	}
+
+	slog.Info("init done", "module", "tokenservice", "component", "lifetime")
+	return policy, nil
+}
+
+// Resolve returns the effective lifetimes for the client and the requested scopes.
+func (p *LifetimePolicy) Resolve(clientId string, scopes []string) Lifetimes {
+	lifetimes := Lifetimes{
+		AccessTokenSeconds:      defaultLifetimeSeconds,
+		IDTokenSeconds:          defaultLifetimeSeconds,
+		RefreshTokenIdleSeconds: defaultLifetimeSeconds,
+	}
+	if p == nil {
+		return lifetimes
+	}
+
+	lifetimes = lifetimes.apply(p.global, scopes)
+	if clientLayer, ok := p.clients[clientId]; ok {
+		lifetimes = lifetimes.apply(clientLayer, scopes)
+	}
+	return lifetimes
+}
+
+func (l Lifetimes) apply(layer lifetimesLayer, scopes []string) Lifetimes {
+	l = l.override(layer.Base)
+	for _, scope := range scopes {
+		if ov, ok := layer.ScopeOverrides[scope]; ok {
+			l = l.override(ov)
+		}
+	}
+	return l
+}
+
+func (l Lifetimes) override(ov Lifetimes) Lifetimes {
+	if ov.AccessTokenSeconds != 0 {
+		l.AccessTokenSeconds = ov.AccessTokenSeconds
+	}
+	if ov.IDTokenSeconds != 0 {
+		l.IDTokenSeconds = ov.IDTokenSeconds
+	}
+	if ov.RefreshTokenIdleSeconds != 0 {
+		l.RefreshTokenIdleSeconds = ov.RefreshTokenIdleSeconds
+	}
+	if ov.RefreshTokenAbsoluteSeconds != 0 {
+		l.RefreshTokenAbsoluteSeconds = ov.RefreshTokenAbsoluteSeconds
+	}
+	return l
+}
+
+func (l Lifetimes) AccessTokenTTL() time.Duration {
+	return time.Duration(l.AccessTokenSeconds) * time.Second
+}
+
+func (l Lifetimes) IDTokenTTL() time.Duration {
+	return time.Duration(l.IDTokenSeconds) * time.Second
+}
+
+// RefreshTokenExpiry returns the expiry of a refresh token issued at now for a session authenticated at authTime.
+// The idle lifetime is capped by the absolute lifetime (if configured).
+func (l Lifetimes) RefreshTokenExpiry(now time.Time, authTime time.Time) time.Time {
+	expiry := now.Add(time.Duration(l.RefreshTokenIdleSeconds) * time.Second)
+	if l.RefreshTokenAbsoluteSeconds > 0 {
+		absoluteExpiry := authTime.Add(time.Duration(l.RefreshTokenAbsoluteSeconds) * time.Second)
+		if absoluteExpiry.Before(expiry) {
+			expiry = absoluteExpiry
+		}
+	}
+	return expiry
+}
@@ -0,0 +1,68 @@
+package tokenservice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifetimePolicyResolve(t *testing.T) {
+	rawConfig := []byte(`{
+		"tokens": {
+			"lifetimes": {
+				"base": { "accessTokenSeconds": 600, "idTokenSeconds": 60 },
+				"scopeOverrides": { "offline_access": { "refreshTokenIdleSeconds": 86400, "refreshTokenAbsoluteSeconds": 604800 } }
+			}
+		},
+		"clients": {
+			"ACME": { "tokenLifetimes": { "base": { "accessTokenSeconds": 30 } } }
+		}
+	}`)
+	policy, err := NewLifetimePolicyFromConfig(rawConfig)
+	if err != nil {
+		t.Fatalf("NewLifetimePolicyFromConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		clientId string
+		scopes   []string
+		want     Lifetimes
+	}{
+		{
+			name:     "global base",
+			clientId: "OTHER",
+			want:     Lifetimes{AccessTokenSeconds: 600, IDTokenSeconds: 60, RefreshTokenIdleSeconds: 3600},
+		},
+		{
+			name:     "global scope override",
+			clientId: "OTHER",
+			scopes:   []string{"openid", "offline_access"},
+			want:     Lifetimes{AccessTokenSeconds: 600, IDTokenSeconds: 60, RefreshTokenIdleSeconds: 86400, RefreshTokenAbsoluteSeconds: 604800},
+		},
+		{
+			name:     "client base wins",
+			clientId: "ACME",
+			scopes:   []string{"offline_access"},
+			want:     Lifetimes{AccessTokenSeconds: 30, IDTokenSeconds: 60, RefreshTokenIdleSeconds: 86400, RefreshTokenAbsoluteSeconds: 604800},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Resolve(tt.clientId, tt.scopes); got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLifetimesRefreshTokenExpiry(t *testing.T) {
+	authTime := time.Unix(1_000_000, 0)
+	lifetimes := Lifetimes{RefreshTokenIdleSeconds: 100, RefreshTokenAbsoluteSeconds: 150}
+
+	if got, want := lifetimes.RefreshTokenExpiry(authTime, authTime), authTime.Add(100*time.Second); !got.Equal(want) {
+		t.Errorf("RefreshTokenExpiry() = %v, want %v (idle)", got, want)
+	}
+	if got, want := lifetimes.RefreshTokenExpiry(authTime.Add(100*time.Second), authTime), authTime.Add(150*time.Second); !got.Equal(want) {
+		t.Errorf("RefreshTokenExpiry() = %v, want %v (absolute)", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package tokenservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+)
+
+// ProfileScopePrefix selects a token profile by the scope of the token request, e.g. token_profile:expired
+const ProfileScopePrefix = "token_profile:"
+
+// token kinds a profile applies to
+const (
+	TokenAccess  = "access"
+	TokenID      = "id"
+	TokenRefresh = "refresh"
+)
+
+const defaultProfileSkewSeconds = 3600
+
+// TokenProfile makes the issued tokens defective for negative testing of resource servers.
+// Example JSON:
+//
+//	"tokens": {
+//	  "profiles": {
+//	    "expired": { "expired": true },
+//	    "foreign": { "unknownKey": true, "tokens": ["access"] },
+//	    "no-roles": { "removeClaims": ["realm_roles"], "extraClaims": { "admin": true } }
+//	  }
+//	}
+type TokenProfile struct {
+	Name   string   `json:"-"`
+	Tokens []string `json:"tokens"` // default access and id token
+
+	Expired        bool `json:"expired"`        // exp (and iat) in the past
+	NotYetValid    bool `json:"notYetValid"`    // nbf in the future
+	FutureIssuedAt bool `json:"futureIssuedAt"` // iat in the future
+	SkewSeconds    int  `json:"skewSeconds"`    // how far the timestamps are moved, default one hour
+
+	Issuer       string                 `json:"issuer"`   // replaces iss
+	Audience     string                 `json:"audience"` // replaces aud
+	RemoveClaims []string               `json:"removeClaims"`
+	ExtraClaims  map[string]interface{} `json:"extraClaims"`
+
+	UnknownKey  bool `json:"unknownKey"`  // signed with a key absent from the JWKS
+	AlgMismatch bool `json:"algMismatch"` // HS256 with the kid of the signing key
+}
+
+type profilePolicyConfig struct {
+	Tokens struct {
+		Profiles map[string]TokenProfile `json:"profiles"`
+	} `json:"tokens"`
+	Clients map[string]struct {
+		TokenProfile string `json:"tokenProfile"`
+	} `json:"clients"`
+}
+
+// ProfilePolicy resolves the token profile of a token request.
+//
+// The profile of the request scope wins over the profile of the user, which wins over the profile of the client.
+type ProfilePolicy struct {
+	profiles map[string]TokenProfile
+	clients  map[string]string
+}
+
+func NewProfilePolicyFromConfig(rawConfig []byte) (*ProfilePolicy, error) {
+	slog.Info("init started", "module", "tokenservice", "component", "profile")
+	config := profilePolicyConfig{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token profiles config: %w", err)
+	}
+
+	policy := &ProfilePolicy{
+		profiles: make(map[string]TokenProfile),
+		clients:  make(map[string]string),
+	}
+	for name, profile := range config.Tokens.Profiles {
+		for _, kind := range profile.Tokens {
+			if kind != TokenAccess && kind != TokenID && kind != TokenRefresh {
+				return nil, fmt.Errorf("token profile %s: unknown token '%s'", name, kind)
+			}
+		}
+		profile.Name = name
+		policy.profiles[name] = profile
+	}
+	for clientId, clientData := range config.Clients {
+		if clientData.TokenProfile == "" {
+			continue
+		}
+		if _, ok := policy.profiles[clientData.TokenProfile]; !ok {
+			return nil, fmt.Errorf("client %s: unknown token profile '%s'", clientId, clientData.TokenProfile)
+		}
+		policy.clients[clientId] = clientData.TokenProfile
+	}
+
+	slog.Info("init done", "module", "tokenservice", "component", "profile")
+	return policy, nil
+}
+
+// Resolve returns the profile (nil for regular tokens) of a token request of the client, userProfile is
+// the profile name of the user (may be empty). The profile scopes are removed from the returned scopes.
+func (p *ProfilePolicy) Resolve(clientId string, userProfile string, scopes []string) (*TokenProfile, []string, error) {
+	name := ""
+	remaining := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if profileName, ok := strings.CutPrefix(scope, ProfileScopePrefix); ok {
+			name = profileName
+			continue
+		}
+		remaining = append(remaining, scope)
+	}
+	if p == nil {
+		if name != "" {
+			return nil, nil, errs.New(fmt.Sprintf("unknown token profile '%s'", name), errs.ErrInvalidArgument)
+		}
+		return nil, remaining, nil
+	}
+	if name == "" {
+		name = userProfile
+	}
+	if name == "" {
+		name = p.clients[clientId]
+	}
+	if name == "" {
+		return nil, remaining, nil
+	}
+	profile, ok := p.profiles[name]
+	if !ok {
+		return nil, nil, errs.New(fmt.Sprintf("unknown token profile '%s'", name), errs.ErrInvalidArgument)
+	}
+	return &profile, remaining, nil
+}
+
+// Applies tells whether the profile changes the token of the kind
+func (t *TokenProfile) Applies(kind string) bool {
+	if t == nil {
+		return false
+	}
+	if len(t.Tokens) == 0 {
+		return kind == TokenAccess || kind == TokenID
+	}
+	return slices.Contains(t.Tokens, kind)
+}
+
+// Mutate applies the claim defects of the profile to the claims of a token issued at now
+func (t *TokenProfile) Mutate(claims map[string]interface{}, now time.Time) {
+	skew := int64(t.SkewSeconds)
+	if skew == 0 {
+		skew = defaultProfileSkewSeconds
+	}
+	if t.Expired {
+		// the whole lifetime lies in the past
+		exp, _ := claims["exp"].(int64)
+		iat, _ := claims["iat"].(int64)
+		shift := exp - now.Unix() + skew
+		claims["exp"] = exp - shift
+		claims["iat"] = iat - shift
+	}
+	if t.NotYetValid {
+		claims["nbf"] = now.Unix() + skew
+	}
+	if t.FutureIssuedAt {
+		claims["iat"] = now.Unix() + skew
+	}
+	if t.Issuer != "" {
+		claims["iss"] = t.Issuer
+	}
+	if t.Audience != "" {
+		claims["aud"] = t.Audience
+	}
+	for _, claim := range t.RemoveClaims {
+		delete(claims, claim)
+	}
+	for claim, value := range t.ExtraClaims {
+		claims[claim] = value
+	}
+}
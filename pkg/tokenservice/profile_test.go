@@ -0,0 +1,89 @@
+package tokenservice
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+)
+
+func TestProfilePolicyResolve(t *testing.T) {
+	rawConfig := []byte(`{
+		"tokens": {
+			"profiles": {
+				"expired": { "expired": true },
+				"foreign": { "unknownKey": true, "tokens": ["access"] },
+				"wrong-aud": { "audience": "someone-else" }
+			}
+		},
+		"clients": {
+			"ACME": { "tokenProfile": "wrong-aud" }
+		}
+	}`)
+	policy, err := NewProfilePolicyFromConfig(rawConfig)
+	if err != nil {
+		t.Fatalf("NewProfilePolicyFromConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		clientId    string
+		userProfile string
+		scopes      []string
+		want        string
+		wantScopes  []string
+	}{
+		{name: "no profile", clientId: "OTHER", scopes: []string{"openid"}, wantScopes: []string{"openid"}},
+		{name: "client", clientId: "ACME", scopes: []string{"openid"}, want: "wrong-aud", wantScopes: []string{"openid"}},
+		{name: "user wins", clientId: "ACME", userProfile: "foreign", want: "foreign", wantScopes: []string{}},
+		{name: "scope wins", clientId: "ACME", userProfile: "foreign", scopes: []string{"openid", "token_profile:expired"}, want: "expired", wantScopes: []string{"openid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, scopes, err := policy.Resolve(tt.clientId, tt.userProfile, tt.scopes)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			got := ""
+			if profile != nil {
+				got = profile.Name
+			}
+			if got != tt.want || !slices.Equal(scopes, tt.wantScopes) {
+				t.Errorf("Resolve() = %q, %v, want %q, %v", got, scopes, tt.want, tt.wantScopes)
+			}
+		})
+	}
+
+	if _, _, err := policy.Resolve("ACME", "", []string{"token_profile:nope"}); !errors.Is(err, errs.ErrInvalidArgument) {
+		t.Errorf("Resolve() error = %v, want invalid argument", err)
+	}
+	if _, err := NewProfilePolicyFromConfig([]byte(`{"clients": {"ACME": {"tokenProfile": "nope"}}}`)); err == nil {
+		t.Error("NewProfilePolicyFromConfig() accepted an unknown client profile")
+	}
+}
+
+func TestTokenProfileMutate(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	profile := &TokenProfile{Expired: true, NotYetValid: true, Issuer: "https://evil", RemoveClaims: []string{"sub"}, ExtraClaims: map[string]interface{}{"admin": true}}
+	claims := map[string]interface{}{"iss": "https://good", "sub": "demo", "iat": now.Unix(), "exp": now.Unix() + 300}
+	profile.Mutate(claims, now)
+
+	if exp := claims["exp"].(int64); exp != now.Unix()-defaultProfileSkewSeconds {
+		t.Errorf("exp = %d, want %d", exp, now.Unix()-defaultProfileSkewSeconds)
+	}
+	if iat := claims["iat"].(int64); iat != now.Unix()-defaultProfileSkewSeconds-300 {
+		t.Errorf("iat = %d, want %d", iat, now.Unix()-defaultProfileSkewSeconds-300)
+	}
+	if nbf := claims["nbf"].(int64); nbf != now.Unix()+defaultProfileSkewSeconds {
+		t.Errorf("nbf = %d, want %d", nbf, now.Unix()+defaultProfileSkewSeconds)
+	}
+	if _, ok := claims["sub"]; ok || claims["iss"] != "https://evil" || claims["admin"] != true {
+		t.Errorf("claims = %v", claims)
+	}
+
+	if !profile.Applies(TokenID) || profile.Applies(TokenRefresh) {
+		t.Error("Applies() without tokens must cover access and id tokens only")
+	}
+}
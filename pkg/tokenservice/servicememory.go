@@ -0,0 +1,197 @@
+package tokenservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/axent-pl/oauth2mock/pkg/auth"
+	"github.com/axent-pl/oauth2mock/pkg/clock"
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+)
+
+const (
+	defaultOpaqueTokenLength = 32
+	defaultJournalLimit      = 100
+	memoryCleanupInterval    = time.Minute
+)
+
+type memoryTokenServiceConfig struct {
+	Provider          string `json:"provider"`
+	OpaqueTokenLength int    `json:"opaqueTokenLength"`
+	JournalLimit      int    `json:"journalLimit"`
+}
+
+type memoryTokenService struct {
+	tokenLength int
+	tokens      map[string]Reference
+	tokensMU    sync.RWMutex
+
+	usedRefreshTokens   map[string]time.Time // expiry by refresh token
+	usedRefreshTokensMU sync.Mutex
+
+	journalLimit int
+	journal      []Issuance
+	journalMU    sync.RWMutex
+}
+
+func NewMemoryTokenService(rawTokensConfig json.RawMessage, rawConfig json.RawMessage) (Service, error) {
+	slog.Info("tokenservice factory NewMemoryTokenService started")
+	config := memoryTokenServiceConfig{}
+	if err := json.Unmarshal(rawTokensConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token service config: %w", err)
+	}
+
+	service := &memoryTokenService{
+		tokenLength:       config.OpaqueTokenLength,
+		tokens:            make(map[string]Reference),
+		usedRefreshTokens: make(map[string]time.Time),
+		journalLimit:      config.JournalLimit,
+	}
+	if service.tokenLength <= 0 {
+		service.tokenLength = defaultOpaqueTokenLength
+	}
+	if service.journalLimit <= 0 {
+		service.journalLimit = defaultJournalLimit
+	}
+
+	go service.cleanupExpiredTokens()
+
+	return service, nil
+}
+
+func (s *memoryTokenService) Store(ref Reference) (string, error) {
+	s.tokensMU.Lock()
+	defer s.tokensMU.Unlock()
+
+	token, err := auth.GenerateRandomCode(s.tokenLength)
+	if err != nil {
+		return "", errs.Wrap("internal error", err).WithKind(errs.ErrInternal).WithDetails("failed to generate opaque token")
+	}
+	s.tokens[token] = ref
+
+	return token, nil
+}
+
+func (s *memoryTokenService) Put(token string, ref Reference) error {
+	s.tokensMU.Lock()
+	defer s.tokensMU.Unlock()
+
+	s.tokens[token] = ref
+	return nil
+}
+
+func (s *memoryTokenService) Get(token string) (Reference, error) {
+	s.tokensMU.RLock()
+	defer s.tokensMU.RUnlock()
+
+	ref, ok := s.tokens[token]
+	if !ok {
+		return Reference{}, errs.New("invalid token", errs.ErrNotFound).WithDetails("opaque token not found")
+	}
+	if clock.Now().After(ref.ExpiresAt) {
+		return Reference{}, errs.New("invalid token", errs.ErrUnauthenticated).WithDetails("opaque token has expired")
+	}
+	return ref, nil
+}
+
+func (s *memoryTokenService) Revoke(token string) error {
+	s.tokensMU.Lock()
+	defer s.tokensMU.Unlock()
+
+	delete(s.tokens, token)
+	return nil
+}
+
+func (s *memoryTokenService) UseRefreshToken(token string, expiresAt time.Time) error {
+	s.usedRefreshTokensMU.Lock()
+	defer s.usedRefreshTokensMU.Unlock()
+
+	if _, used := s.usedRefreshTokens[token]; used {
+		return errs.New("invalid token", errs.ErrUnauthenticated).WithDetails("refresh token has already been used")
+	}
+	s.usedRefreshTokens[token] = expiresAt
+	return nil
+}
+
+// Record keeps the issuance, the oldest one is dropped beyond the journal limit
+func (s *memoryTokenService) Record(issuance Issuance) {
+	s.journalMU.Lock()
+	defer s.journalMU.Unlock()
+	s.journal = append(s.journal, issuance)
+	if len(s.journal) > s.journalLimit {
+		s.journal = s.journal[len(s.journal)-s.journalLimit:]
+	}
+}
+
+func (s *memoryTokenService) GetIssuances() []Issuance {
+	s.journalMU.RLock()
+	defer s.journalMU.RUnlock()
+	issuances := make([]Issuance, len(s.journal))
+	for i, issuance := range s.journal {
+		issuances[len(s.journal)-1-i] = issuance
+	}
+	return issuances
+}
+
+// Reset drops all opaque tokens, the used refresh tokens and the journal
+func (s *memoryTokenService) Reset() error {
+	s.tokensMU.Lock()
+	s.tokens = make(map[string]Reference)
+	s.tokensMU.Unlock()
+	s.usedRefreshTokensMU.Lock()
+	s.usedRefreshTokens = make(map[string]time.Time)
+	s.usedRefreshTokensMU.Unlock()
+	s.journalMU.Lock()
+	s.journal = nil
+	s.journalMU.Unlock()
+	return nil
+}
+
+// Snapshot returns the references of the opaque tokens by token
+func (s *memoryTokenService) Snapshot() (json.RawMessage, error) {
+	s.tokensMU.RLock()
+	defer s.tokensMU.RUnlock()
+	return json.Marshal(s.tokens)
+}
+
+func (s *memoryTokenService) Restore(rawSnapshot json.RawMessage) (func(), error) {
+	tokens := make(map[string]Reference)
+	if err := json.Unmarshal(rawSnapshot, &tokens); err != nil {
+		return nil, errs.New("invalid tokens snapshot", errs.ErrInvalidArgument).WithDetails(err.Error())
+	}
+	return func() {
+		s.tokensMU.Lock()
+		defer s.tokensMU.Unlock()
+		s.tokens = tokens
+	}, nil
+}
+
+func (s *memoryTokenService) cleanupExpiredTokens() {
+	ticker := time.NewTicker(memoryCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.tokensMU.Lock()
+		for token, ref := range s.tokens {
+			if clock.Now().After(ref.ExpiresAt) {
+				delete(s.tokens, token)
+			}
+		}
+		s.tokensMU.Unlock()
+		// expired refresh tokens are rejected by their exp claim
+		s.usedRefreshTokensMU.Lock()
+		for token, expiresAt := range s.usedRefreshTokens {
+			if clock.Now().After(expiresAt) {
+				delete(s.usedRefreshTokens, token)
+			}
+		}
+		s.usedRefreshTokensMU.Unlock()
+	}
+}
+
+func init() {
+	Register("memory", NewMemoryTokenService)
+}
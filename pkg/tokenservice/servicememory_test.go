@@ -0,0 +1,54 @@
+package tokenservice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenServiceJournal(t *testing.T) {
+	service, err := NewMemoryTokenService([]byte(`{"provider": "memory", "journalLimit": 2}`), nil)
+	if err != nil {
+		t.Fatalf("NewMemoryTokenService() error = %v", err)
+	}
+	journal, ok := service.(Journal)
+	if !ok {
+		t.Fatal("memory token service does not keep a journal")
+	}
+	for _, clientId := range []string{"A", "B", "C"} {
+		journal.Record(Issuance{ClientId: clientId})
+	}
+
+	issuances := journal.GetIssuances()
+	if len(issuances) != 2 || issuances[0].ClientId != "C" || issuances[1].ClientId != "B" {
+		t.Errorf("GetIssuances() = %+v, want C and B", issuances)
+	}
+	if err := service.(*memoryTokenService).Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if issuances := journal.GetIssuances(); len(issuances) != 0 {
+		t.Errorf("GetIssuances() after Reset() = %+v", issuances)
+	}
+}
+
+func TestMemoryTokenServiceUseRefreshToken(t *testing.T) {
+	service, err := NewMemoryTokenService([]byte(`{"provider": "memory"}`), nil)
+	if err != nil {
+		t.Fatalf("NewMemoryTokenService() error = %v", err)
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	if err := service.UseRefreshToken("refresh", expiresAt); err != nil {
+		t.Fatalf("UseRefreshToken() error = %v", err)
+	}
+	if err := service.UseRefreshToken("refresh", expiresAt); err == nil {
+		t.Error("UseRefreshToken() accepted a used refresh token")
+	}
+	if err := service.UseRefreshToken("other", expiresAt); err != nil {
+		t.Errorf("UseRefreshToken() of another token error = %v", err)
+	}
+	if err := service.(*memoryTokenService).Reset(); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	if err := service.UseRefreshToken("refresh", expiresAt); err != nil {
+		t.Errorf("UseRefreshToken() after Reset() error = %v", err)
+	}
+}
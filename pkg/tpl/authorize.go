@@ -6,6 +6,46 @@ type LoginTemplateData struct {
 	Username         string
 	UsernameError    string
 	PasswordError    string
+	Upstreams        []UpstreamLink
+	PasskeyLoginURL  string
+	EmailLogin       bool
+	Personas         []Persona
+}
+
+// Persona is a user of the one-click development login
+type Persona struct {
+	Username    string
+	Description string
+	Roles       []string
+}
+
+// UpstreamLink is a "Log in with" link of an upstream identity provider
+type UpstreamLink struct {
+	DisplayName string
+	URL         string
+}
+
+// OTPTemplateData is the second login step, Secret and KeyURI are set while the user enrols an authenticator
+type OTPTemplateData struct {
+	FormAction       string
+	FormErrorMessage string
+	Secret           string
+	KeyURI           string
+	Enrolled         bool
+}
+
+// EmailLoginTemplateData is the page to enter the code sent by email
+type EmailLoginTemplateData struct {
+	FormAction       string
+	FormErrorMessage string
+	Email            string
+}
+
+// PasskeyTemplateData is the passkey registration page, Options are the JSON encoded credential creation options
+type PasskeyTemplateData struct {
+	FormAction  string
+	Options     string
+	Credentials int
 }
 
 type AuthorizeTemplateData struct {
@@ -15,3 +55,92 @@ type AuthorizeTemplateData struct {
 	UsernameError    string
 	PasswordError    string
 }
+
+// ConsoleTemplateData is a page of the admin console, Page selects the section shown (login without an Admin).
+// The JSON fields are indented JSON shown in text areas.
+type ConsoleTemplateData struct {
+	FormAction   string
+	Page         string
+	Admin        string
+	Message      string
+	ErrorMessage string
+
+	Users    []ConsoleUser
+	User     ConsoleUser // edited user, empty to add one
+	Clients  []ConsoleClient
+	Client   ConsoleClient // edited client, empty to add one
+	Scopes   []ConsoleScope
+	Consents []ConsoleConsent // consents of ConsentsUser
+	Keys     []ConsoleKey
+	Sessions []ConsoleSession
+	Codes    []ConsoleCode
+	Tokens   []ConsoleIssuance
+
+	ConsentsUser string
+	ClaimsUser   string // owner of ClaimsJSON, either the user
+	ClaimsClient string // or the client
+	ClaimsJSON   string
+
+	KeyTypes       []string
+	SigningMethods []string
+}
+
+type ConsoleUser struct {
+	Username       string
+	Email          string
+	Active         bool
+	TOTP           bool
+	TOTPSecret     string
+	AttributesJSON string
+}
+
+type ConsoleClient struct {
+	Id                string
+	RedirectURI       string
+	AccessTokenFormat string
+	RequireMFA        bool
+	ConfigJSON        string
+}
+
+type ConsoleScope struct {
+	Name           string
+	RequireConsent bool
+}
+
+type ConsoleConsent struct {
+	Scope   string
+	Granted bool
+}
+
+type ConsoleKey struct {
+	Kid    string
+	Type   string
+	Method string
+	Active bool
+}
+
+type ConsoleSession struct {
+	Id       string
+	Username string
+	AMR      string
+	LastUsed string
+}
+
+// ConsoleCode is an outstanding authorization code
+type ConsoleCode struct {
+	Code        string
+	ClientId    string
+	Username    string
+	Scopes      string
+	RedirectURI string
+	ExpiresAt   string
+}
+
+type ConsoleIssuance struct {
+	Time     string
+	ClientId string
+	UserId   string
+	Scopes   string
+	Profile  string
+	Opaque   bool
+}
@@ -10,6 +10,10 @@ type Entity interface {
 	SetActive(bool)
 	AuthenticationScheme() authentication.SchemeHandler
 	SetAuthenticationScheme(authentication.SchemeHandler)
+	TOTPSecret() string
+	SetTOTPSecret(string)
+	Email() string
+	SetEmail(string)
 	GetAllAttributes() map[string]map[string]interface{}
 	SetAllAttributes(map[string]map[string]interface{})
 	GetAttributesGroup(group string) map[string]interface{}
@@ -20,5 +24,7 @@ type Service interface {
 	Authenticate(credentials authentication.CredentialsHandler) (Entity, error)
 	GetUsers() ([]Entity, error)
 	AddUser(Entity) error
+	UpdateUser(Entity) error
 	GetUser(string) (Entity, error)
+	DeleteUser(string) error
 }
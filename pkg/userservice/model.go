@@ -1,12 +1,31 @@
 package userservice
 
-import "github.com/axent-pl/oauth2mock/pkg/service/authentication"
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
+)
+
+// attribute groups of users created by identity brokering
+const (
+	AttributesGroupBroker   = "broker"   // alias of the upstream provider
+	AttributesGroupUpstream = "upstream" // claims received from the upstream provider
+)
+
+// AttributesGroupPersona describes the user on the persona login page (description)
+const AttributesGroupPersona = "persona"
+
+// AttributesGroupTokens selects the token profile (profile) of the tokens issued to the user
+const AttributesGroupTokens = "tokens"
 
 type userHandler struct {
 	id         string
 	name       string
 	active     bool
 	authScheme authentication.SchemeHandler
+	totpSecret string
+	email      string
 	attributes map[string]map[string]interface{}
 }
 
@@ -38,6 +57,24 @@ func (s *userHandler) SetAuthenticationScheme(scheme authentication.SchemeHandle
 	s.authScheme = scheme
 }
 
+// TOTPSecret returns the base32 encoded TOTP secret, empty when the user has not enrolled a second factor
+func (s *userHandler) TOTPSecret() string {
+	return s.totpSecret
+}
+
+func (s *userHandler) SetTOTPSecret(secret string) {
+	s.totpSecret = secret
+}
+
+// Email returns the address one-time codes and magic links are sent to
+func (s *userHandler) Email() string {
+	return s.email
+}
+
+func (s *userHandler) SetEmail(email string) {
+	s.email = email
+}
+
 func (s *userHandler) GetAllAttributes() map[string]map[string]interface{} {
 	return s.attributes
 }
@@ -97,9 +134,73 @@ func WithActive(active bool) UserHandlerOption {
 	}
 }
 
+func WithTOTPSecret(secret string) UserHandlerOption {
+	return func(u *userHandler) error {
+		u.totpSecret = secret
+		return nil
+	}
+}
+
+func WithEmail(email string) UserHandlerOption {
+	return func(u *userHandler) error {
+		u.email = email
+		return nil
+	}
+}
+
 func WithCustomAttributes(key string, value map[string]interface{}) UserHandlerOption {
 	return func(u *userHandler) error {
 		u.SetAttributesGroup(key, value)
 		return nil
 	}
 }
+
+// entityJSON is the serialized form of a user, the credentials are not serialized
+type entityJSON struct {
+	Id         string                            `json:"id"`
+	Username   string                            `json:"username"`
+	Active     bool                              `json:"active"`
+	TOTPSecret string                            `json:"totpSecret,omitempty"`
+	Email      string                            `json:"email,omitempty"`
+	Attributes map[string]map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// MarshalEntity serializes the user (e.g. for a snapshot) without the password, UnmarshalEntity
+// restores a user without local credentials
+func MarshalEntity(user Entity) (json.RawMessage, error) {
+	return json.Marshal(entityJSON{
+		Id:         user.Id(),
+		Username:   user.Name(),
+		Active:     user.Active(),
+		TOTPSecret: user.TOTPSecret(),
+		Email:      user.Email(),
+		Attributes: user.GetAllAttributes(),
+	})
+}
+
+// MarshalJSON makes the users stored in sessions serializable
+func (s *userHandler) MarshalJSON() ([]byte, error) {
+	return MarshalEntity(s)
+}
+
+func UnmarshalEntity(raw json.RawMessage) (Entity, error) {
+	data := entityJSON{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return unmarshalUserHandler(data)
+}
+
+func unmarshalUserHandler(data entityJSON) (*userHandler, error) {
+	if data.Id == "" {
+		return nil, fmt.Errorf("user '%s': missing id", data.Username)
+	}
+	return &userHandler{
+		id:         data.Id,
+		name:       data.Username,
+		active:     data.Active,
+		totpSecret: data.TOTPSecret,
+		email:      data.Email,
+		attributes: data.Attributes,
+	}, nil
+}
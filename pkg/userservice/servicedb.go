@@ -26,6 +26,7 @@ type databaseUserServiceConfig struct {
 		GetUser    string `json:"get_user,omitempty"`
 		GetUsers   string `json:"get_users,omitempty"`
 		AddUser    string `json:"add_user,omitempty"`
+		DeleteUser string `json:"delete_user,omitempty"`
 		UserExists string `json:"user_exists,omitempty"`
 	} `json:"queries,omitempty"`
 }
@@ -40,6 +41,7 @@ type databaseUserService struct {
 		GetUser    string
 		GetUsers   string
 		AddUser    string
+		DeleteUser string
 		UserExists string
 	}
 }
@@ -73,6 +75,10 @@ func NewDatabaseUserService(rawConfig json.RawMessage) (Service, error) {
 	if svc.queries.AddUser == "" {
 		svc.queries.AddUser = `INSERT INTO users (username, password, active, custom_attributes) VALUES ($1, $2, $3, $4)`
 	}
+	svc.queries.DeleteUser = config.Queries.DeleteUser
+	if svc.queries.DeleteUser == "" {
+		svc.queries.DeleteUser = `DELETE FROM users WHERE username = $1`
+	}
 	svc.queries.UserExists = config.Queries.UserExists
 	if svc.queries.UserExists == "" {
 		svc.queries.UserExists = `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)`
@@ -176,6 +182,10 @@ func (s *databaseUserService) GetUser(username string) (Entity, error) {
 	return nil, errors.New("not implemented")
 }
 
+func (s *databaseUserService) UpdateUser(user Entity) error {
+	return errors.New("not implemented")
+}
+
 func (s *databaseUserService) AddUser(user Entity) error {
 	username := user.Name()
 
@@ -204,6 +214,17 @@ func (s *databaseUserService) AddUser(user Entity) error {
 	return err
 }
 
+func (s *databaseUserService) DeleteUser(username string) error {
+	result, err := s.db.ExecContext(context.Background(), s.queries.DeleteUser, username)
+	if err != nil {
+		return fmt.Errorf("failed to execute user delete query: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return errs.New("user does not exist", errs.ErrNotFound).WithDetailsf("user '%s' not found", username)
+	}
+	return nil
+}
+
 func init() {
 	Register("database", NewDatabaseUserService)
 }
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"sync"
 
-	"github.com/axent-pl/oauth2mock/pkg/di"
 	"github.com/axent-pl/oauth2mock/pkg/errs"
 	"github.com/axent-pl/oauth2mock/pkg/service/authentication"
 )
@@ -16,6 +15,8 @@ type jsonUserServiceConfig struct {
 	Users    map[string]struct {
 		Username   string                            `json:"username"`
 		Password   string                            `json:"password"`
+		TOTPSecret string                            `json:"totpSecret"`
+		Email      string                            `json:"email"`
 		Attributes map[string]map[string]interface{} `json:"attributes"`
 	} `json:"users"`
 }
@@ -25,21 +26,43 @@ type jsonUserHandler struct {
 }
 
 type jsonUserService struct {
+	config  jsonUserServiceConfig // users of the config, the service returns to them on Reset
 	users   map[string]jsonUserHandler
+	changed map[string]bool // users added, updated (e.g. TOTP enrolments) or deleted at runtime
 	usersMU sync.RWMutex
+
+	// credentials of the users at their latest snapshot, snapshots do not carry credentials
+	snapshotCredentials   map[string]userCredentials
+	snapshotCredentialsMU sync.Mutex
+}
+
+// userCredentials are the password and the TOTP secret of a user
+type userCredentials struct {
+	authScheme authentication.SchemeHandler
+	totpSecret string
 }
 
 func NewJSONUserService(rawConfig json.RawMessage) (Service, error) {
-	config := jsonUserServiceConfig{}
-	userService := &jsonUserService{
-		users: make(map[string]jsonUserHandler),
+	userService := &jsonUserService{}
+
+	if err := json.Unmarshal(rawConfig, &userService.config); err != nil {
+		return nil, err
 	}
 
-	if err := json.Unmarshal(rawConfig, &config); err != nil {
+	users, err := userService.configUsers()
+	if err != nil {
 		return nil, err
 	}
+	userService.users = users
+	userService.changed = make(map[string]bool)
+	userService.snapshotCredentials = make(map[string]userCredentials)
 
-	for username, userData := range config.Users {
+	return userService, nil
+}
+
+func (s *jsonUserService) configUsers() (map[string]jsonUserHandler, error) {
+	users := make(map[string]jsonUserHandler)
+	for username, userData := range s.config.Users {
 		authScheme, err := authentication.NewScheme(authentication.WithUsernameAndPassword(userData.Username, userData.Password))
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse user credentials for '%s': %w", username, err)
@@ -50,15 +73,14 @@ func NewJSONUserService(rawConfig json.RawMessage) (Service, error) {
 				name:       username,
 				active:     true,
 				authScheme: authScheme,
+				totpSecret: userData.TOTPSecret,
+				email:      userData.Email,
 				attributes: userData.Attributes,
 			},
 		}
-		userService.users[username] = user
+		users[username] = user
 	}
-
-	di.Register(userService)
-
-	return userService, nil
+	return users, nil
 }
 
 func (s *jsonUserService) Authenticate(inputCredentials authentication.CredentialsHandler) (Entity, error) {
@@ -77,8 +99,8 @@ func (s *jsonUserService) Authenticate(inputCredentials authentication.Credentia
 		return nil, errs.New("invalid credentials", errs.ErrInvalidArgument).WithDetailsf("user '%s' not found", username)
 	}
 
-	// check if credentials match
-	if user.AuthenticationScheme().Matches(inputCredentials) {
+	// check if credentials match (brokered users have no local credentials)
+	if scheme := user.AuthenticationScheme(); scheme != nil && scheme.Matches(inputCredentials) {
 		return &user, nil
 	}
 
@@ -86,6 +108,8 @@ func (s *jsonUserService) Authenticate(inputCredentials authentication.Credentia
 }
 
 func (s *jsonUserService) GetUsers() ([]Entity, error) {
+	s.usersMU.RLock()
+	defer s.usersMU.RUnlock()
 	var users []Entity = make([]Entity, 0)
 	for _, k := range s.users {
 		users = append(users, &k)
@@ -94,6 +118,8 @@ func (s *jsonUserService) GetUsers() ([]Entity, error) {
 }
 
 func (s *jsonUserService) GetUser(username string) (Entity, error) {
+	s.usersMU.RLock()
+	defer s.usersMU.RUnlock()
 	user, ok := s.users[username]
 	if ok {
 		return &user, nil
@@ -102,8 +128,8 @@ func (s *jsonUserService) GetUser(username string) (Entity, error) {
 }
 
 func (s *jsonUserService) AddUser(user Entity) error {
-	s.usersMU.RLock()
-	defer s.usersMU.RUnlock()
+	s.usersMU.Lock()
+	defer s.usersMU.Unlock()
 
 	username := user.Name()
 
@@ -117,13 +143,155 @@ func (s *jsonUserService) AddUser(user Entity) error {
 			name:       user.Name(),
 			active:     user.Active(),
 			authScheme: user.AuthenticationScheme(),
+			totpSecret: user.TOTPSecret(),
+			email:      user.Email(),
 			attributes: user.GetAllAttributes(),
 		},
 	}
+	s.changed[username] = true
 
 	return nil
 }
 
+func (s *jsonUserService) UpdateUser(user Entity) error {
+	s.usersMU.Lock()
+	defer s.usersMU.Unlock()
+
+	stored, ok := s.users[user.Name()]
+	if !ok {
+		return errors.New("user does not exist")
+	}
+	stored.active = user.Active()
+	stored.authScheme = user.AuthenticationScheme()
+	stored.totpSecret = user.TOTPSecret()
+	stored.email = user.Email()
+	stored.attributes = user.GetAllAttributes()
+	s.users[user.Name()] = stored
+	s.changed[user.Name()] = true
+
+	return nil
+}
+
+func (s *jsonUserService) DeleteUser(username string) error {
+	s.usersMU.Lock()
+	defer s.usersMU.Unlock()
+
+	if _, ok := s.users[username]; !ok {
+		return errs.New("user does not exist", errs.ErrNotFound).WithDetailsf("user '%s' not found", username)
+	}
+	delete(s.users, username)
+	s.changed[username] = true
+
+	return nil
+}
+
+// KeepRuntimeChanges carries the users added, updated or deleted at runtime and the credentials of
+// the snapshotted users over from previous (the service of the config before a reload), they win over the config
+func (s *jsonUserService) KeepRuntimeChanges(previous Service) {
+	p, ok := previous.(*jsonUserService)
+	if !ok || p == s {
+		return
+	}
+	p.usersMU.RLock()
+	defer p.usersMU.RUnlock()
+	s.usersMU.Lock()
+	defer s.usersMU.Unlock()
+	for username := range p.changed {
+		if user, ok := p.users[username]; ok {
+			s.users[username] = user
+		} else {
+			delete(s.users, username)
+		}
+		s.changed[username] = true
+	}
+	p.snapshotCredentialsMU.Lock()
+	defer p.snapshotCredentialsMU.Unlock()
+	s.snapshotCredentialsMU.Lock()
+	defer s.snapshotCredentialsMU.Unlock()
+	for username, credentials := range p.snapshotCredentials {
+		s.snapshotCredentials[username] = credentials
+	}
+}
+
+// Reset drops the users added or changed at runtime
+func (s *jsonUserService) Reset() error {
+	users, err := s.configUsers()
+	if err != nil {
+		return err
+	}
+	s.usersMU.Lock()
+	defer s.usersMU.Unlock()
+	s.users = users
+	s.changed = make(map[string]bool)
+	return nil
+}
+
+// Snapshot returns the users by name without their credentials (passwords and TOTP secrets),
+// the service keeps the credentials of the snapshotted users in memory for Restore
+func (s *jsonUserService) Snapshot() (json.RawMessage, error) {
+	s.usersMU.RLock()
+	defer s.usersMU.RUnlock()
+	s.snapshotCredentialsMU.Lock()
+	defer s.snapshotCredentialsMU.Unlock()
+	snapshot := make(map[string]json.RawMessage, len(s.users))
+	for username, user := range s.users {
+		s.snapshotCredentials[username] = userCredentials{authScheme: user.authScheme, totpSecret: user.totpSecret}
+		user.totpSecret = ""
+		data, err := MarshalEntity(&user)
+		if err != nil {
+			return nil, err
+		}
+		snapshot[username] = data
+	}
+	return json.Marshal(snapshot)
+}
+
+// Restore replaces the users. A restored user gets the credentials it had at its latest snapshot
+// taken by this service, otherwise those of the current user of the same name; a user known to
+// neither has no password.
+func (s *jsonUserService) Restore(rawSnapshot json.RawMessage) (func(), error) {
+	snapshot := make(map[string]entityJSON)
+	if err := json.Unmarshal(rawSnapshot, &snapshot); err != nil {
+		return nil, errs.New("invalid users snapshot", errs.ErrInvalidArgument).WithDetails(err.Error())
+	}
+	users := make(map[string]jsonUserHandler, len(snapshot))
+	for username, data := range snapshot {
+		user, err := unmarshalUserHandler(data)
+		if err != nil {
+			return nil, errs.New(fmt.Sprintf("invalid users snapshot: %v", err), errs.ErrInvalidArgument)
+		}
+		users[username] = jsonUserHandler{*user}
+	}
+	return func() {
+		s.usersMU.Lock()
+		defer s.usersMU.Unlock()
+		s.snapshotCredentialsMU.Lock()
+		defer s.snapshotCredentialsMU.Unlock()
+		for username, user := range users {
+			credentials, ok := s.snapshotCredentials[username]
+			if current, known := s.users[username]; !ok && known {
+				credentials, ok = userCredentials{authScheme: current.authScheme, totpSecret: current.totpSecret}, true
+			}
+			if ok {
+				user.authScheme = credentials.authScheme
+				// snapshots of older versions carry the TOTP secret
+				if user.totpSecret == "" {
+					user.totpSecret = credentials.totpSecret
+				}
+				users[username] = user
+			}
+		}
+		// the restored users replace the current ones, all of them are runtime state now
+		for username := range s.users {
+			s.changed[username] = true
+		}
+		for username := range users {
+			s.changed[username] = true
+		}
+		s.users = users
+	}, nil
+}
+
 func init() {
 	Register("json", NewJSONUserService)
 }
@@ -0,0 +1,197 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// path addresses a value of a JSON document, a segment is either a property name or an array index ("[0]")
+type path []string
+
+func (p path) key(name string) path {
+	return append(p.clone(), name)
+}
+
+func (p path) index(i int) path {
+	return append(p.clone(), "["+strconv.Itoa(i)+"]")
+}
+
+func (p path) clone() path {
+	return append(path{}, p...)
+}
+
+func (p path) id() string {
+	return strings.Join(p, "\x00")
+}
+
+// String renders the path like clients.ACME.claims or signing.keys[0].method
+func (p path) String() string {
+	var sb strings.Builder
+	for _, segment := range p {
+		switch {
+		case strings.HasPrefix(segment, "["):
+			sb.WriteString(segment)
+		case strings.ContainsAny(segment, ".[] \""):
+			sb.WriteString("[" + strconv.Quote(segment) + "]")
+		default:
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(segment)
+		}
+	}
+	return sb.String()
+}
+
+// position is where a value (or property name) starts in a data file, line and column are 1-based
+type position struct {
+	file   string
+	line   int
+	column int
+}
+
+// positions maps the values and property names of a data file (or of merged data files) to their positions
+type positions struct {
+	values map[string]position
+	keys   map[string]position
+}
+
+func newPositions() *positions {
+	return &positions{values: map[string]position{}, keys: map[string]position{}}
+}
+
+// merge adds the positions of a data file merged over the current ones
+func (pos *positions) merge(other *positions) {
+	maps.Copy(pos.values, other.values)
+	maps.Copy(pos.keys, other.keys)
+}
+
+// lookup returns the position of the value at the path, or of its property name;
+// for paths missing in the document the position of the closest existing parent is used
+func (pos *positions) lookup(p path, key bool) (position, bool) {
+	for ; len(p) > 0; p = p[:len(p)-1] {
+		if key {
+			if at, ok := pos.keys[p.id()]; ok {
+				return at, true
+			}
+		}
+		if at, ok := pos.values[p.id()]; ok {
+			return at, true
+		}
+		key = false
+	}
+	at, ok := pos.values[path{}.id()]
+	return at, ok
+}
+
+// jsonIndexer walks the tokens of a JSON document
+type jsonIndexer struct {
+	file       string
+	data       []byte
+	lineStarts []int
+	pos        *positions
+}
+
+// indexJSON records where every value (and property name) of the JSON document starts
+func indexJSON(file string, data []byte) (*positions, error) {
+	idx := &jsonIndexer{file: file, data: data, lineStarts: []int{0}, pos: newPositions()}
+	for i, b := range data {
+		if b == '\n' {
+			idx.lineStarts = append(idx.lineStarts, i+1)
+		}
+	}
+	if err := idx.walk(json.NewDecoder(bytes.NewReader(data)), path{}); err != nil {
+		return nil, err
+	}
+	return idx.pos, nil
+}
+
+func (idx *jsonIndexer) walk(dec *json.Decoder, p path) error {
+	idx.pos.values[p.id()] = idx.position(dec.InputOffset())
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		for dec.More() {
+			keyPosition := idx.position(dec.InputOffset())
+			keyToken, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			child := p.key(keyToken.(string))
+			idx.pos.keys[child.id()] = keyPosition
+			if err := idx.walk(dec, child); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			if err := idx.walk(dec, p.index(i)); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	}
+	return err
+}
+
+// position skips the whitespace and separators in front of the next token at the offset
+func (idx *jsonIndexer) position(offset int64) position {
+	for offset < int64(len(idx.data)) && strings.IndexByte(" \t\r\n,:", idx.data[offset]) >= 0 {
+		offset++
+	}
+	return offsetPosition(idx.file, idx.lineStarts, int(offset))
+}
+
+func offsetPosition(file string, lineStarts []int, offset int) position {
+	line := sort.SearchInts(lineStarts, offset+1)
+	return position{file: file, line: line, column: offset - lineStarts[line-1] + 1}
+}
+
+// jsonSyntaxPosition returns the position of the offending character of a JSON syntax error
+func jsonSyntaxPosition(file string, data []byte, err *json.SyntaxError) position {
+	lineStarts := []int{0}
+	for i, b := range data {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	// the offset is past the offending character
+	return offsetPosition(file, lineStarts, int(max(err.Offset-1, 0)))
+}
+
+// indexYAML records where every value (and property name) of the YAML document starts
+func indexYAML(file string, node *yaml.Node) *positions {
+	pos := newPositions()
+	var walk func(node *yaml.Node, p path)
+	walk = func(node *yaml.Node, p path) {
+		pos.values[p.id()] = position{file: file, line: node.Line, column: node.Column}
+		switch node.Kind {
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				walk(child, p.index(i))
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				if key.Tag == "!!merge" {
+					continue
+				}
+				child := p.key(key.Value)
+				pos.keys[child.id()] = position{file: file, line: key.Line, column: key.Column}
+				walk(value, child)
+			}
+		}
+	}
+	walk(node, path{})
+	return pos
+}
@@ -0,0 +1,267 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/axent-pl/oauth2mock/pkg/service/signing"
+)
+
+// requiredSections have to be defined by every realm (session and authorization may come from the root)
+var requiredSections = []string{"users", "claims", "consents", "session", "authorization"}
+
+// inheritedSections are taken from the root config when a realm does not define them (see realm.LoadAll)
+var inheritedSections = []string{"session", "authorization", "tokens", "mail"}
+
+// realmView is a realm of the data file: the root, an inline realm or a realm file
+type realmView struct {
+	name    string
+	doc     *document
+	prefix  path // of the realm config in doc
+	rootDoc *document
+}
+
+// section returns the section of the realm (or the inherited one of the root) with its document and path
+func (r *realmView) section(name string) (any, *document, path) {
+	if value, ok := lookup(r.doc.root, r.prefix.key(name)); ok {
+		return value, r.doc, r.prefix.key(name)
+	}
+	if r.name != "" && slices.Contains(inheritedSections, name) {
+		if value, ok := lookup(r.rootDoc.root, path{name}); ok {
+			return value, r.rootDoc, path{name}
+		}
+	}
+	return nil, r.doc, r.prefix.key(name)
+}
+
+// resolveRealm returns the view of an entry of the realms section, realm files are parsed and validated
+func (c *checker) resolveRealm(rootDoc *document, name string, entry any) *realmView {
+	entryPath := path{"realms", name}
+	settings, ok := entry.(map[string]any)
+	if !ok {
+		return nil
+	}
+	file, ok := settings["file"].(string)
+	if !ok || file == "" {
+		return &realmView{name: name, doc: rootDoc, prefix: entryPath, rootDoc: rootDoc}
+	}
+
+	filename := file
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(c.baseDir, filename)
+	}
+	if _, err := os.Stat(filename); err != nil {
+		c.report(rootDoc, entryPath.key("file"), false, "cannot read realm file: %v", err)
+		return nil
+	}
+	doc := c.load(filename)
+	if doc == nil {
+		return nil
+	}
+	c.validateSchema(doc)
+	if _, ok := doc.root.(map[string]any); !ok {
+		return nil
+	}
+	return &realmView{name: name, doc: doc, prefix: path{}, rootDoc: rootDoc}
+}
+
+// checkRealm checks the references between the sections of the realm
+func (c *checker) checkRealm(r *realmView) {
+	for _, name := range requiredSections {
+		if value, _, _ := r.section(name); value == nil {
+			c.report(r.doc, r.prefix, false, "missing section %q", name)
+		}
+	}
+	c.checkScopes(r)
+	c.checkClients(r)
+	c.checkSigning(r)
+}
+
+// checkScopes reports the scopes used by users, clients and upstreams which are not defined in consents.scopes,
+// requesting them fails with "undefined scope" at token time
+func (c *checker) checkScopes(r *realmView) {
+	consents, _, _ := r.section("consents")
+	scopes, ok := lookup(consents, path{"scopes"})
+	if !ok {
+		return
+	}
+	defined, _ := scopes.(map[string]any)
+	clients, _, _ := r.section("clients")
+	clientIds, _ := clients.(map[string]any)
+
+	checkScope := func(p path) {
+		if _, ok := defined[p[len(p)-1]]; !ok {
+			c.report(r.doc, p, true, "scope %q is not defined in consents.scopes", p[len(p)-1])
+		}
+	}
+	checkClaims := func(p path) {
+		for _, layer := range claimsLayers(r.doc.root, p) {
+			for _, scope := range keysAt(r.doc.root, layer.key("scopeOverrides")) {
+				checkScope(layer.key("scopeOverrides").key(scope))
+			}
+			for _, clientId := range keysAt(r.doc.root, layer.key("clientOverrides")) {
+				if _, ok := clientIds[clientId]; !ok {
+					c.report(r.doc, layer.key("clientOverrides").key(clientId), true, "client %q is not defined in clients", clientId)
+				}
+			}
+		}
+	}
+
+	users := r.prefix.key("users").key("users")
+	for _, username := range keysAt(r.doc.root, users) {
+		for _, scope := range keysAt(r.doc.root, users.key(username).key("consents")) {
+			checkScope(users.key(username).key("consents").key(scope))
+		}
+		checkClaims(users.key(username).key("claims"))
+	}
+	for _, clientId := range keysAt(r.doc.root, r.prefix.key("clients")) {
+		client := r.prefix.key("clients").key(clientId)
+		checkClaims(client.key("claims"))
+		for _, scope := range keysAt(r.doc.root, client.key("tokenLifetimes").key("scopeOverrides")) {
+			checkScope(client.key("tokenLifetimes").key("scopeOverrides").key(scope))
+		}
+	}
+	upstreams := r.prefix.key("brokers").key("upstreams")
+	for _, alias := range keysAt(r.doc.root, upstreams) {
+		for _, scope := range keysAt(r.doc.root, upstreams.key(alias).key("consents")) {
+			checkScope(upstreams.key(alias).key("consents").key(scope))
+		}
+		checkClaims(upstreams.key(alias).key("claims"))
+	}
+	lifetimes := r.prefix.key("tokens").key("lifetimes").key("scopeOverrides")
+	for _, scope := range keysAt(r.doc.root, lifetimes) {
+		checkScope(lifetimes.key(scope))
+	}
+}
+
+// checkClients reports clients without claims, with a client_id other than their name
+// and with a token profile which is not defined in tokens.profiles
+func (c *checker) checkClients(r *realmView) {
+	tokens, _, _ := r.section("tokens")
+	profiles, _ := lookup(tokens, path{"profiles"})
+	definedProfiles, _ := profiles.(map[string]any)
+
+	clients := r.prefix.key("clients")
+	for _, clientId := range keysAt(r.doc.root, clients) {
+		client, _ := lookup(r.doc.root, clients.key(clientId))
+		config, ok := client.(map[string]any)
+		if !ok {
+			continue
+		}
+		if claims, ok := config["claims"]; !ok || claims == nil {
+			c.report(r.doc, clients.key(clientId), true, "missing property \"claims\" (no claims for client %s)", clientId)
+		}
+		if id, ok := config["client_id"].(string); ok && id != clientId {
+			c.report(r.doc, clients.key(clientId).key("client_id"), false, "client_id '%s' does not match the client '%s'", id, clientId)
+		}
+		if name, ok := config["tokenProfile"].(string); ok && name != "" {
+			if _, ok := definedProfiles[name]; !ok {
+				c.report(r.doc, clients.key(clientId).key("tokenProfile"), false, "token profile %q is not defined in tokens.profiles", name)
+			}
+		}
+	}
+}
+
+// checkSigning reports keys whose signing method does not fit the key type and realms without an active key
+func (c *checker) checkSigning(r *realmView) {
+	keysPath := r.prefix.key("signing").key("keys")
+	keys, _ := lookup(r.doc.root, keysPath)
+	list, _ := keys.([]any)
+
+	active := false
+	for i, key := range list {
+		config, ok := key.(map[string]any)
+		if !ok {
+			continue
+		}
+		keyPath := keysPath.index(i)
+		if isActive, _ := config["active"].(bool); isActive {
+			active = true
+		}
+		method, ok := config["method"].(string)
+		if !ok {
+			continue
+		}
+		keyType, err := signingKeyType(config["provider"])
+		if err != nil {
+			c.report(r.doc, keyPath.key("provider"), false, "cannot load key: %v", err)
+			continue
+		}
+		if keyType != "" && !signing.IsKeyCompatible(signing.SigningMethod(method), keyType) {
+			c.report(r.doc, keyPath.key("method"), false, "signing method %s does not work with %s keys", method, keyType)
+		}
+	}
+	if !active {
+		c.report(r.doc, keysPath, false, "no active signing key, tokens cannot be signed")
+	}
+}
+
+// signingKeyType returns the type of the key of the provider config, random keys are not generated
+func signingKeyType(provider any) (signing.KeyType, error) {
+	raw, err := json.Marshal(provider)
+	if err != nil {
+		return "", err
+	}
+	var providerConfig map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &providerConfig); err != nil || len(providerConfig) != 1 {
+		// reported by the schema
+		return "", nil
+	}
+	instance, err := signing.FromJSONRawMessage(providerConfig)
+	if err != nil {
+		return "", err
+	}
+	if random, ok := instance.(*signing.FromRandomConfig); ok {
+		return random.Type, nil
+	}
+	handler, err := instance.Init()
+	if err != nil {
+		return "", err
+	}
+	return handler.GetType(), nil
+}
+
+// claimsLayers returns the paths of the layers (default and by purpose) of the claims set at the path
+func claimsLayers(root any, p path) []path {
+	if _, ok := lookup(root, p); !ok {
+		return nil
+	}
+	layers := []path{p.key("default")}
+	for _, purpose := range keysAt(root, p.key("byPurpose")) {
+		layers = append(layers, p.key("byPurpose").key(purpose))
+	}
+	return layers
+}
+
+// lookup returns the value at the path of the document
+func lookup(root any, p path) (any, bool) {
+	value := root
+	for _, segment := range p {
+		switch current := value.(type) {
+		case map[string]any:
+			var ok bool
+			if value, ok = current[segment]; !ok {
+				return nil, false
+			}
+		case []any:
+			var i int
+			if _, err := fmt.Sscanf(segment, "[%d]", &i); err != nil || i < 0 || i >= len(current) {
+				return nil, false
+			}
+			value = current[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// keysAt returns the sorted property names of the object at the path (none for other values)
+func keysAt(root any, p path) []string {
+	value, _ := lookup(root, p)
+	object, _ := value.(map[string]any)
+	return sortedKeys(object)
+}
@@ -0,0 +1,322 @@
+package validate
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is the JSON Schema (draft 2020-12) of the data file
+//
+//go:embed config.schema.json
+var Schema []byte
+
+// schema is the subset of JSON Schema the data file schema uses:
+// type, enum, properties, patternProperties, additionalProperties, required, items, minimum, maximum,
+// minProperties, maxProperties, propertyNames (pattern, enum) and $ref into $defs.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Defs                 map[string]*schema `json:"$defs"`
+	Type                 json.RawMessage    `json:"type"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*schema `json:"properties"`
+	PatternProperties    map[string]*schema `json:"patternProperties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinProperties        *int               `json:"minProperties"`
+	MaxProperties        *int               `json:"maxProperties"`
+	PropertyNames        *schema            `json:"propertyNames"`
+	Pattern              string             `json:"pattern"`
+
+	types           []string
+	patterns        []*regexp.Regexp // of the patternProperties, in the order of patternNames
+	patternNames    []string
+	additional      *schema // schema of the additional properties
+	noAdditional    bool    // additionalProperties is false
+	patternCompiled *regexp.Regexp
+}
+
+// compile resolves the keywords which need parsing, defs are the $defs of the root schema
+func (s *schema) compile(defs map[string]*schema) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		if !ok || defs[name] == nil {
+			return fmt.Errorf("unresolvable $ref %s", s.Ref)
+		}
+	}
+	if len(s.Type) > 0 {
+		var single string
+		if err := json.Unmarshal(s.Type, &single); err == nil {
+			s.types = []string{single}
+		} else if err := json.Unmarshal(s.Type, &s.types); err != nil {
+			return fmt.Errorf("invalid type: %w", err)
+		}
+	}
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.noAdditional = !allowed
+		} else {
+			s.additional = &schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return fmt.Errorf("invalid additionalProperties: %w", err)
+			}
+		}
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		s.patternCompiled = pattern
+	}
+	for name := range s.PatternProperties {
+		s.patternNames = append(s.patternNames, name)
+	}
+	sort.Strings(s.patternNames)
+	for _, name := range s.patternNames {
+		pattern, err := regexp.Compile(name)
+		if err != nil {
+			return fmt.Errorf("invalid patternProperties: %w", err)
+		}
+		s.patterns = append(s.patterns, pattern)
+	}
+	children := []*schema{s.Items, s.additional, s.PropertyNames}
+	for _, child := range s.PatternProperties {
+		children = append(children, child)
+	}
+	for _, child := range s.Properties {
+		children = append(children, child)
+	}
+	for _, child := range s.Defs {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		if err := child.compile(defs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSchema(data []byte) (*schema, error) {
+	root := &schema{}
+	if err := json.Unmarshal(data, root); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if err := root.compile(root.Defs); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// validator checks a decoded document (json.Number for numbers) against the schema
+type validator struct {
+	root     *schema
+	problems []schemaProblem
+}
+
+type schemaProblem struct {
+	path    path
+	key     bool // the problem is the property name, not its value
+	message string
+}
+
+func (v *validator) report(p path, key bool, format string, args ...any) {
+	v.problems = append(v.problems, schemaProblem{path: p.clone(), key: key, message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(s *schema, value any, p path) {
+	if s.Ref != "" {
+		s = v.root.Defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+	}
+	if len(s.types) > 0 && !matchesType(s.types, value) {
+		v.report(p, false, "must be %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		return
+	}
+	if len(s.Enum) > 0 && !enumContains(s.Enum, value) {
+		v.report(p, false, "must be one of %s, got %s", formatEnum(s.Enum), formatValue(value))
+		return
+	}
+
+	switch value := value.(type) {
+	case json.Number:
+		number, _ := value.Float64()
+		if s.Minimum != nil && number < *s.Minimum {
+			v.report(p, false, "must be at least %v, got %s", *s.Minimum, value)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			v.report(p, false, "must be at most %v, got %s", *s.Maximum, value)
+		}
+	case string:
+		if s.patternCompiled != nil && !s.patternCompiled.MatchString(value) {
+			v.report(p, false, "must match %s, got %q", s.Pattern, value)
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range value {
+				v.validate(s.Items, item, p.index(i))
+			}
+		}
+	case map[string]any:
+		v.validateObject(s, value, p)
+	}
+}
+
+func (v *validator) validateObject(s *schema, object map[string]any, p path) {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			v.report(p, false, "missing property %q", name)
+		}
+	}
+	if s.MinProperties != nil && len(object) < *s.MinProperties {
+		v.report(p, false, "must have at least %d properties", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && len(object) > *s.MaxProperties {
+		v.report(p, false, "must have at most %d properties", *s.MaxProperties)
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := p.key(name)
+		if s.PropertyNames != nil {
+			before := len(v.problems)
+			v.validate(s.PropertyNames, name, child)
+			for i := before; i < len(v.problems); i++ {
+				v.problems[i].key = true
+				v.problems[i].message = "invalid name: " + v.problems[i].message
+			}
+		}
+		matched := false
+		for i, pattern := range s.patterns {
+			if pattern.MatchString(name) {
+				matched = true
+				v.validate(s.PatternProperties[s.patternNames[i]], object[name], child)
+			}
+		}
+		if property, ok := s.Properties[name]; ok {
+			v.validate(property, object[name], child)
+		} else if matched {
+			continue
+		} else if s.additional != nil {
+			v.validate(s.additional, object[name], child)
+		} else if s.noAdditional {
+			v.report(child, true, "unknown property %q%s", name, suggest(name, s.Properties))
+		}
+	}
+}
+
+// suggest proposes the known property closest to a misspelled one
+func suggest(name string, properties map[string]*schema) string {
+	best, bestDistance := "", 3
+	for candidate := range properties {
+		if d := distance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance || (d == bestDistance && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// distance is the Levenshtein distance of two strings
+func distance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func typeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if isInteger(value) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func isInteger(number json.Number) bool {
+	_, err := number.Int64()
+	return err == nil
+}
+
+func matchesType(types []string, value any) bool {
+	actual := typeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func enumContains(enum []any, value any) bool {
+	for _, candidate := range enum {
+		if formatValue(candidate) == formatValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = formatValue(value)
+	}
+	return strings.Join(values, ", ")
+}
+
+func formatValue(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,264 @@
+// Package validate checks a data file against its JSON Schema and the references between
+// its sections before the server gets to see it.
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/axent-pl/oauth2mock/pkg/config"
+	"github.com/axent-pl/oauth2mock/pkg/realm"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a finding in a data file, Line and Column are 0 when it has no position
+type Problem struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	location := p.File
+	if p.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s", location, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, p.Path, p.Message)
+}
+
+var realmNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var rootSchema = sync.OnceValues(func() (*schema, error) {
+	return parseSchema(Schema)
+})
+
+// document is a parsed data file, or the merge of several data files
+type document struct {
+	file string // the first file, problems without a position are reported there
+	pos  *positions
+	root any
+}
+
+// checker collects the problems of a data file and the realm files it references
+type checker struct {
+	schema   *schema
+	baseDir  string
+	problems []Problem
+}
+
+func newChecker(baseDir string) (*checker, error) {
+	s, err := rootSchema()
+	if err != nil {
+		return nil, err
+	}
+	return &checker{schema: s, baseDir: baseDir}, nil
+}
+
+// File validates the data files of a data file setting (a comma separated list of .json, .yaml or .yml
+// files and conf.d directories, see config.DataFiles) merged like on server start
+func File(setting string) ([]Problem, error) {
+	c, err := newChecker(config.DataFileBaseDir(setting))
+	if err != nil {
+		return nil, err
+	}
+	return c.check(c.load(setting)), nil
+}
+
+// Data validates the content of a data file, the format is selected by the extension of filename
+func Data(filename string, data []byte, baseDir string) ([]Problem, error) {
+	c, err := newChecker(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return c.check(c.parse(filename, data)), nil
+}
+
+// check validates the document and the realms it defines
+func (c *checker) check(doc *document) []Problem {
+	if doc == nil {
+		return c.problems
+	}
+	c.validateSchema(doc)
+
+	if root, ok := doc.root.(map[string]any); ok {
+		realms := []*realmView{{doc: doc, rootDoc: doc}}
+		realmsSection, _ := root["realms"].(map[string]any)
+		for _, name := range sortedKeys(realmsSection) {
+			if !realmNamePattern.MatchString(name) {
+				// reported by the schema, the server refuses to load it
+				continue
+			}
+			if r := c.resolveRealm(doc, name, realmsSection[name]); r != nil {
+				realms = append(realms, r)
+			}
+		}
+		for _, r := range realms {
+			c.checkRealm(r)
+		}
+	}
+
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		a, b := c.problems[i], c.problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	// anything the checks above do not know about (e.g. unreadable key files) fails here like on server start
+	if len(c.problems) == 0 {
+		data, err := json.Marshal(doc.root)
+		if err == nil {
+			_, err = realm.LoadAll(data, c.baseDir)
+		}
+		if err != nil {
+			c.problems = append(c.problems, Problem{File: doc.file, Message: err.Error()})
+		}
+	}
+	return c.problems
+}
+
+// load parses and merges the data files of the setting like config.ReadDataFile
+func (c *checker) load(setting string) *document {
+	files, err := config.DataFiles(setting)
+	if err != nil {
+		c.problems = append(c.problems, Problem{File: setting, Message: err.Error()})
+		return nil
+	}
+	merged := &document{file: files[0], pos: newPositions()}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			c.problems = append(c.problems, Problem{File: file, Message: err.Error()})
+			return nil
+		}
+		doc := c.parse(file, data)
+		if doc == nil {
+			return nil
+		}
+		merged.root = config.Merge(merged.root, doc.root)
+		merged.pos.merge(doc.pos)
+	}
+	return merged
+}
+
+// parse decodes, indexes and interpolates a data file, syntax errors are reported with their position
+func (c *checker) parse(filename string, data []byte) *document {
+	doc := &document{file: filename}
+	var err error
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		var node yaml.Node
+		if err = yaml.Unmarshal(data, &node); err == nil && len(node.Content) > 0 {
+			doc.pos = indexYAML(filename, node.Content[0])
+		}
+	default:
+		if err = json.Unmarshal(data, new(any)); err == nil {
+			doc.pos, err = indexJSON(filename, data)
+		}
+	}
+	if err == nil {
+		doc.root, err = config.DecodeDataFile(filename, data)
+	}
+	if err != nil {
+		problem := Problem{File: filename, Message: "invalid " + formatName(filename) + ": " + err.Error()}
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			at := jsonSyntaxPosition(filename, data, syntaxErr)
+			problem.Line, problem.Column = at.line, at.column
+		} else if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			problem.Line, _ = strconv.Atoi(match[1])
+			problem.Column = 1
+			problem.Message = "invalid YAML: " + match[2]
+		}
+		c.problems = append(c.problems, problem)
+		return nil
+	}
+	if doc.pos == nil {
+		doc.pos = newPositions()
+	}
+	doc.root = c.interpolate(doc, doc.root, path{})
+	return doc
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)`)
+
+func formatName(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	}
+	return "JSON"
+}
+
+// interpolate expands the references of the string values like config.Interpolate
+// and reports the failing ones at their position
+func (c *checker) interpolate(doc *document, value any, p path) any {
+	switch value := value.(type) {
+	case string:
+		expanded, err := config.Expand(value, c.baseDir)
+		if err != nil {
+			c.report(doc, p, false, "%v", err)
+			return value
+		}
+		return expanded
+	case config.PlainReference:
+		expanded, err := value.Value(c.baseDir)
+		if err != nil {
+			c.report(doc, p, false, "%v", err)
+			return string(value)
+		}
+		return expanded
+	case []any:
+		for i, item := range value {
+			value[i] = c.interpolate(doc, item, p.index(i))
+		}
+	case map[string]any:
+		for _, key := range sortedKeys(value) {
+			value[key] = c.interpolate(doc, value[key], p.key(key))
+		}
+	}
+	return value
+}
+
+func (c *checker) validateSchema(doc *document) {
+	v := &validator{root: c.schema}
+	v.validate(c.schema, doc.root, path{})
+	for _, problem := range v.problems {
+		c.report(doc, problem.path, problem.key, "%s", problem.message)
+	}
+}
+
+// report adds a problem at the value (or property name) of the path in the document
+func (c *checker) report(doc *document, p path, key bool, format string, args ...any) {
+	problem := Problem{File: doc.file, Path: p.String(), Message: fmt.Sprintf(format, args...)}
+	if at, ok := doc.pos.lookup(p, key); ok {
+		problem.File, problem.Line, problem.Column = at.file, at.line, at.column
+	}
+	c.problems = append(c.problems, problem)
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
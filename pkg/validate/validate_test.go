@@ -0,0 +1,106 @@
+package validate
+
+import (
+	"slices"
+	"testing"
+)
+
+const validConfig = `{
+    "signing": {"keys": [{"provider": {"fromRandom": {"type": "P-256", "deterministic": true, "seed": "x"}}, "method": "ES256", "active": true}]},
+    "users": {"provider": "json", "users": {"demo": {"username": "demo", "password": "demo", "consents": {"openid": true}}}},
+    "claims": {"provider": "json"},
+    "clients": {"ACME": {"client_id": "ACME", "client_secret": "s", "redirect_uri": "http*", "claims": {"default": {"base": {"azp": "ACME"}}}}},
+    "consents": {"provider": "json", "scopes": {"openid": {"requireConsent": false}}},
+    "authorization": {"provider": "memory", "authorizationRequestTTLSeconds": 60, "authorizationCodeLength": 16},
+    "session": {"provider": "memory"}
+}`
+
+func problemStrings(t *testing.T, data string) []string {
+	t.Helper()
+	problems, err := Data("config.json", []byte(data), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.String())
+	}
+	return got
+}
+
+func TestDataValid(t *testing.T) {
+	if got := problemStrings(t, validConfig); len(got) != 0 {
+		t.Errorf("Data() = %v, want no problems", got)
+	}
+}
+
+func TestDataProblems(t *testing.T) {
+	data := `{
+    "signing": {"keys": [{"provider": {"fromRandom": {"type": "P-256"}}, "method": "RS256"}]},
+    "users": {"provider": "json", "users": {"demo": {"username": "demo", "passwrd": "demo", "consents": {"profle": true}}}},
+    "claims": {"provider": "json"},
+    "clients": {"ACME": {"client_id": "ACME", "redirect_uri": "http*"}},
+    "consents": {"provider": "json", "scopes": {"openid": {"requireConsent": "no"}}},
+    "session": {"provider": "memory"}
+}`
+	want := []string{
+		`config.json:1:1: missing section "authorization"`,
+		`config.json:2:25: signing.keys: no active signing key, tokens cannot be signed`,
+		`config.json:2:84: signing.keys[0].method: signing method RS256 does not work with P-256 keys`,
+		`config.json:3:74: users.users.demo.passwrd: unknown property "passwrd", did you mean "password"?`,
+		`config.json:3:106: users.users.demo.consents.profle: scope "profle" is not defined in consents.scopes`,
+		`config.json:5:17: clients.ACME: missing property "claims" (no claims for client ACME)`,
+		`config.json:6:78: consents.scopes.openid.requireConsent: must be boolean, got string`,
+	}
+	if got := problemStrings(t, data); !slices.Equal(got, want) {
+		t.Errorf("Data() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestDataSyntaxError(t *testing.T) {
+	want := []string{`config.json:3:5: invalid JSON: invalid character '}' looking for beginning of object key string`}
+	if got := problemStrings(t, "{\n  \"users\": {},\n    }"); !slices.Equal(got, want) {
+		t.Errorf("Data() = %q, want %q", got, want)
+	}
+}
+
+func TestDataYAML(t *testing.T) {
+	t.Setenv("AXES_TEST_SECRET", "s")
+	t.Setenv("AXES_TEST_TTL", "60")
+	data := `x-memory: &memory
+  provider: memory
+session: *memory
+authorization:
+  <<: *memory
+  authorizationRequestTTLSeconds: ${AXES_TEST_TTL}
+  authorizationCodeLength: 16
+users: {provider: json}
+claims: {provider: json}
+consents:
+  provider: json
+  scopes: {openid: {requireConsent: false}}
+clients:
+  ACME:
+    client_id: ACME
+    client_secret: ${AXES_TEST_SECRET}
+    redirect_uri: ${AXES_TEST_UNSET}
+    scopes: [openid]
+`
+	problems, err := Data("config.yaml", []byte(data), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.String())
+	}
+	want := []string{
+		`config.yaml:1:1: signing.keys: no active signing key, tokens cannot be signed`,
+		`config.yaml:14:3: clients.ACME: missing property "claims" (no claims for client ACME)`,
+		`config.yaml:17:19: clients.ACME.redirect_uri: environment variable AXES_TEST_UNSET is not set`,
+		`config.yaml:18:5: clients.ACME.scopes: unknown property "scopes"`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Data() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package webauthnservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+type WebAuthnServiceFactory func(json.RawMessage) (Service, error)
+
+var (
+	webAuthnServiceFactoryRegistryMU sync.RWMutex
+	webAuthnServiceFactoryRegistry   = map[string]WebAuthnServiceFactory{}
+)
+
+func Register(name string, f WebAuthnServiceFactory) {
+	webAuthnServiceFactoryRegistryMU.Lock()
+	defer webAuthnServiceFactoryRegistryMU.Unlock()
+	webAuthnServiceFactoryRegistry[name] = f
+}
+
+type Config struct {
+	WebAuthnConfig json.RawMessage `json:"webauthn"`
+}
+
+// NewFromConfig initializes the credential store of the webauthn section,
+// a missing section yields an empty in-memory store with the relying party derived from the requests
+func NewFromConfig(rawConfig []byte) (Service, error) {
+	slog.Info("init started", "module", "webauthnservice")
+	config := Config{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, errors.New("failed to unmarshal config")
+	}
+
+	provider := "memory"
+	if config.WebAuthnConfig != nil {
+		var webAuthnConfig map[string]json.RawMessage
+		if err := json.Unmarshal(config.WebAuthnConfig, &webAuthnConfig); err != nil {
+			return nil, errors.New("failed to parse webauthn config")
+		}
+		if providerRaw, ok := webAuthnConfig["provider"]; ok {
+			if err := json.Unmarshal(providerRaw, &provider); err != nil {
+				return nil, errors.New("invalid webauthn.provider")
+			}
+		}
+	}
+
+	webAuthnServiceFactoryRegistryMU.RLock()
+	factory, ok := webAuthnServiceFactoryRegistry[provider]
+	webAuthnServiceFactoryRegistryMU.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown webauthn service provider: %s", provider)
+	}
+
+	return factory(config.WebAuthnConfig)
+}
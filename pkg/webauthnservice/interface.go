@@ -0,0 +1,22 @@
+package webauthnservice
+
+import "github.com/axent-pl/oauth2mock/pkg/service/webauthn"
+
+// Entity is a WebAuthn credential (passkey) registered for a user
+type Entity interface {
+	Id() []byte
+	UserId() string
+	// PublicKey is the COSE_Key encoded credential public key
+	PublicKey() []byte
+	SignCount() uint32
+	SetSignCount(uint32)
+}
+
+type Service interface {
+	// RelyingParty returns the configured relying party, the handlers derive unset fields from the request
+	RelyingParty() webauthn.RelyingParty
+	GetCredential(id []byte) (Entity, error)
+	GetCredentials(userId string) []Entity
+	AddCredential(Entity) error
+	UpdateCredential(Entity) error
+}
@@ -0,0 +1,37 @@
+package webauthnservice
+
+type credentialHandler struct {
+	id        []byte
+	userId    string
+	publicKey []byte
+	signCount uint32
+}
+
+func NewCredential(id []byte, userId string, publicKey []byte, signCount uint32) Entity {
+	return &credentialHandler{
+		id:        id,
+		userId:    userId,
+		publicKey: publicKey,
+		signCount: signCount,
+	}
+}
+
+func (c *credentialHandler) Id() []byte {
+	return c.id
+}
+
+func (c *credentialHandler) UserId() string {
+	return c.userId
+}
+
+func (c *credentialHandler) PublicKey() []byte {
+	return c.publicKey
+}
+
+func (c *credentialHandler) SignCount() uint32 {
+	return c.signCount
+}
+
+func (c *credentialHandler) SetSignCount(signCount uint32) {
+	c.signCount = signCount
+}
@@ -0,0 +1,131 @@
+package webauthnservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/axent-pl/oauth2mock/pkg/errs"
+	"github.com/axent-pl/oauth2mock/pkg/service/webauthn"
+)
+
+type memoryWebAuthnServiceConfig struct {
+	Provider    string   `json:"provider"`
+	RPID        string   `json:"rpId"`
+	RPName      string   `json:"rpName"`
+	Origins     []string `json:"origins"`
+	Credentials []struct {
+		Id        string `json:"id"`
+		UserId    string `json:"userId"`
+		PublicKey string `json:"publicKey"`
+		SignCount uint32 `json:"signCount"`
+	} `json:"credentials"`
+}
+
+// memoryWebAuthnService keeps the credentials in memory, credentials of the config are loaded on start
+// and the ones registered at runtime are lost on restart
+type memoryWebAuthnService struct {
+	relyingParty  webauthn.RelyingParty
+	credentialsMU sync.RWMutex
+	credentials   map[string]credentialHandler
+}
+
+func NewMemoryWebAuthnService(rawConfig json.RawMessage) (Service, error) {
+	service := &memoryWebAuthnService{
+		credentials: make(map[string]credentialHandler),
+	}
+	if rawConfig == nil {
+		return service, nil
+	}
+
+	config := memoryWebAuthnServiceConfig{}
+	if err := json.Unmarshal(rawConfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webauthn service config: %w", err)
+	}
+	service.relyingParty = webauthn.RelyingParty{
+		ID:      config.RPID,
+		Name:    config.RPName,
+		Origins: config.Origins,
+	}
+
+	for i, credentialConfig := range config.Credentials {
+		id, err := webauthn.Encoding.DecodeString(credentialConfig.Id)
+		if err != nil || len(id) == 0 {
+			return nil, fmt.Errorf("credential %d: invalid id", i)
+		}
+		publicKey, err := webauthn.Encoding.DecodeString(credentialConfig.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("credential %d: invalid publicKey", i)
+		}
+		if _, _, err := webauthn.ParsePublicKey(publicKey); err != nil {
+			return nil, fmt.Errorf("credential %d: %w", i, err)
+		}
+		if credentialConfig.UserId == "" {
+			return nil, fmt.Errorf("credential %d: missing userId", i)
+		}
+		if err := service.AddCredential(NewCredential(id, credentialConfig.UserId, publicKey, credentialConfig.SignCount)); err != nil {
+			return nil, fmt.Errorf("credential %d: %w", i, err)
+		}
+	}
+
+	return service, nil
+}
+
+func (s *memoryWebAuthnService) RelyingParty() webauthn.RelyingParty {
+	return s.relyingParty
+}
+
+func (s *memoryWebAuthnService) GetCredential(id []byte) (Entity, error) {
+	s.credentialsMU.RLock()
+	defer s.credentialsMU.RUnlock()
+	credential, ok := s.credentials[string(id)]
+	if !ok {
+		return nil, errs.New("unknown credential", errs.ErrNotFound)
+	}
+	return &credential, nil
+}
+
+func (s *memoryWebAuthnService) GetCredentials(userId string) []Entity {
+	s.credentialsMU.RLock()
+	defer s.credentialsMU.RUnlock()
+	credentials := make([]Entity, 0)
+	for _, credential := range s.credentials {
+		if credential.userId == userId {
+			credentials = append(credentials, &credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool { return string(credentials[i].Id()) < string(credentials[j].Id()) })
+	return credentials
+}
+
+func (s *memoryWebAuthnService) AddCredential(entity Entity) error {
+	s.credentialsMU.Lock()
+	defer s.credentialsMU.Unlock()
+	if _, ok := s.credentials[string(entity.Id())]; ok {
+		return errs.New("credential already registered", errs.ErrAlreadyExists)
+	}
+	s.credentials[string(entity.Id())] = credentialHandler{
+		id:        entity.Id(),
+		userId:    entity.UserId(),
+		publicKey: entity.PublicKey(),
+		signCount: entity.SignCount(),
+	}
+	return nil
+}
+
+func (s *memoryWebAuthnService) UpdateCredential(entity Entity) error {
+	s.credentialsMU.Lock()
+	defer s.credentialsMU.Unlock()
+	credential, ok := s.credentials[string(entity.Id())]
+	if !ok {
+		return errs.New("unknown credential", errs.ErrNotFound)
+	}
+	credential.signCount = entity.SignCount()
+	s.credentials[string(entity.Id())] = credential
+	return nil
+}
+
+func init() {
+	Register("memory", NewMemoryWebAuthnService)
+}